@@ -0,0 +1,313 @@
+// Package config собирает настройки сервера из значений по умолчанию,
+// YAML-файла, переменных окружения и флагов командной строки.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Config — полная конфигурация сервера.
+type Config struct {
+	// Env — окружение: development или production. От него зависят
+	// значения по умолчанию, которые не заданы явно (см. WithEnvDefaults).
+	Env string `yaml:"env"`
+
+	HTTP     HTTPConfig     `yaml:"http"`
+	Database DatabaseConfig `yaml:"database"`
+	Auth     AuthConfig     `yaml:"auth"`
+	CORS     CORSConfig     `yaml:"cors"`
+	Log      LogConfig      `yaml:"log"`
+	Metrics  MetricsConfig  `yaml:"metrics"`
+	Trash    TrashConfig    `yaml:"trash"`
+
+	// BaseCurrency — валюта итогов по воронке (ISO 4217).
+	BaseCurrency string `yaml:"base_currency"`
+	// CommentEditWindow — сколько автор может изменять свой комментарий; 0 — без ограничения.
+	CommentEditWindow time.Duration `yaml:"comment_edit_window"`
+}
+
+// HTTPConfig — параметры HTTP-сервера. Нулевой таймаут означает его отсутствие.
+type HTTPConfig struct {
+	Addr              string        `yaml:"addr"`
+	ReadTimeout       time.Duration `yaml:"read_timeout"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout"`
+	// ShutdownTimeout — сколько при остановке ждать завершения начатых запросов.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+}
+
+// DatabaseConfig — подключение к PostgreSQL и пул соединений.
+type DatabaseConfig struct {
+	DSN             string        `yaml:"dsn"`
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time"`
+}
+
+// AuthConfig — ключ подписи и время жизни токенов.
+type AuthConfig struct {
+	JWTSecret       string        `yaml:"jwt_secret"`
+	AccessTokenTTL  time.Duration `yaml:"access_token_ttl"`
+	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl"`
+}
+
+// CORSConfig — политика CORS для браузерных клиентов. Пустой список
+// источников отключает CORS: API доступно только с того же источника.
+type CORSConfig struct {
+	AllowOrigins     []string      `yaml:"allow_origins"`
+	AllowMethods     []string      `yaml:"allow_methods"`
+	AllowHeaders     []string      `yaml:"allow_headers"`
+	ExposeHeaders    []string      `yaml:"expose_headers"`
+	AllowCredentials bool          `yaml:"allow_credentials"`
+	MaxAge           time.Duration `yaml:"max_age"`
+}
+
+// LogConfig — параметры журналирования.
+type LogConfig struct {
+	Level string `yaml:"level"`
+	// SlowQuery — SQL-запросы дольше этого пишутся в журнал с предупреждением; 0 — не отмечать.
+	SlowQuery time.Duration `yaml:"slow_query"`
+}
+
+// MetricsConfig — эндпоинт /metrics для Prometheus.
+type MetricsConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Token, если задан, требуется в заголовке Authorization: Bearer <token>.
+	Token string `yaml:"token"`
+}
+
+// TrashConfig — хранение мягко удалённых записей в корзине.
+type TrashConfig struct {
+	// RetentionDays — через сколько дней записи удаляются из корзины окончательно; 0 — хранить всегда.
+	RetentionDays int `yaml:"retention_days"`
+	// PurgeInterval — как часто искать записи с истёкшим сроком хранения.
+	PurgeInterval time.Duration `yaml:"purge_interval"`
+}
+
+// Окружения запуска.
+const (
+	EnvDevelopment = "development"
+	EnvProduction  = "production"
+)
+
+// LogLevels — допустимые значения Log.Level.
+var LogLevels = []string{"debug", "info", "warn", "error"}
+
+// devOrigins — адреса фронтенда из npm start, которым CORS открыт при разработке.
+var devOrigins = []string{"http://localhost:3000", "http://127.0.0.1:3000"}
+
+// Default возвращает конфигурацию по умолчанию. JWT-ключ не задан: его
+// обязательно нужно передать явно. Источники CORS зависят от окружения и
+// подставляются WithEnvDefaults.
+func Default() Config {
+	return Config{
+		Env: EnvDevelopment,
+		HTTP: HTTPConfig{
+			Addr:              ":8080",
+			ReadTimeout:       15 * time.Second,
+			ReadHeaderTimeout: 5 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       60 * time.Second,
+			ShutdownTimeout:   20 * time.Second,
+		},
+		Database: DatabaseConfig{
+			DSN:             "host=localhost user=postgres password=postgres dbname=crm port=5432 sslmode=disable",
+			MaxOpenConns:    25,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: time.Hour,
+			ConnMaxIdleTime: 10 * time.Minute,
+		},
+		Auth: AuthConfig{
+			AccessTokenTTL:  15 * time.Minute,
+			RefreshTokenTTL: 30 * 24 * time.Hour,
+		},
+		CORS: CORSConfig{
+			AllowMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"},
+			AllowHeaders: []string{"Origin", "Content-Type", "Authorization", "X-Request-ID", "If-Match", "If-None-Match"},
+			// Content-Range нужен ra-data-simple-rest для пагинации, ETag — для
+			// условных запросов
+			ExposeHeaders: []string{"Content-Range", "X-Total-Count", "X-Request-ID", "ETag"},
+			MaxAge:        12 * time.Hour,
+		},
+		Log:               LogConfig{Level: "info", SlowQuery: 200 * time.Millisecond},
+		Metrics:           MetricsConfig{Enabled: true},
+		Trash:             TrashConfig{RetentionDays: 30, PurgeInterval: time.Hour},
+		BaseCurrency:      "RUB",
+		CommentEditWindow: 15 * time.Minute,
+	}
+}
+
+// WithEnvDefaults подставляет значения по умолчанию для окружения c.Env в
+// параметры, которые не заданы явно. При разработке CORS открыт для
+// фронтенда на localhost:3000, в production источники нужно перечислить.
+func (c Config) WithEnvDefaults() Config {
+	if c.CORS.AllowOrigins == nil && c.Env == EnvDevelopment {
+		c.CORS.AllowOrigins = append([]string(nil), devOrigins...)
+	}
+	return c
+}
+
+// Validate проверяет конфигурацию и возвращает все найденные ошибки сразу.
+func (c Config) Validate() error {
+	var errs []error
+	fail := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if c.Env != EnvDevelopment && c.Env != EnvProduction {
+		fail("env: %q, ожидается %s или %s", c.Env, EnvDevelopment, EnvProduction)
+	}
+
+	if c.HTTP.Addr == "" {
+		fail("http.addr: адрес не задан")
+	}
+	timeouts := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"read_timeout", c.HTTP.ReadTimeout},
+		{"read_header_timeout", c.HTTP.ReadHeaderTimeout},
+		{"write_timeout", c.HTTP.WriteTimeout},
+		{"idle_timeout", c.HTTP.IdleTimeout},
+	}
+	for _, t := range timeouts {
+		if t.value < 0 {
+			fail("http.%s: не может быть отрицательным", t.name)
+		}
+	}
+	if c.HTTP.ShutdownTimeout <= 0 {
+		fail("http.shutdown_timeout: должно быть больше нуля")
+	}
+
+	if c.Database.DSN == "" {
+		fail("database.dsn: строка подключения не задана")
+	}
+	if c.Database.MaxOpenConns < 0 {
+		fail("database.max_open_conns: не может быть отрицательным")
+	}
+	if c.Database.MaxIdleConns < 0 {
+		fail("database.max_idle_conns: не может быть отрицательным")
+	}
+	if c.Database.MaxOpenConns > 0 && c.Database.MaxIdleConns > c.Database.MaxOpenConns {
+		fail("database.max_idle_conns: больше max_open_conns (%d)", c.Database.MaxOpenConns)
+	}
+	if c.Database.ConnMaxLifetime < 0 {
+		fail("database.conn_max_lifetime: не может быть отрицательным")
+	}
+	if c.Database.ConnMaxIdleTime < 0 {
+		fail("database.conn_max_idle_time: не может быть отрицательным")
+	}
+
+	if c.Auth.JWTSecret == "" {
+		fail("auth.jwt_secret: ключ не задан (JWT_SECRET)")
+	}
+	if c.Auth.AccessTokenTTL <= 0 {
+		fail("auth.access_token_ttl: должно быть больше нуля")
+	}
+	if c.Auth.RefreshTokenTTL <= c.Auth.AccessTokenTTL {
+		fail("auth.refresh_token_ttl: должно быть больше access_token_ttl")
+	}
+
+	for _, origin := range c.CORS.AllowOrigins {
+		switch {
+		case !validOrigin(origin):
+			fail("cors.allow_origins: некорректный источник %q, ожидается вида https://example.com", origin)
+		case origin == "*" && c.CORS.AllowCredentials:
+			fail("cors.allow_origins: \"*\" нельзя сочетать с allow_credentials, браузер отклонит ответ")
+		case origin == "*" && c.Env == EnvProduction:
+			fail("cors.allow_origins: в production нужно перечислить источники явно вместо \"*\"")
+		}
+	}
+	for _, method := range c.CORS.AllowMethods {
+		if !validMethod(method) {
+			fail("cors.allow_methods: некорректный метод %q", method)
+		}
+	}
+	if c.CORS.MaxAge < 0 {
+		fail("cors.max_age: не может быть отрицательным")
+	}
+
+	if !validLevel(c.Log.Level) {
+		fail("log.level: %q, ожидается одно из %s", c.Log.Level, strings.Join(LogLevels, ", "))
+	}
+
+	if c.Log.SlowQuery < 0 {
+		fail("log.slow_query: не может быть отрицательным")
+	}
+
+	if c.Trash.RetentionDays < 0 {
+		fail("trash.retention_days: не может быть отрицательным")
+	}
+	if c.Trash.PurgeInterval <= 0 {
+		fail("trash.purge_interval: должно быть больше нуля")
+	}
+
+	if c.CommentEditWindow < 0 {
+		fail("comment_edit_window: не может быть отрицательным")
+	}
+
+	return errors.Join(errs...)
+}
+
+func validOrigin(origin string) bool {
+	if origin == "*" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+	return u.Path == "" && u.RawQuery == "" && u.Fragment == ""
+}
+
+func validMethod(method string) bool {
+	if method == "" {
+		return false
+	}
+	for _, r := range method {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+func validLevel(level string) bool {
+	for _, l := range LogLevels {
+		if l == level {
+			return true
+		}
+	}
+	return false
+}
+
+// dsnPassword находит пароль в DSN вида key=value.
+var dsnPassword = regexp.MustCompile(`(password=)('[^']*'|\S+)`)
+
+// Redacted возвращает копию конфигурации, пригодную для вывода в журнал:
+// JWT-ключ, токен метрик и пароль базы данных заменены звёздочками.
+func (c Config) Redacted() Config {
+	const mask = "***"
+	if c.Auth.JWTSecret != "" {
+		c.Auth.JWTSecret = mask
+	}
+	if c.Metrics.Token != "" {
+		c.Metrics.Token = mask
+	}
+	if u, err := url.Parse(c.Database.DSN); err == nil && u.Scheme != "" && u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), mask)
+			c.Database.DSN = u.String()
+		}
+	} else {
+		c.Database.DSN = dsnPassword.ReplaceAllString(c.Database.DSN, "${1}"+mask)
+	}
+	return c
+}
@@ -0,0 +1,145 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := vars[key]
+		return v, ok
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "crm.yaml")
+	file := `
+http:
+  addr: ":9000"
+database:
+  max_open_conns: 10
+auth:
+  access_token_ttl: 5m
+cors:
+  allow_origins: [https://crm.example.com]
+log:
+  level: warn
+`
+	if err := os.WriteFile(path, []byte(file), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, flags, err := Load(
+		[]string{"-config", path, "-log-level", "debug", "migrate", "up"},
+		env(map[string]string{"JWT_SECRET": "s3cret", "LOG_LEVEL": "error", "DB_MAX_OPEN_CONNS": "20"}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.HTTP.Addr != ":9000" || cfg.Auth.AccessTokenTTL != 5*time.Minute {
+		t.Errorf("значения из файла не применены: %+v", cfg)
+	}
+	if cfg.Database.MaxOpenConns != 20 {
+		t.Errorf("переменная окружения должна перекрывать файл, max_open_conns = %d", cfg.Database.MaxOpenConns)
+	}
+	if cfg.Log.Level != "debug" {
+		t.Errorf("флаг должен перекрывать окружение, log.level = %q", cfg.Log.Level)
+	}
+	if cfg.Database.MaxIdleConns != Default().Database.MaxIdleConns {
+		t.Errorf("незаданное значение должно остаться по умолчанию, max_idle_conns = %d", cfg.Database.MaxIdleConns)
+	}
+	if got := strings.Join(flags.Args, " "); got != "migrate up" {
+		t.Errorf("Args = %q", got)
+	}
+}
+
+func TestEnvDefaults(t *testing.T) {
+	cfg, _, err := Load(nil, env(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(cfg.CORS.AllowOrigins, ",") != strings.Join(devOrigins, ",") {
+		t.Errorf("development: allow_origins = %v", cfg.CORS.AllowOrigins)
+	}
+
+	cfg, _, err = Load([]string{"-env", EnvProduction}, env(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.CORS.AllowOrigins) != 0 {
+		t.Errorf("production: allow_origins = %v", cfg.CORS.AllowOrigins)
+	}
+
+	cfg, _, err = Load(nil, env(map[string]string{"APP_ENV": EnvProduction, "CORS_ALLOW_ORIGINS": "https://crm.example.com, https://admin.example.com"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.CORS.AllowOrigins) != 2 || cfg.CORS.AllowOrigins[1] != "https://admin.example.com" {
+		t.Errorf("allow_origins из окружения = %v", cfg.CORS.AllowOrigins)
+	}
+	cfg.Auth.JWTSecret = "x"
+	cfg.CORS.AllowOrigins = []string{"*"}
+	if err := cfg.Validate(); err == nil {
+		t.Error("\"*\" в production должен быть ошибкой")
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "crm.yaml")
+	if err := os.WriteFile(path, []byte("htp:\n  addr: \":1\"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Load([]string{"-config", path}, env(nil)); err == nil {
+		t.Error("неизвестный ключ в файле должен быть ошибкой")
+	}
+	if _, _, err := Load(nil, env(map[string]string{"ACCESS_TOKEN_TTL": "15"})); err == nil {
+		t.Error("длительность без единиц должна быть ошибкой")
+	}
+	if _, _, err := Load([]string{"-jwt-secret", "x"}, env(nil)); err == nil {
+		t.Error("JWT-ключ не должен задаваться флагом")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cfg := Default()
+	cfg.Database.MaxIdleConns = 50
+	cfg.Auth.RefreshTokenTTL = time.Minute
+	cfg.CORS.AllowOrigins = []string{"localhost:3000"}
+	cfg.Log.Level = "verbose"
+	cfg.Trash.RetentionDays = -1
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("ожидались ошибки")
+	}
+	for _, field := range []string{"auth.jwt_secret", "database.max_idle_conns", "auth.refresh_token_ttl", "cors.allow_origins", "log.level", "trash.retention_days"} {
+		if !strings.Contains(err.Error(), field) {
+			t.Errorf("нет ошибки для %s:\n%v", field, err)
+		}
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	cfg := Default()
+	cfg.Auth.JWTSecret = "s3cret"
+	out := cfg.Redacted().YAML()
+	if strings.Contains(out, "s3cret") || strings.Contains(out, "password=postgres") {
+		t.Errorf("секреты попали в вывод:\n%s", out)
+	}
+	if cfg.Auth.JWTSecret != "s3cret" {
+		t.Error("Redacted не должен менять исходную конфигурацию")
+	}
+
+	cfg.Database.DSN = "postgres://crm:pa55@db:5432/crm"
+	if dsn := cfg.Redacted().Database.DSN; strings.Contains(dsn, "pa55") || !strings.Contains(dsn, "crm:") {
+		t.Errorf("DSN = %q", dsn)
+	}
+}
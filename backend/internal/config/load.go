@@ -0,0 +1,236 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Flags — параметры запуска, которые не входят в конфигурацию.
+type Flags struct {
+	// File — путь к YAML-файлу (-config или CONFIG_FILE), пустой, если файла нет.
+	File string
+	// CheckConfig — только проверить конфигурацию и завершиться.
+	CheckConfig bool
+	// Args — аргументы после флагов, например подкоманда migrate.
+	Args []string
+}
+
+// option связывает параметр конфигурации с переменной окружения и флагом.
+type option struct {
+	env   string
+	flag  string
+	usage string
+	set   func(c *Config, value string) error
+}
+
+func options() []option {
+	return []option{
+		{"APP_ENV", "env", "окружение: development или production", setString(func(c *Config) *string { return &c.Env })},
+		{"HTTP_ADDR", "addr", "адрес HTTP-сервера", setString(func(c *Config) *string { return &c.HTTP.Addr })},
+		{"HTTP_READ_TIMEOUT", "read-timeout", "таймаут чтения запроса целиком (0 — без ограничения)", setDuration(func(c *Config) *time.Duration { return &c.HTTP.ReadTimeout })},
+		{"HTTP_READ_HEADER_TIMEOUT", "read-header-timeout", "таймаут чтения заголовков запроса", setDuration(func(c *Config) *time.Duration { return &c.HTTP.ReadHeaderTimeout })},
+		{"HTTP_WRITE_TIMEOUT", "write-timeout", "таймаут записи ответа", setDuration(func(c *Config) *time.Duration { return &c.HTTP.WriteTimeout })},
+		{"HTTP_IDLE_TIMEOUT", "idle-timeout", "время простоя keep-alive соединения", setDuration(func(c *Config) *time.Duration { return &c.HTTP.IdleTimeout })},
+		{"HTTP_SHUTDOWN_TIMEOUT", "shutdown-timeout", "сколько ждать завершения запросов при остановке", setDuration(func(c *Config) *time.Duration { return &c.HTTP.ShutdownTimeout })},
+		{"DATABASE_DSN", "database-dsn", "строка подключения к PostgreSQL", setString(func(c *Config) *string { return &c.Database.DSN })},
+		{"DB_MAX_OPEN_CONNS", "db-max-open-conns", "максимум открытых соединений (0 — без ограничения)", setInt(func(c *Config) *int { return &c.Database.MaxOpenConns })},
+		{"DB_MAX_IDLE_CONNS", "db-max-idle-conns", "максимум простаивающих соединений", setInt(func(c *Config) *int { return &c.Database.MaxIdleConns })},
+		{"DB_CONN_MAX_LIFETIME", "db-conn-max-lifetime", "время жизни соединения", setDuration(func(c *Config) *time.Duration { return &c.Database.ConnMaxLifetime })},
+		{"DB_CONN_MAX_IDLE_TIME", "db-conn-max-idle-time", "время простоя соединения до закрытия", setDuration(func(c *Config) *time.Duration { return &c.Database.ConnMaxIdleTime })},
+		{"JWT_SECRET", "", "", setString(func(c *Config) *string { return &c.Auth.JWTSecret })},
+		{"ACCESS_TOKEN_TTL", "access-token-ttl", "время жизни access-токена", setDuration(func(c *Config) *time.Duration { return &c.Auth.AccessTokenTTL })},
+		{"REFRESH_TOKEN_TTL", "refresh-token-ttl", "время жизни refresh-токена", setDuration(func(c *Config) *time.Duration { return &c.Auth.RefreshTokenTTL })},
+		{"CORS_ALLOW_ORIGINS", "cors-allow-origins", "разрешённые источники CORS через запятую", setList(func(c *Config) *[]string { return &c.CORS.AllowOrigins })},
+		{"CORS_ALLOW_METHODS", "cors-allow-methods", "разрешённые методы CORS через запятую", setList(func(c *Config) *[]string { return &c.CORS.AllowMethods })},
+		{"CORS_ALLOW_HEADERS", "cors-allow-headers", "разрешённые заголовки запроса через запятую", setList(func(c *Config) *[]string { return &c.CORS.AllowHeaders })},
+		{"CORS_EXPOSE_HEADERS", "cors-expose-headers", "заголовки ответа, доступные браузеру, через запятую", setList(func(c *Config) *[]string { return &c.CORS.ExposeHeaders })},
+		{"CORS_ALLOW_CREDENTIALS", "cors-allow-credentials", "разрешить запросы с cookie и авторизацией браузера", setBool(func(c *Config) *bool { return &c.CORS.AllowCredentials })},
+		{"CORS_MAX_AGE", "cors-max-age", "сколько браузер кеширует ответ на preflight", setDuration(func(c *Config) *time.Duration { return &c.CORS.MaxAge })},
+		{"LOG_LEVEL", "log-level", "уровень журнала: " + strings.Join(LogLevels, ", "), setString(func(c *Config) *string { return &c.Log.Level })},
+		{"LOG_SLOW_QUERY", "log-slow-query", "порог медленного SQL-запроса (0 — не отмечать)", setDuration(func(c *Config) *time.Duration { return &c.Log.SlowQuery })},
+		{"METRICS_ENABLED", "metrics", "включить эндпоинт /metrics", setBool(func(c *Config) *bool { return &c.Metrics.Enabled })},
+		{"METRICS_TOKEN", "", "", setString(func(c *Config) *string { return &c.Metrics.Token })},
+		{"TRASH_RETENTION_DAYS", "trash-retention-days", "через сколько дней записи удаляются из корзины (0 — хранить всегда)", setInt(func(c *Config) *int { return &c.Trash.RetentionDays })},
+		{"TRASH_PURGE_INTERVAL", "trash-purge-interval", "как часто удалять из корзины записи с истёкшим сроком", setDuration(func(c *Config) *time.Duration { return &c.Trash.PurgeInterval })},
+		{"BASE_CURRENCY", "base-currency", "базовая валюта итогов (ISO 4217)", setString(func(c *Config) *string { return &c.BaseCurrency })},
+		{"COMMENT_EDIT_WINDOW", "comment-edit-window", "сколько автор может изменять комментарий (0 — без ограничения)", setDuration(func(c *Config) *time.Duration { return &c.CommentEditWindow })},
+	}
+}
+
+// Load собирает конфигурацию. Источники применяются по возрастанию
+// приоритета: значения по умолчанию, YAML-файл, переменные окружения, флаги;
+// незаданное после этого дополняется умолчаниями окружения.
+// Секреты (JWT-ключ, токен метрик) намеренно нельзя передать флагом, чтобы
+// они не попадали в список процессов. Проверку результата выполняет Validate.
+func Load(args []string, lookupEnv func(string) (string, bool)) (Config, Flags, error) {
+	cfg := Default()
+	var flags Flags
+
+	type assignment struct {
+		opt   option
+		value string
+	}
+	var fromFlags []assignment
+
+	fs := flag.NewFlagSet("crm-backend", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.StringVar(&flags.File, "config", "", "путь к YAML-файлу конфигурации")
+	fs.BoolVar(&flags.CheckConfig, "check-config", false, "проверить конфигурацию и завершиться")
+	for _, opt := range options() {
+		if opt.flag == "" {
+			continue
+		}
+		fs.Func(opt.flag, opt.usage, func(value string) error {
+			fromFlags = append(fromFlags, assignment{opt, value})
+			return nil
+		})
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return cfg, flags, err
+		}
+		return cfg, flags, fmt.Errorf("флаги: %w", err)
+	}
+	flags.Args = fs.Args()
+
+	if flags.File == "" {
+		flags.File, _ = lookupEnv("CONFIG_FILE")
+	}
+	if flags.File != "" {
+		if err := loadFile(&cfg, flags.File); err != nil {
+			return cfg, flags, err
+		}
+	}
+
+	for _, opt := range options() {
+		if value, ok := lookupEnv(opt.env); ok && value != "" {
+			if err := opt.set(&cfg, value); err != nil {
+				return cfg, flags, fmt.Errorf("%s: %w", opt.env, err)
+			}
+		}
+	}
+
+	for _, a := range fromFlags {
+		if err := a.opt.set(&cfg, a.value); err != nil {
+			return cfg, flags, fmt.Errorf("-%s: %w", a.opt.flag, err)
+		}
+	}
+
+	return cfg.WithEnvDefaults(), flags, nil
+}
+
+// Usage печатает справку по флагам и переменным окружения.
+func Usage(w io.Writer) {
+	fmt.Fprintln(w, "Использование: crm-backend [флаги] [migrate <команда>]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "  -config string       путь к YAML-файлу конфигурации (CONFIG_FILE)")
+	fmt.Fprintln(w, "  -check-config        проверить конфигурацию и завершиться")
+	for _, opt := range options() {
+		if opt.flag == "" {
+			fmt.Fprintf(w, "  %-20s (только переменная окружения %s)\n", "", opt.env)
+			continue
+		}
+		fmt.Fprintf(w, "  -%-19s %s (%s)\n", opt.flag, opt.usage, opt.env)
+	}
+}
+
+// loadFile читает YAML-файл поверх cfg. Неизвестные ключи считаются ошибкой,
+// чтобы опечатка в имени параметра не оставалась незамеченной.
+func loadFile(cfg *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("файл конфигурации: %w", err)
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("файл конфигурации %s: %w", path, err)
+	}
+	return nil
+}
+
+// YAML возвращает конфигурацию в формате файла конфигурации.
+func (c Config) YAML() string {
+	out, err := yaml.Marshal(c)
+	if err != nil {
+		return err.Error()
+	}
+	return string(out)
+}
+
+// LogValue выводит конфигурацию в журнал в виде дерева параметров, всегда
+// без секретов.
+func (c Config) LogValue() slog.Value {
+	var tree map[string]any
+	out, err := yaml.Marshal(c.Redacted())
+	if err == nil {
+		err = yaml.Unmarshal(out, &tree)
+	}
+	if err != nil {
+		return slog.StringValue(err.Error())
+	}
+	return slog.AnyValue(tree)
+}
+
+func setString(field func(*Config) *string) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		*field(c) = strings.TrimSpace(value)
+		return nil
+	}
+}
+
+func setInt(field func(*Config) *int) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("ожидается целое число, получено %q", value)
+		}
+		*field(c) = n
+		return nil
+	}
+}
+
+func setBool(field func(*Config) *bool) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		b, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("ожидается true или false, получено %q", value)
+		}
+		*field(c) = b
+		return nil
+	}
+}
+
+func setDuration(field func(*Config) *time.Duration) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("ожидается длительность вроде 15m или 24h, получено %q", value)
+		}
+		*field(c) = d
+		return nil
+	}
+}
+
+func setList(field func(*Config) *[]string) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		items := []string{}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		*field(c) = items
+		return nil
+	}
+}
@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"time"
+
+	"crm-backend/internal/models"
+	"crm-backend/internal/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+var auditList = store.ListSpec{
+	Resource:   "audit",
+	Table:      "audit_entries",
+	Sortable:   []string{"id", "created_at", "user_id", "entity", "entity_id", "action"},
+	Filterable: []string{"user_id", "action", "entity", "entity_id", "request_id"},
+}
+
+// recordAuditList — журнал одной записи: сущность и ID задаёт путь.
+var recordAuditList = store.ListSpec{
+	Resource:   "audit",
+	Table:      "audit_entries",
+	Sortable:   []string{"id", "created_at", "user_id", "action"},
+	Filterable: []string{"user_id", "action", "request_id"},
+}
+
+// auditIgnored — служебные поля, которые меняются при каждом сохранении и
+// в журнал не попадают.
+var auditIgnored = map[string]bool{"id": true, "version": true, "created_at": true, "updated_at": true}
+
+// audit записывает в журнал изменение записи entity (имя ресурса в API) с
+// идентификатором id от имени текущего пользователя. before пуст при
+// создании, after — при удалении. Изменение без отличающихся полей не
+// записывается. Вызывается в транзакции самого изменения.
+func audit(tx store.Store, c *gin.Context, entity string, id uint, before, after any) error {
+	action := models.AuditUpdate
+	switch {
+	case before == nil:
+		action = models.AuditCreate
+	case after == nil:
+		action = models.AuditDelete
+	}
+	changes, err := auditDiff(before, after)
+	if err != nil {
+		return err
+	}
+	if action == models.AuditUpdate && len(changes) == 0 {
+		return nil
+	}
+	return recordAudit(tx, c, action, entity, id, changes)
+}
+
+// recordAudit записывает в журнал действие action над записью entity с
+// идентификатором id от имени текущего пользователя.
+func recordAudit(tx store.Store, c *gin.Context, action, entity string, id uint, changes models.AuditChanges) error {
+	return tx.Audit().Record(&models.AuditEntry{
+		UserID:    currentUserID(c),
+		Action:    action,
+		Entity:    entity,
+		EntityID:  id,
+		Changes:   changes,
+		RequestID: c.GetString("request_id"),
+		CreatedAt: time.Now().Unix(),
+	})
+}
+
+// auditDiff сравнивает JSON-представления записи до и после изменения и
+// возвращает отличающиеся поля. Вложенные объекты (клиент сделки, автор
+// комментария) пропускаются: их изменения попадают в журнал их собственных
+// записей. Пустой список равен null, а у созданной и удалённой записи
+// пустые поля не перечисляются.
+func auditDiff(before, after any) (models.AuditChanges, error) {
+	old, err := auditFields(before)
+	if err != nil {
+		return nil, err
+	}
+	cur, err := auditFields(after)
+	if err != nil {
+		return nil, err
+	}
+	keys := map[string]bool{}
+	for k := range old {
+		keys[k] = true
+	}
+	for k := range cur {
+		keys[k] = true
+	}
+	whole := before == nil || after == nil
+	changes := models.AuditChanges{}
+	for k := range keys {
+		b, a := old[k], cur[k]
+		if auditIgnored[k] || isObject(b) || isObject(a) || reflect.DeepEqual(b, a) {
+			continue
+		}
+		if whole && (a == "" || b == "") {
+			continue
+		}
+		changes[k] = models.AuditChange{Before: b, After: a}
+	}
+	return changes, nil
+}
+
+// auditFields возвращает поля JSON-представления записи v; для nil — пустой набор.
+func auditFields(v any) (map[string]any, error) {
+	if v == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+	for k, f := range fields {
+		if list, ok := f.([]any); ok && len(list) == 0 {
+			fields[k] = nil
+		}
+	}
+	return fields, nil
+}
+
+func isObject(v any) bool {
+	_, ok := v.(map[string]any)
+	return ok
+}
+
+// GetAudit godoc
+// @Summary      Журнал изменений
+// @Description  Возвращает записи журнала: кто, когда и какие поля изменил при создании, изменении и удалении записей
+// @Tags         audit
+// @Produce      json
+// @Param        sort    query     string  false  "Сортировка: [\"created_at\",\"DESC\"]"
+// @Param        range   query     string  false  "Диапазон записей: [0,24]"
+// @Param        filter  query     string  false  "Фильтр: {\"entity\":\"deals\",\"entity_id\":1,\"user_id\":2,\"action\":\"update\"}"
+// @Success      200  {array}   models.AuditEntry
+// @Header       200  {string}  Content-Range  "Диапазон и общее количество записей"
+// @Failure      400  {object}  errorBody
+// @Failure      403  {object}  errorBody
+// @Router       /audit [get]
+func GetAudit(st store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		st := scoped(st, c)
+		q, err := parseListQuery(c, auditList)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		listAudit(st, c, q)
+	}
+}
+
+// GetRecordAudit godoc
+// @Summary      Журнал изменений записи
+// @Description  Возвращает журнал изменений одной записи, в том числе уже удалённой
+// @Tags         audit
+// @Produce      json
+// @Param        id      path      int     true   "ID записи"
+// @Param        sort    query     string  false  "Сортировка: [\"created_at\",\"ASC|DESC\"]"
+// @Param        range   query     string  false  "Диапазон записей: [0,24]"
+// @Param        filter  query     string  false  "Фильтр: {\"user_id\":2,\"action\":\"update\"}"
+// @Success      200  {array}   models.AuditEntry
+// @Header       200  {string}  Content-Range  "Диапазон и общее количество записей"
+// @Failure      400  {object}  errorBody
+// @Failure      403  {object}  errorBody
+// @Router       /customers/{id}/audit [get]
+// @Router       /deals/{id}/audit [get]
+// @Router       /statuses/{id}/audit [get]
+// @Router       /pipelines/{id}/audit [get]
+// @Router       /tags/{id}/audit [get]
+// @Router       /users/{id}/audit [get]
+// @Router       /comments/{id}/audit [get]
+func GetRecordAudit(st store.Store, entity string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		st := scoped(st, c)
+		q, err := parseListQuery(c, recordAuditList)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		q.Filters["entity"] = entity
+		q.Filters["entity_id"] = idParam(c, "id")
+		listAudit(st, c, q)
+	}
+}
+
+func listAudit(st store.Store, c *gin.Context, q store.ListQuery) {
+	entries, total, err := st.Audit().List(q)
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	setContentRange(c, q, len(entries), total)
+	c.JSON(http.StatusOK, entries)
+}
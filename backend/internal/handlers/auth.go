@@ -1,78 +1,104 @@
 package handlers
 
 import (
+	"fmt"
 	"net/http"
-	"os"
-	"time"
+	"strings"
 
 	"crm-backend/internal/models"
+	"crm-backend/internal/store"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
-	"gorm.io/gorm"
 )
 
 var jwtKey []byte
 
-func init() {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		panic("JWT_SECRET не задан в переменных окружения")
-	}
+// SetJWTSecret задаёт ключ подписи access-токенов. Вызывается при старте до
+// обработки запросов.
+func SetJWTSecret(secret string) {
 	jwtKey = []byte(secret)
 }
 
 type Claims struct {
-	UserID uint   `json:"user_id"`
-	Email  string `json:"email"`
-	Role   string `json:"role"`
+	UserID    uint   `json:"user_id"`
+	Email     string `json:"email"`
+	Role      string `json:"role"`
+	SessionID string `json:"sid"`
 	jwt.StandardClaims
 }
 
+// registerInput — тело запроса на регистрацию.
+type registerInput struct {
+	Name     string `json:"name" binding:"required,max=255"`
+	Email    string `json:"email" binding:"required,email,max=255"`
+	Password string `json:"password" binding:"required,min=8,max=72"`
+}
+
 // Register godoc
 // @Summary      Регистрация пользователя
 // @Tags         auth
 // @Accept       json
 // @Produce      json
-// @Param        user  body      models.User  true  "Данные пользователя"
+// @Param        user  body      registerInput  true  "Данные пользователя"
 // @Success      201   {object}  models.User
-// @Failure      400   {object}  map[string]string
+// @Failure      400   {object}  errorBody
+// @Failure      409   {object}  errorBody
 // @Router       /auth/register [post]
-func Register(db *gorm.DB) gin.HandlerFunc {
+func Register(st store.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var input models.User
+		st := scoped(st, c)
+		var input registerInput
 		if err := c.ShouldBindJSON(&input); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			bindError(c, err)
 			return
 		}
-		if input.PasswordHash == "" || input.Email == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Email и пароль обязательны"})
+		if err := checkEmailFree(st, input.Email, 0); err != nil {
+			writeError(c, err)
 			return
 		}
-		// Проверка на уникальность email
-		var exists models.User
-		if err := db.Where("email = ?", input.Email).First(&exists).Error; err == nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Email уже зарегистрирован"})
+		user := models.User{Name: input.Name, Email: input.Email}
+		if err := setPassword(&user, input.Password); err != nil {
+			internalError(c, err)
 			return
 		}
-		// Хешируем пароль
-		hash, err := bcrypt.GenerateFromPassword([]byte(input.PasswordHash), bcrypt.DefaultCost)
+		// Роль при регистрации не выбирается: первый пользователь становится
+		// администратором, остальные получают роль по умолчанию
+		count, err := st.Users().Count()
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка хеширования пароля"})
+			internalError(c, err)
 			return
 		}
-		input.PasswordHash = string(hash)
-		if input.Role == "" {
-			input.Role = "user"
+		user.Role = DefaultRole
+		if count == 0 {
+			user.Role = AdminRole
 		}
-		if err := db.Create(&input).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		err = st.Tx(func(tx store.Store) error {
+			if err := tx.Users().Create(&user); err != nil {
+				return err
+			}
+			return audit(tx, c, "users", user.ID, nil, user)
+		})
+		if err != nil {
+			internalError(c, err)
 			return
 		}
-		input.PasswordHash = "" // не возвращаем хеш
-		c.JSON(http.StatusCreated, input)
+		c.JSON(http.StatusCreated, user)
+	}
+}
+
+// setPassword хеширует пароль пользователя; пустой пароль оставляет прежний.
+func setPassword(user *models.User, password string) error {
+	if password == "" {
+		return nil
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
 	}
+	user.PasswordHash = string(hash)
+	return nil
 }
 
 // Login godoc
@@ -81,102 +107,198 @@ func Register(db *gorm.DB) gin.HandlerFunc {
 // @Accept       json
 // @Produce      json
 // @Param        credentials  body  map[string]string  true  "Email и пароль"
-// @Success      200  {object}  map[string]string
-// @Failure      401  {object}  map[string]string
+// @Success      200  {object}  map[string]interface{}
+// @Failure      401  {object}  errorBody
 // @Router       /auth/login [post]
-func Login(db *gorm.DB) gin.HandlerFunc {
+func Login(st store.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		st := scoped(st, c)
 		var creds struct {
-			Email    string `json:"email"`
-			Password string `json:"password"`
+			Email    string `json:"email" binding:"required"`
+			Password string `json:"password" binding:"required"`
 		}
 		if err := c.ShouldBindJSON(&creds); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			bindError(c, err)
 			return
 		}
-		var user models.User
-		if err := db.Where("email = ?", creds.Email).First(&user).Error; err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Неверный email или пароль"})
+		user, err := st.Users().GetByEmail(creds.Email)
+		if err != nil {
+			abortWithError(c, unauthorized("auth.invalid_credentials"))
 			return
 		}
 		if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(creds.Password)); err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Неверный email или пароль"})
+			abortWithError(c, unauthorized("auth.invalid_credentials"))
 			return
 		}
-		expirationTime := time.Now().Add(24 * time.Hour)
-		claims := &Claims{
-			UserID: user.ID,
-			Email:  user.Email,
-			Role:   user.Role,
-			StandardClaims: jwt.StandardClaims{
-				ExpiresAt: expirationTime.Unix(),
-			},
+		if user.Disabled {
+			abortWithError(c, errUserInactive)
+			return
 		}
-		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-		tokenString, err := token.SignedString(jwtKey)
+		pair, _, err := issueTokens(st, user, "")
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка генерации токена"})
+			internalError(c, err)
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"token": tokenString})
+		c.JSON(http.StatusOK, pair)
 	}
 }
 
-// JWT middleware
-func JWTAuthMiddleware() gin.HandlerFunc {
+// Refresh godoc
+// @Summary      Обновить пару токенов
+// @Description  Обменивает refresh-токен на новые access- и refresh-токены. Повторное использование старого refresh-токена отзывает всю сессию.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        body  body      map[string]string  true  "refresh_token"
+// @Success      200   {object}  map[string]interface{}
+// @Failure      401   {object}  errorBody
+// @Router       /auth/refresh [post]
+func Refresh(st store.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		st := scoped(st, c)
+		var body struct {
+			RefreshToken string `json:"refresh_token"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil || body.RefreshToken == "" {
+			abortWithError(c, invalidField("refresh_token", "required", "auth.refresh_required"))
+			return
+		}
+		pair, err := rotateRefreshToken(st, body.RefreshToken)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, pair)
+	}
+}
+
+// Logout godoc
+// @Summary      Выход из системы
+// @Description  Отзывает текущую сессию: refresh-токены семейства и связанные access-токены
+// @Tags         auth
+// @Accept       json
+// @Param        body  body  map[string]string  false  "refresh_token (необязательно)"
+// @Success      204   {object}  nil
+// @Router       /auth/logout [post]
+func Logout(st store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		st := scoped(st, c)
+		var body struct {
+			RefreshToken string `json:"refresh_token"`
+		}
+		_ = c.ShouldBindJSON(&body)
+		// Просроченный access-токен не мешает выходу по refresh-токену
+		if claims, err := parseAccessToken(c.GetHeader("Authorization")); err == nil && claims.SessionID != "" {
+			if err := revokeFamily(st, claims.SessionID); err != nil {
+				internalError(c, err)
+				return
+			}
+		}
+		if body.RefreshToken != "" {
+			if rt, err := st.Sessions().GetByHash(hashToken(body.RefreshToken)); err == nil {
+				if err := revokeFamily(st, rt.FamilyID); err != nil {
+					internalError(c, err)
+					return
+				}
+			}
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// parseAccessToken проверяет подпись и срок действия access-токена из
+// заголовка Authorization.
+func parseAccessToken(header string) (*Claims, error) {
+	// Bearer <token>
+	tokenString := strings.TrimPrefix(header, "Bearer ")
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("неожиданный алгоритм подписи %v", token.Header["alg"])
+		}
+		return jwtKey, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, fmt.Errorf("недействительный токен")
+	}
+	return claims, nil
+}
+
+// JWT middleware: проверяет подпись и срок access-токена, а также то, что его
+// сессия не отозвана и пользователь активен.
+func JWTAuthMiddleware(st store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		st := scoped(st, c)
 		tokenString := c.GetHeader("Authorization")
 		if tokenString == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен авторизации"})
+			abortWithError(c, unauthorized("auth.token_required"))
+			return
+		}
+		claims, err := parseAccessToken(tokenString)
+		if err != nil {
+			abortWithError(c, unauthorized("auth.token_invalid"))
 			return
 		}
-		// Bearer <token>
-		if len(tokenString) > 7 && tokenString[:7] == "Bearer " {
-			tokenString = tokenString[7:]
+		role, active, err := sessionRole(st, claims)
+		if err != nil {
+			internalError(c, err)
+			return
 		}
-		claims := &Claims{}
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return jwtKey, nil
-		})
-		if err != nil || !token.Valid {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Недействительный токен"})
+		if !active {
+			abortWithError(c, unauthorized("auth.session_revoked"))
+			return
+		}
+		perms, err := rolePermissions(st, role)
+		if err != nil {
+			internalError(c, err)
 			return
 		}
 		c.Set("user_id", claims.UserID)
-		c.Set("user_role", claims.Role)
+		c.Set("user_role", role)
+		c.Set("permissions", perms)
+		c.Set("session_id", claims.SessionID)
 		c.Next()
 	}
 }
 
-// Проверка, является ли пользователь админом
-func IsAdmin(c *gin.Context) bool {
-	role, ok := c.Get("user_role")
-	if !ok {
-		return false
-	}
-	return role == "admin"
-}
-
 // Me godoc
 // @Summary      Получить информацию о текущем пользователе
 // @Tags         auth
+// @Description  Возвращает пользователя и список его прав
 // @Produce      json
-// @Success      200  {object}  models.User
-// @Failure      401  {object}  map[string]string
+// @Success      200  {object}  map[string]interface{}
+// @Failure      401  {object}  errorBody
 // @Router       /auth/me [get]
-func Me(db *gorm.DB) gin.HandlerFunc {
+func Me(st store.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userID, ok := c.Get("user_id")
-		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Не удалось определить пользователя"})
+		st := scoped(st, c)
+		userID := currentUserID(c)
+		if userID == nil {
+			abortWithError(c, unauthorized("auth.unknown_user"))
 			return
 		}
-		var user models.User
-		if err := db.First(&user, userID).Error; err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Пользователь не найден"})
+		user, err := st.Users().Get(*userID)
+		if err != nil {
+			abortWithError(c, unauthorized("user.not_found"))
 			return
 		}
+		perms := make([]string, 0)
+		for _, p := range permissionCatalog {
+			if HasPermission(c, p.Name) {
+				perms = append(perms, p.Name)
+			}
+		}
 		user.PasswordHash = ""
-		c.JSON(http.StatusOK, user)
+		c.JSON(http.StatusOK, gin.H{
+			"id":          user.ID,
+			"name":        user.Name,
+			"email":       user.Email,
+			"role":        user.Role,
+			"disabled":    user.Disabled,
+			"permissions": perms,
+		})
 	}
 }
@@ -0,0 +1,368 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"crm-backend/internal/models"
+	"crm-backend/internal/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxBulkSize — сколько записей может затронуть одна массовая операция.
+const maxBulkSize = maxPageSize
+
+// errRollback откатывает транзакцию массовой операции, которая не должна
+// сохраниться: пробный прогон или прогон с ошибками.
+var errRollback = errors.New("bulk rollback")
+
+// bulkSelection — записи, к которым применяется массовая операция: список
+// ids или фильтр в формате GET-списка, ровно одно из двух. Пустой фильтр
+// не принимается, чтобы случайно не затронуть все записи. При dry_run
+// операция выполняется и откатывается.
+type bulkSelection struct {
+	IDs    []uint                 `json:"ids" binding:"max=1000,dive,min=1"`
+	Filter map[string]interface{} `json:"filter"`
+	DryRun bool                   `json:"dry_run"`
+}
+
+// bulkTags — изменение тегов: tag_ids заменяет их целиком, add_tag_ids и
+// remove_tag_ids добавляют и снимают отдельные теги.
+type bulkTags struct {
+	TagIDs       *[]uint `json:"tag_ids" binding:"omitempty,dive,min=1"`
+	AddTagIDs    []uint  `json:"add_tag_ids" binding:"dive,min=1"`
+	RemoveTagIDs []uint  `json:"remove_tag_ids" binding:"dive,min=1"`
+}
+
+func (t bulkTags) empty() bool {
+	return t.TagIDs == nil && len(t.AddTagIDs) == 0 && len(t.RemoveTagIDs) == 0
+}
+
+// apply возвращает теги записи после изменения.
+func (t bulkTags) apply(ids []uint) []uint {
+	if t.TagIDs != nil {
+		ids = *t.TagIDs
+	}
+	removed := make(map[uint]bool, len(t.RemoveTagIDs))
+	for _, id := range t.RemoveTagIDs {
+		removed[id] = true
+	}
+	out := []uint{}
+	for _, id := range append(append([]uint{}, ids...), t.AddTagIDs...) {
+		if !removed[id] {
+			out = append(out, id)
+		}
+	}
+	return store.UniqueIDs(out)
+}
+
+// bulkItem — результат операции над одной записью.
+type bulkItem struct {
+	ID    uint       `json:"id"`
+	OK    bool       `json:"ok"`
+	Error *errorBody `json:"error,omitempty"`
+}
+
+// bulkResult — итог массовой операции. Affected — сколько записей изменено,
+// а при dry_run — сколько было бы изменено.
+type bulkResult struct {
+	DryRun   bool       `json:"dry_run"`
+	Affected int        `json:"affected"`
+	Failed   int        `json:"failed"`
+	Items    []bulkItem `json:"items"`
+}
+
+// idLister выбирает ID записей по запросу списка и возвращает их общее количество.
+type idLister func(q store.ListQuery) ([]uint, int64, error)
+
+func listIDs[M any](list func(store.ListQuery) ([]M, int64, error), id func(M) uint) idLister {
+	return func(q store.ListQuery) ([]uint, int64, error) {
+		rows, total, err := list(q)
+		if err != nil {
+			return nil, 0, err
+		}
+		ids := make([]uint, 0, len(rows))
+		for _, row := range rows {
+			ids = append(ids, id(row))
+		}
+		return ids, total, nil
+	}
+}
+
+func dealIDs(st store.Store) idLister {
+	return listIDs(st.Deals().List, func(d models.Deal) uint { return d.ID })
+}
+
+func customerIDs(st store.Store) idLister {
+	return listIDs(st.Customers().List, func(c models.Customer) uint { return c.ID })
+}
+
+// bulkIDs возвращает ID записей, выбранных sel: переданные ids без повторов
+// или все записи spec, подходящие под фильтр, по возрастанию ID.
+func bulkIDs(sel bulkSelection, spec store.ListSpec, list idLister) ([]uint, error) {
+	if (len(sel.IDs) > 0) == (len(sel.Filter) > 0) {
+		return nil, badRequest("bulk.selection")
+	}
+	if len(sel.IDs) > 0 {
+		return store.UniqueIDs(sel.IDs), nil
+	}
+	q := store.NewListQuery(spec)
+	if err := applyFilter(&q, sel.Filter); err != nil {
+		return nil, err
+	}
+	// Ключи вроде {"q":""} или {"tag_ids":[]} условий не добавляют
+	if q.Search == "" && len(q.Filters) == 0 && len(q.TagIDs) == 0 {
+		return nil, badRequest("bulk.selection")
+	}
+	q.HasRange, q.End = true, maxBulkSize-1
+	ids, total, err := list(q)
+	if err != nil {
+		return nil, err
+	}
+	if total > maxBulkSize {
+		return nil, badRequest("bulk.too_many", maxBulkSize)
+	}
+	return ids, nil
+}
+
+// runBulk применяет apply к каждой записи ids в одной транзакции и отвечает
+// итогом. Если хотя бы одна запись не прошла, изменения откатываются и
+// клиент получает 409 с результатами по записям. При dry_run изменения
+// откатываются всегда, а ответ показывает, что было бы сделано.
+func runBulk(c *gin.Context, st store.Store, ids []uint, dryRun bool, apply func(tx store.Store, id uint) error) {
+	lang := requestLang(c)
+	result := bulkResult{DryRun: dryRun, Items: make([]bulkItem, 0, len(ids))}
+	err := st.Tx(func(tx store.Store) error {
+		for _, id := range ids {
+			// Своя вложенная транзакция не даёт ошибке одной записи прервать остальные
+			err := tx.Tx(func(tx store.Store) error { return apply(tx, id) })
+			item := bulkItem{ID: id, OK: err == nil}
+			if err != nil {
+				var e *apiError
+				switch {
+				case errors.As(err, &e):
+				case errors.Is(err, store.ErrNotFound):
+					e = notFound("not_found")
+				case errors.Is(err, store.ErrConflict):
+					e = conflict("record.modified")
+				default:
+					return err
+				}
+				body := e.body(lang)
+				item.Error = &body
+				result.Failed++
+			}
+			result.Items = append(result.Items, item)
+		}
+		if dryRun || result.Failed > 0 {
+			return errRollback
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errRollback) {
+		internalError(c, err)
+		return
+	}
+	result.Affected = len(ids) - result.Failed
+	if result.Failed > 0 && !dryRun {
+		abortWithError(c, conflict("bulk.failed", result.Failed).
+			withMeta("failed", result.Failed).withMeta("items", result.Items))
+		return
+	}
+	c.Header("Content-Language", lang)
+	c.JSON(http.StatusOK, result)
+}
+
+// orNotFound заменяет store.ErrNotFound ошибкой 404 с сообщением key.
+func orNotFound(err error, key string) error {
+	if errors.Is(err, store.ErrNotFound) {
+		return notFound(key)
+	}
+	return err
+}
+
+// dealBulkChanges — изменения сделок при массовом обновлении. Этап переносит
+// сделку и в свою воронку.
+type dealBulkChanges struct {
+	StatusID   *uint `json:"status_id" binding:"omitempty,min=1"`
+	CustomerID *uint `json:"customer_id" binding:"omitempty,min=1"`
+	bulkTags
+}
+
+// dealBulkUpdate — тело массового обновления сделок.
+type dealBulkUpdate struct {
+	bulkSelection
+	Data dealBulkChanges `json:"data"`
+}
+
+// customerBulkUpdate — тело массового обновления клиентов.
+type customerBulkUpdate struct {
+	bulkSelection
+	Data bulkTags `json:"data"`
+}
+
+// BulkUpdateDeals godoc
+// @Summary      Массово обновить сделки
+// @Description  Меняет этап, клиента и теги сделок, выбранных списком ids или фильтром, в одной транзакции. Если хотя бы одна сделка не прошла проверку, ничего не сохраняется и возвращается 409 с результатами по сделкам в meta.items. При dry_run изменения проверяются, но не сохраняются
+// @Tags         deals
+// @Accept       json
+// @Produce      json
+// @Param        body  body      dealBulkUpdate  true  "Выбор сделок и изменения"
+// @Success      200   {object}  bulkResult
+// @Failure      400   {object}  errorBody
+// @Failure      409   {object}  errorBody
+// @Failure      500   {object}  errorBody
+// @Router       /deals/bulk/update [post]
+func BulkUpdateDeals(st store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		st := scoped(st, c)
+		var req dealBulkUpdate
+		if err := c.ShouldBindJSON(&req); err != nil {
+			bindError(c, err)
+			return
+		}
+		data := req.Data
+		if data.StatusID == nil && data.CustomerID == nil && data.empty() {
+			abortWithError(c, badRequest("bulk.no_changes"))
+			return
+		}
+		ids, err := bulkIDs(req.bulkSelection, dealList, dealIDs(st))
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		runBulk(c, st, ids, req.DryRun, func(tx store.Store, id uint) error {
+			deal, err := tx.Deals().Get(id)
+			if err != nil {
+				return orNotFound(err, "deal.not_found")
+			}
+			before := deal
+			if data.StatusID != nil {
+				deal.StatusID, deal.PipelineID = *data.StatusID, 0
+			}
+			if data.CustomerID != nil {
+				deal.CustomerID = *data.CustomerID
+			}
+			deal.TagIDs = data.apply(deal.TagIDs)
+			return saveDeal(tx, c, before, &deal)
+		})
+	}
+}
+
+// BulkDeleteDeals godoc
+// @Summary      Массово удалить сделки
+// @Description  Удаляет сделки, выбранные списком ids или фильтром, вместе с их комментариями в одной транзакции; ответы — как у массового обновления
+// @Tags         deals
+// @Accept       json
+// @Produce      json
+// @Param        body  body      bulkSelection  true  "Выбор сделок"
+// @Success      200   {object}  bulkResult
+// @Failure      400   {object}  errorBody
+// @Failure      409   {object}  errorBody
+// @Failure      500   {object}  errorBody
+// @Router       /deals/bulk/delete [post]
+func BulkDeleteDeals(st store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		st := scoped(st, c)
+		var req bulkSelection
+		if err := c.ShouldBindJSON(&req); err != nil {
+			bindError(c, err)
+			return
+		}
+		ids, err := bulkIDs(req, dealList, dealIDs(st))
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		runBulk(c, st, ids, req.DryRun, func(tx store.Store, id uint) error {
+			deal, err := tx.Deals().Get(id)
+			if err != nil {
+				return orNotFound(err, "deal.not_found")
+			}
+			return removeDeal(tx, c, deal)
+		})
+	}
+}
+
+// BulkUpdateCustomers godoc
+// @Summary      Массово обновить клиентов
+// @Description  Меняет теги клиентов, выбранных списком ids или фильтром, в одной транзакции; ответы — как у массового обновления сделок
+// @Tags         customers
+// @Accept       json
+// @Produce      json
+// @Param        body  body      customerBulkUpdate  true  "Выбор клиентов и изменения"
+// @Success      200   {object}  bulkResult
+// @Failure      400   {object}  errorBody
+// @Failure      409   {object}  errorBody
+// @Failure      500   {object}  errorBody
+// @Router       /customers/bulk/update [post]
+func BulkUpdateCustomers(st store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		st := scoped(st, c)
+		var req customerBulkUpdate
+		if err := c.ShouldBindJSON(&req); err != nil {
+			bindError(c, err)
+			return
+		}
+		if req.Data.empty() {
+			abortWithError(c, badRequest("bulk.no_changes"))
+			return
+		}
+		ids, err := bulkIDs(req.bulkSelection, customerList, customerIDs(st))
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		runBulk(c, st, ids, req.DryRun, func(tx store.Store, id uint) error {
+			customer, err := tx.Customers().Get(id)
+			if err != nil {
+				return orNotFound(err, "customer.not_found")
+			}
+			before := customer
+			customer.TagIDs = req.Data.apply(customer.TagIDs)
+			return saveCustomer(tx, c, before, &customer)
+		})
+	}
+}
+
+// BulkDeleteCustomers godoc
+// @Summary      Массово удалить клиентов
+// @Description  Удаляет клиентов, выбранных списком ids или фильтром, в одной транзакции. Сделки клиентов обрабатываются по cascade и move_to, как при удалении одного клиента; ответы — как у массового обновления сделок
+// @Tags         customers
+// @Accept       json
+// @Produce      json
+// @Param        body     body      bulkSelection  true   "Выбор клиентов"
+// @Param        cascade  query     bool           false  "Удалить сделки клиентов вместе с ними"
+// @Param        move_to  query     int            false  "ID клиента, к которому переносятся сделки"
+// @Success      200      {object}  bulkResult
+// @Failure      400      {object}  errorBody
+// @Failure      409      {object}  errorBody
+// @Failure      500      {object}  errorBody
+// @Router       /customers/bulk/delete [post]
+func BulkDeleteCustomers(st store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		st := scoped(st, c)
+		policy, ok := parseDeletePolicy(c)
+		if !ok {
+			return
+		}
+		var req bulkSelection
+		if err := c.ShouldBindJSON(&req); err != nil {
+			bindError(c, err)
+			return
+		}
+		ids, err := bulkIDs(req, customerList, customerIDs(st))
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		runBulk(c, st, ids, req.DryRun, func(tx store.Store, id uint) error {
+			customer, err := tx.Customers().Get(id)
+			if err != nil {
+				return orNotFound(err, "customer.not_found")
+			}
+			return removeCustomer(tx, c, customer, policy)
+		})
+	}
+}
@@ -1,28 +1,71 @@
 package handlers
 
 import (
-	"crm-backend/internal/models"
+	"errors"
 	"net/http"
+	"strings"
+	"time"
+
+	"crm-backend/internal/models"
+	"crm-backend/internal/store"
 
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 )
 
+var commentList = store.ListSpec{
+	Resource:   "comments",
+	Table:      "comments",
+	Sortable:   []string{"id", "deal_id", "user_id", "created_at", "edited_at"},
+	Filterable: []string{"deal_id", "user_id", "parent_id"},
+	Searchable: []string{"content"},
+}
+
+// dealCommentList — лента комментариев одной сделки, по умолчанию в хронологическом порядке.
+var dealCommentList = store.ListSpec{
+	Resource:    "comments",
+	Table:       "comments",
+	Sortable:    []string{"id", "created_at"},
+	Filterable:  []string{"user_id", "parent_id"},
+	Searchable:  []string{"content"},
+	DefaultSort: "created_at",
+}
+
+func findComment(st store.Store, c *gin.Context) (models.Comment, bool) {
+	comment, err := st.Comments().Get(idParam(c, "id"))
+	if err != nil {
+		notFoundOr(c, err, "comment.not_found")
+		return comment, false
+	}
+	return comment, true
+}
+
 // GetComments godoc
 // @Summary      Получить список комментариев
-// @Description  Возвращает все комментарии
+// @Description  Возвращает комментарии с сортировкой, пагинацией и фильтрами
 // @Tags         comments
 // @Produce      json
+// @Param        sort    query     string  false  "Сортировка: [\"поле\",\"ASC|DESC\"]"
+// @Param        range   query     string  false  "Диапазон записей: [0,24]"
+// @Param        filter  query     string  false  "Фильтр: {\"q\":\"текст\",\"поле\":значение}"
 // @Success      200  {array}   models.Comment
-// @Failure      500  {object}  map[string]string
+// @Header       200  {string}  Content-Range  "Диапазон и общее количество записей"
+// @Failure      400  {object}  errorBody
+// @Failure      500  {object}  errorBody
 // @Router       /comments [get]
-func GetComments(db *gorm.DB) gin.HandlerFunc {
+func GetComments(st store.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var comments []models.Comment
-		if err := db.Preload("User").Preload("Deal").Find(&comments).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		st := scoped(st, c)
+		q, err := parseListQuery(c, commentList)
+		if err != nil {
+			writeError(c, err)
 			return
 		}
+		comments, total, err := st.Comments().List(q)
+		if err != nil {
+			internalError(c, err)
+			return
+		}
+		setContentRange(c, q, len(comments), total)
 		c.JSON(http.StatusOK, comments)
 	}
 }
@@ -32,62 +75,362 @@ func GetComments(db *gorm.DB) gin.HandlerFunc {
 // @Description  Возвращает комментарий по идентификатору
 // @Tags         comments
 // @Produce      json
-// @Param        id   path      int  true  "ID комментария"
-// @Success      200  {object}  models.Comment
-// @Failure      404  {object}  map[string]string
+// @Param        id             path      int     true   "ID комментария"
+// @Param        If-None-Match  header    string  false  "ETag из прошлого ответа: 304, если запись не изменилась"
+// @Success      200            {object}  models.Comment
+// @Header       200            {string}  ETag    "Версия записи"
+// @Failure      404            {object}  errorBody
 // @Router       /comments/{id} [get]
-func GetComment(db *gorm.DB) gin.HandlerFunc {
+func GetComment(st store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		st := scoped(st, c)
+		comment, ok := findComment(st, c)
+		if !ok {
+			return
+		}
+		respondRecord(c, http.StatusOK, comment.Version, comment)
+	}
+}
+
+// CommentEditWindow — сколько времени после создания автор может изменить или
+// удалить свой комментарий; 0 снимает ограничение. Задаётся при старте.
+var CommentEditWindow = 15 * time.Minute
+
+// commentInput — тело запроса на создание и изменение комментария. Автор
+// берётся из токена, а не из тела.
+type commentInput struct {
+	DealID   uint   `json:"deal_id"`
+	ParentID *uint  `json:"parent_id"`
+	Content  string `json:"content" binding:"required,max=10000"`
+}
+
+func (in *commentInput) load(m models.Comment) {
+	*in = commentInput{DealID: m.DealID, ParentID: m.ParentID, Content: m.Content}
+}
+
+// apply переносит только текст: сделку и родителя комментария не меняют.
+func (in *commentInput) apply(m *models.Comment) {
+	m.Content = strings.TrimSpace(in.Content)
+}
+
+// canModifyComment проверяет, что текущий пользователь может изменить или
+// удалить комментарий, и возвращает причину отказа.
+func canModifyComment(c *gin.Context, comment models.Comment) error {
+	if isAdmin(c) {
+		return nil
+	}
+	userID := currentUserID(c)
+	if userID == nil || *userID != comment.UserID {
+		return forbidden("comment.author_only")
+	}
+	if CommentEditWindow > 0 && time.Since(time.Unix(comment.CreatedAt, 0)) > CommentEditWindow {
+		return forbidden("comment.edit_expired")
+	}
+	return nil
+}
+
+// createComment создаёт комментарий к сделке dealID от имени текущего
+// пользователя вместе с упоминаниями и пишет ответ.
+func createComment(st store.Store, c *gin.Context, dealID uint, input commentInput) {
+	input.Content = strings.TrimSpace(input.Content)
+	if input.Content == "" {
+		abortWithError(c, invalidField("content", "required", "comment.content_required"))
+		return
+	}
+	if _, err := st.Deals().Get(dealID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			err = invalidField("deal_id", "not_found", "deal.not_found")
+		}
+		writeError(c, err)
+		return
+	}
+	if input.ParentID != nil {
+		parent, err := st.Comments().Get(*input.ParentID)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			writeError(c, err)
+			return
+		}
+		if err != nil || parent.DealID != dealID {
+			abortWithError(c, invalidField("parent_id", "not_found", "comment.parent_invalid"))
+			return
+		}
+	}
+	userID := currentUserID(c)
+	if userID == nil {
+		abortWithError(c, unauthorized("auth.required"))
+		return
+	}
+	comment := models.Comment{DealID: dealID, ParentID: input.ParentID, UserID: *userID, Content: input.Content}
+	err := st.Tx(func(tx store.Store) error {
+		if err := tx.Comments().Create(&comment); err != nil {
+			return err
+		}
+		if err := saveMentions(tx, &comment); err != nil {
+			return err
+		}
+		return audit(tx, c, "comments", comment.ID, nil, comment)
+	})
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	respondRecord(c, http.StatusCreated, comment.Version, comment)
+}
+
+// CreateComment godoc
+// @Summary      Создать комментарий
+// @Description  Создаёт комментарий к сделке от имени текущего пользователя. Упоминания @имя (email или его часть до @) сохраняются.
+// @Tags         comments
+// @Accept       json
+// @Produce      json
+// @Param        comment  body      commentInput  true  "Сделка, родительский комментарий и текст"
+// @Success      201      {object}  models.Comment
+// @Header       201      {string}  ETag          "Версия записи"
+// @Failure      400      {object}  errorBody
+// @Router       /comments [post]
+func CreateComment(st store.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var comment models.Comment
-		id := c.Param("id")
-		if err := db.Preload("User").Preload("Deal").First(&comment, id).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Комментарий не найден"})
+		st := scoped(st, c)
+		var input commentInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			bindError(c, err)
 			return
 		}
-		c.JSON(http.StatusOK, comment)
+		createComment(st, c, input.DealID, input)
 	}
 }
 
-func CreateComment(db *gorm.DB) gin.HandlerFunc {
+// GetDealComments godoc
+// @Summary      Комментарии сделки
+// @Description  Возвращает ленту комментариев сделки в хронологическом порядке; ответы ссылаются на родителя через parent_id
+// @Tags         comments
+// @Produce      json
+// @Param        id      path      int     true   "ID сделки"
+// @Param        sort    query     string  false  "Сортировка: [\"created_at\",\"ASC|DESC\"]"
+// @Param        range   query     string  false  "Диапазон записей: [0,24]"
+// @Param        filter  query     string  false  "Фильтр: {\"parent_id\":null} — только верхний уровень"
+// @Success      200  {array}   models.Comment
+// @Header       200  {string}  Content-Range  "Диапазон и общее количество записей"
+// @Failure      404  {object}  errorBody
+// @Router       /deals/{id}/comments [get]
+func GetDealComments(st store.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var comment models.Comment
-		if err := c.ShouldBindJSON(&comment); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		st := scoped(st, c)
+		deal, ok := findDeal(st, c)
+		if !ok {
+			return
+		}
+		q, err := parseListQuery(c, dealCommentList)
+		if err != nil {
+			writeError(c, err)
 			return
 		}
-		if err := db.Create(&comment).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		q.Filters["deal_id"] = deal.ID
+		comments, total, err := st.Comments().List(q)
+		if err != nil {
+			internalError(c, err)
 			return
 		}
-		c.JSON(http.StatusCreated, comment)
+		setContentRange(c, q, len(comments), total)
+		c.JSON(http.StatusOK, comments)
 	}
 }
 
-func UpdateComment(db *gorm.DB) gin.HandlerFunc {
+// CreateDealComment godoc
+// @Summary      Добавить комментарий к сделке
+// @Description  Создаёт комментарий или ответ (parent_id) в ленте сделки; deal_id в теле игнорируется
+// @Tags         comments
+// @Accept       json
+// @Produce      json
+// @Param        id       path      int           true  "ID сделки"
+// @Param        comment  body      commentInput  true  "Родительский комментарий и текст"
+// @Success      201      {object}  models.Comment
+// @Header       201      {string}  ETag          "Версия записи"
+// @Failure      400      {object}  errorBody
+// @Failure      404      {object}  errorBody
+// @Router       /deals/{id}/comments [post]
+func CreateDealComment(st store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		st := scoped(st, c)
+		deal, ok := findDeal(st, c)
+		if !ok {
+			return
+		}
+		var input commentInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			bindError(c, err)
+			return
+		}
+		createComment(st, c, deal.ID, input)
+	}
+}
+
+// GetMyMentions godoc
+// @Summary      Комментарии с моими упоминаниями
+// @Description  Возвращает комментарии, в которых упомянут текущий пользователь, от новых к старым
+// @Tags         comments
+// @Produce      json
+// @Param        range   query     string  false  "Диапазон записей: [0,24]"
+// @Param        filter  query     string  false  "Фильтр: {\"deal_id\":1}"
+// @Success      200  {array}   models.Comment
+// @Header       200  {string}  Content-Range  "Диапазон и общее количество записей"
+// @Router       /comments/mentions [get]
+func GetMyMentions(st store.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var comment models.Comment
-		id := c.Param("id")
-		if err := db.First(&comment, id).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Комментарий не найден"})
+		st := scoped(st, c)
+		q, err := parseListQuery(c, commentList)
+		if err != nil {
+			writeError(c, err)
 			return
 		}
-		if err := c.ShouldBindJSON(&comment); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		if c.Query("sort") == "" {
+			q.SortField, q.SortOrder = "created_at", "DESC"
+		}
+		userID := currentUserID(c)
+		if userID == nil {
+			abortWithError(c, unauthorized("auth.required"))
 			return
 		}
-		if err := db.Save(&comment).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		comments, total, err := st.Comments().ListMentioning(*userID, q)
+		if err != nil {
+			internalError(c, err)
 			return
 		}
-		c.JSON(http.StatusOK, comment)
+		setContentRange(c, q, len(comments), total)
+		c.JSON(http.StatusOK, comments)
 	}
 }
 
-func DeleteComment(db *gorm.DB) gin.HandlerFunc {
+// UpdateComment godoc
+// @Summary      Изменить комментарий
+// @Description  Меняет текст комментария. Автор может сделать это в течение окна редактирования, администратор — всегда. Прежний текст сохраняется в истории.
+// @Tags         comments
+// @Accept       json
+// @Produce      json
+// @Param        id        path      int           true   "ID комментария"
+// @Param        comment   body      commentInput  true   "Новый текст; deal_id и parent_id игнорируются"
+// @Param        If-Match  header    string        false  "ETag записи: 412, если её успели изменить"
+// @Success      200       {object}  models.Comment
+// @Header       200       {string}  ETag          "Версия записи"
+// @Failure      400       {object}  errorBody
+// @Failure      403       {object}  errorBody
+// @Failure      404       {object}  errorBody
+// @Failure      412       {object}  errorBody
+// @Router       /comments/{id} [put]
+// @Router       /comments/{id} [patch]
+func UpdateComment(st store.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		id := c.Param("id")
-		if err := db.Delete(&models.Comment{}, id).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		st := scoped(st, c)
+		comment, ok := findComment(st, c)
+		if !ok {
+			return
+		}
+		if err := canModifyComment(c, comment); err != nil {
+			writeError(c, err)
+			return
+		}
+		if !checkIfMatch(c, comment.Version) {
+			return
+		}
+		before := comment
+		if !bindInput(c, &commentInput{}, &comment) {
+			return
+		}
+		if comment.Content == "" {
+			abortWithError(c, invalidField("content", "required", "comment.content_required"))
+			return
+		}
+		if comment.Content == before.Content {
+			respondRecord(c, http.StatusOK, comment.Version, comment)
+			return
+		}
+		now := time.Now().Unix()
+		err := st.Tx(func(tx store.Store) error {
+			revision := models.CommentRevision{
+				CommentID: comment.ID,
+				Content:   before.Content,
+				EditedBy:  currentUserID(c),
+				EditedAt:  now,
+			}
+			if err := tx.Comments().AddRevision(&revision); err != nil {
+				return err
+			}
+			comment.EditedAt = &now
+			if err := tx.Comments().UpdateContent(&comment); err != nil {
+				return err
+			}
+			if err := saveMentions(tx, &comment); err != nil {
+				return err
+			}
+			return audit(tx, c, "comments", comment.ID, before, comment)
+		})
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		respondRecord(c, http.StatusOK, comment.Version, comment)
+	}
+}
+
+// GetCommentRevisions godoc
+// @Summary      История изменений комментария
+// @Description  Возвращает прежние версии текста комментария, от старых к новым
+// @Tags         comments
+// @Produce      json
+// @Param        id   path      int  true  "ID комментария"
+// @Success      200  {array}   models.CommentRevision
+// @Failure      404  {object}  errorBody
+// @Router       /comments/{id}/revisions [get]
+func GetCommentRevisions(st store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		st := scoped(st, c)
+		comment, ok := findComment(st, c)
+		if !ok {
+			return
+		}
+		revisions, err := st.Comments().Revisions(comment.ID)
+		if err != nil {
+			internalError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, revisions)
+	}
+}
+
+// DeleteComment godoc
+// @Summary      Удалить комментарий
+// @Description  Удаляет комментарий. Автор может сделать это в течение окна редактирования, администратор — всегда.
+// @Tags         comments
+// @Produce      json
+// @Param        id        path      int     true   "ID комментария"
+// @Param        If-Match  header    string  false  "ETag записи: 412, если её успели изменить"
+// @Success      204       {object}  nil
+// @Failure      403       {object}  errorBody
+// @Failure      404       {object}  errorBody
+// @Failure      412       {object}  errorBody
+// @Router       /comments/{id} [delete]
+func DeleteComment(st store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		st := scoped(st, c)
+		comment, ok := findComment(st, c)
+		if !ok {
+			return
+		}
+		if err := canModifyComment(c, comment); err != nil {
+			writeError(c, err)
+			return
+		}
+		if !checkIfMatch(c, comment.Version) {
+			return
+		}
+		err := st.Tx(func(tx store.Store) error {
+			if err := tx.Comments().Delete(comment.ID); err != nil {
+				return err
+			}
+			return audit(tx, c, "comments", comment.ID, comment, nil)
+		})
+		if err != nil {
+			internalError(c, err)
 			return
 		}
 		c.Status(http.StatusNoContent)
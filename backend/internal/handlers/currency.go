@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"crm-backend/internal/models"
+	"crm-backend/internal/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BaseCurrency — валюта, в которой считаются итоги по воронке. Задаётся при старте.
+var BaseCurrency = "RUB"
+
+// currencyExponent — число знаков минимальной единицы для поддерживаемых валют ISO 4217.
+var currencyExponent = map[string]int{
+	"AED": 2, "AMD": 2, "AUD": 2, "AZN": 2, "BHD": 3, "BYN": 2, "CAD": 2, "CHF": 2,
+	"CNY": 2, "CZK": 2, "EUR": 2, "GBP": 2, "GEL": 2, "HKD": 2, "INR": 2, "JPY": 0,
+	"KGS": 2, "KRW": 0, "KWD": 3, "KZT": 2, "NOK": 2, "PLN": 2, "RUB": 2, "SEK": 2,
+	"SGD": 2, "TRY": 2, "UAH": 2, "USD": 2, "UZS": 2,
+}
+
+// ValidCurrency сообщает, поддерживается ли код валюты.
+func ValidCurrency(code string) bool {
+	_, ok := currencyExponent[code]
+	return ok
+}
+
+// toBase переводит сумму в минимальных единицах currency в минимальные
+// единицы базовой валюты по курсу rate.
+func toBase(amount int64, currency string, rate float64) int64 {
+	value := float64(amount) / math.Pow10(currencyExponent[currency]) * rate
+	return int64(math.Round(value * math.Pow10(currencyExponent[BaseCurrency])))
+}
+
+// loadRates возвращает курсы всех валют к базовой; у базовой валюты курс 1.
+func loadRates(st store.Store) (map[string]float64, error) {
+	rows, err := st.Rates().List()
+	if err != nil {
+		return nil, err
+	}
+	rates := map[string]float64{BaseCurrency: 1}
+	for _, r := range rows {
+		if r.Currency != BaseCurrency {
+			rates[r.Currency] = r.Rate
+		}
+	}
+	return rates, nil
+}
+
+// GetExchangeRates godoc
+// @Summary      Получить курсы валют
+// @Description  Возвращает курсы валют к базовой валюте
+// @Tags         exchange-rates
+// @Produce      json
+// @Success      200  {array}   models.ExchangeRate
+// @Failure      500  {object}  errorBody
+// @Router       /exchange-rates [get]
+func GetExchangeRates(st store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		st := scoped(st, c)
+		rates, err := st.Rates().List()
+		if err != nil {
+			internalError(c, err)
+			return
+		}
+		c.Header("Content-Range", fmt.Sprintf("exchange-rates 0-%d/%d", len(rates)-1, len(rates)))
+		c.Header("X-Total-Count", fmt.Sprint(len(rates)))
+		c.JSON(http.StatusOK, rates)
+	}
+}
+
+// PutExchangeRate godoc
+// @Summary      Задать курс валюты
+// @Description  Создаёт или обновляет курс валюты к базовой
+// @Tags         exchange-rates
+// @Accept       json
+// @Produce      json
+// @Param        currency  path      string             true  "Код валюты ISO 4217"
+// @Param        rate      body      map[string]float64  true  "rate — стоимость единицы валюты в базовой валюте"
+// @Success      200       {object}  models.ExchangeRate
+// @Failure      400       {object}  errorBody
+// @Router       /exchange-rates/{currency} [put]
+func PutExchangeRate(st store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		st := scoped(st, c)
+		code := strings.ToUpper(c.Param("currency"))
+		if !ValidCurrency(code) {
+			abortWithError(c, badRequest("currency.unknown", code))
+			return
+		}
+		if code == BaseCurrency {
+			abortWithError(c, badRequest("rate.base"))
+			return
+		}
+		var body struct {
+			Rate float64 `json:"rate" binding:"gt=0"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			bindError(c, err)
+			return
+		}
+		rate := models.ExchangeRate{Currency: code, Rate: body.Rate, UpdatedAt: time.Now().Unix()}
+		if err := st.Rates().Save(&rate); err != nil {
+			internalError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, rate)
+	}
+}
+
+// DeleteExchangeRate godoc
+// @Summary      Удалить курс валюты
+// @Tags         exchange-rates
+// @Param        currency  path  string  true  "Код валюты ISO 4217"
+// @Success      204  {object}  nil
+// @Failure      500  {object}  errorBody
+// @Router       /exchange-rates/{currency} [delete]
+func DeleteExchangeRate(st store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		st := scoped(st, c)
+		code := strings.ToUpper(c.Param("currency"))
+		if err := st.Rates().Delete(code); err != nil {
+			internalError(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+type currencyTotal struct {
+	Currency       string `json:"currency"`
+	Count          int64  `json:"count"`
+	Amount         int64  `json:"amount"`
+	AmountBase     *int64 `json:"amount_base"`
+	WeightedAmount int64  `json:"weighted_amount"`
+}
+
+type pipelineTotals struct {
+	BaseCurrency   string          `json:"base_currency"`
+	Count          int64           `json:"count"`
+	Amount         int64           `json:"amount"`
+	WeightedAmount int64           `json:"weighted_amount"`
+	ByCurrency     []currencyTotal `json:"by_currency"`
+	MissingRates   []string        `json:"missing_rates"`
+}
+
+// GetPipelineTotals godoc
+// @Summary      Сумма сделок в воронке
+// @Description  Считает сумму и взвешенную по вероятности сумму открытых сделок в базовой валюте. Принимает тот же filter, что и список сделок; closed=true включает закрытые сделки.
+// @Tags         deals
+// @Produce      json
+// @Param        filter  query     string  false  "Фильтр сделок"
+// @Param        closed  query     bool    false  "Учитывать закрытые сделки"
+// @Success      200     {object}  pipelineTotals
+// @Failure      400     {object}  errorBody
+// @Router       /reports/pipeline [get]
+func GetPipelineTotals(st store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		st := scoped(st, c)
+		q, err := parseListQuery(c, dealList)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		// Старые сделки без валюты считаются в базовой; без своей вероятности
+		// сделка берёт вероятность этапа
+		rows, err := st.Deals().Totals(q, c.Query("closed") == "true", BaseCurrency)
+		if err != nil {
+			internalError(c, err)
+			return
+		}
+		rates, err := loadRates(st)
+		if err != nil {
+			internalError(c, err)
+			return
+		}
+
+		result := pipelineTotals{BaseCurrency: BaseCurrency, ByCurrency: []currencyTotal{}, MissingRates: []string{}}
+		for _, row := range rows {
+			currency := row.Currency
+			total := currencyTotal{Currency: currency, Count: row.Count, Amount: row.Amount, WeightedAmount: int64(math.Round(row.Weighted))}
+			result.Count += row.Count
+			if rate, ok := rates[currency]; ok {
+				base := toBase(row.Amount, currency, rate)
+				total.AmountBase = &base
+				result.Amount += base
+				result.WeightedAmount += toBase(total.WeightedAmount, currency, rate)
+			} else if row.Amount > 0 {
+				result.MissingRates = append(result.MissingRates, currency)
+			}
+			result.ByCurrency = append(result.ByCurrency, total)
+		}
+		c.JSON(http.StatusOK, result)
+	}
+}
@@ -1,29 +1,69 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 
 	"crm-backend/internal/models"
+	"crm-backend/internal/store"
 
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 )
 
+var customerList = store.ListSpec{
+	Resource:   "customers",
+	Table:      "customers",
+	Sortable:   []string{"id", "name", "email", "phone", "company", "created_at", "updated_at"},
+	Filterable: []string{"name", "email", "phone", "company"},
+	Searchable: []string{"name", "email", "phone", "company"},
+	TagTable:   "customer_tags",
+	TagKey:     "customer_id",
+}
+
+// customerInput — изменяемые поля клиента.
+type customerInput struct {
+	Name    string `json:"name"`
+	Email   string `json:"email"`
+	Phone   string `json:"phone"`
+	Company string `json:"company"`
+	TagIDs  []uint `json:"tag_ids" binding:"dive,min=1"`
+}
+
+func (in *customerInput) load(m models.Customer) {
+	*in = customerInput{Name: m.Name, Email: m.Email, Phone: m.Phone, Company: m.Company, TagIDs: m.TagIDs}
+}
+
+func (in *customerInput) apply(m *models.Customer) {
+	m.Name, m.Email, m.Phone, m.Company, m.TagIDs = in.Name, in.Email, in.Phone, in.Company, in.TagIDs
+}
+
 // GetCustomers godoc
 // @Summary      Получить список клиентов
-// @Description  Возвращает всех клиентов
+// @Description  Возвращает клиентов с сортировкой, пагинацией и фильтрами
 // @Tags         customers
 // @Produce      json
+// @Param        sort    query     string  false  "Сортировка: [\"поле\",\"ASC|DESC\"]"
+// @Param        range   query     string  false  "Диапазон записей: [0,24]"
+// @Param        filter  query     string  false  "Фильтр: {\"q\":\"текст\",\"поле\":значение,\"tag_ids\":[1,2],\"tag_match\":\"any|all\"}"
 // @Success      200  {array}   models.Customer
-// @Failure      500  {object}  map[string]string
+// @Header       200  {string}  Content-Range  "Диапазон и общее количество записей"
+// @Failure      400  {object}  errorBody
+// @Failure      500  {object}  errorBody
 // @Router       /customers [get]
-func GetCustomers(db *gorm.DB) gin.HandlerFunc {
+func GetCustomers(st store.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var customers []models.Customer
-		if err := db.Find(&customers).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		st := scoped(st, c)
+		q, err := parseListQuery(c, customerList)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		customers, total, err := st.Customers().List(q)
+		if err != nil {
+			internalError(c, err)
 			return
 		}
+		setContentRange(c, q, len(customers), total)
 		c.JSON(http.StatusOK, customers)
 	}
 }
@@ -33,19 +73,20 @@ func GetCustomers(db *gorm.DB) gin.HandlerFunc {
 // @Description  Возвращает клиента по идентификатору
 // @Tags         customers
 // @Produce      json
-// @Param        id   path      int  true  "ID клиента"
-// @Success      200  {object}  models.Customer
-// @Failure      404  {object}  map[string]string
+// @Param        id             path      int     true   "ID клиента"
+// @Param        If-None-Match  header    string  false  "ETag из прошлого ответа: 304, если запись не изменилась"
+// @Success      200            {object}  models.Customer
+// @Header       200            {string}  ETag    "Версия записи"
+// @Failure      404            {object}  errorBody
 // @Router       /customers/{id} [get]
-func GetCustomer(db *gorm.DB) gin.HandlerFunc {
+func GetCustomer(st store.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var customer models.Customer
-		id := c.Param("id")
-		if err := db.First(&customer, id).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Клиент не найден"})
+		st := scoped(st, c)
+		customer, ok := findCustomer(st, c)
+		if !ok {
 			return
 		}
-		c.JSON(http.StatusOK, customer)
+		respondRecord(c, http.StatusOK, customer.Version, customer)
 	}
 }
 
@@ -55,73 +96,176 @@ func GetCustomer(db *gorm.DB) gin.HandlerFunc {
 // @Tags         customers
 // @Accept       json
 // @Produce      json
-// @Param        customer  body      models.Customer  true  "Данные клиента"
+// @Param        customer  body      customerInput  true  "Данные клиента"
 // @Success      201       {object}  models.Customer
-// @Failure      400       {object}  map[string]string
+// @Header       201       {string}  ETag           "Версия записи"
+// @Failure      400       {object}  errorBody
 // @Router       /customers [post]
-func CreateCustomer(db *gorm.DB) gin.HandlerFunc {
+func CreateCustomer(st store.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		st := scoped(st, c)
 		var customer models.Customer
-		if err := c.ShouldBindJSON(&customer); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		if !bindInput(c, &customerInput{}, &customer) {
+			return
+		}
+		tagIDs, err := checkTags(st, customer.TagIDs)
+		if err != nil {
+			writeError(c, err)
 			return
 		}
-		if err := db.Create(&customer).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		err = st.Tx(func(tx store.Store) error {
+			return insertCustomer(tx, c, &customer, tagIDs)
+		})
+		if err != nil {
+			internalError(c, err)
 			return
 		}
-		c.JSON(http.StatusCreated, customer)
+		respondRecord(c, http.StatusCreated, customer.Version, customer)
 	}
 }
 
 // UpdateCustomer godoc
 // @Summary      Обновить клиента
-// @Description  Обновляет данные клиента по ID
+// @Description  PUT заменяет переданные поля клиента, PATCH применяет JSON Merge Patch. Без tag_ids теги не меняются, null снимает все теги.
 // @Tags         customers
 // @Accept       json
 // @Produce      json
-// @Param        id        path      int              true  "ID клиента"
-// @Param        customer  body      models.Customer  true  "Данные клиента"
+// @Param        id        path      int            true   "ID клиента"
+// @Param        customer  body      customerInput  true   "Данные клиента"
+// @Param        If-Match  header    string         false  "ETag записи: 412, если её успели изменить"
 // @Success      200       {object}  models.Customer
-// @Failure      400       {object}  map[string]string
-// @Failure      404       {object}  map[string]string
+// @Header       200       {string}  ETag           "Версия записи"
+// @Failure      400       {object}  errorBody
+// @Failure      404       {object}  errorBody
+// @Failure      412       {object}  errorBody
 // @Router       /customers/{id} [put]
-func UpdateCustomer(db *gorm.DB) gin.HandlerFunc {
+// @Router       /customers/{id} [patch]
+func UpdateCustomer(st store.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var customer models.Customer
-		id := c.Param("id")
-		if err := db.First(&customer, id).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Клиент не найден"})
+		st := scoped(st, c)
+		customer, ok := findCustomer(st, c)
+		if !ok || !checkIfMatch(c, customer.Version) {
+			return
+		}
+		before := customer
+		if !bindInput(c, &customerInput{}, &customer) {
 			return
 		}
-		if err := c.ShouldBindJSON(&customer); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		if err := saveCustomer(st, c, before, &customer); err != nil {
+			writeError(c, err)
 			return
 		}
-		if err := db.Save(&customer).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		var err error
+		if customer.TagIDs, err = st.Customers().TagIDs(customer.ID); err != nil {
+			internalError(c, err)
 			return
 		}
-		c.JSON(http.StatusOK, customer)
+		respondRecord(c, http.StatusOK, customer.Version, customer)
 	}
 }
 
 // DeleteCustomer godoc
 // @Summary      Удалить клиента
-// @Description  Удаляет клиента по ID
+// @Description  Удаляет клиента по ID. Если у клиента есть сделки, нужно либо удалить их вместе с ним (cascade=true, вместе с комментариями), либо перенести к другому клиенту (move_to); иначе 409 со списком сделок. Удалённое можно восстановить из корзины
 // @Tags         customers
 // @Produce      json
-// @Param        id   path      int  true  "ID клиента"
-// @Success      204  {object}  nil
-// @Failure      500  {object}  map[string]string
+// @Param        id        path      int     true   "ID клиента"
+// @Param        cascade   query     bool    false  "Удалить сделки клиента вместе с ним"
+// @Param        move_to   query     int     false  "ID клиента, к которому переносятся сделки"
+// @Param        If-Match  header    string  false  "ETag записи: 412, если её успели изменить"
+// @Success      204       {object}  nil
+// @Failure      400       {object}  errorBody
+// @Failure      404       {object}  errorBody
+// @Failure      409       {object}  errorBody
+// @Failure      412       {object}  errorBody
+// @Failure      500       {object}  errorBody
 // @Router       /customers/{id} [delete]
-func DeleteCustomer(db *gorm.DB) gin.HandlerFunc {
+func DeleteCustomer(st store.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		id := c.Param("id")
-		if err := db.Delete(&models.Customer{}, id).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		st := scoped(st, c)
+		policy, ok := parseDeletePolicy(c)
+		if !ok {
+			return
+		}
+		customer, err := st.Customers().Get(idParam(c, "id"))
+		if goneWithoutIfMatch(c, err) {
+			return
+		}
+		if err != nil {
+			notFoundOr(c, err, "customer.not_found")
+			return
+		}
+		if !checkIfMatch(c, customer.Version) {
+			return
+		}
+		if err := removeCustomer(st, c, customer, policy); err != nil {
+			writeError(c, err)
 			return
 		}
 		c.Status(http.StatusNoContent)
 	}
 }
+
+// insertCustomer создаёт проверенного клиента с тегами tagIDs и записывает
+// создание в журнал. Вызывается в транзакции.
+func insertCustomer(tx store.Store, c *gin.Context, customer *models.Customer, tagIDs []uint) error {
+	if err := tx.Customers().Create(customer); err != nil {
+		return err
+	}
+	if err := tx.Customers().SetTags(customer.ID, tagIDs); err != nil {
+		return err
+	}
+	customer.TagIDs = tagIDs
+	return audit(tx, c, "customers", customer.ID, nil, *customer)
+}
+
+// saveCustomer проверяет теги изменённого клиента и сохраняет его вместе с
+// ними и записью в журнале; before — клиент до изменений.
+func saveCustomer(st store.Store, c *gin.Context, before models.Customer, customer *models.Customer) error {
+	tagIDs, err := checkTags(st, customer.TagIDs)
+	if err != nil {
+		return err
+	}
+	return st.Tx(func(tx store.Store) error {
+		if err := tx.Customers().Update(customer); err != nil {
+			return err
+		}
+		if err := tx.Customers().SetTags(customer.ID, tagIDs); err != nil {
+			return err
+		}
+		customer.TagIDs = tagIDs
+		return audit(tx, c, "customers", customer.ID, before, *customer)
+	})
+}
+
+// removeCustomer удаляет клиента, поступая с его сделками по policy, и
+// записывает это в журнал.
+func removeCustomer(st store.Store, c *gin.Context, customer models.Customer, policy deletePolicy) error {
+	blockers, deals, err := dealBlockers(st, "customer_id", customer.ID)
+	if err != nil {
+		return err
+	}
+	move := deals > 0 && policy.moveTo != 0
+	switch {
+	case deals > 0 && policy.restricts():
+		return conflict("customer.has_deals").withMeta("deals", deals).withMeta("blockers", blockers)
+	case move:
+		target, err := st.Customers().Get(policy.moveTo)
+		if errors.Is(err, store.ErrNotFound) || err == nil && target.ID == customer.ID {
+			return badRequest("customer.move_to_invalid")
+		} else if err != nil {
+			return err
+		}
+	}
+	return st.Tx(func(tx store.Store) error {
+		if move {
+			if err := tx.Deals().MoveToCustomer(customer.ID, policy.moveTo); err != nil {
+				return err
+			}
+		}
+		if err := tx.Customers().Delete(customer.ID); err != nil {
+			return err
+		}
+		return audit(tx, c, "customers", customer.ID, customer, nil)
+	})
+}
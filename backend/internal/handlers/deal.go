@@ -1,29 +1,113 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
+	"strings"
 
 	"crm-backend/internal/models"
+	"crm-backend/internal/store"
 
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 )
 
+var dealList = store.ListSpec{
+	Resource:   "deals",
+	Table:      "deals",
+	Sortable:   []string{"id", "title", "customer_id", "pipeline_id", "status_id", "amount", "currency", "expected_close_date", "probability", "closed_at", "created_at", "updated_at"},
+	Filterable: []string{"customer_id", "pipeline_id", "status_id", "currency"},
+	Searchable: []string{"title", "description"},
+	TagTable:   "deal_tags",
+	TagKey:     "deal_id",
+}
+
+// dealInput — изменяемые поля сделки.
+type dealInput struct {
+	Title             string       `json:"title"`
+	Description       string       `json:"description"`
+	CustomerID        uint         `json:"customer_id"`
+	PipelineID        uint         `json:"pipeline_id"`
+	StatusID          uint         `json:"status_id"`
+	Amount            int64        `json:"amount"`
+	Currency          string       `json:"currency"`
+	ExpectedCloseDate *models.Date `json:"expected_close_date"`
+	Probability       *int         `json:"probability"`
+	ClosedAt          *int64       `json:"closed_at"`
+	TagIDs            []uint       `json:"tag_ids"`
+}
+
+func (in *dealInput) load(m models.Deal) {
+	*in = dealInput{
+		Title: m.Title, Description: m.Description, CustomerID: m.CustomerID,
+		PipelineID: m.PipelineID, StatusID: m.StatusID, Amount: m.Amount, Currency: m.Currency,
+		ExpectedCloseDate: m.ExpectedCloseDate, Probability: m.Probability, ClosedAt: m.ClosedAt,
+		TagIDs: m.TagIDs,
+	}
+}
+
+func (in *dealInput) apply(m *models.Deal) {
+	m.Title, m.Description, m.CustomerID = in.Title, in.Description, in.CustomerID
+	m.PipelineID, m.StatusID, m.Amount, m.Currency = in.PipelineID, in.StatusID, in.Amount, in.Currency
+	m.ExpectedCloseDate, m.Probability, m.ClosedAt = in.ExpectedCloseDate, in.Probability, in.ClosedAt
+	m.TagIDs = in.TagIDs
+}
+
+// normalizeDeal приводит денежные поля сделки к каноническому виду и
+// возвращает ошибку, если они некорректны.
+func normalizeDeal(deal *models.Deal) error {
+	deal.Currency = strings.ToUpper(strings.TrimSpace(deal.Currency))
+	if deal.Currency == "" {
+		deal.Currency = BaseCurrency
+	}
+	if !ValidCurrency(deal.Currency) {
+		return invalidField("currency", "invalid", "currency.unknown", deal.Currency)
+	}
+	if deal.ExpectedCloseDate != nil && deal.ExpectedCloseDate.IsZero() {
+		deal.ExpectedCloseDate = nil
+	}
+	if deal.ClosedAt != nil && *deal.ClosedAt <= 0 {
+		deal.ClosedAt = nil
+	}
+	return nil
+}
+
+// checkCustomer проверяет, что клиент сделки существует.
+func checkCustomer(st store.Store, id uint) error {
+	if _, err := st.Customers().Get(id); errors.Is(err, store.ErrNotFound) {
+		return invalidField("customer_id", "not_found", "customer.not_found")
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
 // GetDeals godoc
 // @Summary      Получить список сделок
-// @Description  Возвращает все сделки
+// @Description  Возвращает сделки с сортировкой, пагинацией и фильтрами
 // @Tags         deals
 // @Produce      json
+// @Param        sort    query     string  false  "Сортировка: [\"поле\",\"ASC|DESC\"]"
+// @Param        range   query     string  false  "Диапазон записей: [0,24]"
+// @Param        filter  query     string  false  "Фильтр: {\"q\":\"текст\",\"поле\":значение,\"tag_ids\":[1,2],\"tag_match\":\"any|all\"}"
 // @Success      200  {array}   models.Deal
-// @Failure      500  {object}  map[string]string
+// @Header       200  {string}  Content-Range  "Диапазон и общее количество записей"
+// @Failure      400  {object}  errorBody
+// @Failure      500  {object}  errorBody
 // @Router       /deals [get]
-func GetDeals(db *gorm.DB) gin.HandlerFunc {
+func GetDeals(st store.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var deals []models.Deal
-		if err := db.Preload("Customer").Preload("Status").Find(&deals).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		st := scoped(st, c)
+		q, err := parseListQuery(c, dealList)
+		if err != nil {
+			writeError(c, err)
 			return
 		}
+		deals, total, err := st.Deals().List(q)
+		if err != nil {
+			internalError(c, err)
+			return
+		}
+		setContentRange(c, q, len(deals), total)
 		c.JSON(http.StatusOK, deals)
 	}
 }
@@ -33,19 +117,20 @@ func GetDeals(db *gorm.DB) gin.HandlerFunc {
 // @Description  Возвращает сделку по идентификатору
 // @Tags         deals
 // @Produce      json
-// @Param        id   path      int  true  "ID сделки"
-// @Success      200  {object}  models.Deal
-// @Failure      404  {object}  map[string]string
+// @Param        id             path      int     true   "ID сделки"
+// @Param        If-None-Match  header    string  false  "ETag из прошлого ответа: 304, если запись не изменилась"
+// @Success      200            {object}  models.Deal
+// @Header       200            {string}  ETag    "Версия записи"
+// @Failure      404            {object}  errorBody
 // @Router       /deals/{id} [get]
-func GetDeal(db *gorm.DB) gin.HandlerFunc {
+func GetDeal(st store.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var deal models.Deal
-		id := c.Param("id")
-		if err := db.Preload("Customer").Preload("Status").First(&deal, id).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Сделка не найдена"})
+		st := scoped(st, c)
+		deal, ok := findDeal(st, c)
+		if !ok {
 			return
 		}
-		c.JSON(http.StatusOK, deal)
+		respondRecord(c, http.StatusOK, deal.Version, deal)
 	}
 }
 
@@ -55,73 +140,176 @@ func GetDeal(db *gorm.DB) gin.HandlerFunc {
 // @Tags         deals
 // @Accept       json
 // @Produce      json
-// @Param        deal  body      models.Deal  true  "Данные сделки"
+// @Param        deal  body      dealInput  true  "Данные сделки"
 // @Success      201   {object}  models.Deal
-// @Failure      400   {object}  map[string]string
+// @Header       201   {string}  ETag       "Версия записи"
+// @Failure      400   {object}  errorBody
 // @Router       /deals [post]
-func CreateDeal(db *gorm.DB) gin.HandlerFunc {
+func CreateDeal(st store.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		st := scoped(st, c)
 		var deal models.Deal
-		if err := c.ShouldBindJSON(&deal); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		if !bindInput(c, &dealInput{}, &deal) {
 			return
 		}
-		if err := db.Create(&deal).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if err := normalizeDeal(&deal); err != nil {
+			writeError(c, err)
 			return
 		}
-		c.JSON(http.StatusCreated, deal)
+		if err := checkCustomer(st, deal.CustomerID); err != nil {
+			writeError(c, err)
+			return
+		}
+		if err := applyStage(st, &deal); err != nil {
+			writeError(c, err)
+			return
+		}
+		tagIDs, err := checkTags(st, deal.TagIDs)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		err = st.Tx(func(tx store.Store) error {
+			return insertDeal(tx, c, &deal, tagIDs)
+		})
+		if err != nil {
+			internalError(c, err)
+			return
+		}
+		respondRecord(c, http.StatusCreated, deal.Version, deal)
 	}
 }
 
 // UpdateDeal godoc
 // @Summary      Обновить сделку
-// @Description  Обновляет данные сделки по ID
+// @Description  PUT заменяет переданные поля сделки, PATCH применяет JSON Merge Patch. Без tag_ids теги не меняются, null снимает все теги.
 // @Tags         deals
 // @Accept       json
 // @Produce      json
-// @Param        id    path      int        true  "ID сделки"
-// @Param        deal  body      models.Deal  true  "Данные сделки"
-// @Success      200   {object}  models.Deal
-// @Failure      400   {object}  map[string]string
-// @Failure      404   {object}  map[string]string
+// @Param        id        path      int        true   "ID сделки"
+// @Param        deal      body      dealInput  true   "Данные сделки"
+// @Param        If-Match  header    string     false  "ETag записи: 412, если её успели изменить"
+// @Success      200       {object}  models.Deal
+// @Header       200       {string}  ETag       "Версия записи"
+// @Failure      400       {object}  errorBody
+// @Failure      404       {object}  errorBody
+// @Failure      412       {object}  errorBody
 // @Router       /deals/{id} [put]
-func UpdateDeal(db *gorm.DB) gin.HandlerFunc {
+// @Router       /deals/{id} [patch]
+func UpdateDeal(st store.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var deal models.Deal
-		id := c.Param("id")
-		if err := db.First(&deal, id).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Сделка не найдена"})
+		st := scoped(st, c)
+		deal, ok := findDeal(st, c)
+		if !ok || !checkIfMatch(c, deal.Version) {
+			return
+		}
+		before := deal
+		if !bindInput(c, &dealInput{}, &deal) {
 			return
 		}
-		if err := c.ShouldBindJSON(&deal); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		if err := saveDeal(st, c, before, &deal); err != nil {
+			writeError(c, err)
 			return
 		}
-		if err := db.Save(&deal).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		// Клиент и этап могли смениться, поэтому сделка перечитывается целиком
+		var err error
+		if deal, err = st.Deals().Get(deal.ID); err != nil {
+			internalError(c, err)
 			return
 		}
-		c.JSON(http.StatusOK, deal)
+		respondRecord(c, http.StatusOK, deal.Version, deal)
 	}
 }
 
 // DeleteDeal godoc
 // @Summary      Удалить сделку
-// @Description  Удаляет сделку по ID
+// @Description  Удаляет сделку по ID вместе с её комментариями; их можно восстановить из корзины
 // @Tags         deals
 // @Produce      json
-// @Param        id   path      int  true  "ID сделки"
-// @Success      204  {object}  nil
-// @Failure      500  {object}  map[string]string
+// @Param        id        path      int     true   "ID сделки"
+// @Param        If-Match  header    string  false  "ETag записи: 412, если её успели изменить"
+// @Success      204       {object}  nil
+// @Failure      404       {object}  errorBody
+// @Failure      412       {object}  errorBody
+// @Failure      500       {object}  errorBody
 // @Router       /deals/{id} [delete]
-func DeleteDeal(db *gorm.DB) gin.HandlerFunc {
+func DeleteDeal(st store.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		id := c.Param("id")
-		if err := db.Delete(&models.Deal{}, id).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		st := scoped(st, c)
+		deal, err := st.Deals().Get(idParam(c, "id"))
+		if goneWithoutIfMatch(c, err) {
+			return
+		}
+		if err != nil {
+			notFoundOr(c, err, "deal.not_found")
+			return
+		}
+		if !checkIfMatch(c, deal.Version) {
+			return
+		}
+		if err := removeDeal(st, c, deal); err != nil {
+			internalError(c, err)
 			return
 		}
 		c.Status(http.StatusNoContent)
 	}
 }
+
+// insertDeal создаёт проверенную сделку с тегами tagIDs, записывает её
+// первый этап в историю и создание — в журнал. Вызывается в транзакции.
+func insertDeal(tx store.Store, c *gin.Context, deal *models.Deal, tagIDs []uint) error {
+	if err := tx.Deals().Create(deal); err != nil {
+		return err
+	}
+	if err := tx.Deals().SetTags(deal.ID, tagIDs); err != nil {
+		return err
+	}
+	if err := recordStageChange(tx, deal.ID, nil, deal.StatusID, currentUserID(c)); err != nil {
+		return err
+	}
+	deal.TagIDs = tagIDs
+	return audit(tx, c, "deals", deal.ID, nil, *deal)
+}
+
+// saveDeal проверяет изменённую сделку и сохраняет её вместе с тегами,
+// переходом этапа и записью в журнале; before — сделка до изменений.
+func saveDeal(st store.Store, c *gin.Context, before models.Deal, deal *models.Deal) error {
+	if err := normalizeDeal(deal); err != nil {
+		return err
+	}
+	if err := checkCustomer(st, deal.CustomerID); err != nil {
+		return err
+	}
+	if err := applyStage(st, deal); err != nil {
+		return err
+	}
+	tagIDs, err := checkTags(st, deal.TagIDs)
+	if err != nil {
+		return err
+	}
+	return st.Tx(func(tx store.Store) error {
+		if err := tx.Deals().Update(deal); err != nil {
+			return err
+		}
+		if err := tx.Deals().SetTags(deal.ID, tagIDs); err != nil {
+			return err
+		}
+		if deal.StatusID != before.StatusID {
+			if err := recordStageChange(tx, deal.ID, &before.StatusID, deal.StatusID, currentUserID(c)); err != nil {
+				return err
+			}
+		}
+		deal.TagIDs = tagIDs
+		return audit(tx, c, "deals", deal.ID, before, *deal)
+	})
+}
+
+// removeDeal удаляет сделку и записывает это в журнал.
+func removeDeal(st store.Store, c *gin.Context, deal models.Deal) error {
+	return st.Tx(func(tx store.Store) error {
+		if err := tx.Deals().Delete(deal.ID); err != nil {
+			return err
+		}
+		return audit(tx, c, "deals", deal.ID, deal, nil)
+	})
+}
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"crm-backend/internal/models"
+	"crm-backend/internal/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// currentUserID возвращает ID пользователя из JWT или nil для анонимного запроса.
+func currentUserID(c *gin.Context) *uint {
+	v, ok := c.Get("user_id")
+	if !ok {
+		return nil
+	}
+	id, ok := v.(uint)
+	if !ok {
+		return nil
+	}
+	return &id
+}
+
+// recordStageChange записывает переход сделки на этап to.
+func recordStageChange(tx store.Store, dealID uint, from *uint, to uint, userID *uint) error {
+	return tx.Deals().RecordStageChange(&models.DealStageChange{
+		DealID:       dealID,
+		FromStatusID: from,
+		ToStatusID:   to,
+		UserID:       userID,
+		ChangedAt:    time.Now().Unix(),
+	})
+}
+
+type stageVisit struct {
+	models.DealStageChange
+	DurationSeconds int64 `json:"duration_seconds"`
+}
+
+type stageTime struct {
+	StatusID uint    `json:"status_id"`
+	Name     string  `json:"name"`
+	Seconds  int64   `json:"seconds"`
+	Days     float64 `json:"days"`
+}
+
+// GetDealHistory godoc
+// @Summary      История этапов сделки
+// @Description  Возвращает переходы сделки между этапами с длительностью пребывания на каждом и суммарное время по этапам
+// @Tags         deals
+// @Produce      json
+// @Param        id   path      int  true  "ID сделки"
+// @Success      200  {object}  map[string]interface{}
+// @Failure      404  {object}  errorBody
+// @Router       /deals/{id}/history [get]
+func GetDealHistory(st store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		st := scoped(st, c)
+		deal, ok := findDeal(st, c)
+		if !ok {
+			return
+		}
+		changes, err := st.Deals().StageChanges(deal.ID)
+		if err != nil {
+			internalError(c, err)
+			return
+		}
+
+		// Последний этап длится до закрытия сделки или до текущего момента
+		end := time.Now().Unix()
+		if deal.ClosedAt != nil {
+			end = *deal.ClosedAt
+		}
+		visits := make([]stageVisit, len(changes))
+		totals := map[uint]int64{}
+		var order []uint
+		for i, ch := range changes {
+			until := end
+			if i+1 < len(changes) {
+				until = changes[i+1].ChangedAt
+			}
+			duration := until - ch.ChangedAt
+			if duration < 0 {
+				duration = 0
+			}
+			visits[i] = stageVisit{DealStageChange: ch, DurationSeconds: duration}
+			if _, seen := totals[ch.ToStatusID]; !seen {
+				order = append(order, ch.ToStatusID)
+			}
+			totals[ch.ToStatusID] += duration
+		}
+
+		names := map[uint]string{}
+		for _, id := range order {
+			if stage, err := st.Statuses().Get(id); err == nil {
+				names[id] = stage.Name
+			}
+		}
+		timeInStage := make([]stageTime, 0, len(order))
+		for _, id := range order {
+			timeInStage = append(timeInStage, stageTime{
+				StatusID: id,
+				Name:     names[id],
+				Seconds:  totals[id],
+				Days:     float64(totals[id]) / 86400,
+			})
+		}
+		c.JSON(http.StatusOK, gin.H{"transitions": visits, "time_in_stage": timeInStage})
+	}
+}
+
+// GetStageDurations godoc
+// @Summary      Среднее время на этапах
+// @Description  Считает среднее число дней, которое сделки проводят на каждом этапе, по посещениям этапов, начавшимся в диапазоне дат
+// @Tags         deals
+// @Produce      json
+// @Param        from         query     string  false  "Начало диапазона, ГГГГ-ММ-ДД (по умолчанию 90 дней назад)"
+// @Param        to           query     string  false  "Конец диапазона включительно, ГГГГ-ММ-ДД (по умолчанию сегодня)"
+// @Param        pipeline_id  query     int     false  "Ограничить одной воронкой"
+// @Success      200  {array}   map[string]interface{}
+// @Failure      400  {object}  errorBody
+// @Router       /reports/stage-durations [get]
+func GetStageDurations(st store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		st := scoped(st, c)
+		now := time.Now()
+		to := now
+		from := now.AddDate(0, 0, -90)
+		if s := c.Query("from"); s != "" {
+			t, err := time.Parse("2006-01-02", s)
+			if err != nil {
+				abortWithError(c, badRequest("report.date", "from"))
+				return
+			}
+			from = t
+		}
+		if s := c.Query("to"); s != "" {
+			t, err := time.Parse("2006-01-02", s)
+			if err != nil {
+				abortWithError(c, badRequest("report.date", "to"))
+				return
+			}
+			to = t
+		}
+		// Конец диапазона включает весь день to
+		toExclusive := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, to.Location()).AddDate(0, 0, 1)
+		if !from.Before(toExclusive) {
+			abortWithError(c, badRequest("report.range"))
+			return
+		}
+
+		var pipelineID uint
+		if pid := c.Query("pipeline_id"); pid != "" {
+			id, err := strconv.ParseUint(pid, 10, 64)
+			if err != nil {
+				abortWithError(c, badRequest("report.pipeline_id"))
+				return
+			}
+			pipelineID = uint(id)
+		}
+		rows, err := st.Deals().StageDurations(from, toExclusive, pipelineID)
+		if err != nil {
+			internalError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, rows)
+	}
+}
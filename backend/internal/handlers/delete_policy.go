@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"strconv"
+	"unicode/utf8"
+
+	"crm-backend/internal/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Что происходит с записями, которые ссылаются на удаляемую:
+//
+//	клиент → сделки            409, cascade=true или move_to=<клиент>
+//	сделка → комментарии       удаляются вместе со сделкой
+//	этап → сделки              409 или move_to=<этап той же воронки>
+//	воронка → этапы            удаляются вместе с воронкой
+//	воронка → сделки           409, включая сделки в корзине
+//	пользователь → комментарии 409, cascade=true или move_to=<пользователь>
+//
+// В ответе 409 meta содержит количество мешающих записей и первые из них
+// (blockers). Удалённые вместе с записью зависимые получают то же время
+// удаления и восстанавливаются из корзины вместе с ней. Внешние ключи в базе
+// страхуют от ссылок на записи, удалённые окончательно.
+
+// maxBlockers — сколько мешающих удалению записей перечисляется в ответе 409.
+const maxBlockers = 20
+
+// blocker — запись, из-за которой удаление запрещено.
+type blocker struct {
+	Entity string `json:"entity"`
+	ID     uint   `json:"id"`
+	Title  string `json:"title"`
+}
+
+// deletePolicy — параметры удаления записи, на которую ссылаются другие:
+// cascade удаляет их вместе с ней, moveTo переносит на другую запись. Без
+// них удаление запрещено.
+type deletePolicy struct {
+	cascade bool
+	moveTo  uint
+}
+
+// restricts сообщает, что ни cascade, ни move_to не указаны.
+func (p deletePolicy) restricts() bool {
+	return !p.cascade && p.moveTo == 0
+}
+
+// parseDeletePolicy разбирает параметры cascade и move_to. При ошибке
+// отвечает 400 и возвращает false.
+func parseDeletePolicy(c *gin.Context) (deletePolicy, bool) {
+	var p deletePolicy
+	if v := c.Query("cascade"); v != "" {
+		cascade, err := strconv.ParseBool(v)
+		if err != nil {
+			abortWithError(c, badRequest("delete.cascade_invalid"))
+			return p, false
+		}
+		p.cascade = cascade
+	}
+	if v := c.Query("move_to"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil || id == 0 {
+			abortWithError(c, badRequest("delete.move_to_invalid"))
+			return p, false
+		}
+		p.moveTo = uint(id)
+	}
+	if p.cascade && p.moveTo != 0 {
+		abortWithError(c, badRequest("delete.policy_conflict"))
+		return p, false
+	}
+	return p, true
+}
+
+// blockerQuery отбирает первые maxBlockers записей spec с field = id.
+func blockerQuery(spec store.ListSpec, field string, id uint) store.ListQuery {
+	q := store.NewListQuery(spec)
+	q.Filters[field] = id
+	q.HasRange, q.End = true, maxBlockers-1
+	return q
+}
+
+// dealBlockers возвращает первые неудалённые сделки с field = id и их общее
+// количество.
+func dealBlockers(st store.Store, field string, id uint) ([]blocker, int64, error) {
+	deals, total, err := st.Deals().List(blockerQuery(dealList, field, id))
+	if err != nil {
+		return nil, 0, err
+	}
+	blockers := make([]blocker, 0, len(deals))
+	for _, d := range deals {
+		blockers = append(blockers, blocker{Entity: "deals", ID: d.ID, Title: d.Title})
+	}
+	return blockers, total, nil
+}
+
+// commentBlockers возвращает первые неудалённые комментарии с field = id и
+// их общее количество. Заголовок — первые 100 символов текста, как в корзине.
+func commentBlockers(st store.Store, field string, id uint) ([]blocker, int64, error) {
+	comments, total, err := st.Comments().List(blockerQuery(commentList, field, id))
+	if err != nil {
+		return nil, 0, err
+	}
+	blockers := make([]blocker, 0, len(comments))
+	for _, cm := range comments {
+		title := cm.Content
+		if utf8.RuneCountInString(title) > 100 {
+			title = string([]rune(title)[:100])
+		}
+		blockers = append(blockers, blocker{Entity: "comments", ID: cm.ID, Title: title})
+	}
+	return blockers, total, nil
+}
@@ -0,0 +1,276 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"crm-backend/internal/i18n"
+	"crm-backend/internal/store"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// Коды ошибок API. В отличие от текста сообщения они не зависят от языка и
+// не меняются, поэтому интеграции должны опираться на них.
+const (
+	CodeBadRequest   = "bad_request"
+	CodeValidation   = "validation_failed"
+	CodeUnauthorized = "unauthorized"
+	CodeForbidden    = "forbidden"
+	CodeNotFound     = "not_found"
+	CodeConflict     = "conflict"
+	CodeInternal     = "internal"
+
+	CodePreconditionFailed = "precondition_failed"
+)
+
+// apiError — ошибка, которую видит клиент: HTTP-статус, код и ключ сообщения
+// в каталоге i18n. Текст переводится при ответе на язык запроса.
+type apiError struct {
+	status  int
+	code    string
+	key     string
+	args    []any
+	details []fieldError
+	meta    gin.H
+}
+
+// fieldError описывает ошибку в одном поле тела запроса.
+type fieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	key     string
+	args    []any
+}
+
+// errorBody — тело ответа с ошибкой. Поле message читает react-admin.
+type errorBody struct {
+	Code      string       `json:"code"`
+	Message   string       `json:"message"`
+	Details   []fieldError `json:"details,omitempty"`
+	Meta      gin.H        `json:"meta,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+}
+
+func (e *apiError) Error() string {
+	return i18n.T(i18n.Default, e.key, e.args...)
+}
+
+// withMeta возвращает копию ошибки с дополнительными данными для клиента,
+// например количеством мешающих удалению сделок.
+func (e *apiError) withMeta(key string, value any) *apiError {
+	copied := *e
+	copied.meta = gin.H{key: value}
+	for k, v := range e.meta {
+		copied.meta[k] = v
+	}
+	return &copied
+}
+
+func newError(status int, code, key string, args ...any) *apiError {
+	return &apiError{status: status, code: code, key: key, args: args}
+}
+
+func badRequest(key string, args ...any) *apiError {
+	return newError(http.StatusBadRequest, CodeBadRequest, key, args...)
+}
+
+func unauthorized(key string, args ...any) *apiError {
+	return newError(http.StatusUnauthorized, CodeUnauthorized, key, args...)
+}
+
+func forbidden(key string, args ...any) *apiError {
+	return newError(http.StatusForbidden, CodeForbidden, key, args...)
+}
+
+func notFound(key string, args ...any) *apiError {
+	return newError(http.StatusNotFound, CodeNotFound, key, args...)
+}
+
+func conflict(key string, args ...any) *apiError {
+	return newError(http.StatusConflict, CodeConflict, key, args...)
+}
+
+// invalidField сообщает об ошибке в поле field тела запроса; code — вид
+// нарушения (required, invalid, not_found и т. п.).
+func invalidField(field, code, key string, args ...any) *apiError {
+	e := newError(http.StatusBadRequest, CodeValidation, key, args...)
+	e.details = []fieldError{{Field: field, Code: code, key: key, args: args}}
+	return e
+}
+
+// requestLang выбирает язык ответа по заголовку Accept-Language.
+func requestLang(c *gin.Context) string {
+	return i18n.Negotiate(c.GetHeader("Accept-Language"))
+}
+
+// body переводит ошибку на язык lang.
+func (e *apiError) body(lang string) errorBody {
+	body := errorBody{
+		Code:    e.code,
+		Message: i18n.T(lang, e.key, e.args...),
+		Meta:    e.meta,
+	}
+	for _, d := range e.details {
+		d.Message = i18n.T(lang, d.key, d.args...)
+		body.Details = append(body.Details, d)
+	}
+	return body
+}
+
+// abortWithError прерывает обработку запроса и отвечает ошибкой e на языке клиента.
+func abortWithError(c *gin.Context, e *apiError) {
+	lang := requestLang(c)
+	body := e.body(lang)
+	body.RequestID = c.GetString("request_id")
+	c.Header("Content-Language", lang)
+	c.AbortWithStatusJSON(e.status, body)
+}
+
+// writeError отвечает на ошибку обработчика: apiError передаётся клиенту как
+// есть, отсутствие записи — 404, запись, изменённая параллельным запросом, —
+// 412 при If-Match и 409 без него, остальное — 500.
+func writeError(c *gin.Context, err error) {
+	var e *apiError
+	switch {
+	case errors.As(err, &e):
+		abortWithError(c, e)
+	case errors.Is(err, store.ErrNotFound):
+		abortWithError(c, notFound("not_found"))
+	case errors.Is(err, store.ErrConflict) && c.GetHeader("If-Match") != "":
+		abortWithError(c, errModified)
+	case errors.Is(err, store.ErrConflict):
+		abortWithError(c, conflict("record.modified"))
+	default:
+		internalError(c, err)
+	}
+}
+
+// internalError отвечает 500, не раскрывая клиенту текст ошибки: в нём бывают
+// SQL и детали схемы. Ошибка пишется в журнал запроса, а клиент получает
+// request_id, по которому её можно там найти.
+func internalError(c *gin.Context, err error) {
+	c.Error(err)
+	abortWithError(c, newError(http.StatusInternalServerError, CodeInternal, "internal"))
+}
+
+// notFoundOr отвечает 404 с сообщением key, если записи нет, и 500 на
+// остальные ошибки хранилища.
+func notFoundOr(c *gin.Context, err error, key string) {
+	if errors.Is(err, store.ErrNotFound) {
+		abortWithError(c, notFound(key))
+		return
+	}
+	internalError(c, err)
+}
+
+// bindError отвечает на ошибку разбора тела запроса: нарушения правил
+// валидации и несовпадения типов возвращаются по полям.
+func bindError(c *gin.Context, err error) {
+	var (
+		apiErr  *apiError
+		verrs   validator.ValidationErrors
+		typeErr *json.UnmarshalTypeError
+	)
+	switch {
+	case errors.As(err, &apiErr):
+		abortWithError(c, apiErr)
+	case errors.As(err, &verrs):
+		e := newError(http.StatusBadRequest, CodeValidation, "validation_failed")
+		for _, fe := range verrs {
+			e.details = append(e.details, ruleError(fe))
+		}
+		abortWithError(c, e)
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		abortWithError(c, invalidField(typeErr.Field, "type", typeKey(typeErr.Type)))
+	default:
+		abortWithError(c, badRequest("request.bad_json"))
+	}
+}
+
+// ruleMessages сопоставляет правила валидатора ключам сообщений.
+var ruleMessages = map[string]string{
+	"required": "field.required",
+	"email":    "field.email",
+	"min":      "field.min",
+	"gte":      "field.min",
+	"max":      "field.max",
+	"lte":      "field.max",
+	"gt":       "field.gt",
+	"len":      "field.len",
+	"oneof":    "field.oneof",
+	"e164":     "field.phone",
+	"hexcolor": "field.color",
+}
+
+// lengthMessages — сообщения о длине строки для правил min и max, которые
+// у чисел ограничивают значение.
+var lengthMessages = map[string]string{
+	"min": "field.min_length",
+	"max": "field.max_length",
+}
+
+func ruleError(fe validator.FieldError) fieldError {
+	// Namespace начинается с имени типа: Pipeline.stages[0].name → stages[0].name;
+	// у анонимной структуры тела запроса имени типа нет
+	field := fe.Namespace()
+	if _, rest, ok := strings.Cut(field, "."); ok {
+		field = rest
+	}
+	key, ok := ruleMessages[fe.Tag()]
+	if !ok {
+		return fieldError{Field: field, Code: fe.Tag(), key: "field.invalid"}
+	}
+	if k, ok := lengthMessages[fe.Tag()]; ok && fe.Kind() == reflect.String {
+		key = k
+	}
+	var args []any
+	if fe.Param() != "" {
+		args = []any{fe.Param()}
+	}
+	return fieldError{Field: field, Code: fe.Tag(), key: key, args: args}
+}
+
+// typeKey возвращает ключ сообщения об ожидаемом типе значения.
+func typeKey(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "field.type_string"
+	case reflect.Bool:
+		return "field.type_boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "field.type_number"
+	case reflect.Slice, reflect.Array:
+		return "field.type_array"
+	case reflect.Struct, reflect.Map:
+		return "field.type_object"
+	}
+	return "field.invalid"
+}
+
+// Валидатор называет поля по json-тегам, как их видит клиент.
+func init() {
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(f reflect.StructField) string {
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			switch name {
+			case "-":
+				return ""
+			case "":
+				return f.Name
+			}
+			return name
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"crm-backend/internal/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errModified — запись изменили после того, как клиент её прочитал.
+var errModified = newError(http.StatusPreconditionFailed, CodePreconditionFailed, "record.modified")
+
+// etag возвращает ETag записи версии version. Версия растёт при каждом
+// изменении записи, поэтому совпадение ETag означает, что запись не менялась.
+func etag(version uint) string {
+	return `"` + strconv.FormatUint(uint64(version), 10) + `"`
+}
+
+// checkIfMatch проверяет заголовок If-Match перед изменением или удалением
+// записи версии version; без заголовка запрос выполняется без проверки. Если
+// версия не совпала, отвечает 412 и возвращает false.
+func checkIfMatch(c *gin.Context, version uint) bool {
+	header := c.GetHeader("If-Match")
+	if header == "" || matchETag(header, etag(version), false) {
+		return true
+	}
+	abortWithError(c, errModified)
+	return false
+}
+
+// goneWithoutIfMatch отвечает 204 на удаление отсутствующей записи без
+// If-Match: повторный DELETE не считается ошибкой. С If-Match клиент ждёт
+// конкретную версию, и отсутствие записи остаётся ошибкой.
+func goneWithoutIfMatch(c *gin.Context, err error) bool {
+	if errors.Is(err, store.ErrNotFound) && c.GetHeader("If-Match") == "" {
+		c.Status(http.StatusNoContent)
+		return true
+	}
+	return false
+}
+
+// respondRecord отвечает записью версии version с заголовком ETag. На GET с
+// If-None-Match, совпадающим с ETag, отвечает 304 без тела.
+func respondRecord(c *gin.Context, status int, version uint, record any) {
+	tag := etag(version)
+	c.Header("ETag", tag)
+	if c.Request.Method == http.MethodGet && matchETag(c.GetHeader("If-None-Match"), tag, true) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.JSON(status, record)
+}
+
+// matchETag сообщает, совпадает ли tag с одним из ETag в header. Слабые ETag
+// (W/"…") учитываются только при слабом сравнении: RFC 9110 требует его для
+// If-None-Match и запрещает для If-Match.
+func matchETag(header, tag string, weak bool) bool {
+	for _, v := range strings.Split(header, ",") {
+		v = strings.TrimSpace(v)
+		if v == "*" {
+			return true
+		}
+		if opaque, ok := strings.CutPrefix(v, "W/"); ok {
+			if !weak {
+				continue
+			}
+			v = opaque
+		}
+		if v == tag {
+			return true
+		}
+	}
+	return false
+}
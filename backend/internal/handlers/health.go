@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// readinessTimeout ограничивает время проверок /readyz, чтобы зависшая база
+// не задерживала ответ оркестратору.
+const readinessTimeout = 2 * time.Second
+
+// ReadinessProbe — проверки, от которых зависит готовность принимать запросы.
+type ReadinessProbe interface {
+	// Ping проверяет соединение с базой данных.
+	Ping(ctx context.Context) error
+	// PendingMigrations возвращает количество неприменённых миграций.
+	PendingMigrations(ctx context.Context) (int, error)
+}
+
+// Healthz godoc
+// @Summary      Проверка жизнеспособности
+// @Description  Отвечает 200, пока процесс обрабатывает запросы. Базу данных не проверяет.
+// @Tags         health
+// @Produce      json
+// @Success      200  {object}  map[string]string
+// @Router       /healthz [get]
+func Healthz() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	}
+}
+
+// Readyz godoc
+// @Summary      Проверка готовности
+// @Description  Проверяет соединение с PostgreSQL и наличие неприменённых миграций. Пока база недоступна или схема не обновлена, отвечает 503.
+// @Tags         health
+// @Produce      json
+// @Success      200  {object}  map[string]interface{}
+// @Failure      503  {object}  map[string]interface{}
+// @Router       /readyz [get]
+func Readyz(probe ReadinessProbe) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), readinessTimeout)
+		defer cancel()
+
+		ready := true
+		database := gin.H{"status": "ok"}
+		migrations := gin.H{}
+		// Текст ошибки (адрес базы, пользователь) уходит только в журнал запроса:
+		// /readyz доступен без авторизации
+		if err := probe.Ping(ctx); err != nil {
+			ready = false
+			c.Error(err)
+			database = gin.H{"status": "unavailable"}
+		} else if pending, err := probe.PendingMigrations(ctx); err != nil {
+			ready = false
+			c.Error(err)
+			migrations = gin.H{"status": "unknown"}
+		} else {
+			migrations = gin.H{"status": "ok", "pending": pending}
+			if pending > 0 {
+				ready = false
+				migrations["status"] = "pending"
+			}
+		}
+
+		code, status := http.StatusOK, "ready"
+		if !ready {
+			code, status = http.StatusServiceUnavailable, "not_ready"
+		}
+		c.JSON(code, gin.H{"status": status, "database": database, "migrations": migrations})
+	}
+}
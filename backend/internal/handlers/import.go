@@ -0,0 +1,799 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"crm-backend/internal/i18n"
+	"crm-backend/internal/models"
+	"crm-backend/internal/spreadsheet"
+	"crm-backend/internal/store"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// Ограничения импорта: размер файла, число строк, размер пачки, которая
+// сохраняется одной транзакцией, число записей в предпросмотре и строк в
+// отчёте об ошибках (отклонённые строки сверх него только считаются).
+const (
+	maxImportSize     = 10 << 20
+	maxImportRows     = 10000
+	importBatchSize   = 100
+	importPreviewSize = 20
+	maxImportErrors   = 1000
+)
+
+// importStaleAfter — сколько задача может не сохранять ход, прежде чем её
+// сочтут брошенной. Пачка сохраняется намного быстрее.
+const importStaleAfter = 10 * time.Minute
+
+var importList = store.ListSpec{
+	Resource:    "imports",
+	Table:       "import_jobs",
+	Sortable:    []string{"id", "entity", "status", "created_at", "updated_at", "finished_at"},
+	Filterable:  []string{"entity", "status", "dry_run", "user_id"},
+	DefaultSort: "id",
+}
+
+// importRow — непустая строка файла: её номер в файле, значения по
+// заголовкам колонок и значения сопоставленных полей.
+type importRow struct {
+	num    int
+	values map[string]string
+	fields map[string]string
+}
+
+// importBuild собирает запись из значений полей строки и проверяет её.
+// Ошибки в данных строки возвращаются как apiError с ошибками по полям,
+// остальные ошибки прерывают импорт.
+type importBuild[M any] func(tx store.Store, fields map[string]string) (M, error)
+
+// importer — правила импорта записей M.
+type importer[M any] struct {
+	entity string
+	// fields — поля, которым можно сопоставить колонки файла
+	fields []string
+	// required — группы полей: из каждой должно быть сопоставлено хотя бы одно
+	required [][]string
+	// aliases — поле файла, из которого берётся поле записи, если само оно
+	// не сопоставлено: клиент по названию вместо customer_id и т. п.
+	aliases map[string]string
+	// build возвращает сборщик записей для одной задачи: справочники, нужные
+	// для поиска по названию, он загружает один раз
+	build  func() importBuild[M]
+	insert func(tx store.Store, c *gin.Context, record *M) error
+}
+
+var customerImporter = importer[models.Customer]{
+	entity:   "customers",
+	fields:   []string{"name", "email", "phone", "company"},
+	required: [][]string{{"name"}},
+	build:    func() importBuild[models.Customer] { return buildCustomer },
+	insert: func(tx store.Store, c *gin.Context, customer *models.Customer) error {
+		return insertCustomer(tx, c, customer, []uint{})
+	},
+}
+
+var dealImporter = importer[models.Deal]{
+	entity: "deals",
+	fields: []string{
+		"title", "description", "customer_id", "customer", "pipeline_id", "pipeline", "status_id", "status",
+		"amount", "currency", "expected_close_date", "probability",
+	},
+	required: [][]string{{"title"}, {"customer_id", "customer"}},
+	aliases:  map[string]string{"customer_id": "customer", "pipeline_id": "pipeline", "status_id": "status"},
+	build: func() importBuild[models.Deal] {
+		r := &dealResolver{customers: map[string][]uint{}}
+		return r.build
+	},
+	insert: func(tx store.Store, c *gin.Context, deal *models.Deal) error {
+		return insertDeal(tx, c, deal, []uint{})
+	},
+}
+
+// ImportCustomers godoc
+// @Summary      Импортировать клиентов
+// @Description  Принимает CSV или XLSX (до 10 МБ и 10000 строк, первая строка — заголовки) и запускает фоновую задачу импорта. mapping сопоставляет заголовки колонок полям: name, email, phone, company; без него колонки сопоставляются полям с тем же именем. При dry_run строки только проверяются, а задача показывает первые записи, которые будут созданы. Ход задачи — в GET /imports/{id}.
+// @Tags         imports
+// @Accept       multipart/form-data
+// @Produce      json
+// @Param        file     formData  file    true   "Файл .csv или .xlsx"
+// @Param        mapping  formData  string  false  "Сопоставление: {\"Колонка\":\"поле\"}"
+// @Param        dry_run  formData  bool    false  "Только проверить строки"
+// @Success      202      {object}  models.ImportJob
+// @Header       202      {string}  Location  "Адрес задачи импорта"
+// @Failure      400      {object}  errorBody
+// @Failure      413      {object}  errorBody
+// @Router       /customers/import [post]
+func ImportCustomers(st store.Store, runner *ImportRunner) gin.HandlerFunc {
+	return startImport(st, runner, customerImporter)
+}
+
+// ImportDeals godoc
+// @Summary      Импортировать сделки
+// @Description  Как импорт клиентов. Поля: title, description, customer_id или customer (название клиента), pipeline_id или pipeline (название воронки), status_id или status (название этапа, ищется в воронке сделки, если она указана), amount (в основных единицах валюты: 1500,50), currency, expected_close_date (ГГГГ-ММ-ДД, ДД.ММ.ГГГГ или дата Excel), probability.
+// @Tags         imports
+// @Accept       multipart/form-data
+// @Produce      json
+// @Param        file     formData  file    true   "Файл .csv или .xlsx"
+// @Param        mapping  formData  string  false  "Сопоставление: {\"Колонка\":\"поле\"}"
+// @Param        dry_run  formData  bool    false  "Только проверить строки"
+// @Success      202      {object}  models.ImportJob
+// @Header       202      {string}  Location  "Адрес задачи импорта"
+// @Failure      400      {object}  errorBody
+// @Failure      413      {object}  errorBody
+// @Router       /deals/import [post]
+func ImportDeals(st store.Store, runner *ImportRunner) gin.HandlerFunc {
+	return startImport(st, runner, dealImporter)
+}
+
+// GetImports godoc
+// @Summary      Получить список задач импорта
+// @Description  Возвращает задачи импорта текущего пользователя, администратору — все
+// @Tags         imports
+// @Produce      json
+// @Param        sort    query     string  false  "Сортировка: [\"created_at\",\"DESC\"]"
+// @Param        range   query     string  false  "Диапазон записей: [0,24]"
+// @Param        filter  query     string  false  "Фильтр: {\"entity\":\"deals\",\"status\":\"done\"}"
+// @Success      200  {array}   models.ImportJob
+// @Header       200  {string}  Content-Range  "Диапазон и общее количество записей"
+// @Failure      400  {object}  errorBody
+// @Router       /imports [get]
+func GetImports(st store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		st := scoped(st, c)
+		q, err := parseListQuery(c, importList)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		if !isAdmin(c) {
+			q.Filters["user_id"] = nil
+			if id := currentUserID(c); id != nil {
+				q.Filters["user_id"] = *id
+			}
+		}
+		jobs, total, err := st.Imports().List(q)
+		if err != nil {
+			internalError(c, err)
+			return
+		}
+		setContentRange(c, q, len(jobs), total)
+		c.JSON(http.StatusOK, jobs)
+	}
+}
+
+// GetImport godoc
+// @Summary      Получить задачу импорта
+// @Description  Возвращает состояние задачи импорта, отчёт об отклонённых строках и предпросмотр. Чужие задачи видит только администратор.
+// @Tags         imports
+// @Produce      json
+// @Param        id   path      int  true  "ID задачи"
+// @Success      200  {object}  models.ImportJob
+// @Failure      404  {object}  errorBody
+// @Router       /imports/{id} [get]
+func GetImport(st store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		st := scoped(st, c)
+		job, err := st.Imports().Get(idParam(c, "id"))
+		if err != nil {
+			notFoundOr(c, err, "import.not_found")
+			return
+		}
+		if !ownsImport(c, job) {
+			abortWithError(c, notFound("import.not_found"))
+			return
+		}
+		c.JSON(http.StatusOK, job)
+	}
+}
+
+// ownsImport сообщает, что задачу job запустил текущий пользователь или что
+// он администратор.
+func ownsImport(c *gin.Context, job models.ImportJob) bool {
+	if isAdmin(c) {
+		return true
+	}
+	id := currentUserID(c)
+	return id != nil && job.UserID != nil && *id == *job.UserID
+}
+
+// startImport читает загруженный файл, проверяет сопоставление колонок,
+// создаёт задачу и передаёт её runner: задача переживает запрос.
+func startImport[M any](st store.Store, runner *ImportRunner, imp importer[M]) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		st := scoped(st, c)
+		// Запас на заголовки multipart и остальные поля формы
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize+1<<20)
+		file, err := c.FormFile("file")
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.As(err, &tooLarge) || err == nil && file.Size > maxImportSize:
+			abortWithError(c, newError(http.StatusRequestEntityTooLarge, CodeBadRequest, "import.too_large", maxImportSize>>20))
+			return
+		case err != nil:
+			abortWithError(c, invalidField("file", "required", "import.file_required"))
+			return
+		}
+		rows, err := readUpload(file)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		header := rows[0]
+		for i := range header {
+			header[i] = strings.TrimSpace(header[i])
+		}
+		mapping, err := importMapping(c.PostForm("mapping"), header, imp)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		dryRun, err := strconv.ParseBool(c.DefaultPostForm("dry_run", "false"))
+		if err != nil {
+			abortWithError(c, invalidField("dry_run", "type", "field.type_boolean"))
+			return
+		}
+
+		data := importRows(header, rows[1:], mapping)
+		job := models.ImportJob{
+			Entity: imp.entity, FileName: file.Filename, DryRun: dryRun, Mapping: mapping,
+			Status: models.ImportQueued, Total: len(data), UserID: currentUserID(c),
+			Errors: models.ImportRowErrors{}, Preview: models.ImportPreview{},
+		}
+		if err := st.Imports().Create(&job); err != nil {
+			internalError(c, err)
+			return
+		}
+		runner.wg.Add(1)
+		go runImport(runner, c.Copy(), imp, job, data, requestLang(c))
+		c.Header("Location", fmt.Sprintf("/imports/%d", job.ID))
+		c.JSON(http.StatusAccepted, job)
+	}
+}
+
+// readUpload читает таблицу из загруженного файла; в ней есть хотя бы
+// строка заголовков.
+func readUpload(file *multipart.FileHeader) ([][]string, error) {
+	f, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	// Строка заголовков не считается
+	rows, err := spreadsheet.Read(file.Filename, f, file.Size, maxImportRows+1)
+	switch {
+	case errors.Is(err, spreadsheet.ErrTooLong):
+		return nil, badRequest("import.too_many_rows", maxImportRows)
+	case errors.Is(err, spreadsheet.ErrFormat):
+		return nil, invalidField("file", "invalid", "import.file_invalid")
+	case err != nil:
+		return nil, err
+	case len(rows) == 0 || len(rows[0]) == 0:
+		return nil, invalidField("file", "invalid", "import.file_empty")
+	}
+	return rows, nil
+}
+
+// importMapping разбирает сопоставление колонок полям — JSON-объект
+// {"Колонка":"поле"}, где пустое поле пропускает колонку — и проверяет, что
+// колонки есть в файле, поля известны и не повторяются, а обязательные
+// сопоставлены. Без сопоставления колонки сопоставляются полям с тем же
+// именем без учёта регистра.
+func importMapping[M any](raw string, header []string, imp importer[M]) (models.ImportMapping, error) {
+	mapping := models.ImportMapping{}
+	if raw == "" {
+		for _, col := range header {
+			field := strings.ToLower(col)
+			if contains(imp.fields, field) {
+				mapping[col] = field
+			}
+		}
+	} else if err := json.Unmarshal([]byte(raw), &mapping); err != nil {
+		return nil, invalidField("mapping", "invalid", "import.mapping_invalid")
+	}
+
+	columns := make([]string, 0, len(mapping))
+	for col := range mapping {
+		columns = append(columns, col)
+	}
+	sort.Strings(columns)
+	used := map[string]bool{}
+	for _, col := range columns {
+		field := mapping[col]
+		switch {
+		case field == "":
+			delete(mapping, col)
+		case !contains(header, col):
+			return nil, invalidField("mapping", "not_found", "import.column_missing", col)
+		case !contains(imp.fields, field):
+			return nil, invalidField("mapping", "invalid", "import.field_unknown", field)
+		case used[field]:
+			return nil, invalidField("mapping", "invalid", "import.field_duplicate", field)
+		}
+		used[field] = true
+	}
+	for _, group := range imp.required {
+		found := false
+		for _, field := range group {
+			found = found || used[field]
+		}
+		if !found {
+			return nil, invalidField("mapping", "required", "import.field_required", strings.Join(group, " / "))
+		}
+	}
+	return mapping, nil
+}
+
+// importRows отбирает непустые строки данных. Номера строк считаются с
+// единицы вместе со строкой заголовков, как в таблице. Если заголовок
+// повторяется, берётся первая колонка с ним.
+func importRows(header []string, data [][]string, mapping models.ImportMapping) []importRow {
+	var rows []importRow
+	for i, cells := range data {
+		row := importRow{num: i + 2, values: map[string]string{}, fields: map[string]string{}}
+		empty := true
+		for j, col := range header {
+			if _, seen := row.values[col]; seen || col == "" {
+				continue
+			}
+			value := ""
+			if j < len(cells) {
+				value = strings.TrimSpace(cells[j])
+			}
+			empty = empty && value == ""
+			row.values[col] = value
+			if field := mapping[col]; field != "" {
+				row.fields[field] = value
+			}
+		}
+		if !empty {
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+// ImportRunner выполняет задачи импорта в фоне. Stop прерывает их и ждёт,
+// пока они сохранят своё состояние, поэтому вызывается до закрытия
+// соединений с базой.
+type ImportRunner struct {
+	st     store.Store
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewImportRunner возвращает исполнителя задач импорта над хранилищем st.
+func NewImportRunner(st store.Store) *ImportRunner {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &ImportRunner{st: st, ctx: ctx, cancel: cancel}
+}
+
+// Stop прерывает выполняющиеся задачи: каждая дописывает текущую пачку (или
+// откатывает её) и отмечается прерванной.
+func (r *ImportRunner) Stop() {
+	r.cancel()
+	r.wg.Wait()
+}
+
+// runImport проверяет строки задачи job и, если это не пробный запуск,
+// сохраняет подходящие пачками по importBatchSize строк: каждая пачка
+// сохраняется одной транзакцией вместе с ходом задачи. Ошибка хранилища или
+// остановка сервера прерывает задачу, уже сохранённые пачки остаются. Если
+// задачу успел завершить другой процесс (Update вернул ErrConflict), она
+// бросается без сохранения. Сообщения об ошибках — на языке lang запроса,
+// создавшего задачу.
+func runImport[M any](r *ImportRunner, c *gin.Context, imp importer[M], job models.ImportJob, rows []importRow, lang string) {
+	defer r.wg.Done()
+	// Запросы отменяются вместе с r.ctx, а итог задачи сохраняется и после отмены
+	st := r.st.WithContext(r.ctx)
+	fail := func(err error) {
+		switch {
+		case errors.Is(err, store.ErrConflict):
+			slog.Warn("Задача импорта завершена другим процессом", "import_id", job.ID)
+			return
+		case r.ctx.Err() != nil:
+			slog.Warn("Импорт прерван остановкой сервера", "import_id", job.ID, "processed", job.Processed)
+			finishImport(r.st, &job, models.ImportFailed, i18n.T(lang, "import.interrupted"))
+		default:
+			slog.Error("Импорт прерван", "import_id", job.ID, "entity", job.Entity, "error", err)
+			finishImport(r.st, &job, models.ImportFailed, i18n.T(lang, "import.failed"))
+		}
+	}
+	defer func() {
+		if rec := recover(); rec != nil {
+			fail(fmt.Errorf("panic: %v", rec))
+		}
+	}()
+
+	job.Status = models.ImportRunning
+	if err := st.Imports().Update(&job); err != nil {
+		fail(err)
+		return
+	}
+	columns := map[string]string{}
+	for col, field := range job.Mapping {
+		columns[field] = col
+	}
+	build := imp.build()
+	for start := 0; start < len(rows); start += importBatchSize {
+		if err := r.ctx.Err(); err != nil {
+			fail(err)
+			return
+		}
+		batch := rows[start:min(start+importBatchSize, len(rows))]
+		next := job
+		err := st.Tx(func(tx store.Store) error {
+			next = job
+			next.Processed += len(batch)
+			for _, row := range batch {
+				record, err := build(tx, row.fields)
+				var errs rowErrors
+				if err := errs.collect(err); err != nil {
+					return err
+				}
+				if len(errs) > 0 {
+					next.Rejected++
+					if len(next.Errors) < maxImportErrors {
+						next.Errors = append(next.Errors, importReport(row, errs, imp, columns, lang))
+					}
+					continue
+				}
+				next.Imported++
+				if job.DryRun {
+					if len(next.Preview) < importPreviewSize {
+						b, err := json.Marshal(record)
+						if err != nil {
+							return err
+						}
+						next.Preview = append(next.Preview, b)
+					}
+					continue
+				}
+				if err := imp.insert(tx, c, &record); err != nil {
+					return err
+				}
+			}
+			return tx.Imports().Update(&next)
+		})
+		if err != nil {
+			fail(err)
+			return
+		}
+		job = next
+	}
+	finishImport(r.st, &job, models.ImportDone, "")
+}
+
+// finishImport сохраняет итог задачи.
+func finishImport(st store.Store, job *models.ImportJob, status, failure string) {
+	now := time.Now().Unix()
+	job.Status, job.Failure, job.FinishedAt = status, failure, &now
+	if err := st.Imports().Update(job); err != nil {
+		slog.Error("Ошибка сохранения задачи импорта", "import_id", job.ID, "error", err)
+	}
+}
+
+// importReport описывает отклонённую строку: ошибки по полям с колонками,
+// из которых они взяты, на языке lang.
+func importReport[M any](row importRow, errs rowErrors, imp importer[M], columns map[string]string, lang string) models.ImportRowError {
+	report := models.ImportRowError{Row: row.num, Values: row.values}
+	for _, e := range errs {
+		col, ok := columns[e.Field]
+		if !ok {
+			col = columns[imp.aliases[e.Field]]
+		}
+		report.Errors = append(report.Errors, models.ImportFieldError{
+			Field: e.Field, Column: col, Message: i18n.T(lang, e.key, e.args...),
+		})
+	}
+	return report
+}
+
+// rowErrors накапливает ошибки в полях строки файла; для каждого поля
+// хранится первая ошибка.
+type rowErrors []fieldError
+
+func (r *rowErrors) add(field, code, key string, args ...any) {
+	r.append(fieldError{Field: field, Code: code, key: key, args: args})
+}
+
+func (r *rowErrors) append(e fieldError) {
+	for _, old := range *r {
+		if old.Field == e.Field {
+			return
+		}
+	}
+	*r = append(*r, e)
+}
+
+// collect добавляет ошибки в данных из err и возвращает остальные ошибки:
+// их исправлением строки не устранить.
+func (r *rowErrors) collect(err error) error {
+	var (
+		e     *apiError
+		verrs validator.ValidationErrors
+	)
+	switch {
+	case err == nil:
+	case errors.As(err, &e) && len(e.details) > 0:
+		for _, d := range e.details {
+			r.append(d)
+		}
+	case errors.As(err, &e):
+		r.append(fieldError{Code: e.code, key: e.key, args: e.args})
+	case errors.As(err, &verrs):
+		for _, fe := range verrs {
+			r.append(ruleError(fe))
+		}
+	default:
+		return err
+	}
+	return nil
+}
+
+// err возвращает накопленные ошибки как ошибку проверки или nil.
+func (r rowErrors) err() error {
+	if len(r) == 0 {
+		return nil
+	}
+	e := newError(http.StatusBadRequest, CodeValidation, "validation_failed")
+	e.details = r
+	return e
+}
+
+// id разбирает идентификатор записи; пустое значение — 0.
+func (r *rowErrors) id(field, value string) uint {
+	if value == "" {
+		return 0
+	}
+	id, err := strconv.ParseUint(value, 10, 0)
+	if err != nil || id == 0 {
+		r.add(field, "type", "import.id_invalid")
+		return 0
+	}
+	return uint(id)
+}
+
+func buildCustomer(_ store.Store, fields map[string]string) (models.Customer, error) {
+	customer := models.Customer{
+		Name: fields["name"], Email: fields["email"], Phone: importPhone(fields["phone"]), Company: fields["company"],
+	}
+	return customer, binding.Validator.ValidateStruct(&customer)
+}
+
+// importPhone убирает из телефона пробелы, скобки и дефисы, с которыми его
+// обычно записывают в таблицах: +7 (999) 123-45-67 → +79991234567.
+func importPhone(phone string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\u00a0', '(', ')', '-', '.':
+			return -1
+		}
+		return r
+	}, phone)
+}
+
+// dealResolver собирает сделки из строк файла, находя клиентов, воронки и
+// этапы по названию. Найденные клиенты и список воронок запоминаются на
+// время задачи.
+type dealResolver struct {
+	customers map[string][]uint
+	pipelines []models.Pipeline
+	loaded    bool
+}
+
+func (r *dealResolver) build(tx store.Store, fields map[string]string) (models.Deal, error) {
+	var errs rowErrors
+	deal := models.Deal{Title: fields["title"], Description: fields["description"], Currency: fields["currency"]}
+	deal.CustomerID = errs.id("customer_id", fields["customer_id"])
+	deal.PipelineID = errs.id("pipeline_id", fields["pipeline_id"])
+	deal.StatusID = errs.id("status_id", fields["status_id"])
+	if name := fields["customer"]; name != "" && fields["customer_id"] == "" {
+		id, err := r.customer(tx, name)
+		if err := errs.collect(err); err != nil {
+			return deal, err
+		}
+		deal.CustomerID = id
+	}
+	if name := fields["pipeline"]; name != "" && fields["pipeline_id"] == "" {
+		id, err := r.pipeline(tx, name)
+		if err := errs.collect(err); err != nil {
+			return deal, err
+		}
+		deal.PipelineID = id
+	}
+	if name := fields["status"]; name != "" && fields["status_id"] == "" {
+		id, err := r.stage(tx, name, deal.PipelineID)
+		if err := errs.collect(err); err != nil {
+			return deal, err
+		}
+		deal.StatusID = id
+	}
+	if v := fields["probability"]; v != "" {
+		p, err := strconv.Atoi(strings.TrimSuffix(v, "%"))
+		if err != nil {
+			errs.add("probability", "type", "field.type_number")
+		}
+		deal.Probability = &p
+	}
+	if v := fields["expected_close_date"]; v != "" {
+		date, ok := parseImportDate(v)
+		if !ok {
+			errs.add("expected_close_date", "type", "import.date_invalid")
+		}
+		deal.ExpectedCloseDate = &date
+	}
+	if err := errs.collect(normalizeDeal(&deal)); err != nil {
+		return deal, err
+	}
+	if v := fields["amount"]; v != "" && ValidCurrency(deal.Currency) {
+		amount, ok := parseAmount(v, currencyExponent[deal.Currency])
+		if !ok {
+			errs.add("amount", "type", "import.amount_invalid", currencyExponent[deal.Currency])
+		}
+		deal.Amount = amount
+	}
+	if err := errs.collect(binding.Validator.ValidateStruct(&deal)); err != nil {
+		return deal, err
+	}
+	if len(errs) > 0 {
+		return deal, errs.err()
+	}
+	if err := errs.collect(checkCustomer(tx, deal.CustomerID)); err != nil {
+		return deal, err
+	}
+	if len(errs) == 0 {
+		if err := errs.collect(applyStage(tx, &deal)); err != nil {
+			return deal, err
+		}
+	}
+	return deal, errs.err()
+}
+
+// customer находит клиента по точному названию.
+func (r *dealResolver) customer(tx store.Store, name string) (uint, error) {
+	ids, ok := r.customers[name]
+	if !ok {
+		q := store.NewListQuery(customerList)
+		q.Filters["name"] = name
+		q.HasRange, q.End = true, 1
+		customers, _, err := tx.Customers().List(q)
+		if err != nil {
+			return 0, err
+		}
+		for _, customer := range customers {
+			ids = append(ids, customer.ID)
+		}
+		r.customers[name] = ids
+	}
+	switch len(ids) {
+	case 0:
+		return 0, invalidField("customer_id", "not_found", "import.customer_not_found", name)
+	case 1:
+		return ids[0], nil
+	}
+	return 0, invalidField("customer_id", "ambiguous", "import.customer_ambiguous", name)
+}
+
+// load загружает воронки с этапами.
+func (r *dealResolver) load(tx store.Store) error {
+	if r.loaded {
+		return nil
+	}
+	pipelines, _, err := tx.Pipelines().List(store.NewListQuery(pipelineList))
+	if err != nil {
+		return err
+	}
+	r.pipelines, r.loaded = pipelines, true
+	return nil
+}
+
+// pipeline находит воронку по названию без учёта регистра.
+func (r *dealResolver) pipeline(tx store.Store, name string) (uint, error) {
+	if err := r.load(tx); err != nil {
+		return 0, err
+	}
+	var found []uint
+	for _, p := range r.pipelines {
+		if strings.EqualFold(p.Name, name) {
+			found = append(found, p.ID)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return 0, invalidField("pipeline_id", "not_found", "import.pipeline_not_found", name)
+	case 1:
+		return found[0], nil
+	}
+	return 0, invalidField("pipeline_id", "ambiguous", "import.pipeline_ambiguous", name)
+}
+
+// stage находит этап по названию без учёта регистра: в воронке pipelineID,
+// если она известна, иначе во всех воронках.
+func (r *dealResolver) stage(tx store.Store, name string, pipelineID uint) (uint, error) {
+	if err := r.load(tx); err != nil {
+		return 0, err
+	}
+	var found []uint
+	for _, p := range r.pipelines {
+		if pipelineID != 0 && p.ID != pipelineID {
+			continue
+		}
+		for _, s := range p.Stages {
+			if strings.EqualFold(s.Name, name) {
+				found = append(found, s.ID)
+			}
+		}
+	}
+	switch len(found) {
+	case 0:
+		return 0, invalidField("status_id", "not_found", "import.status_not_found", name)
+	case 1:
+		return found[0], nil
+	}
+	return 0, invalidField("status_id", "ambiguous", "import.status_ambiguous", name)
+}
+
+// parseAmount переводит сумму в основных единицах валюты ("1 500,50",
+// "1500.5") в минимальные единицы с exp знаками. Дробная часть длиннее exp
+// не округляется, а считается ошибкой.
+func parseAmount(s string, exp int) (int64, bool) {
+	s = strings.NewReplacer(" ", "", "\u00a0", "", ",", ".").Replace(s)
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" || len(frac) > exp || !isDigits(whole) || !isDigits(frac) {
+		return 0, false
+	}
+	amount, err := strconv.ParseInt(whole+frac+strings.Repeat("0", exp-len(frac)), 10, 64)
+	return amount, err == nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// excelEpoch — день, от которого Excel отсчитывает даты.
+var excelEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// parseImportDate разбирает дату в виде ГГГГ-ММ-ДД, ДД.ММ.ГГГГ или номера
+// дня Excel: в XLSX даты хранятся числами.
+func parseImportDate(s string) (models.Date, bool) {
+	for _, layout := range []string{"2006-01-02", "02.01.2006"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return models.Date{Time: t}, true
+		}
+	}
+	// Дробная часть — время дня
+	days, err := strconv.ParseFloat(s, 64)
+	if err != nil || days < 1 || days > 2958465 {
+		return models.Date{}, false
+	}
+	return models.Date{Time: excelEpoch.AddDate(0, 0, int(days))}, true
+}
+
+// InterruptStaleImports завершает с ошибкой задачи импорта, которые не
+// сохраняли ход дольше importStaleAfter: выполнявший их процесс упал, не
+// успев их прервать. Задачи, которые сейчас выполняют другие процессы,
+// обновляются после каждой пачки и не затрагиваются. Вызывается при старте.
+func InterruptStaleImports(st store.Store) (int64, error) {
+	now := time.Now()
+	return st.Imports().Interrupt(i18n.T(i18n.Default, "import.interrupted"), now.Add(-importStaleAfter), now)
+}
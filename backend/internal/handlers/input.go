@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// modelInput — тело запроса на создание и изменение записи M. В нём есть
+// только поля, которые клиент вправе менять: id, даты и служебные поля в
+// запись из тела не попадают.
+type modelInput[M any] interface {
+	// load заполняет тело текущими значениями записи.
+	load(M)
+	// apply переносит значения тела в запись.
+	apply(*M)
+}
+
+// bindInput разбирает тело запроса в input и переносит его в model. POST и
+// PUT накладывают тело на текущие значения: отсутствующие поля не меняются.
+// PATCH применяет тело как JSON Merge Patch (RFC 7396): null сбрасывает поле.
+// Проверяются и тело, и получившаяся запись. При ошибке отвечает клиенту и
+// возвращает false.
+func bindInput[M any](c *gin.Context, input modelInput[M], model *M) bool {
+	input.load(*model)
+	var err error
+	if c.Request.Method == http.MethodPatch {
+		err = mergePatch(c, input)
+	} else {
+		err = c.ShouldBindJSON(input)
+	}
+	if err == nil {
+		input.apply(model)
+		err = binding.Validator.ValidateStruct(model)
+	}
+	if err != nil {
+		bindError(c, err)
+		return false
+	}
+	return true
+}
+
+// mergePatch применяет тело запроса как JSON Merge Patch к input.
+func mergePatch(c *gin.Context, input any) error {
+	var patch any
+	if err := json.NewDecoder(c.Request.Body).Decode(&patch); err != nil {
+		return err
+	}
+	if _, ok := patch.(map[string]any); !ok {
+		return badRequest("request.patch_object")
+	}
+	current, err := json.Marshal(input)
+	if err != nil {
+		return err
+	}
+	var doc any
+	if err := json.Unmarshal(current, &doc); err != nil {
+		return err
+	}
+	merged, err := json.Marshal(mergeValue(doc, patch))
+	if err != nil {
+		return err
+	}
+	// Сброшенные через null поля получают нулевые значения
+	v := reflect.ValueOf(input).Elem()
+	v.SetZero()
+	if err := json.Unmarshal(merged, input); err != nil {
+		return err
+	}
+	return binding.Validator.ValidateStruct(input)
+}
+
+// mergeValue накладывает patch на target по правилам RFC 7396.
+func mergeValue(target, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = map[string]any{}
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+		} else {
+			t[k] = mergeValue(t[k], v)
+		}
+	}
+	return t
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"regexp"
+	"strings"
+
+	"crm-backend/internal/models"
+	"crm-backend/internal/store"
+)
+
+// mentionPattern находит упоминания вида @ivan или @ivan@example.com. Перед
+// @ не должно быть буквы или точки, чтобы не принять адрес почты в тексте за
+// упоминание.
+var mentionPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_.@])@([\p{L}\p{N}_.+-]+(?:@[\p{L}\p{N}-]+(?:\.[\p{L}\p{N}-]+)+)?)`)
+
+// parseMentions возвращает упомянутые в тексте имена в нижнем регистре без повторов.
+func parseMentions(content string) []string {
+	seen := map[string]bool{}
+	var handles []string
+	for _, m := range mentionPattern.FindAllStringSubmatch(content, -1) {
+		h := strings.ToLower(strings.TrimRight(m[1], "."))
+		if h != "" && !seen[h] {
+			seen[h] = true
+			handles = append(handles, h)
+		}
+	}
+	return handles
+}
+
+// resolveMentions сопоставляет упоминания пользователям. Упоминание — это
+// email целиком или его часть до @; если такая часть есть у нескольких
+// пользователей, упоминание неоднозначно и пропускается.
+func resolveMentions(st store.Store, handles []string) ([]uint, error) {
+	if len(handles) == 0 {
+		return nil, nil
+	}
+	users, err := st.Users().FindByMentions(handles)
+	if err != nil {
+		return nil, err
+	}
+	byEmail := map[string]uint{}
+	byLocal := map[string][]uint{}
+	for _, u := range users {
+		email := strings.ToLower(u.Email)
+		byEmail[email] = u.ID
+		local := strings.SplitN(email, "@", 2)[0]
+		byLocal[local] = append(byLocal[local], u.ID)
+	}
+	var ids []uint
+	for _, h := range handles {
+		if id, ok := byEmail[h]; ok {
+			ids = append(ids, id)
+		} else if matches := byLocal[h]; len(matches) == 1 {
+			ids = append(ids, matches[0])
+		}
+	}
+	return store.UniqueIDs(ids), nil
+}
+
+// saveMentions заменяет упоминания комментария разобранными из его текста
+// и заполняет comment.MentionIDs.
+func saveMentions(tx store.Store, comment *models.Comment) error {
+	ids, err := resolveMentions(tx, parseMentions(comment.Content))
+	if err != nil {
+		return err
+	}
+	if err := tx.Comments().SetMentions(comment.ID, ids); err != nil {
+		return err
+	}
+	comment.MentionIDs = append([]uint{}, ids...)
+	return nil
+}
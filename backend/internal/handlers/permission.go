@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"crm-backend/internal/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Права доступа. Роль получает их через таблицу role_permissions.
+const (
+	PermCustomersRead   = "customers:read"
+	PermCustomersWrite  = "customers:write"
+	PermCustomersDelete = "customers:delete"
+	PermDealsRead       = "deals:read"
+	PermDealsWrite      = "deals:write"
+	PermDealsDelete     = "deals:delete"
+	PermRatesManage     = "exchange_rates:manage"
+	PermStatusesRead    = "statuses:read"
+	PermStatusesWrite   = "statuses:write"
+	PermStatusesDelete  = "statuses:delete"
+	PermTagsRead        = "tags:read"
+	PermTagsWrite       = "tags:write"
+	PermTagsDelete      = "tags:delete"
+	PermCommentsRead    = "comments:read"
+	PermCommentsWrite   = "comments:write"
+	PermCommentsDelete  = "comments:delete"
+	PermUsersRead       = "users:read"
+	PermUsersManage     = "users:manage"
+	PermRolesManage     = "roles:manage"
+	PermAuditRead       = "audit:read"
+)
+
+// Роль администратора имеет все права, включая добавленные позже,
+// и не может быть изменена или удалена.
+const AdminRole = "admin"
+
+// Роль, назначаемая при регистрации.
+const DefaultRole = "user"
+
+type permissionInfo struct {
+	Name        string
+	Description string
+}
+
+// permissionCatalog — все известные права; только их можно выдавать ролям.
+var permissionCatalog = []permissionInfo{
+	{PermCustomersRead, "Просмотр клиентов"},
+	{PermCustomersWrite, "Создание и изменение клиентов"},
+	{PermCustomersDelete, "Удаление клиентов"},
+	{PermDealsRead, "Просмотр сделок"},
+	{PermDealsWrite, "Создание и изменение сделок"},
+	{PermDealsDelete, "Удаление сделок"},
+	{PermRatesManage, "Управление курсами валют"},
+	{PermStatusesRead, "Просмотр статусов"},
+	{PermStatusesWrite, "Создание и изменение статусов"},
+	{PermStatusesDelete, "Удаление статусов"},
+	{PermTagsRead, "Просмотр тегов"},
+	{PermTagsWrite, "Создание и изменение тегов"},
+	{PermTagsDelete, "Удаление тегов"},
+	{PermCommentsRead, "Просмотр комментариев"},
+	{PermCommentsWrite, "Создание и изменение комментариев"},
+	{PermCommentsDelete, "Удаление комментариев"},
+	{PermUsersRead, "Просмотр пользователей"},
+	{PermUsersManage, "Управление пользователями"},
+	{PermRolesManage, "Управление ролями и правами"},
+	{PermAuditRead, "Просмотр журнала изменений"},
+}
+
+func knownPermission(name string) bool {
+	for _, p := range permissionCatalog {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// rolePermissions загружает права роли по её имени.
+func rolePermissions(st store.Store, role string) (map[string]bool, error) {
+	perms := map[string]bool{}
+	if role == AdminRole {
+		for _, p := range permissionCatalog {
+			perms[p.Name] = true
+		}
+		return perms, nil
+	}
+	names, err := st.Roles().Permissions(role)
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range names {
+		perms[n] = true
+	}
+	return perms, nil
+}
+
+// HasPermission сообщает, есть ли у текущего пользователя право perm.
+// Работает после JWTAuthMiddleware.
+func HasPermission(c *gin.Context, perm string) bool {
+	v, ok := c.Get("permissions")
+	if !ok {
+		return false
+	}
+	perms, _ := v.(map[string]bool)
+	return perms[perm]
+}
+
+// isAdmin сообщает, что текущий пользователь — администратор.
+func isAdmin(c *gin.Context) bool {
+	role, _ := c.Get("user_role")
+	return role == AdminRole
+}
+
+// RequirePermission пропускает запрос, только если у пользователя есть право perm.
+// Должен стоять после JWTAuthMiddleware.
+func RequirePermission(perm string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !HasPermission(c, perm) {
+			abortWithError(c, forbidden("auth.forbidden", perm))
+			return
+		}
+		c.Next()
+	}
+}
+
+// GetPermissions godoc
+// @Summary      Получить список прав
+// @Description  Возвращает все права, которые можно выдать ролям
+// @Tags         roles
+// @Produce      json
+// @Success      200  {array}   map[string]string
+// @Router       /permissions [get]
+func GetPermissions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// id нужен react-admin для ReferenceArrayInput
+		result := make([]gin.H, 0, len(permissionCatalog))
+		for _, p := range permissionCatalog {
+			result = append(result, gin.H{"id": p.Name, "name": p.Name, "description": p.Description})
+		}
+		c.Header("Content-Range", fmt.Sprintf("permissions 0-%d/%d", len(result)-1, len(result)))
+		c.Header("X-Total-Count", fmt.Sprint(len(result)))
+		c.JSON(http.StatusOK, result)
+	}
+}
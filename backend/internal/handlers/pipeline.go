@@ -0,0 +1,354 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"crm-backend/internal/models"
+	"crm-backend/internal/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+var pipelineList = store.ListSpec{
+	Resource:    "pipelines",
+	Table:       "pipelines",
+	Sortable:    []string{"id", "name", "position"},
+	Filterable:  []string{"name"},
+	Searchable:  []string{"name"},
+	DefaultSort: "position",
+}
+
+// applyStage привязывает сделку к воронке и этапу: подставляет первый открытый
+// этап, если он не задан, отклоняет этап из чужой воронки и выставляет ClosedAt
+// по типу этапа.
+func applyStage(st store.Store, deal *models.Deal) error {
+	if deal.StatusID == 0 {
+		if deal.PipelineID == 0 {
+			pipeline, err := st.Pipelines().Default()
+			if errors.Is(err, store.ErrNotFound) {
+				return conflict("pipeline.default_missing")
+			} else if err != nil {
+				return err
+			}
+			deal.PipelineID = pipeline.ID
+		}
+		first, err := st.Statuses().FirstOpen(deal.PipelineID)
+		if errors.Is(err, store.ErrNotFound) {
+			return invalidField("pipeline_id", "invalid", "pipeline.no_open_stages")
+		} else if err != nil {
+			return err
+		}
+		deal.StatusID = first.ID
+	}
+	stage, err := st.Statuses().Get(deal.StatusID)
+	if errors.Is(err, store.ErrNotFound) {
+		return invalidField("status_id", "not_found", "status.not_found")
+	} else if err != nil {
+		return err
+	}
+	if deal.PipelineID == 0 {
+		deal.PipelineID = stage.PipelineID
+	} else if stage.PipelineID != deal.PipelineID {
+		return invalidField("status_id", "invalid", "stage.wrong_pipeline")
+	}
+	if stage.Closed() {
+		if deal.ClosedAt == nil {
+			now := time.Now().Unix()
+			deal.ClosedAt = &now
+		}
+	} else {
+		deal.ClosedAt = nil
+	}
+	return nil
+}
+
+// pipelineInput — изменяемые поля воронки. Этапы меняются через /statuses и
+// /pipelines/{id}/reorder.
+type pipelineInput struct {
+	Name     string `json:"name"`
+	Position int    `json:"position"`
+}
+
+func (in *pipelineInput) load(m models.Pipeline) {
+	*in = pipelineInput{Name: m.Name, Position: m.Position}
+}
+
+func (in *pipelineInput) apply(m *models.Pipeline) {
+	m.Name, m.Position = in.Name, in.Position
+}
+
+// pipelineCreateInput — новая воронка вместе с этапами в порядке следования.
+type pipelineCreateInput struct {
+	pipelineInput
+	Stages []statusInput `json:"stages"`
+}
+
+func (in *pipelineCreateInput) load(m models.Pipeline) {
+	in.pipelineInput.load(m)
+}
+
+func (in *pipelineCreateInput) apply(m *models.Pipeline) {
+	in.pipelineInput.apply(m)
+	m.Stages = make([]models.Status, len(in.Stages))
+	for i := range in.Stages {
+		in.Stages[i].apply(&m.Stages[i])
+		m.Stages[i].Position = i
+		if m.Stages[i].Type == "" {
+			m.Stages[i].Type = models.StageOpen
+		}
+	}
+}
+
+func findPipeline(st store.Store, c *gin.Context) (models.Pipeline, bool) {
+	pipeline, err := st.Pipelines().Get(idParam(c, "id"))
+	if err != nil {
+		notFoundOr(c, err, "pipeline.not_found")
+		return pipeline, false
+	}
+	return pipeline, true
+}
+
+// GetPipelines godoc
+// @Summary      Получить список воронок
+// @Description  Возвращает воронки с этапами, упорядоченными по позиции
+// @Tags         pipelines
+// @Produce      json
+// @Param        sort    query     string  false  "Сортировка: [\"поле\",\"ASC|DESC\"]"
+// @Param        range   query     string  false  "Диапазон записей: [0,24]"
+// @Param        filter  query     string  false  "Фильтр: {\"q\":\"текст\",\"поле\":значение}"
+// @Success      200  {array}   models.Pipeline
+// @Header       200  {string}  Content-Range  "Диапазон и общее количество записей"
+// @Failure      400  {object}  errorBody
+// @Failure      500  {object}  errorBody
+// @Router       /pipelines [get]
+func GetPipelines(st store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		st := scoped(st, c)
+		q, err := parseListQuery(c, pipelineList)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		pipelines, total, err := st.Pipelines().List(q)
+		if err != nil {
+			internalError(c, err)
+			return
+		}
+		setContentRange(c, q, len(pipelines), total)
+		c.JSON(http.StatusOK, pipelines)
+	}
+}
+
+// GetPipeline godoc
+// @Summary      Получить воронку по ID
+// @Tags         pipelines
+// @Produce      json
+// @Param        id             path      int     true   "ID воронки"
+// @Param        If-None-Match  header    string  false  "ETag из прошлого ответа: 304, если запись не изменилась"
+// @Success      200            {object}  models.Pipeline
+// @Header       200            {string}  ETag    "Версия записи"
+// @Failure      404            {object}  errorBody
+// @Router       /pipelines/{id} [get]
+func GetPipeline(st store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		st := scoped(st, c)
+		pipeline, ok := findPipeline(st, c)
+		if !ok {
+			return
+		}
+		respondRecord(c, http.StatusOK, pipeline.Version, pipeline)
+	}
+}
+
+// CreatePipeline godoc
+// @Summary      Создать воронку
+// @Description  Создаёт воронку; этапы из stages создаются в переданном порядке
+// @Tags         pipelines
+// @Accept       json
+// @Produce      json
+// @Param        pipeline  body      pipelineCreateInput  true  "Данные воронки"
+// @Success      201       {object}  models.Pipeline
+// @Header       201       {string}  ETag                 "Версия записи"
+// @Failure      400       {object}  errorBody
+// @Router       /pipelines [post]
+func CreatePipeline(st store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		st := scoped(st, c)
+		var pipeline models.Pipeline
+		if !bindInput(c, &pipelineCreateInput{}, &pipeline) {
+			return
+		}
+		err := st.Tx(func(tx store.Store) error {
+			if err := tx.Pipelines().Create(&pipeline); err != nil {
+				return err
+			}
+			return audit(tx, c, "pipelines", pipeline.ID, nil, pipeline)
+		})
+		if err != nil {
+			internalError(c, err)
+			return
+		}
+		respondRecord(c, http.StatusCreated, pipeline.Version, pipeline)
+	}
+}
+
+// UpdatePipeline godoc
+// @Summary      Обновить воронку
+// @Description  Обновляет название и позицию воронки: PUT заменяет переданные поля, PATCH применяет JSON Merge Patch. Этапы меняются через /statuses и /pipelines/{id}/reorder.
+// @Tags         pipelines
+// @Accept       json
+// @Produce      json
+// @Param        id        path      int            true   "ID воронки"
+// @Param        pipeline  body      pipelineInput  true   "Данные воронки"
+// @Param        If-Match  header    string         false  "ETag записи: 412, если её успели изменить"
+// @Success      200       {object}  models.Pipeline
+// @Header       200       {string}  ETag           "Версия записи"
+// @Failure      400       {object}  errorBody
+// @Failure      404       {object}  errorBody
+// @Failure      412       {object}  errorBody
+// @Router       /pipelines/{id} [put]
+// @Router       /pipelines/{id} [patch]
+func UpdatePipeline(st store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		st := scoped(st, c)
+		pipeline, ok := findPipeline(st, c)
+		if !ok || !checkIfMatch(c, pipeline.Version) {
+			return
+		}
+		before := pipeline
+		if !bindInput(c, &pipelineInput{}, &pipeline) {
+			return
+		}
+		err := st.Tx(func(tx store.Store) error {
+			if err := tx.Pipelines().Update(&pipeline); err != nil {
+				return err
+			}
+			return audit(tx, c, "pipelines", pipeline.ID, before, pipeline)
+		})
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		respondRecord(c, http.StatusOK, pipeline.Version, pipeline)
+	}
+}
+
+// DeletePipeline godoc
+// @Summary      Удалить воронку
+// @Description  Удаляет воронку вместе с её этапами, если в ней нет сделок. Последнюю воронку удалить нельзя.
+// @Tags         pipelines
+// @Produce      json
+// @Param        id        path      int     true   "ID воронки"
+// @Param        If-Match  header    string  false  "ETag записи: 412, если её успели изменить"
+// @Success      204       {object}  nil
+// @Failure      404       {object}  errorBody
+// @Failure      409       {object}  errorBody
+// @Failure      412       {object}  errorBody
+// @Router       /pipelines/{id} [delete]
+func DeletePipeline(st store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		st := scoped(st, c)
+		pipeline, ok := findPipeline(st, c)
+		if !ok || !checkIfMatch(c, pipeline.Version) {
+			return
+		}
+		deals, err := st.Deals().CountInPipeline(pipeline.ID)
+		if err != nil {
+			internalError(c, err)
+			return
+		}
+		if deals > 0 {
+			abortWithError(c, conflict("pipeline.has_deals").withMeta("deals", deals))
+			return
+		}
+		pipelines, err := st.Pipelines().Count()
+		if err != nil {
+			internalError(c, err)
+			return
+		}
+		if pipelines <= 1 {
+			abortWithError(c, conflict("pipeline.last"))
+			return
+		}
+		err = st.Tx(func(tx store.Store) error {
+			if err := tx.Pipelines().Delete(pipeline.ID); err != nil {
+				return err
+			}
+			return audit(tx, c, "pipelines", pipeline.ID, pipeline, nil)
+		})
+		if err != nil {
+			internalError(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+var errStageSet = invalidField("stage_ids", "invalid", "pipeline.stage_set")
+
+// ReorderStages godoc
+// @Summary      Изменить порядок этапов воронки
+// @Description  Принимает полный список ID этапов воронки в новом порядке
+// @Tags         pipelines
+// @Accept       json
+// @Produce      json
+// @Param        id        path      int                true   "ID воронки"
+// @Param        body      body      map[string][]uint  true   "stage_ids — ID этапов в новом порядке"
+// @Param        If-Match  header    string             false  "ETag записи: 412, если её успели изменить"
+// @Success      200       {object}  models.Pipeline
+// @Header       200       {string}  ETag               "Версия записи"
+// @Failure      400       {object}  errorBody
+// @Failure      404       {object}  errorBody
+// @Failure      412       {object}  errorBody
+// @Router       /pipelines/{id}/reorder [post]
+func ReorderStages(st store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		st := scoped(st, c)
+		pipeline, ok := findPipeline(st, c)
+		if !ok || !checkIfMatch(c, pipeline.Version) {
+			return
+		}
+		var body struct {
+			StageIDs []uint `json:"stage_ids" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			bindError(c, err)
+			return
+		}
+		if len(body.StageIDs) != len(pipeline.Stages) {
+			abortWithError(c, errStageSet)
+			return
+		}
+		known := map[uint]bool{}
+		for _, s := range pipeline.Stages {
+			known[s.ID] = true
+		}
+		for _, id := range body.StageIDs {
+			if !known[id] {
+				abortWithError(c, errStageSet)
+				return
+			}
+			delete(known, id)
+		}
+		order := make([]uint, len(pipeline.Stages))
+		for i, s := range pipeline.Stages {
+			order[i] = s.ID
+		}
+		err := st.Tx(func(tx store.Store) error {
+			if err := tx.Statuses().SetPositions(body.StageIDs); err != nil {
+				return err
+			}
+			return audit(tx, c, "pipelines", pipeline.ID, gin.H{"stage_ids": order}, gin.H{"stage_ids": body.StageIDs})
+		})
+		if err != nil {
+			internalError(c, err)
+			return
+		}
+		pipeline, ok = findPipeline(st, c)
+		if ok {
+			respondRecord(c, http.StatusOK, pipeline.Version, pipeline)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"crm-backend/internal/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Максимальный размер одной страницы, чтобы клиент не мог выгрузить всю таблицу.
+const maxPageSize = 1000
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// parseListQuery разбирает параметры списка и проверяет их по белым спискам spec.
+func parseListQuery(c *gin.Context, spec store.ListSpec) (store.ListQuery, error) {
+	q := store.NewListQuery(spec)
+
+	if raw := c.Query("sort"); raw != "" {
+		var sort []string
+		if err := json.Unmarshal([]byte(raw), &sort); err != nil || len(sort) != 2 {
+			return q, badRequest("query.sort_invalid")
+		}
+		if !contains(spec.Sortable, sort[0]) {
+			return q, badRequest("query.sort_field", sort[0])
+		}
+		order := strings.ToUpper(sort[1])
+		if order != "ASC" && order != "DESC" {
+			return q, badRequest("query.sort_order")
+		}
+		q.SortField, q.SortOrder = sort[0], order
+	}
+
+	if raw := c.Query("range"); raw != "" {
+		var rng []int
+		if err := json.Unmarshal([]byte(raw), &rng); err != nil || len(rng) != 2 {
+			return q, badRequest("query.range_invalid")
+		}
+		if rng[0] < 0 || rng[1] < rng[0] {
+			return q, badRequest("query.range_invalid")
+		}
+		if rng[1]-rng[0]+1 > maxPageSize {
+			rng[1] = rng[0] + maxPageSize - 1
+		}
+		q.Start, q.End, q.HasRange = rng[0], rng[1], true
+	}
+
+	if raw := c.Query("filter"); raw != "" {
+		var filter map[string]interface{}
+		if err := json.Unmarshal([]byte(raw), &filter); err != nil {
+			return q, badRequest("query.filter_invalid")
+		}
+		if err := applyFilter(&q, filter); err != nil {
+			return q, err
+		}
+	}
+	return q, nil
+}
+
+// applyFilter переносит в q разобранный фильтр списка, проверяя поля по
+// белому списку q.Spec.
+func applyFilter(q *store.ListQuery, filter map[string]interface{}) error {
+	spec := q.Spec
+	for field, value := range filter {
+		if field == "q" {
+			s, ok := value.(string)
+			if !ok {
+				return badRequest("query.q_string")
+			}
+			q.Search = strings.TrimSpace(s)
+			continue
+		}
+		if spec.TagTable != "" && (field == "tag_ids" || field == "tag_match") {
+			if err := parseTagFilter(q, field, value); err != nil {
+				return err
+			}
+			continue
+		}
+		if field != "id" && !contains(spec.Filterable, field) {
+			return badRequest("query.filter_field", field)
+		}
+		if _, ok := value.(map[string]interface{}); ok {
+			return badRequest("query.filter_value", field)
+		}
+		q.Filters[field] = value
+	}
+	return nil
+}
+
+// parseTagFilter разбирает tag_ids (число или массив чисел) и tag_match.
+func parseTagFilter(q *store.ListQuery, field string, value interface{}) error {
+	if field == "tag_match" {
+		switch value {
+		case "any", nil:
+			q.TagAll = false
+		case "all":
+			q.TagAll = true
+		default:
+			return badRequest("query.tag_match")
+		}
+		return nil
+	}
+	values, ok := value.([]interface{})
+	if !ok {
+		values = []interface{}{value}
+	}
+	q.TagIDs = q.TagIDs[:0]
+	for _, v := range values {
+		n, ok := v.(float64)
+		if !ok || n < 1 || n != float64(uint(n)) {
+			return badRequest("query.tag_ids")
+		}
+		q.TagIDs = append(q.TagIDs, uint(n))
+	}
+	return nil
+}
+
+// setContentRange выставляет заголовки, по которым ra-data-simple-rest
+// определяет общее количество записей.
+func setContentRange(c *gin.Context, q store.ListQuery, count int, total int64) {
+	if count == 0 {
+		c.Header("Content-Range", fmt.Sprintf("%s */%d", q.Spec.Resource, total))
+	} else {
+		c.Header("Content-Range", fmt.Sprintf("%s %d-%d/%d", q.Spec.Resource, q.Start, q.Start+count-1, total))
+	}
+	c.Header("X-Total-Count", fmt.Sprint(total))
+}
+
+// idParam разбирает идентификатор из пути; для некорректного значения
+// возвращает 0, которому не соответствует ни одна запись.
+func idParam(c *gin.Context, name string) uint {
+	id, err := strconv.ParseUint(c.Param(name), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return uint(id)
+}
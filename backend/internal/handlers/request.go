@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"crm-backend/internal/logging"
+	"crm-backend/internal/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestIDHeader — заголовок с идентификатором запроса. Клиент или прокси
+// может передать свой, иначе он генерируется; в ответе он возвращается всегда.
+const RequestIDHeader = "X-Request-ID"
+
+// RequestLogger присваивает запросу идентификатор и после обработки пишет в
+// журнал метод, маршрут, статус, длительность и пользователя. Ошибки,
+// переданные через internalError, попадают в ту же запись.
+func RequestLogger(logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		c.Header(RequestIDHeader, id)
+		c.Set("request_id", id)
+		ctx := logging.WithRequestID(c.Request.Context(), id)
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		status := c.Writer.Status()
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("route", c.FullPath()),
+			slog.String("path", c.Request.URL.Path),
+			slog.Int("status", status),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.Int("bytes", max(c.Writer.Size(), 0)),
+			slog.String("ip", c.ClientIP()),
+		}
+		if userID := currentUserID(c); userID != nil {
+			attrs = append(attrs, slog.Uint64("user_id", uint64(*userID)))
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("error", strings.Join(c.Errors.Errors(), "; ")))
+		}
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+		logger.LogAttrs(ctx, level, "HTTP-запрос", attrs...)
+	}
+}
+
+// Recovery перехватывает панику обработчика: стек пишется в журнал, клиент
+// получает 500 с идентификатором запроса.
+func Recovery(logger *slog.Logger) gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, rec any) {
+		logger.ErrorContext(c.Request.Context(), "Паника при обработке запроса",
+			"panic", fmt.Sprint(rec), "stack", string(debug.Stack()))
+		internalError(c, fmt.Errorf("panic: %v", rec))
+	})
+}
+
+// scoped привязывает хранилище к контексту запроса.
+func scoped(st store.Store, c *gin.Context) store.Store {
+	return st.WithContext(c.Request.Context())
+}
+
+// validRequestID допускает короткие идентификаторы из безопасных символов,
+// чтобы чужой заголовок не испортил журнал.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.', r == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,307 @@
+package handlers
+
+import (
+	"net/http"
+
+	"crm-backend/internal/models"
+	"crm-backend/internal/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+var roleList = store.ListSpec{
+	Resource:   "roles",
+	Table:      "roles",
+	Sortable:   []string{"id", "name"},
+	Filterable: []string{"name"},
+	Searchable: []string{"name", "description"},
+}
+
+// roleInput — тело запроса на создание и изменение роли.
+type roleInput struct {
+	Name        string   `json:"name" binding:"required,max=64"`
+	Description string   `json:"description" binding:"max=1000"`
+	Permissions []string `json:"permissions"`
+}
+
+func (in *roleInput) load(m models.Role) {
+	*in = roleInput{Name: m.Name, Description: m.Description, Permissions: m.Permissions}
+}
+
+func (in *roleInput) apply(m *models.Role) {
+	m.Name, m.Description, m.Permissions = in.Name, in.Description, in.Permissions
+}
+
+// validate проверяет, что все права роли известны.
+func (in roleInput) validate() error {
+	for _, p := range in.Permissions {
+		if !knownPermission(p) {
+			return invalidField("permissions", "oneof", "role.unknown_permission", p)
+		}
+	}
+	return nil
+}
+
+// fillPermissions переносит выданные права из Grants в поле Permissions.
+func fillPermissions(roles []models.Role) {
+	for i := range roles {
+		roles[i].Permissions = make([]string, 0, len(roles[i].Grants))
+		if roles[i].Name == AdminRole {
+			for _, p := range permissionCatalog {
+				roles[i].Permissions = append(roles[i].Permissions, p.Name)
+			}
+			continue
+		}
+		for _, g := range roles[i].Grants {
+			roles[i].Permissions = append(roles[i].Permissions, g.Permission)
+		}
+	}
+}
+
+func saveGrants(tx store.Store, role *models.Role, perms []string) error {
+	role.Grants = nil
+	seen := map[string]bool{}
+	for _, p := range perms {
+		if seen[p] {
+			continue
+		}
+		seen[p] = true
+		role.Grants = append(role.Grants, models.RolePermission{RoleID: role.ID, Permission: p})
+	}
+	return tx.Roles().SetGrants(role)
+}
+
+// GetRoles godoc
+// @Summary      Получить список ролей
+// @Description  Возвращает роли с их правами
+// @Tags         roles
+// @Produce      json
+// @Param        sort    query     string  false  "Сортировка: [\"поле\",\"ASC|DESC\"]"
+// @Param        range   query     string  false  "Диапазон записей: [0,24]"
+// @Param        filter  query     string  false  "Фильтр: {\"q\":\"текст\",\"поле\":значение}"
+// @Success      200  {array}   models.Role
+// @Header       200  {string}  Content-Range  "Диапазон и общее количество записей"
+// @Failure      400  {object}  errorBody
+// @Failure      500  {object}  errorBody
+// @Router       /roles [get]
+func GetRoles(st store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		st := scoped(st, c)
+		q, err := parseListQuery(c, roleList)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		roles, total, err := st.Roles().List(q)
+		if err != nil {
+			internalError(c, err)
+			return
+		}
+		fillPermissions(roles)
+		setContentRange(c, q, len(roles), total)
+		c.JSON(http.StatusOK, roles)
+	}
+}
+
+// GetRole godoc
+// @Summary      Получить роль по ID
+// @Tags         roles
+// @Produce      json
+// @Param        id             path      int     true   "ID роли"
+// @Param        If-None-Match  header    string  false  "ETag из прошлого ответа: 304, если запись не изменилась"
+// @Success      200            {object}  models.Role
+// @Header       200            {string}  ETag    "Версия записи"
+// @Failure      404            {object}  errorBody
+// @Router       /roles/{id} [get]
+func GetRole(st store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		st := scoped(st, c)
+		role, ok := findRole(st, c)
+		if !ok {
+			return
+		}
+		roles := []models.Role{role}
+		fillPermissions(roles)
+		respondRecord(c, http.StatusOK, role.Version, roles[0])
+	}
+}
+
+// CreateRole godoc
+// @Summary      Создать роль
+// @Tags         roles
+// @Accept       json
+// @Produce      json
+// @Param        role  body      roleInput  true  "Название, описание и права"
+// @Success      201   {object}  models.Role
+// @Header       201   {string}  ETag       "Версия записи"
+// @Failure      400   {object}  errorBody
+// @Router       /roles [post]
+func CreateRole(st store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		st := scoped(st, c)
+		var input roleInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			bindError(c, err)
+			return
+		}
+		if err := input.validate(); err != nil {
+			writeError(c, err)
+			return
+		}
+		if exists, err := roleExists(st, input.Name); err != nil {
+			internalError(c, err)
+			return
+		} else if exists {
+			abortWithError(c, conflict("role.name_taken"))
+			return
+		}
+		role := models.Role{Name: input.Name, Description: input.Description}
+		err := st.Tx(func(tx store.Store) error {
+			if err := tx.Roles().Create(&role); err != nil {
+				return err
+			}
+			return saveGrants(tx, &role, input.Permissions)
+		})
+		if err != nil {
+			internalError(c, err)
+			return
+		}
+		roles := []models.Role{role}
+		fillPermissions(roles)
+		respondRecord(c, http.StatusCreated, role.Version, roles[0])
+	}
+}
+
+// UpdateRole godoc
+// @Summary      Обновить роль
+// @Description  PUT заменяет переданные поля роли, PATCH применяет JSON Merge Patch. Роль admin изменить нельзя.
+// @Tags         roles
+// @Accept       json
+// @Produce      json
+// @Param        id        path      int        true   "ID роли"
+// @Param        role      body      roleInput  true   "Название, описание и права"
+// @Param        If-Match  header    string     false  "ETag записи: 412, если её успели изменить"
+// @Success      200       {object}  models.Role
+// @Header       200       {string}  ETag       "Версия записи"
+// @Failure      400       {object}  errorBody
+// @Failure      404       {object}  errorBody
+// @Failure      412       {object}  errorBody
+// @Router       /roles/{id} [put]
+// @Router       /roles/{id} [patch]
+func UpdateRole(st store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		st := scoped(st, c)
+		role, ok := findRole(st, c)
+		if !ok {
+			return
+		}
+		if role.Name == AdminRole {
+			abortWithError(c, conflict("role.admin_immutable"))
+			return
+		}
+		if !checkIfMatch(c, role.Version) {
+			return
+		}
+		oldName := role.Name
+		roles := []models.Role{role}
+		fillPermissions(roles)
+		role = roles[0]
+		var input roleInput
+		if !bindInput(c, &input, &role) {
+			return
+		}
+		if err := input.validate(); err != nil {
+			writeError(c, err)
+			return
+		}
+		if oldName == DefaultRole && role.Name != DefaultRole {
+			abortWithError(c, conflict("role.default_rename"))
+			return
+		}
+		if role.Name != oldName {
+			if exists, err := roleExists(st, role.Name); err != nil {
+				internalError(c, err)
+				return
+			} else if exists {
+				abortWithError(c, conflict("role.name_taken"))
+				return
+			}
+		}
+		err := st.Tx(func(tx store.Store) error {
+			if err := tx.Roles().Update(&role); err != nil {
+				return err
+			}
+			// Пользователи ссылаются на роль по имени
+			if oldName != role.Name {
+				if err := tx.Users().RenameRole(oldName, role.Name); err != nil {
+					return err
+				}
+			}
+			return saveGrants(tx, &role, role.Permissions)
+		})
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		roles = []models.Role{role}
+		fillPermissions(roles)
+		respondRecord(c, http.StatusOK, role.Version, roles[0])
+	}
+}
+
+// DeleteRole godoc
+// @Summary      Удалить роль
+// @Description  Удаляет роль, если она не назначена ни одному пользователю. Роли admin и user удалить нельзя.
+// @Tags         roles
+// @Produce      json
+// @Param        id        path      int     true   "ID роли"
+// @Param        If-Match  header    string  false  "ETag записи: 412, если её успели изменить"
+// @Success      204       {object}  nil
+// @Failure      400       {object}  errorBody
+// @Failure      404       {object}  errorBody
+// @Failure      412       {object}  errorBody
+// @Router       /roles/{id} [delete]
+func DeleteRole(st store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		st := scoped(st, c)
+		role, ok := findRole(st, c)
+		if !ok {
+			return
+		}
+		if role.Name == AdminRole || role.Name == DefaultRole {
+			abortWithError(c, conflict("role.builtin_delete"))
+			return
+		}
+		if !checkIfMatch(c, role.Version) {
+			return
+		}
+		users, err := st.Users().CountWithRole(role.Name)
+		if err != nil {
+			internalError(c, err)
+			return
+		}
+		if users > 0 {
+			abortWithError(c, conflict("role.in_use").withMeta("users", users))
+			return
+		}
+		if err := st.Roles().Delete(role.ID); err != nil {
+			internalError(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// roleExists проверяет, что роль с таким именем есть в базе.
+func roleExists(st store.Store, name string) (bool, error) {
+	return st.Roles().Exists(name)
+}
+
+func findRole(st store.Store, c *gin.Context) (models.Role, bool) {
+	role, err := st.Roles().Get(idParam(c, "id"))
+	if err != nil {
+		notFoundOr(c, err, "role.not_found")
+		return role, false
+	}
+	return role, true
+}
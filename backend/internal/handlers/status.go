@@ -1,28 +1,99 @@
 package handlers
 
 import (
-	"crm-backend/internal/models"
+	"errors"
 	"net/http"
 
+	"crm-backend/internal/models"
+	"crm-backend/internal/store"
+
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 )
 
+var statusList = store.ListSpec{
+	Resource:    "statuses",
+	Table:       "statuses",
+	Sortable:    []string{"id", "name", "color", "pipeline_id", "position", "probability", "type"},
+	Filterable:  []string{"name", "color", "pipeline_id", "type"},
+	Searchable:  []string{"name"},
+	DefaultSort: "position",
+}
+
+// statusInput — изменяемые поля этапа.
+type statusInput struct {
+	Name        string `json:"name"`
+	Color       string `json:"color"`
+	PipelineID  uint   `json:"pipeline_id"`
+	Position    int    `json:"position"`
+	Probability int    `json:"probability"`
+	Type        string `json:"type"`
+}
+
+func (in *statusInput) load(m models.Status) {
+	*in = statusInput{Name: m.Name, Color: m.Color, PipelineID: m.PipelineID, Position: m.Position, Probability: m.Probability, Type: m.Type}
+}
+
+func (in *statusInput) apply(m *models.Status) {
+	m.Name, m.Color, m.PipelineID, m.Position, m.Probability, m.Type = in.Name, in.Color, in.PipelineID, in.Position, in.Probability, in.Type
+}
+
+// prepareStatus проверяет этап перед сохранением: воронка существует, пустой
+// тип означает open. Новому этапу без позиции назначается место в конце воронки.
+func prepareStatus(st store.Store, status *models.Status, isNew bool) error {
+	if status.Type == "" {
+		status.Type = models.StageOpen
+	}
+	if status.PipelineID == 0 {
+		pipeline, err := st.Pipelines().Default()
+		if errors.Is(err, store.ErrNotFound) {
+			return conflict("pipeline.default_missing")
+		} else if err != nil {
+			return err
+		}
+		status.PipelineID = pipeline.ID
+	}
+	if _, err := st.Pipelines().Get(status.PipelineID); errors.Is(err, store.ErrNotFound) {
+		return invalidField("pipeline_id", "not_found", "pipeline.not_found")
+	} else if err != nil {
+		return err
+	}
+	if isNew && status.Position == 0 {
+		next, err := st.Statuses().NextPosition(status.PipelineID)
+		if err != nil {
+			return err
+		}
+		status.Position = next
+	}
+	return nil
+}
+
 // GetStatuses godoc
 // @Summary      Получить список статусов
-// @Description  Возвращает все статусы
+// @Description  Возвращает статусы с сортировкой, пагинацией и фильтрами
 // @Tags         statuses
 // @Produce      json
+// @Param        sort    query     string  false  "Сортировка: [\"поле\",\"ASC|DESC\"]"
+// @Param        range   query     string  false  "Диапазон записей: [0,24]"
+// @Param        filter  query     string  false  "Фильтр: {\"q\":\"текст\",\"поле\":значение}"
 // @Success      200  {array}   models.Status
-// @Failure      500  {object}  map[string]string
+// @Header       200  {string}  Content-Range  "Диапазон и общее количество записей"
+// @Failure      400  {object}  errorBody
+// @Failure      500  {object}  errorBody
 // @Router       /statuses [get]
-func GetStatuses(db *gorm.DB) gin.HandlerFunc {
+func GetStatuses(st store.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var statuses []models.Status
-		if err := db.Find(&statuses).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		st := scoped(st, c)
+		q, err := parseListQuery(c, statusList)
+		if err != nil {
+			writeError(c, err)
 			return
 		}
+		statuses, total, err := st.Statuses().List(q)
+		if err != nil {
+			internalError(c, err)
+			return
+		}
+		setContentRange(c, q, len(statuses), total)
 		c.JSON(http.StatusOK, statuses)
 	}
 }
@@ -32,19 +103,21 @@ func GetStatuses(db *gorm.DB) gin.HandlerFunc {
 // @Description  Возвращает статус по идентификатору
 // @Tags         statuses
 // @Produce      json
-// @Param        id   path      int  true  "ID статуса"
-// @Success      200  {object}  models.Status
-// @Failure      404  {object}  map[string]string
+// @Param        id             path      int     true   "ID статуса"
+// @Param        If-None-Match  header    string  false  "ETag из прошлого ответа: 304, если запись не изменилась"
+// @Success      200            {object}  models.Status
+// @Header       200            {string}  ETag    "Версия записи"
+// @Failure      404            {object}  errorBody
 // @Router       /statuses/{id} [get]
-func GetStatus(db *gorm.DB) gin.HandlerFunc {
+func GetStatus(st store.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var status models.Status
-		id := c.Param("id")
-		if err := db.First(&status, id).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Статус не найден"})
+		st := scoped(st, c)
+		status, err := st.Statuses().Get(idParam(c, "id"))
+		if err != nil {
+			notFoundOr(c, err, "status.not_found")
 			return
 		}
-		c.JSON(http.StatusOK, status)
+		respondRecord(c, http.StatusOK, status.Version, status)
 	}
 }
 
@@ -54,75 +127,166 @@ func GetStatus(db *gorm.DB) gin.HandlerFunc {
 // @Tags         statuses
 // @Accept       json
 // @Produce      json
-// @Param        status  body      models.Status  true  "Данные статуса"
+// @Param        status  body      statusInput  true  "Данные статуса"
 // @Success      201     {object}  models.Status
-// @Failure      400     {object}  map[string]string
+// @Header       201     {string}  ETag         "Версия записи"
+// @Failure      400     {object}  errorBody
 // @Router       /statuses [post]
-func CreateStatus(db *gorm.DB) gin.HandlerFunc {
+func CreateStatus(st store.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		st := scoped(st, c)
 		var status models.Status
-		if err := c.ShouldBindJSON(&status); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		if !bindInput(c, &statusInput{}, &status) {
 			return
 		}
-		if err := db.Create(&status).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if err := prepareStatus(st, &status, true); err != nil {
+			writeError(c, err)
 			return
 		}
-		c.JSON(http.StatusCreated, status)
+		err := st.Tx(func(tx store.Store) error {
+			if err := tx.Statuses().Create(&status); err != nil {
+				return err
+			}
+			return audit(tx, c, "statuses", status.ID, nil, status)
+		})
+		if err != nil {
+			internalError(c, err)
+			return
+		}
+		respondRecord(c, http.StatusCreated, status.Version, status)
 	}
 }
 
 // UpdateStatus godoc
 // @Summary      Обновить статус
-// @Description  Обновляет данные статуса по ID
+// @Description  PUT заменяет переданные поля статуса, PATCH применяет JSON Merge Patch
 // @Tags         statuses
 // @Accept       json
 // @Produce      json
-// @Param        id      path      int           true  "ID статуса"
-// @Param        status  body      models.Status true  "Данные статуса"
-// @Success      200     {object}  models.Status
-// @Failure      400     {object}  map[string]string
-// @Failure      404     {object}  map[string]string
+// @Param        id        path      int          true   "ID статуса"
+// @Param        status    body      statusInput  true   "Данные статуса"
+// @Param        If-Match  header    string       false  "ETag записи: 412, если её успели изменить"
+// @Success      200       {object}  models.Status
+// @Header       200       {string}  ETag         "Версия записи"
+// @Failure      400       {object}  errorBody
+// @Failure      404       {object}  errorBody
+// @Failure      412       {object}  errorBody
 // @Router       /statuses/{id} [put]
-func UpdateStatus(db *gorm.DB) gin.HandlerFunc {
+// @Router       /statuses/{id} [patch]
+func UpdateStatus(st store.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var status models.Status
-		id := c.Param("id")
-		if err := db.First(&status, id).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Статус не найден"})
+		st := scoped(st, c)
+		status, err := st.Statuses().Get(idParam(c, "id"))
+		if err != nil {
+			notFoundOr(c, err, "status.not_found")
 			return
 		}
-		if err := c.ShouldBindJSON(&status); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		if !checkIfMatch(c, status.Version) {
 			return
 		}
-		if err := db.Save(&status).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		before := status
+		if !bindInput(c, &statusInput{}, &status) {
+			return
+		}
+		if err := prepareStatus(st, &status, false); err != nil {
+			writeError(c, err)
+			return
+		}
+		// Перенос этапа в другую воронку оставил бы сделки с чужим этапом
+		if status.PipelineID != before.PipelineID {
+			deals, err := st.Deals().CountInStage(status.ID)
+			if err != nil {
+				internalError(c, err)
+				return
+			}
+			if deals > 0 {
+				abortWithError(c, conflict("stage.pipeline_locked").withMeta("deals", deals))
+				return
+			}
+		}
+		err = st.Tx(func(tx store.Store) error {
+			if err := tx.Statuses().Update(&status); err != nil {
+				return err
+			}
+			return audit(tx, c, "statuses", status.ID, before, status)
+		})
+		if err != nil {
+			writeError(c, err)
 			return
 		}
-		c.JSON(http.StatusOK, status)
+		respondRecord(c, http.StatusOK, status.Version, status)
 	}
 }
 
 // DeleteStatus godoc
 // @Summary      Удалить статус
-// @Description  Удаляет статус по ID
+// @Description  Удаляет этап по ID. Если на этапе есть сделки, их нужно перенести на другой этап той же воронки, указав move_to; иначе 409 со списком сделок. cascade не поддерживается: сделки без этапа не остаются.
 // @Tags         statuses
 // @Produce      json
-// @Param        id   path      int  true  "ID статуса"
-// @Success      204  {object}  nil
-// @Failure      500  {object}  map[string]string
+// @Param        id        path      int     true   "ID статуса"
+// @Param        move_to   query     int     false  "ID этапа, на который переносятся сделки"
+// @Param        If-Match  header    string  false  "ETag записи: 412, если её успели изменить"
+// @Success      204       {object}  nil
+// @Failure      400       {object}  errorBody
+// @Failure      404       {object}  errorBody
+// @Failure      409       {object}  errorBody
+// @Failure      412       {object}  errorBody
+// @Failure      500       {object}  errorBody
 // @Router       /statuses/{id} [delete]
-func DeleteStatus(db *gorm.DB) gin.HandlerFunc {
+func DeleteStatus(st store.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if !IsAdmin(c) {
-			c.JSON(403, gin.H{"error": "Только администратор может удалять статусы"})
+		st := scoped(st, c)
+		policy, ok := parseDeletePolicy(c)
+		if !ok {
 			return
 		}
-		id := c.Param("id")
-		if err := db.Delete(&models.Status{}, id).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		// Сделки не могут остаться без этапа, поэтому удалять их вместе с ним нельзя
+		if policy.cascade {
+			abortWithError(c, badRequest("stage.cascade_unsupported"))
+			return
+		}
+		status, err := st.Statuses().Get(idParam(c, "id"))
+		if err != nil {
+			notFoundOr(c, err, "status.not_found")
+			return
+		}
+		if !checkIfMatch(c, status.Version) {
+			return
+		}
+		blockers, deals, err := dealBlockers(st, "status_id", status.ID)
+		if err != nil {
+			internalError(c, err)
+			return
+		}
+		var target models.Status
+		if deals > 0 {
+			if policy.restricts() {
+				abortWithError(c, conflict("stage.has_deals").withMeta("deals", deals).withMeta("blockers", blockers))
+				return
+			}
+			target, err = st.Statuses().Get(policy.moveTo)
+			if err != nil && !errors.Is(err, store.ErrNotFound) {
+				internalError(c, err)
+				return
+			}
+			if err != nil || target.ID == status.ID || target.PipelineID != status.PipelineID {
+				abortWithError(c, badRequest("stage.move_to_invalid"))
+				return
+			}
+		}
+		err = st.Tx(func(tx store.Store) error {
+			if deals > 0 {
+				if err := tx.Deals().MoveToStage(status.ID, target, currentUserID(c)); err != nil {
+					return err
+				}
+			}
+			if err := tx.Statuses().Delete(status.ID); err != nil {
+				return err
+			}
+			return audit(tx, c, "statuses", status.ID, status, nil)
+		})
+		if err != nil {
+			internalError(c, err)
 			return
 		}
 		c.Status(http.StatusNoContent)
@@ -1,28 +1,58 @@
 package handlers
 
 import (
-	"crm-backend/internal/models"
 	"net/http"
 
+	"crm-backend/internal/models"
+	"crm-backend/internal/store"
+
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 )
 
+var tagList = store.ListSpec{
+	Resource:   "tags",
+	Table:      "tags",
+	Sortable:   []string{"id", "name"},
+	Filterable: []string{"name"},
+	Searchable: []string{"name"},
+}
+
+// tagInput — изменяемые поля тега.
+type tagInput struct {
+	Name string `json:"name"`
+}
+
+func (in *tagInput) load(m models.Tag) { in.Name = m.Name }
+
+func (in *tagInput) apply(m *models.Tag) { m.Name = in.Name }
+
 // GetTags godoc
 // @Summary      Получить список тегов
-// @Description  Возвращает все теги
+// @Description  Возвращает теги с сортировкой, пагинацией и фильтрами
 // @Tags         tags
 // @Produce      json
+// @Param        sort    query     string  false  "Сортировка: [\"поле\",\"ASC|DESC\"]"
+// @Param        range   query     string  false  "Диапазон записей: [0,24]"
+// @Param        filter  query     string  false  "Фильтр: {\"q\":\"текст\",\"поле\":значение}"
 // @Success      200  {array}   models.Tag
-// @Failure      500  {object}  map[string]string
+// @Header       200  {string}  Content-Range  "Диапазон и общее количество записей"
+// @Failure      400  {object}  errorBody
+// @Failure      500  {object}  errorBody
 // @Router       /tags [get]
-func GetTags(db *gorm.DB) gin.HandlerFunc {
+func GetTags(st store.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var tags []models.Tag
-		if err := db.Preload("Deals").Find(&tags).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		st := scoped(st, c)
+		q, err := parseListQuery(c, tagList)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		tags, total, err := st.Tags().List(q)
+		if err != nil {
+			internalError(c, err)
 			return
 		}
+		setContentRange(c, q, len(tags), total)
 		c.JSON(http.StatusOK, tags)
 	}
 }
@@ -32,19 +62,21 @@ func GetTags(db *gorm.DB) gin.HandlerFunc {
 // @Description  Возвращает тег по идентификатору
 // @Tags         tags
 // @Produce      json
-// @Param        id   path      int  true  "ID тега"
-// @Success      200  {object}  models.Tag
-// @Failure      404  {object}  map[string]string
+// @Param        id             path      int     true   "ID тега"
+// @Param        If-None-Match  header    string  false  "ETag из прошлого ответа: 304, если запись не изменилась"
+// @Success      200            {object}  models.Tag
+// @Header       200            {string}  ETag    "Версия записи"
+// @Failure      404            {object}  errorBody
 // @Router       /tags/{id} [get]
-func GetTag(db *gorm.DB) gin.HandlerFunc {
+func GetTag(st store.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var tag models.Tag
-		id := c.Param("id")
-		if err := db.Preload("Deals").First(&tag, id).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Тег не найден"})
+		st := scoped(st, c)
+		tag, err := st.Tags().Get(idParam(c, "id"))
+		if err != nil {
+			notFoundOr(c, err, "tag.not_found")
 			return
 		}
-		c.JSON(http.StatusOK, tag)
+		respondRecord(c, http.StatusOK, tag.Version, tag)
 	}
 }
 
@@ -54,54 +86,74 @@ func GetTag(db *gorm.DB) gin.HandlerFunc {
 // @Tags         tags
 // @Accept       json
 // @Produce      json
-// @Param        tag  body      models.Tag  true  "Данные тега"
+// @Param        tag  body      tagInput  true  "Данные тега"
 // @Success      201  {object}  models.Tag
-// @Failure      400  {object}  map[string]string
+// @Header       201  {string}  ETag      "Версия записи"
+// @Failure      400  {object}  errorBody
 // @Router       /tags [post]
-func CreateTag(db *gorm.DB) gin.HandlerFunc {
+func CreateTag(st store.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		st := scoped(st, c)
 		var tag models.Tag
-		if err := c.ShouldBindJSON(&tag); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		if !bindInput(c, &tagInput{}, &tag) {
 			return
 		}
-		if err := db.Create(&tag).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		err := st.Tx(func(tx store.Store) error {
+			if err := tx.Tags().Create(&tag); err != nil {
+				return err
+			}
+			return audit(tx, c, "tags", tag.ID, nil, tag)
+		})
+		if err != nil {
+			internalError(c, err)
 			return
 		}
-		c.JSON(http.StatusCreated, tag)
+		respondRecord(c, http.StatusCreated, tag.Version, tag)
 	}
 }
 
 // UpdateTag godoc
 // @Summary      Обновить тег
-// @Description  Обновляет данные тега по ID
+// @Description  PUT и PATCH меняют название тега
 // @Tags         tags
 // @Accept       json
 // @Produce      json
-// @Param        id   path      int       true  "ID тега"
-// @Param        tag  body      models.Tag  true  "Данные тега"
-// @Success      200  {object}  models.Tag
-// @Failure      400  {object}  map[string]string
-// @Failure      404  {object}  map[string]string
+// @Param        id        path      int       true   "ID тега"
+// @Param        tag       body      tagInput  true   "Данные тега"
+// @Param        If-Match  header    string    false  "ETag записи: 412, если её успели изменить"
+// @Success      200       {object}  models.Tag
+// @Header       200       {string}  ETag      "Версия записи"
+// @Failure      400       {object}  errorBody
+// @Failure      404       {object}  errorBody
+// @Failure      412       {object}  errorBody
 // @Router       /tags/{id} [put]
-func UpdateTag(db *gorm.DB) gin.HandlerFunc {
+// @Router       /tags/{id} [patch]
+func UpdateTag(st store.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var tag models.Tag
-		id := c.Param("id")
-		if err := db.First(&tag, id).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Тег не найден"})
+		st := scoped(st, c)
+		tag, err := st.Tags().Get(idParam(c, "id"))
+		if err != nil {
+			notFoundOr(c, err, "tag.not_found")
 			return
 		}
-		if err := c.ShouldBindJSON(&tag); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		if !checkIfMatch(c, tag.Version) {
 			return
 		}
-		if err := db.Save(&tag).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		before := tag
+		if !bindInput(c, &tagInput{}, &tag) {
 			return
 		}
-		c.JSON(http.StatusOK, tag)
+		err = st.Tx(func(tx store.Store) error {
+			if err := tx.Tags().Update(&tag); err != nil {
+				return err
+			}
+			return audit(tx, c, "tags", tag.ID, before, tag)
+		})
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		respondRecord(c, http.StatusOK, tag.Version, tag)
 	}
 }
 
@@ -110,15 +162,35 @@ func UpdateTag(db *gorm.DB) gin.HandlerFunc {
 // @Description  Удаляет тег по ID
 // @Tags         tags
 // @Produce      json
-// @Param        id   path      int  true  "ID тега"
-// @Success      204  {object}  nil
-// @Failure      500  {object}  map[string]string
+// @Param        id        path      int     true   "ID тега"
+// @Param        If-Match  header    string  false  "ETag записи: 412, если её успели изменить"
+// @Success      204       {object}  nil
+// @Failure      404       {object}  errorBody
+// @Failure      412       {object}  errorBody
+// @Failure      500       {object}  errorBody
 // @Router       /tags/{id} [delete]
-func DeleteTag(db *gorm.DB) gin.HandlerFunc {
+func DeleteTag(st store.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		id := c.Param("id")
-		if err := db.Delete(&models.Tag{}, id).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		st := scoped(st, c)
+		tag, err := st.Tags().Get(idParam(c, "id"))
+		if goneWithoutIfMatch(c, err) {
+			return
+		}
+		if err != nil {
+			notFoundOr(c, err, "tag.not_found")
+			return
+		}
+		if !checkIfMatch(c, tag.Version) {
+			return
+		}
+		err = st.Tx(func(tx store.Store) error {
+			if err := tx.Tags().Delete(tag.ID); err != nil {
+				return err
+			}
+			return audit(tx, c, "tags", tag.ID, tag, nil)
+		})
+		if err != nil {
+			internalError(c, err)
 			return
 		}
 		c.Status(http.StatusNoContent)
@@ -0,0 +1,289 @@
+package handlers
+
+import (
+	"net/http"
+
+	"crm-backend/internal/models"
+	"crm-backend/internal/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// tagIDsInput — тело запроса на замену набора тегов.
+type tagIDsInput struct {
+	TagIDs []uint `json:"tag_ids" binding:"dive,min=1"`
+}
+
+// errUnknownTag — среди переданных ID есть несуществующий или удалённый тег.
+var errUnknownTag = invalidField("tag_ids", "not_found", "tag.not_found")
+
+// checkTags проверяет, что все теги из ids существуют, и возвращает их ID
+// без повторов; пустой список кодируется как [], а не null.
+func checkTags(st store.Store, ids []uint) ([]uint, error) {
+	ids = store.UniqueIDs(ids)
+	tags, err := st.Tags().Find(ids)
+	if err != nil {
+		return nil, err
+	}
+	if len(tags) != len(ids) {
+		return nil, errUnknownTag
+	}
+	found := make([]uint, 0, len(tags))
+	for _, t := range tags {
+		found = append(found, t.ID)
+	}
+	return found, nil
+}
+
+// taggedStore — хранилище записей с тегами. Смена тегов сохраняет и саму
+// запись, чтобы увеличить её версию и проверить, что её не изменили.
+type taggedStore[M any] interface {
+	store.Taggable
+	Update(record *M) error
+}
+
+func dealTags(st store.Store) taggedStore[models.Deal]         { return st.Deals() }
+func customerTags(st store.Store) taggedStore[models.Customer] { return st.Customers() }
+
+// setOwnerTags заменяет теги записи id (сделки или клиента) на переданные в
+// теле запроса и возвращает итоговый список ID. В журнал изменение
+// попадает как правка tag_ids записи entity.
+func setOwnerTags[M any](st store.Store, c *gin.Context, owner func(store.Store) taggedStore[M], entity string, record *M, id uint) ([]uint, bool) {
+	var input tagIDsInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		bindError(c, err)
+		return nil, false
+	}
+	ids, err := checkTags(st, input.TagIDs)
+	if err == nil {
+		err = st.Tx(func(tx store.Store) error {
+			prev, err := owner(tx).TagIDs(id)
+			if err != nil {
+				return err
+			}
+			if err := owner(tx).Update(record); err != nil {
+				return err
+			}
+			if err := owner(tx).SetTags(id, ids); err != nil {
+				return err
+			}
+			return audit(tx, c, entity, id, gin.H{"tag_ids": prev}, gin.H{"tag_ids": ids})
+		})
+	}
+	if err != nil {
+		writeError(c, err)
+		return nil, false
+	}
+	return ids, true
+}
+
+// changeOwnerTag добавляет (add=true) или снимает тег из пути у записи id и
+// возвращает итоговый список ID.
+func changeOwnerTag[M any](st store.Store, c *gin.Context, owner func(store.Store) taggedStore[M], entity string, record *M, id uint, add bool) ([]uint, bool) {
+	tag, err := st.Tags().Get(idParam(c, "tag_id"))
+	if err != nil {
+		notFoundOr(c, err, "tag.not_found")
+		return nil, false
+	}
+	var ids []uint
+	err = st.Tx(func(tx store.Store) error {
+		prev, err := owner(tx).TagIDs(id)
+		if err != nil {
+			return err
+		}
+		if err := owner(tx).Update(record); err != nil {
+			return err
+		}
+		if add {
+			err = owner(tx).AddTag(id, tag.ID)
+		} else {
+			err = owner(tx).RemoveTag(id, tag.ID)
+		}
+		if err != nil {
+			return err
+		}
+		if ids, err = owner(tx).TagIDs(id); err != nil {
+			return err
+		}
+		return audit(tx, c, entity, id, gin.H{"tag_ids": prev}, gin.H{"tag_ids": ids})
+	})
+	if err != nil {
+		writeError(c, err)
+		return nil, false
+	}
+	return ids, true
+}
+
+func findDeal(st store.Store, c *gin.Context) (models.Deal, bool) {
+	deal, err := st.Deals().Get(idParam(c, "id"))
+	if err != nil {
+		notFoundOr(c, err, "deal.not_found")
+		return deal, false
+	}
+	return deal, true
+}
+
+func findCustomer(st store.Store, c *gin.Context) (models.Customer, bool) {
+	customer, err := st.Customers().Get(idParam(c, "id"))
+	if err != nil {
+		notFoundOr(c, err, "customer.not_found")
+		return customer, false
+	}
+	return customer, true
+}
+
+// SetDealTags godoc
+// @Summary      Задать теги сделки
+// @Description  Заменяет набор тегов сделки; пустой список снимает все теги
+// @Tags         deals
+// @Accept       json
+// @Produce      json
+// @Param        id        path      int          true   "ID сделки"
+// @Param        tags      body      tagIDsInput  true   "ID тегов"
+// @Param        If-Match  header    string       false  "ETag записи: 412, если её успели изменить"
+// @Success      200       {object}  models.Deal
+// @Header       200       {string}  ETag         "Версия записи"
+// @Failure      400       {object}  errorBody
+// @Failure      404       {object}  errorBody
+// @Failure      412       {object}  errorBody
+// @Router       /deals/{id}/tags [put]
+func SetDealTags(st store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		st := scoped(st, c)
+		deal, ok := findDeal(st, c)
+		if !ok || !checkIfMatch(c, deal.Version) {
+			return
+		}
+		if deal.TagIDs, ok = setOwnerTags(st, c, dealTags, "deals", &deal, deal.ID); ok {
+			respondRecord(c, http.StatusOK, deal.Version, deal)
+		}
+	}
+}
+
+// AddDealTag godoc
+// @Summary      Добавить тег сделке
+// @Tags         deals
+// @Produce      json
+// @Param        id        path      int     true   "ID сделки"
+// @Param        tag_id    path      int     true   "ID тега"
+// @Param        If-Match  header    string  false  "ETag записи: 412, если её успели изменить"
+// @Success      200       {object}  models.Deal
+// @Header       200       {string}  ETag    "Версия записи"
+// @Failure      404       {object}  errorBody
+// @Failure      412       {object}  errorBody
+// @Router       /deals/{id}/tags/{tag_id} [post]
+func AddDealTag(st store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		st := scoped(st, c)
+		deal, ok := findDeal(st, c)
+		if !ok || !checkIfMatch(c, deal.Version) {
+			return
+		}
+		if deal.TagIDs, ok = changeOwnerTag(st, c, dealTags, "deals", &deal, deal.ID, true); ok {
+			respondRecord(c, http.StatusOK, deal.Version, deal)
+		}
+	}
+}
+
+// RemoveDealTag godoc
+// @Summary      Снять тег со сделки
+// @Tags         deals
+// @Produce      json
+// @Param        id        path      int     true   "ID сделки"
+// @Param        tag_id    path      int     true   "ID тега"
+// @Param        If-Match  header    string  false  "ETag записи: 412, если её успели изменить"
+// @Success      200       {object}  models.Deal
+// @Header       200       {string}  ETag    "Версия записи"
+// @Failure      404       {object}  errorBody
+// @Failure      412       {object}  errorBody
+// @Router       /deals/{id}/tags/{tag_id} [delete]
+func RemoveDealTag(st store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		st := scoped(st, c)
+		deal, ok := findDeal(st, c)
+		if !ok || !checkIfMatch(c, deal.Version) {
+			return
+		}
+		if deal.TagIDs, ok = changeOwnerTag(st, c, dealTags, "deals", &deal, deal.ID, false); ok {
+			respondRecord(c, http.StatusOK, deal.Version, deal)
+		}
+	}
+}
+
+// SetCustomerTags godoc
+// @Summary      Задать теги клиента
+// @Description  Заменяет набор тегов клиента; пустой список снимает все теги
+// @Tags         customers
+// @Accept       json
+// @Produce      json
+// @Param        id        path      int          true   "ID клиента"
+// @Param        tags      body      tagIDsInput  true   "ID тегов"
+// @Param        If-Match  header    string       false  "ETag записи: 412, если её успели изменить"
+// @Success      200       {object}  models.Customer
+// @Header       200       {string}  ETag         "Версия записи"
+// @Failure      400       {object}  errorBody
+// @Failure      404       {object}  errorBody
+// @Failure      412       {object}  errorBody
+// @Router       /customers/{id}/tags [put]
+func SetCustomerTags(st store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		st := scoped(st, c)
+		customer, ok := findCustomer(st, c)
+		if !ok || !checkIfMatch(c, customer.Version) {
+			return
+		}
+		if customer.TagIDs, ok = setOwnerTags(st, c, customerTags, "customers", &customer, customer.ID); ok {
+			respondRecord(c, http.StatusOK, customer.Version, customer)
+		}
+	}
+}
+
+// AddCustomerTag godoc
+// @Summary      Добавить тег клиенту
+// @Tags         customers
+// @Produce      json
+// @Param        id        path      int     true   "ID клиента"
+// @Param        tag_id    path      int     true   "ID тега"
+// @Param        If-Match  header    string  false  "ETag записи: 412, если её успели изменить"
+// @Success      200       {object}  models.Customer
+// @Header       200       {string}  ETag    "Версия записи"
+// @Failure      404       {object}  errorBody
+// @Failure      412       {object}  errorBody
+// @Router       /customers/{id}/tags/{tag_id} [post]
+func AddCustomerTag(st store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		st := scoped(st, c)
+		customer, ok := findCustomer(st, c)
+		if !ok || !checkIfMatch(c, customer.Version) {
+			return
+		}
+		if customer.TagIDs, ok = changeOwnerTag(st, c, customerTags, "customers", &customer, customer.ID, true); ok {
+			respondRecord(c, http.StatusOK, customer.Version, customer)
+		}
+	}
+}
+
+// RemoveCustomerTag godoc
+// @Summary      Снять тег с клиента
+// @Tags         customers
+// @Produce      json
+// @Param        id        path      int     true   "ID клиента"
+// @Param        tag_id    path      int     true   "ID тега"
+// @Param        If-Match  header    string  false  "ETag записи: 412, если её успели изменить"
+// @Success      200       {object}  models.Customer
+// @Header       200       {string}  ETag    "Версия записи"
+// @Failure      404       {object}  errorBody
+// @Failure      412       {object}  errorBody
+// @Router       /customers/{id}/tags/{tag_id} [delete]
+func RemoveCustomerTag(st store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		st := scoped(st, c)
+		customer, ok := findCustomer(st, c)
+		if !ok || !checkIfMatch(c, customer.Version) {
+			return
+		}
+		if customer.TagIDs, ok = changeOwnerTag(st, c, customerTags, "customers", &customer, customer.ID, false); ok {
+			respondRecord(c, http.StatusOK, customer.Version, customer)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"crm-backend/internal/models"
+	"crm-backend/internal/store"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// Время жизни токенов. Задаётся при старте.
+var (
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+var (
+	errRefreshInvalid = unauthorized("auth.refresh_invalid")
+	errRefreshReused  = unauthorized("auth.refresh_reused")
+	errUserInactive   = unauthorized("auth.user_inactive")
+)
+
+// tokenPair — ответ на логин и обновление токенов.
+type tokenPair struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken возвращает SHA-256 refresh-токена; в базе хранится только хеш.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func signAccessToken(user models.User, familyID string) (string, error) {
+	claims := &Claims{
+		UserID:    user.ID,
+		Email:     user.Email,
+		Role:      user.Role,
+		SessionID: familyID,
+		StandardClaims: jwt.StandardClaims{
+			IssuedAt:  time.Now().Unix(),
+			ExpiresAt: time.Now().Add(AccessTokenTTL).Unix(),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(jwtKey)
+}
+
+// issueTokens создаёт refresh-токен в семействе familyID (новое семейство,
+// если familyID пуст) и подписанный access-токен для той же сессии.
+func issueTokens(tx store.Store, user models.User, familyID string) (tokenPair, *models.RefreshToken, error) {
+	if familyID == "" {
+		id, err := randomToken(16)
+		if err != nil {
+			return tokenPair{}, nil, err
+		}
+		familyID = id
+	}
+	raw, err := randomToken(32)
+	if err != nil {
+		return tokenPair{}, nil, err
+	}
+	rt := &models.RefreshToken{
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		TokenHash: hashToken(raw),
+		ExpiresAt: time.Now().Add(RefreshTokenTTL),
+	}
+	if err := tx.Sessions().Create(rt); err != nil {
+		return tokenPair{}, nil, err
+	}
+	access, err := signAccessToken(user, familyID)
+	if err != nil {
+		return tokenPair{}, nil, err
+	}
+	return tokenPair{Token: access, RefreshToken: raw, ExpiresIn: int64(AccessTokenTTL.Seconds())}, rt, nil
+}
+
+// rotateRefreshToken обменивает refresh-токен на новую пару. Повторное
+// предъявление уже заменённого токена считается кражей: всё семейство отзывается.
+func rotateRefreshToken(st store.Store, raw string) (tokenPair, error) {
+	var pair tokenPair
+	var reused bool
+	err := st.Tx(func(tx store.Store) error {
+		rt, err := tx.Sessions().GetByHash(hashToken(raw))
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				return errRefreshInvalid
+			}
+			return err
+		}
+		if rt.RevokedAt != nil {
+			if rt.ReplacedByID != nil {
+				reused = true
+			}
+			return errRefreshInvalid
+		}
+		if time.Now().After(rt.ExpiresAt) {
+			return errRefreshInvalid
+		}
+		user, err := tx.Users().Get(rt.UserID)
+		if err != nil || user.Disabled {
+			return errUserInactive
+		}
+		var next *models.RefreshToken
+		pair, next, err = issueTokens(tx, user, rt.FamilyID)
+		if err != nil {
+			return err
+		}
+		replaced, err := tx.Sessions().Replace(rt.ID, next.ID, time.Now())
+		if err != nil {
+			return err
+		}
+		if !replaced {
+			// Параллельный запрос успел повернуть этот же токен.
+			reused = true
+			return errRefreshInvalid
+		}
+		return nil
+	})
+	if reused {
+		if rt, err := st.Sessions().GetByHash(hashToken(raw)); err == nil {
+			if err := revokeFamily(st, rt.FamilyID); err != nil {
+				return tokenPair{}, err
+			}
+		}
+		return tokenPair{}, errRefreshReused
+	}
+	return pair, err
+}
+
+// revokeFamily отзывает все токены сессии.
+func revokeFamily(st store.Store, familyID string) error {
+	return st.Sessions().RevokeFamily(familyID, time.Now())
+}
+
+// RevokeUserSessions отзывает все сессии пользователя, например при его
+// отключении или удалении.
+func RevokeUserSessions(st store.Store, userID uint) error {
+	return st.Sessions().RevokeUser(userID, time.Now())
+}
+
+// sessionRole проверяет, что сессия access-токена не отозвана, а пользователь
+// существует и не отключён, и возвращает его текущую роль из базы — так смена
+// роли действует сразу, не дожидаясь нового токена.
+func sessionRole(st store.Store, claims *Claims) (string, bool, error) {
+	if claims.SessionID == "" {
+		return "", false, nil
+	}
+	return st.Sessions().ActiveRole(claims.SessionID, claims.UserID)
+}
@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"crm-backend/internal/models"
+	"crm-backend/internal/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+var trashList = store.ListSpec{
+	Resource:    "trash",
+	Table:       "trash",
+	Sortable:    []string{"deleted_at", "entity", "entity_id", "title"},
+	Filterable:  []string{"entity", "entity_id"},
+	Searchable:  []string{"title"},
+	DefaultSort: "deleted_at",
+}
+
+// trashPermissions — право, с которым запись каждого типа удаляют; с ним же
+// её видят в корзине и восстанавливают.
+var trashPermissions = map[string]string{
+	"comments":  PermCommentsDelete,
+	"deals":     PermDealsDelete,
+	"customers": PermCustomersDelete,
+	"tags":      PermTagsDelete,
+	"statuses":  PermStatusesDelete,
+	"users":     PermUsersManage,
+}
+
+// trashEntity проверяет тип записи из пути и право пользователя на него.
+// При ошибке отвечает клиенту и возвращает false.
+func trashEntity(c *gin.Context) (string, bool) {
+	entity := c.Param("entity")
+	perm, ok := trashPermissions[entity]
+	if !ok {
+		abortWithError(c, notFound("trash.entity_unknown", entity))
+		return "", false
+	}
+	if !HasPermission(c, perm) {
+		abortWithError(c, forbidden("auth.forbidden", perm))
+		return "", false
+	}
+	return entity, true
+}
+
+// trashError отвечает на ошибку хранилища корзины.
+func trashError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		abortWithError(c, notFound("trash.not_found"))
+	case errors.Is(err, store.ErrParentDeleted):
+		abortWithError(c, conflict("trash.parent_deleted"))
+	case errors.Is(err, store.ErrDuplicate):
+		abortWithError(c, conflict("trash.duplicate"))
+	case errors.Is(err, store.ErrReferenced):
+		abortWithError(c, conflict("trash.referenced"))
+	default:
+		internalError(c, err)
+	}
+}
+
+// GetTrash godoc
+// @Summary      Корзина
+// @Description  Возвращает мягко удалённые записи тех типов, которые пользователь вправе удалять
+// @Tags         trash
+// @Produce      json
+// @Param        sort    query     string  false  "Сортировка: [\"deleted_at\",\"DESC\"]"
+// @Param        range   query     string  false  "Диапазон записей: [0,24]"
+// @Param        filter  query     string  false  "Фильтр: {\"q\":\"текст\",\"entity\":\"deals\"}"
+// @Success      200  {array}   models.TrashItem
+// @Header       200  {string}  Content-Range  "Диапазон и общее количество записей"
+// @Failure      400  {object}  errorBody
+// @Failure      500  {object}  errorBody
+// @Router       /trash [get]
+func GetTrash(st store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		st := scoped(st, c)
+		q, err := parseListQuery(c, trashList)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		// Фильтр по типу сужается до доступных пользователю типов
+		requested, filtered := q.Filters["entity"]
+		allowed := []interface{}{}
+		for _, entity := range store.TrashEntities {
+			if HasPermission(c, trashPermissions[entity]) && (!filtered || filterHas(requested, entity)) {
+				allowed = append(allowed, entity)
+			}
+		}
+		q.Filters["entity"] = allowed
+		items, total, err := st.Trash().List(q)
+		if err != nil {
+			internalError(c, err)
+			return
+		}
+		setContentRange(c, q, len(items), total)
+		c.JSON(http.StatusOK, items)
+	}
+}
+
+// filterHas сообщает, выбирает ли значение фильтра (одно или список) value.
+func filterHas(filter interface{}, value string) bool {
+	list, ok := filter.([]interface{})
+	if !ok {
+		list = []interface{}{filter}
+	}
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// RestoreTrash godoc
+// @Summary      Восстановить запись из корзины
+// @Description  Возвращает удалённую запись вместе с удалёнными одновременно с ней сделками и комментариями. Требует права на удаление записей этого типа
+// @Tags         trash
+// @Produce      json
+// @Param        entity  path  string  true  "Тип записи: customers, deals, comments, tags, statuses, users"
+// @Param        id      path  int     true  "ID записи"
+// @Success      204     {object}  nil
+// @Failure      403     {object}  errorBody
+// @Failure      404     {object}  errorBody
+// @Failure      409     {object}  errorBody
+// @Failure      500     {object}  errorBody
+// @Router       /trash/{entity}/{id}/restore [post]
+func RestoreTrash(st store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		st := scoped(st, c)
+		entity, ok := trashEntity(c)
+		if !ok {
+			return
+		}
+		id := idParam(c, "id")
+		err := st.Tx(func(tx store.Store) error {
+			if err := tx.Trash().Restore(entity, id); err != nil {
+				return err
+			}
+			return recordAudit(tx, c, models.AuditRestore, entity, id, models.AuditChanges{})
+		})
+		if err != nil {
+			trashError(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// PurgeTrash godoc
+// @Summary      Удалить запись из корзины окончательно
+// @Description  Удаляет запись из корзины без возможности восстановления вместе с зависимыми данными. Доступно только администратору
+// @Tags         trash
+// @Produce      json
+// @Param        entity  path  string  true  "Тип записи: customers, deals, comments, tags, statuses, users"
+// @Param        id      path  int     true  "ID записи"
+// @Success      204     {object}  nil
+// @Failure      403     {object}  errorBody
+// @Failure      404     {object}  errorBody
+// @Failure      409     {object}  errorBody
+// @Failure      500     {object}  errorBody
+// @Router       /trash/{entity}/{id} [delete]
+func PurgeTrash(st store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		st := scoped(st, c)
+		if !isAdmin(c) {
+			abortWithError(c, forbidden("trash.purge_admin_only"))
+			return
+		}
+		entity, ok := trashEntity(c)
+		if !ok {
+			return
+		}
+		id := idParam(c, "id")
+		err := st.Tx(func(tx store.Store) error {
+			if err := tx.Trash().Purge(entity, id); err != nil {
+				return err
+			}
+			return recordAudit(tx, c, models.AuditPurge, entity, id, models.AuditChanges{})
+		})
+		if err != nil {
+			trashError(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// PurgeExpiredTrash окончательно удаляет записи, попавшие в корзину раньше
+// before, каждую в своей транзакции, и возвращает их количество. Записи, на
+// которые ещё ссылаются другие, остаются в корзине до следующего раза.
+func PurgeExpiredTrash(st store.Store, before time.Time) (int, error) {
+	items, err := st.Trash().DeletedBefore(before)
+	if err != nil {
+		return 0, err
+	}
+	purged := 0
+	for _, item := range items {
+		err := st.Tx(func(tx store.Store) error {
+			if err := tx.Trash().Purge(item.Entity, item.EntityID); err != nil {
+				return err
+			}
+			return tx.Audit().Record(&models.AuditEntry{
+				Action:    models.AuditPurge,
+				Entity:    item.Entity,
+				EntityID:  item.EntityID,
+				Changes:   models.AuditChanges{},
+				CreatedAt: time.Now().Unix(),
+			})
+		})
+		switch {
+		case err == nil:
+			purged++
+		// Запись могли восстановить или удалить параллельно
+		case errors.Is(err, store.ErrReferenced), errors.Is(err, store.ErrNotFound):
+		default:
+			return purged, err
+		}
+	}
+	return purged, nil
+}
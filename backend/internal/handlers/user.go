@@ -1,28 +1,75 @@
 package handlers
 
 import (
-	"crm-backend/internal/models"
+	"errors"
 	"net/http"
 
+	"crm-backend/internal/models"
+	"crm-backend/internal/store"
+
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 )
 
+var userList = store.ListSpec{
+	Resource:   "users",
+	Table:      "users",
+	Sortable:   []string{"id", "name", "email", "role"},
+	Filterable: []string{"email", "role"},
+	Searchable: []string{"name", "email"},
+}
+
+// userInput — изменяемые поля пользователя. Пароль не возвращается: пустой
+// пароль оставляет текущий.
+type userInput struct {
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Role     string `json:"role"`
+	Disabled bool   `json:"disabled"`
+	Password string `json:"password,omitempty" binding:"omitempty,min=8,max=72"`
+}
+
+func (in *userInput) load(m models.User) {
+	*in = userInput{Name: m.Name, Email: m.Email, Role: m.Role, Disabled: m.Disabled}
+}
+
+func (in *userInput) apply(m *models.User) {
+	m.Name, m.Email, m.Role, m.Disabled = in.Name, in.Email, in.Role, in.Disabled
+}
+
+// auditedUser — пользователь в журнале изменений: хеш пароля туда не
+// попадает, видно только, что пароль сменили.
+type auditedUser struct {
+	models.User
+	PasswordChanged bool `json:"password_changed,omitempty"`
+}
+
 // GetUsers godoc
 // @Summary      Получить список пользователей
-// @Description  Возвращает всех пользователей
+// @Description  Возвращает пользователей с сортировкой, пагинацией и фильтрами
 // @Tags         users
 // @Produce      json
+// @Param        sort    query     string  false  "Сортировка: [\"поле\",\"ASC|DESC\"]"
+// @Param        range   query     string  false  "Диапазон записей: [0,24]"
+// @Param        filter  query     string  false  "Фильтр: {\"q\":\"текст\",\"поле\":значение}"
 // @Success      200  {array}   models.User
-// @Failure      500  {object}  map[string]string
+// @Header       200  {string}  Content-Range  "Диапазон и общее количество записей"
+// @Failure      400  {object}  errorBody
+// @Failure      500  {object}  errorBody
 // @Router       /users [get]
-func GetUsers(db *gorm.DB) gin.HandlerFunc {
+func GetUsers(st store.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var users []models.User
-		if err := db.Find(&users).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		st := scoped(st, c)
+		q, err := parseListQuery(c, userList)
+		if err != nil {
+			writeError(c, err)
 			return
 		}
+		users, total, err := st.Users().List(q)
+		if err != nil {
+			internalError(c, err)
+			return
+		}
+		setContentRange(c, q, len(users), total)
 		c.JSON(http.StatusOK, users)
 	}
 }
@@ -32,19 +79,20 @@ func GetUsers(db *gorm.DB) gin.HandlerFunc {
 // @Description  Возвращает пользователя по идентификатору
 // @Tags         users
 // @Produce      json
-// @Param        id   path      int  true  "ID пользователя"
-// @Success      200  {object}  models.User
-// @Failure      404  {object}  map[string]string
+// @Param        id             path      int     true   "ID пользователя"
+// @Param        If-None-Match  header    string  false  "ETag из прошлого ответа: 304, если запись не изменилась"
+// @Success      200            {object}  models.User
+// @Header       200            {string}  ETag    "Версия записи"
+// @Failure      404            {object}  errorBody
 // @Router       /users/{id} [get]
-func GetUser(db *gorm.DB) gin.HandlerFunc {
+func GetUser(st store.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var user models.User
-		id := c.Param("id")
-		if err := db.First(&user, id).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Пользователь не найден"})
+		st := scoped(st, c)
+		user, ok := findUser(st, c)
+		if !ok {
 			return
 		}
-		c.JSON(http.StatusOK, user)
+		respondRecord(c, http.StatusOK, user.Version, user)
 	}
 }
 
@@ -54,77 +102,227 @@ func GetUser(db *gorm.DB) gin.HandlerFunc {
 // @Tags         users
 // @Accept       json
 // @Produce      json
-// @Param        user  body      models.User  true  "Данные пользователя"
+// @Param        user  body      userInput  true  "Данные пользователя"
 // @Success      201   {object}  models.User
-// @Failure      400   {object}  map[string]string
+// @Header       201   {string}  ETag       "Версия записи"
+// @Failure      400   {object}  errorBody
+// @Failure      403   {object}  errorBody
+// @Failure      409   {object}  errorBody
 // @Router       /users [post]
-func CreateUser(db *gorm.DB) gin.HandlerFunc {
+func CreateUser(st store.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var user models.User
-		if err := c.ShouldBindJSON(&user); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		st := scoped(st, c)
+		user := models.User{Role: DefaultRole}
+		var input userInput
+		if !bindInput(c, &input, &user) {
+			return
+		}
+		if user.Role == "" {
+			user.Role = DefaultRole
+		}
+		if err := checkUser(st, c, models.User{Role: DefaultRole}, user); err != nil {
+			writeError(c, err)
+			return
+		}
+		if err := setPassword(&user, input.Password); err != nil {
+			internalError(c, err)
 			return
 		}
-		if err := db.Create(&user).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		err := st.Tx(func(tx store.Store) error {
+			if err := tx.Users().Create(&user); err != nil {
+				return err
+			}
+			return audit(tx, c, "users", user.ID, nil, user)
+		})
+		if err != nil {
+			internalError(c, err)
 			return
 		}
-		c.JSON(http.StatusCreated, user)
+		respondRecord(c, http.StatusCreated, user.Version, user)
 	}
 }
 
 // UpdateUser godoc
 // @Summary      Обновить пользователя
-// @Description  Обновляет данные пользователя по ID
+// @Description  PUT заменяет переданные поля пользователя, PATCH применяет JSON Merge Patch. Менять роль может только администратор.
 // @Tags         users
 // @Accept       json
 // @Produce      json
-// @Param        id    path      int         true  "ID пользователя"
-// @Param        user  body      models.User true  "Данные пользователя"
-// @Success      200   {object}  models.User
-// @Failure      400   {object}  map[string]string
-// @Failure      404   {object}  map[string]string
+// @Param        id        path      int        true   "ID пользователя"
+// @Param        user      body      userInput  true   "Данные пользователя"
+// @Param        If-Match  header    string     false  "ETag записи: 412, если её успели изменить"
+// @Success      200       {object}  models.User
+// @Header       200       {string}  ETag       "Версия записи"
+// @Failure      400       {object}  errorBody
+// @Failure      403       {object}  errorBody
+// @Failure      404       {object}  errorBody
+// @Failure      409       {object}  errorBody
+// @Failure      412       {object}  errorBody
 // @Router       /users/{id} [put]
-func UpdateUser(db *gorm.DB) gin.HandlerFunc {
+// @Router       /users/{id} [patch]
+func UpdateUser(st store.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var user models.User
-		id := c.Param("id")
-		if err := db.First(&user, id).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Пользователь не найден"})
+		st := scoped(st, c)
+		user, ok := findUser(st, c)
+		if !ok || !checkIfMatch(c, user.Version) {
+			return
+		}
+		before := user
+		var input userInput
+		if !bindInput(c, &input, &user) {
 			return
 		}
-		if err := c.ShouldBindJSON(&user); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		if err := checkUser(st, c, before, user); err != nil {
+			writeError(c, err)
 			return
 		}
-		if err := db.Save(&user).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if err := setPassword(&user, input.Password); err != nil {
+			internalError(c, err)
 			return
 		}
-		c.JSON(http.StatusOK, user)
+		err := st.Tx(func(tx store.Store) error {
+			if err := tx.Users().Update(&user); err != nil {
+				return err
+			}
+			// Отключённый пользователь теряет все активные сессии
+			if user.Disabled {
+				if err := RevokeUserSessions(tx, user.ID); err != nil {
+					return err
+				}
+			}
+			after := auditedUser{User: user, PasswordChanged: input.Password != ""}
+			return audit(tx, c, "users", user.ID, auditedUser{User: before}, after)
+		})
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		respondRecord(c, http.StatusOK, user.Version, user)
 	}
 }
 
 // DeleteUser godoc
 // @Summary      Удалить пользователя
-// @Description  Удаляет пользователя по ID
+// @Description  Удаляет пользователя по ID. Если у пользователя есть комментарии, нужно либо удалить их вместе с ним (cascade=true), либо передать другому пользователю (move_to); иначе 409 со списком комментариев
 // @Tags         users
 // @Produce      json
-// @Param        id   path      int  true  "ID пользователя"
-// @Success      204  {object}  nil
-// @Failure      500  {object}  map[string]string
+// @Param        id        path      int     true   "ID пользователя"
+// @Param        cascade   query     bool    false  "Удалить комментарии пользователя вместе с ним"
+// @Param        move_to   query     int     false  "ID пользователя, которому передаются комментарии"
+// @Param        If-Match  header    string  false  "ETag записи: 412, если её успели изменить"
+// @Success      204       {object}  nil
+// @Failure      400       {object}  errorBody
+// @Failure      403       {object}  errorBody
+// @Failure      404       {object}  errorBody
+// @Failure      409       {object}  errorBody
+// @Failure      412       {object}  errorBody
+// @Failure      500       {object}  errorBody
 // @Router       /users/{id} [delete]
-func DeleteUser(db *gorm.DB) gin.HandlerFunc {
+func DeleteUser(st store.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if !IsAdmin(c) {
-			c.JSON(403, gin.H{"error": "Только администратор может удалять пользователей"})
+		st := scoped(st, c)
+		policy, ok := parseDeletePolicy(c)
+		if !ok {
+			return
+		}
+		user, ok := findUser(st, c)
+		if !ok {
+			return
+		}
+		if !isAdmin(c) && user.Role == AdminRole {
+			abortWithError(c, forbidden("user.admin_protected"))
+			return
+		}
+		if !checkIfMatch(c, user.Version) {
+			return
+		}
+		blockers, comments, err := commentBlockers(st, "user_id", user.ID)
+		if err != nil {
+			internalError(c, err)
 			return
 		}
-		id := c.Param("id")
-		if err := db.Delete(&models.User{}, id).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		move := comments > 0 && policy.moveTo != 0
+		switch {
+		case comments > 0 && policy.restricts():
+			abortWithError(c, conflict("user.has_comments").withMeta("comments", comments).withMeta("blockers", blockers))
+			return
+		case move:
+			target, err := st.Users().Get(policy.moveTo)
+			if errors.Is(err, store.ErrNotFound) || err == nil && target.ID == user.ID {
+				abortWithError(c, badRequest("user.move_to_invalid"))
+				return
+			} else if err != nil {
+				internalError(c, err)
+				return
+			}
+		}
+		err = st.Tx(func(tx store.Store) error {
+			if move {
+				if err := tx.Comments().MoveToUser(user.ID, policy.moveTo); err != nil {
+					return err
+				}
+			}
+			if err := tx.Users().Delete(user.ID); err != nil {
+				return err
+			}
+			if err := RevokeUserSessions(tx, user.ID); err != nil {
+				return err
+			}
+			return audit(tx, c, "users", user.ID, user, nil)
+		})
+		if err != nil {
+			internalError(c, err)
 			return
 		}
 		c.Status(http.StatusNoContent)
 	}
 }
+
+func findUser(st store.Store, c *gin.Context) (models.User, bool) {
+	user, err := st.Users().Get(idParam(c, "id"))
+	if err != nil {
+		notFoundOr(c, err, "user.not_found")
+		return user, false
+	}
+	return user, true
+}
+
+// checkUser проверяет изменение пользователя before на after. Право
+// users:manage не даёт назначать роли: иначе его владелец мог бы сделать
+// себя администратором. Поэтому без роли администратора нельзя менять роль
+// и трогать учётные записи администраторов.
+func checkUser(st store.Store, c *gin.Context, before, after models.User) error {
+	if !isAdmin(c) {
+		if before.Role == AdminRole {
+			return forbidden("user.admin_protected")
+		}
+		if after.Role != before.Role {
+			return forbidden("user.role_admin_only")
+		}
+	}
+	if after.Role != before.Role || before.ID == 0 {
+		ok, err := roleExists(st, after.Role)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return invalidField("role", "not_found", "role.not_found")
+		}
+	}
+	return checkEmailFree(st, after.Email, after.ID)
+}
+
+// checkEmailFree возвращает конфликт, если email занят другим пользователем.
+func checkEmailFree(st store.Store, email string, id uint) error {
+	other, err := st.Users().GetByEmail(email)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if other.ID != id {
+		return conflict("auth.email_taken")
+	}
+	return nil
+}
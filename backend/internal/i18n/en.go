@@ -0,0 +1,150 @@
+package i18n
+
+var en = map[string]string{
+	// Общие
+	"internal":             "Internal server error",
+	"bad_request":          "Bad request",
+	"request.bad_json":     "Malformed JSON in request body",
+	"request.patch_object": "PATCH body must be a JSON object",
+	"not_found":            "Record not found",
+	"record.modified":      "The record was changed by someone else; reload it and try again",
+	"validation_failed":    "Some fields are invalid",
+
+	// Проверка полей
+	"field.required":     "This field is required",
+	"field.invalid":      "Invalid value",
+	"field.email":        "Invalid email address",
+	"field.min":          "Must be at least %s",
+	"field.max":          "Must be at most %s",
+	"field.min_length":   "Must be at least %s characters long",
+	"field.max_length":   "Must be at most %s characters long",
+	"field.len":          "Must be exactly %s characters long",
+	"field.gt":           "Must be greater than %s",
+	"field.phone":        "Phone number in E.164 format, e.g. +14155552671",
+	"field.color":        "Color in #RRGGBB or #RGB format",
+	"field.oneof":        "Allowed values: %s",
+	"field.type_string":  "Expected a string",
+	"field.type_number":  "Expected a number",
+	"field.type_boolean": "Expected true or false",
+	"field.type_array":   "Expected an array",
+	"field.type_object":  "Expected an object",
+
+	// Параметры списков
+	"query.sort_invalid":   "Invalid sort parameter",
+	"query.sort_field":     "Sorting by %q is not supported",
+	"query.sort_order":     "Sort order must be ASC or DESC",
+	"query.range_invalid":  "Invalid range parameter",
+	"query.filter_invalid": "Invalid filter parameter",
+	"query.q_string":       "Parameter q must be a string",
+	"query.filter_field":   "Filtering by %q is not supported",
+	"query.filter_value":   "Invalid value for filter %q",
+	"query.tag_match":      "tag_match must be any or all",
+	"query.tag_ids":        "Invalid tag_ids filter",
+
+	// Аутентификация и права
+	"auth.email_taken":         "Email is already registered",
+	"auth.invalid_credentials": "Invalid email or password",
+	"auth.user_inactive":       "User is disabled or deleted",
+	"auth.refresh_required":    "refresh_token is required",
+	"auth.refresh_invalid":     "Invalid refresh token",
+	"auth.refresh_reused":      "Refresh token has already been used; the session is revoked",
+	"auth.token_required":      "Authorization token is required",
+	"auth.token_invalid":       "Invalid token",
+	"auth.session_revoked":     "Session has been revoked",
+	"auth.unknown_user":        "Could not determine the current user",
+	"auth.required":            "Authentication required",
+	"auth.forbidden":           "Insufficient permissions: %s is required",
+	"metrics.token_required":   "A token is required to read metrics",
+
+	// Записи
+	"customer.not_found":   "Customer not found",
+	"deal.not_found":       "Deal not found",
+	"pipeline.not_found":   "Pipeline not found",
+	"status.not_found":     "Stage not found",
+	"tag.not_found":        "Tag not found",
+	"user.not_found":       "User not found",
+	"user.role_admin_only": "Only an administrator can change user roles",
+	"user.admin_protected": "Only an administrator can modify administrators",
+	"role.not_found":       "Role not found",
+	"comment.not_found":    "Comment not found",
+
+	// Сделки и валюты
+	"currency.unknown":          "Unknown currency: %s",
+	"rate.base":                 "The base currency rate is always 1",
+	"report.date":               "Invalid %s date, expected YYYY-MM-DD",
+	"report.range":              "from must not be later than to",
+	"report.pipeline_id":        "Invalid pipeline_id",
+	"stage.wrong_pipeline":      "The stage does not belong to the deal's pipeline",
+	"stage.has_deals":           "The stage has deals: pass move_to with the stage to move them to",
+	"stage.move_to_invalid":     "move_to must be another stage of the same pipeline",
+	"stage.pipeline_locked":     "A stage that has deals cannot be moved to another pipeline",
+	"stage.cascade_unsupported": "A stage's deals cannot be deleted with it: move them to another stage (move_to)",
+
+	// Воронки
+	"pipeline.default_missing": "Default pipeline not found",
+	"pipeline.no_open_stages":  "The pipeline has no open stages",
+	"pipeline.has_deals":       "The pipeline has deals",
+	"pipeline.last":            "The last pipeline cannot be deleted",
+	"pipeline.stage_set":       "The stage list must contain every stage of the pipeline exactly once",
+
+	// Роли
+	"role.unknown_permission": "Unknown permission: %s",
+	"role.name_taken":         "A role with this name already exists",
+	"role.admin_immutable":    "The administrator role cannot be changed",
+	"role.default_rename":     "The default role cannot be renamed",
+	"role.builtin_delete":     "Built-in roles cannot be deleted",
+	"role.in_use":             "The role is assigned to users",
+
+	// Комментарии
+	"comment.author_only":      "Only the author can modify this comment",
+	"comment.edit_expired":     "The time to edit this comment has expired",
+	"comment.content_required": "Comment text is required",
+	"comment.parent_invalid":   "Parent comment not found in this deal",
+
+	// Trash
+	"trash.entity_unknown":   "Unknown record type: %s",
+	"trash.not_found":        "Record not found in the trash",
+	"trash.parent_deleted":   "Restore the record this one depends on first: the deal's customer or stage, the comment's deal",
+	"trash.duplicate":        "The email is taken by another user",
+	"trash.referenced":       "Other records refer to this record",
+	"trash.purge_admin_only": "Only an administrator can delete records permanently",
+
+	// Deleting related records
+	"delete.cascade_invalid":   "cascade must be true or false",
+	"delete.move_to_invalid":   "move_to must be a record ID",
+	"delete.policy_conflict":   "Pass either cascade or move_to, not both",
+	"customer.has_deals":       "The customer has deals: delete them with it (cascade=true) or move them to another customer (move_to)",
+	"customer.move_to_invalid": "move_to must be another existing customer",
+	"user.has_comments":        "The user has comments: delete them with the user (cascade=true) or hand them over to another user (move_to)",
+	"user.move_to_invalid":     "move_to must be another existing user",
+
+	// Bulk operations
+	"bulk.selection":  "Pass either ids or a non-empty filter",
+	"bulk.too_many":   "The filter selects more than %d records: narrow it down",
+	"bulk.no_changes": "Pass at least one change in data",
+	"bulk.failed":     "Nothing was saved: %d records failed",
+
+	// Import
+	"import.file_required":      "Attach a .csv or .xlsx file in the file field",
+	"import.file_invalid":       "The file must be a UTF-8 CSV or an XLSX workbook",
+	"import.file_empty":         "The file has no header row",
+	"import.too_large":          "The file is larger than %d MB",
+	"import.too_many_rows":      "The file has more than %d rows: split it",
+	"import.mapping_invalid":    "mapping must be a JSON object {\"Column\":\"field\"}",
+	"import.column_missing":     "The file has no column \"%s\"",
+	"import.field_unknown":      "Unknown field: %s",
+	"import.field_duplicate":    "Several columns are mapped to the field %s",
+	"import.field_required":     "Map a column to the required field: %s",
+	"import.not_found":          "Import job not found",
+	"import.failed":             "The import was aborted by an internal error",
+	"import.interrupted":        "The import was interrupted by a server restart",
+	"import.id_invalid":         "A record ID is expected",
+	"import.date_invalid":       "A date in YYYY-MM-DD or DD.MM.YYYY format is expected",
+	"import.amount_invalid":     "A non-negative amount with at most %d decimal places is expected",
+	"import.customer_not_found": "Customer \"%s\" not found",
+	"import.customer_ambiguous": "Several customers are named \"%s\": use customer_id",
+	"import.pipeline_not_found": "Pipeline \"%s\" not found",
+	"import.pipeline_ambiguous": "Several pipelines are named \"%s\": use pipeline_id",
+	"import.status_not_found":   "Stage \"%s\" not found",
+	"import.status_ambiguous":   "Several stages are named \"%s\": specify the pipeline or status_id",
+}
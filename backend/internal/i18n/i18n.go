@@ -0,0 +1,77 @@
+// Package i18n переводит сообщения API. Сообщения хранятся в каталогах по
+// ключам, язык выбирается по заголовку Accept-Language.
+package i18n
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Default — язык, на котором отвечает API, если клиент не указал
+// поддерживаемый.
+const Default = "ru"
+
+var catalogs = map[string]map[string]string{
+	"ru": ru,
+	"en": en,
+}
+
+// Languages возвращает поддерживаемые языки.
+func Languages() []string {
+	langs := make([]string, 0, len(catalogs))
+	for lang := range catalogs {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// Keys возвращает ключи каталога языка lang.
+func Keys(lang string) []string {
+	keys := make([]string, 0, len(catalogs[lang]))
+	for key := range catalogs[lang] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// T возвращает сообщение key на языке lang, подставляя args как в fmt.Sprintf.
+// Если перевода нет, берётся язык по умолчанию, а если нет и его — сам ключ.
+func T(lang, key string, args ...any) string {
+	msg, ok := catalogs[lang][key]
+	if !ok {
+		if msg, ok = catalogs[Default][key]; !ok {
+			return key
+		}
+	}
+	if len(args) == 0 {
+		return msg
+	}
+	return fmt.Sprintf(msg, args...)
+}
+
+// Negotiate выбирает язык по значению Accept-Language, например
+// "en-US,en;q=0.9,ru;q=0.8". Учитываются веса q и основной подтег языка.
+func Negotiate(header string) string {
+	best, bestQ := Default, 0.0
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		lang, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+		if _, ok := catalogs[lang]; !ok || q <= bestQ {
+			continue
+		}
+		best, bestQ = lang, q
+	}
+	return best
+}
@@ -0,0 +1,47 @@
+package i18n
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCatalogsMatch(t *testing.T) {
+	want := Keys(Default)
+	for _, lang := range Languages() {
+		if got := Keys(lang); !slices.Equal(got, want) {
+			t.Errorf("ключи каталога %s отличаются от %s:\n%v\n%v", lang, Default, got, want)
+		}
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	for header, want := range map[string]string{
+		"":                       "ru",
+		"en":                     "en",
+		"en-GB":                  "en",
+		"EN-us, ru;q=0.5":        "en",
+		"ru;q=0.5, en;q=0.8":     "en",
+		"de, fr;q=0.9":           "ru",
+		"de, en;q=0.1":           "en",
+		"en;q=0, ru;q=0.1":       "ru",
+		"en;q=bad, ru;q=0.3":     "ru",
+		"*":                      "ru",
+		"uk, ru;q=0.9, en;q=0.8": "ru",
+	} {
+		if got := Negotiate(header); got != want {
+			t.Errorf("Negotiate(%q) = %q, ожидался %q", header, got, want)
+		}
+	}
+}
+
+func TestT(t *testing.T) {
+	if got := T("en", "currency.unknown", "XXX"); got != "Unknown currency: XXX" {
+		t.Errorf("подстановка аргументов: %q", got)
+	}
+	if got := T("de", "not_found"); got != ru["not_found"] {
+		t.Errorf("нет языка — язык по умолчанию: %q", got)
+	}
+	if got := T("en", "no.such.key"); got != "no.such.key" {
+		t.Errorf("нет ключа — сам ключ: %q", got)
+	}
+}
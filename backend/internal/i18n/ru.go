@@ -0,0 +1,150 @@
+package i18n
+
+var ru = map[string]string{
+	// Общие
+	"internal":             "Внутренняя ошибка сервера",
+	"bad_request":          "Некорректный запрос",
+	"request.bad_json":     "Некорректный JSON в теле запроса",
+	"request.patch_object": "Тело PATCH должно быть JSON-объектом",
+	"not_found":            "Запись не найдена",
+	"record.modified":      "Запись изменена другим пользователем: обновите её и повторите",
+	"validation_failed":    "Проверьте правильность заполнения полей",
+
+	// Проверка полей
+	"field.required":     "Обязательное поле",
+	"field.invalid":      "Некорректное значение",
+	"field.email":        "Некорректный email",
+	"field.min":          "Значение должно быть не меньше %s",
+	"field.max":          "Значение должно быть не больше %s",
+	"field.min_length":   "Не менее %s символов",
+	"field.max_length":   "Не более %s символов",
+	"field.len":          "Количество символов должно быть %s",
+	"field.gt":           "Значение должно быть больше %s",
+	"field.phone":        "Телефон в формате E.164, например +79991234567",
+	"field.color":        "Цвет в формате #RRGGBB или #RGB",
+	"field.oneof":        "Допустимые значения: %s",
+	"field.type_string":  "Ожидается строка",
+	"field.type_number":  "Ожидается число",
+	"field.type_boolean": "Ожидается true или false",
+	"field.type_array":   "Ожидается массив",
+	"field.type_object":  "Ожидается объект",
+
+	// Параметры списков
+	"query.sort_invalid":   "Некорректный параметр sort",
+	"query.sort_field":     "Сортировка по полю %q не поддерживается",
+	"query.sort_order":     "Порядок сортировки должен быть ASC или DESC",
+	"query.range_invalid":  "Некорректный параметр range",
+	"query.filter_invalid": "Некорректный параметр filter",
+	"query.q_string":       "Параметр q должен быть строкой",
+	"query.filter_field":   "Фильтрация по полю %q не поддерживается",
+	"query.filter_value":   "Некорректное значение фильтра %q",
+	"query.tag_match":      "Параметр tag_match должен быть any или all",
+	"query.tag_ids":        "Некорректное значение фильтра tag_ids",
+
+	// Аутентификация и права
+	"auth.email_taken":         "Email уже зарегистрирован",
+	"auth.invalid_credentials": "Неверный email или пароль",
+	"auth.user_inactive":       "Пользователь отключён или удалён",
+	"auth.refresh_required":    "Требуется refresh_token",
+	"auth.refresh_invalid":     "Недействительный refresh-токен",
+	"auth.refresh_reused":      "Refresh-токен уже использован, сессия отозвана",
+	"auth.token_required":      "Требуется токен авторизации",
+	"auth.token_invalid":       "Недействительный токен",
+	"auth.session_revoked":     "Сессия отозвана",
+	"auth.unknown_user":        "Не удалось определить пользователя",
+	"auth.required":            "Требуется авторизация",
+	"auth.forbidden":           "Недостаточно прав: требуется %s",
+	"metrics.token_required":   "Требуется токен для чтения метрик",
+
+	// Записи
+	"customer.not_found":   "Клиент не найден",
+	"deal.not_found":       "Сделка не найдена",
+	"pipeline.not_found":   "Воронка не найдена",
+	"status.not_found":     "Этап не найден",
+	"tag.not_found":        "Тег не найден",
+	"user.not_found":       "Пользователь не найден",
+	"user.role_admin_only": "Менять роль пользователя может только администратор",
+	"user.admin_protected": "Изменять администраторов может только администратор",
+	"role.not_found":       "Роль не найдена",
+	"comment.not_found":    "Комментарий не найден",
+
+	// Сделки и валюты
+	"currency.unknown":          "Неизвестная валюта: %s",
+	"rate.base":                 "Курс базовой валюты всегда равен 1",
+	"report.date":               "Некорректная дата %s, ожидается ГГГГ-ММ-ДД",
+	"report.range":              "Дата from должна быть не позже to",
+	"report.pipeline_id":        "Некорректный pipeline_id",
+	"stage.wrong_pipeline":      "Этап не принадлежит воронке сделки",
+	"stage.has_deals":           "На этапе есть сделки: укажите move_to — этап, куда их перенести",
+	"stage.move_to_invalid":     "Этап move_to должен быть другим этапом той же воронки",
+	"stage.pipeline_locked":     "Нельзя перенести в другую воронку этап, на котором есть сделки",
+	"stage.cascade_unsupported": "Сделки этапа нельзя удалить вместе с ним: перенесите их на другой этап (move_to)",
+
+	// Воронки
+	"pipeline.default_missing": "Не найдена воронка по умолчанию",
+	"pipeline.no_open_stages":  "В воронке нет открытых этапов",
+	"pipeline.has_deals":       "В воронке есть сделки",
+	"pipeline.last":            "Нельзя удалить последнюю воронку",
+	"pipeline.stage_set":       "Список этапов должен содержать каждый этап воронки ровно один раз",
+
+	// Роли
+	"role.unknown_permission": "Неизвестное право: %s",
+	"role.name_taken":         "Роль с таким названием уже существует",
+	"role.admin_immutable":    "Роль администратора нельзя изменить",
+	"role.default_rename":     "Роль по умолчанию нельзя переименовать",
+	"role.builtin_delete":     "Встроенную роль удалить нельзя",
+	"role.in_use":             "Роль назначена пользователям",
+
+	// Комментарии
+	"comment.author_only":      "Изменять комментарий может только его автор",
+	"comment.edit_expired":     "Срок изменения комментария истёк",
+	"comment.content_required": "Текст комментария обязателен",
+	"comment.parent_invalid":   "Родительский комментарий не найден в этой сделке",
+
+	// Корзина
+	"trash.entity_unknown":   "Неизвестный тип записи: %s",
+	"trash.not_found":        "Запись не найдена в корзине",
+	"trash.parent_deleted":   "Сначала восстановите запись, от которой зависит эта: клиента или этап сделки, сделку комментария",
+	"trash.duplicate":        "Email занят другим пользователем",
+	"trash.referenced":       "На запись ссылаются другие записи",
+	"trash.purge_admin_only": "Окончательно удалять записи может только администратор",
+
+	// Удаление связанных записей
+	"delete.cascade_invalid":   "Параметр cascade должен быть true или false",
+	"delete.move_to_invalid":   "Параметр move_to должен быть ID записи",
+	"delete.policy_conflict":   "Укажите либо cascade, либо move_to",
+	"customer.has_deals":       "У клиента есть сделки: удалите их вместе с ним (cascade=true) или перенесите к другому клиенту (move_to)",
+	"customer.move_to_invalid": "Клиент move_to должен быть другим существующим клиентом",
+	"user.has_comments":        "У пользователя есть комментарии: удалите их вместе с ним (cascade=true) или передайте другому пользователю (move_to)",
+	"user.move_to_invalid":     "Пользователь move_to должен быть другим существующим пользователем",
+
+	// Массовые операции
+	"bulk.selection":  "Укажите либо ids, либо непустой filter",
+	"bulk.too_many":   "Фильтр выбирает больше %d записей: сузьте его",
+	"bulk.no_changes": "Укажите в data хотя бы одно изменение",
+	"bulk.failed":     "Изменения не сохранены: записей с ошибками — %d",
+
+	// Импорт
+	"import.file_required":      "Приложите файл .csv или .xlsx в поле file",
+	"import.file_invalid":       "Файл должен быть CSV в UTF-8 или книгой XLSX",
+	"import.file_empty":         "В файле нет строки заголовков",
+	"import.too_large":          "Файл больше %d МБ",
+	"import.too_many_rows":      "В файле больше %d строк: разделите его",
+	"import.mapping_invalid":    "mapping должен быть JSON-объектом {\"Колонка\":\"поле\"}",
+	"import.column_missing":     "В файле нет колонки «%s»",
+	"import.field_unknown":      "Неизвестное поле: %s",
+	"import.field_duplicate":    "Полю %s сопоставлено несколько колонок",
+	"import.field_required":     "Сопоставьте колонку обязательному полю: %s",
+	"import.not_found":          "Задача импорта не найдена",
+	"import.failed":             "Импорт прерван из-за внутренней ошибки",
+	"import.interrupted":        "Импорт прерван перезапуском сервера",
+	"import.id_invalid":         "Ожидается ID записи",
+	"import.date_invalid":       "Ожидается дата ГГГГ-ММ-ДД или ДД.ММ.ГГГГ",
+	"import.amount_invalid":     "Ожидается неотрицательная сумма, не больше %d знаков после запятой",
+	"import.customer_not_found": "Клиент «%s» не найден",
+	"import.customer_ambiguous": "Клиентов с названием «%s» несколько: укажите customer_id",
+	"import.pipeline_not_found": "Воронка «%s» не найдена",
+	"import.pipeline_ambiguous": "Воронок с названием «%s» несколько: укажите pipeline_id",
+	"import.status_not_found":   "Этап «%s» не найден",
+	"import.status_ambiguous":   "Этапов с названием «%s» несколько: укажите воронку или status_id",
+}
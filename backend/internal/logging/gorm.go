@@ -0,0 +1,76 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// GormLogger передаёт журнал GORM в slog. Ошибки SQL и запросы дольше
+// SlowThreshold попадают в журнал с request_id запроса, в рамках которого
+// выполнялись; остальные запросы пишутся только на уровне debug.
+type GormLogger struct {
+	Logger        *slog.Logger
+	SlowThreshold time.Duration
+}
+
+var (
+	_ gormlogger.Interface = GormLogger{}
+	_ gorm.ParamsFilter    = GormLogger{}
+)
+
+// NewGormLogger возвращает мост журнала GORM; slow = 0 отключает отметку
+// медленных запросов.
+func NewGormLogger(logger *slog.Logger, slow time.Duration) GormLogger {
+	return GormLogger{Logger: logger, SlowThreshold: slow}
+}
+
+// LogMode не меняет уровень: он задаётся уровнем slog.
+func (l GormLogger) LogMode(gormlogger.LogLevel) gormlogger.Interface { return l }
+
+func (l GormLogger) Info(ctx context.Context, msg string, args ...interface{}) {
+	l.Logger.InfoContext(ctx, fmt.Sprintf(msg, args...))
+}
+
+func (l GormLogger) Warn(ctx context.Context, msg string, args ...interface{}) {
+	l.Logger.WarnContext(ctx, fmt.Sprintf(msg, args...))
+}
+
+func (l GormLogger) Error(ctx context.Context, msg string, args ...interface{}) {
+	l.Logger.ErrorContext(ctx, fmt.Sprintf(msg, args...))
+}
+
+func (l GormLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	elapsed := time.Since(begin)
+	level, msg := slog.LevelDebug, "SQL-запрос"
+	switch {
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound):
+		level, msg = slog.LevelError, "Ошибка SQL-запроса"
+	case l.SlowThreshold > 0 && elapsed > l.SlowThreshold:
+		level, msg = slog.LevelWarn, "Медленный SQL-запрос"
+	}
+	if !l.Logger.Enabled(ctx, level) {
+		return
+	}
+	sql, rows := fc()
+	attrs := []slog.Attr{
+		slog.String("sql", sql),
+		slog.Int64("rows", rows),
+		slog.Float64("duration_ms", float64(elapsed.Microseconds())/1000),
+	}
+	if level == slog.LevelError {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+	l.Logger.LogAttrs(ctx, level, msg, attrs...)
+}
+
+// ParamsFilter убирает значения параметров из SQL в журнале: в них бывают
+// персональные данные и хеши паролей.
+func (l GormLogger) ParamsFilter(ctx context.Context, sql string, params ...interface{}) (string, []interface{}) {
+	return sql, nil
+}
@@ -0,0 +1,61 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestGormLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewGormLogger(New(&buf, slog.LevelInfo), 100*time.Millisecond)
+	ctx := WithRequestID(context.Background(), "req-1")
+	query := func() (string, int64) { return "SELECT * FROM deals", 3 }
+
+	// Быстрые запросы и «не найдено» на уровне info не пишутся
+	l.Trace(ctx, time.Now(), query, nil)
+	l.Trace(ctx, time.Now(), query, gorm.ErrRecordNotFound)
+	if buf.Len() != 0 {
+		t.Fatalf("лишние записи: %s", buf.String())
+	}
+
+	cases := []struct {
+		begin time.Time
+		err   error
+		level string
+	}{
+		{time.Now().Add(-time.Second), nil, "WARN"},
+		{time.Now(), errors.New("deadlock detected"), "ERROR"},
+	}
+	for _, tc := range cases {
+		buf.Reset()
+		l.Trace(ctx, tc.begin, query, tc.err)
+		var entry struct {
+			Level     string
+			RequestID string `json:"request_id"`
+			SQL       string
+			Rows      int64
+		}
+		if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+			t.Fatalf("%v: %s", err, buf.String())
+		}
+		if entry.Level != tc.level || entry.RequestID != "req-1" || entry.SQL != "SELECT * FROM deals" || entry.Rows != 3 {
+			t.Errorf("запись: %s", buf.String())
+		}
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	if l, err := ParseLevel("warn"); err != nil || l != slog.LevelWarn {
+		t.Errorf("warn: %v, %v", l, err)
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("неизвестный уровень должен быть ошибкой")
+	}
+}
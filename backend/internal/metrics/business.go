@@ -0,0 +1,62 @@
+package metrics
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"crm-backend/internal/store"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// collectTimeout ограничивает запросы к базе при сборе бизнес-метрик.
+const collectTimeout = 5 * time.Second
+
+// business считает показатели CRM из хранилища при каждом опросе, поэтому
+// они совпадают с данными в базе и после перезапуска сервера.
+type business struct {
+	st            store.Store
+	openDeals     *prometheus.Desc
+	commentsToday *prometheus.Desc
+}
+
+// RegisterBusiness регистрирует в reg бизнес-метрики по данным st.
+func RegisterBusiness(reg prometheus.Registerer, st store.Store) {
+	reg.MustRegister(&business{
+		st: st,
+		openDeals: prometheus.NewDesc(namespace+"_open_deals",
+			"Открытые сделки на этапе воронки.",
+			[]string{"pipeline_id", "status_id", "status"}, nil),
+		commentsToday: prometheus.NewDesc(namespace+"_comments_created_today",
+			"Комментарии, созданные с начала текущих суток (UTC).",
+			nil, nil),
+	})
+}
+
+func (b *business) Describe(ch chan<- *prometheus.Desc) {
+	ch <- b.openDeals
+	ch <- b.commentsToday
+}
+
+func (b *business) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), collectTimeout)
+	defer cancel()
+	st := b.st.WithContext(ctx)
+
+	stages, err := st.Deals().OpenByStage()
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(b.openDeals, err)
+	}
+	for _, stage := range stages {
+		ch <- prometheus.MustNewConstMetric(b.openDeals, prometheus.GaugeValue, float64(stage.Deals),
+			strconv.FormatUint(uint64(stage.PipelineID), 10), strconv.FormatUint(uint64(stage.StatusID), 10), stage.Name)
+	}
+
+	midnight := time.Now().UTC().Truncate(24 * time.Hour)
+	if n, err := st.Comments().CountSince(midnight.Unix()); err != nil {
+		ch <- prometheus.NewInvalidMetric(b.commentsToday, err)
+	} else {
+		ch <- prometheus.MustNewConstMetric(b.commentsToday, prometheus.GaugeValue, float64(n))
+	}
+}
@@ -0,0 +1,60 @@
+// Package metrics собирает метрики сервера в формате Prometheus: HTTP-запросы,
+// пул соединений с базой и бизнес-показатели CRM.
+package metrics
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"crm-backend/internal/i18n"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace — префикс метрик CRM.
+const namespace = "crm"
+
+// NewRegistry возвращает реестр со стандартными метриками Go-рантайма и процесса.
+func NewRegistry() *prometheus.Registry {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return reg
+}
+
+// Handler отдаёт метрики реестра reg. Если token не пуст, запрос должен
+// содержать заголовок Authorization: Bearer <token>. Ошибка одной метрики не
+// мешает отдать остальные.
+func Handler(reg *prometheus.Registry, token string) gin.HandlerFunc {
+	h := promhttp.HandlerFor(reg, promhttp.HandlerOpts{
+		ErrorLog:      errorLog{},
+		ErrorHandling: promhttp.ContinueOnError,
+	})
+	want := []byte("Bearer " + token)
+	return func(c *gin.Context) {
+		if token != "" && subtle.ConstantTimeCompare([]byte(c.GetHeader("Authorization")), want) != 1 {
+			lang := i18n.Negotiate(c.GetHeader("Accept-Language"))
+			c.Header("Content-Language", lang)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"code":    "unauthorized",
+				"message": i18n.T(lang, "metrics.token_required"),
+			})
+			return
+		}
+		h.ServeHTTP(c.Writer, c.Request)
+	}
+}
+
+// errorLog передаёт ошибки сбора метрик в журнал.
+type errorLog struct{}
+
+func (errorLog) Println(v ...interface{}) {
+	slog.Error("Ошибка сбора метрик", "error", fmt.Sprint(v...))
+}
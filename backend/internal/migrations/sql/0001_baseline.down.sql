@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS deal_tags;
+DROP TABLE IF EXISTS tags;
+DROP TABLE IF EXISTS comments;
+DROP TABLE IF EXISTS users;
+DROP TABLE IF EXISTS deals;
+DROP TABLE IF EXISTS statuses;
+DROP TABLE IF EXISTS customers;
@@ -0,0 +1,65 @@
+-- Базовая схема, совпадающая с тем, что создавал db.AutoMigrate.
+-- IF NOT EXISTS позволяет применить миграцию к уже существующей базе.
+
+CREATE TABLE IF NOT EXISTS customers (
+    id         BIGSERIAL PRIMARY KEY,
+    name       TEXT,
+    email      TEXT,
+    phone      TEXT,
+    company    TEXT,
+    created_at BIGINT,
+    updated_at BIGINT,
+    deleted_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_customers_deleted_at ON customers (deleted_at);
+
+CREATE TABLE IF NOT EXISTS statuses (
+    id    BIGSERIAL PRIMARY KEY,
+    name  TEXT,
+    color TEXT
+);
+
+CREATE TABLE IF NOT EXISTS deals (
+    id          BIGSERIAL PRIMARY KEY,
+    title       TEXT,
+    description TEXT,
+    customer_id BIGINT,
+    status_id   BIGINT,
+    created_at  BIGINT,
+    updated_at  BIGINT,
+    deleted_at  TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_deals_deleted_at ON deals (deleted_at);
+
+CREATE TABLE IF NOT EXISTS users (
+    id            BIGSERIAL PRIMARY KEY,
+    name          TEXT,
+    email         TEXT,
+    password_hash TEXT,
+    role          TEXT,
+    deleted_at    TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users (deleted_at);
+
+CREATE TABLE IF NOT EXISTS comments (
+    id         BIGSERIAL PRIMARY KEY,
+    deal_id    BIGINT,
+    user_id    BIGINT,
+    content    TEXT,
+    created_at BIGINT,
+    deleted_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_comments_deleted_at ON comments (deleted_at);
+
+CREATE TABLE IF NOT EXISTS tags (
+    id         BIGSERIAL PRIMARY KEY,
+    name       TEXT,
+    deleted_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_tags_deleted_at ON tags (deleted_at);
+
+CREATE TABLE IF NOT EXISTS deal_tags (
+    tag_id  BIGINT NOT NULL,
+    deal_id BIGINT NOT NULL,
+    PRIMARY KEY (tag_id, deal_id)
+);
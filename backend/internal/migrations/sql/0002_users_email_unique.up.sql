@@ -0,0 +1,2 @@
+-- Email пользователя уникален среди неудалённых записей.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email ON users (email) WHERE deleted_at IS NULL;
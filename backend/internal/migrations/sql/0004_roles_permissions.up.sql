@@ -0,0 +1,51 @@
+CREATE TABLE roles (
+    id          BIGSERIAL PRIMARY KEY,
+    name        TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT ''
+);
+CREATE UNIQUE INDEX idx_roles_name ON roles (name);
+
+CREATE TABLE role_permissions (
+    role_id    BIGINT NOT NULL REFERENCES roles (id) ON DELETE CASCADE,
+    permission TEXT NOT NULL,
+    PRIMARY KEY (role_id, permission)
+);
+
+INSERT INTO roles (name, description) VALUES
+    ('admin', 'Администратор: все права'),
+    ('manager', 'Руководитель продаж'),
+    ('sales_rep', 'Менеджер по продажам'),
+    ('accountant', 'Бухгалтер: только просмотр'),
+    ('user', 'Пользователь по умолчанию');
+
+INSERT INTO role_permissions (role_id, permission)
+SELECT r.id, p.permission
+FROM roles r
+JOIN (VALUES
+    ('manager', 'customers:read'), ('manager', 'customers:write'), ('manager', 'customers:delete'),
+    ('manager', 'deals:read'), ('manager', 'deals:write'), ('manager', 'deals:delete'),
+    ('manager', 'statuses:read'), ('manager', 'statuses:write'), ('manager', 'statuses:delete'),
+    ('manager', 'tags:read'), ('manager', 'tags:write'), ('manager', 'tags:delete'),
+    ('manager', 'comments:read'), ('manager', 'comments:write'), ('manager', 'comments:delete'),
+    ('manager', 'users:read'),
+
+    ('sales_rep', 'customers:read'), ('sales_rep', 'customers:write'),
+    ('sales_rep', 'deals:read'), ('sales_rep', 'deals:write'),
+    ('sales_rep', 'statuses:read'),
+    ('sales_rep', 'tags:read'), ('sales_rep', 'tags:write'),
+    ('sales_rep', 'comments:read'), ('sales_rep', 'comments:write'),
+    ('sales_rep', 'users:read'),
+
+    ('accountant', 'customers:read'), ('accountant', 'deals:read'), ('accountant', 'statuses:read'),
+    ('accountant', 'tags:read'), ('accountant', 'comments:read'), ('accountant', 'users:read'),
+
+    -- Прежние права роли user: всё, кроме удаления статусов и пользователей
+    ('user', 'customers:read'), ('user', 'customers:write'), ('user', 'customers:delete'),
+    ('user', 'deals:read'), ('user', 'deals:write'), ('user', 'deals:delete'),
+    ('user', 'statuses:read'), ('user', 'statuses:write'),
+    ('user', 'tags:read'), ('user', 'tags:write'), ('user', 'tags:delete'),
+    ('user', 'comments:read'), ('user', 'comments:write'), ('user', 'comments:delete'),
+    ('user', 'users:read')
+) AS p (role, permission) ON p.role = r.name;
+
+UPDATE users SET role = 'user' WHERE role IS NULL OR role NOT IN (SELECT name FROM roles);
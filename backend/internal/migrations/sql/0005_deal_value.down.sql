@@ -0,0 +1,11 @@
+DELETE FROM role_permissions WHERE permission = 'exchange_rates:manage';
+DROP TABLE IF EXISTS exchange_rates;
+DROP INDEX IF EXISTS idx_deals_expected_close_date;
+ALTER TABLE deals
+    DROP CONSTRAINT IF EXISTS chk_deals_probability,
+    DROP CONSTRAINT IF EXISTS chk_deals_amount,
+    DROP COLUMN IF EXISTS closed_at,
+    DROP COLUMN IF EXISTS probability,
+    DROP COLUMN IF EXISTS expected_close_date,
+    DROP COLUMN IF EXISTS currency,
+    DROP COLUMN IF EXISTS amount;
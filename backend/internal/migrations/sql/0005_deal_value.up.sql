@@ -0,0 +1,21 @@
+ALTER TABLE deals
+    ADD COLUMN amount              BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN currency            TEXT NOT NULL DEFAULT '',
+    ADD COLUMN expected_close_date DATE,
+    ADD COLUMN probability         INTEGER,
+    ADD COLUMN closed_at           BIGINT;
+
+ALTER TABLE deals
+    ADD CONSTRAINT chk_deals_amount CHECK (amount >= 0),
+    ADD CONSTRAINT chk_deals_probability CHECK (probability BETWEEN 0 AND 100);
+
+CREATE INDEX idx_deals_expected_close_date ON deals (expected_close_date);
+
+CREATE TABLE exchange_rates (
+    currency   TEXT PRIMARY KEY,
+    rate       DOUBLE PRECISION NOT NULL CHECK (rate > 0),
+    updated_at BIGINT
+);
+
+INSERT INTO role_permissions (role_id, permission)
+SELECT id, 'exchange_rates:manage' FROM roles WHERE name = 'manager';
@@ -0,0 +1,13 @@
+DROP INDEX IF EXISTS idx_deals_pipeline_id;
+ALTER TABLE deals DROP COLUMN IF EXISTS pipeline_id;
+
+DROP INDEX IF EXISTS idx_statuses_pipeline_position;
+ALTER TABLE statuses
+    DROP CONSTRAINT IF EXISTS chk_statuses_type,
+    DROP CONSTRAINT IF EXISTS chk_statuses_probability,
+    DROP COLUMN IF EXISTS type,
+    DROP COLUMN IF EXISTS probability,
+    DROP COLUMN IF EXISTS position,
+    DROP COLUMN IF EXISTS pipeline_id;
+
+DROP TABLE IF EXISTS pipelines;
@@ -0,0 +1,34 @@
+CREATE TABLE pipelines (
+    id         BIGSERIAL PRIMARY KEY,
+    name       TEXT NOT NULL,
+    position   INTEGER NOT NULL DEFAULT 0,
+    created_at BIGINT,
+    updated_at BIGINT
+);
+
+INSERT INTO pipelines (name, position, created_at, updated_at)
+VALUES ('Основная воронка', 0, EXTRACT(EPOCH FROM now())::BIGINT, EXTRACT(EPOCH FROM now())::BIGINT);
+
+-- Существующие статусы становятся этапами основной воронки в порядке создания
+ALTER TABLE statuses
+    ADD COLUMN pipeline_id BIGINT REFERENCES pipelines (id),
+    ADD COLUMN position    INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN probability INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN type        TEXT NOT NULL DEFAULT 'open';
+
+UPDATE statuses s
+SET pipeline_id = (SELECT MIN(id) FROM pipelines),
+    position = o.position
+FROM (SELECT id, ROW_NUMBER() OVER (ORDER BY id) - 1 AS position FROM statuses) o
+WHERE o.id = s.id;
+
+ALTER TABLE statuses
+    ALTER COLUMN pipeline_id SET NOT NULL,
+    ADD CONSTRAINT chk_statuses_probability CHECK (probability BETWEEN 0 AND 100),
+    ADD CONSTRAINT chk_statuses_type CHECK (type IN ('open', 'won', 'lost'));
+CREATE INDEX idx_statuses_pipeline_position ON statuses (pipeline_id, position);
+
+ALTER TABLE deals ADD COLUMN pipeline_id BIGINT REFERENCES pipelines (id);
+UPDATE deals d
+SET pipeline_id = COALESCE((SELECT s.pipeline_id FROM statuses s WHERE s.id = d.status_id), (SELECT MIN(id) FROM pipelines));
+CREATE INDEX idx_deals_pipeline_id ON deals (pipeline_id);
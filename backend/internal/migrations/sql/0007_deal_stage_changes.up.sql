@@ -0,0 +1,16 @@
+CREATE TABLE deal_stage_changes (
+    id             BIGSERIAL PRIMARY KEY,
+    deal_id        BIGINT NOT NULL REFERENCES deals (id) ON DELETE CASCADE,
+    from_status_id BIGINT,
+    to_status_id   BIGINT NOT NULL,
+    user_id        BIGINT,
+    changed_at     BIGINT NOT NULL
+);
+CREATE INDEX idx_deal_stage_changes_deal_id ON deal_stage_changes (deal_id, changed_at);
+CREATE INDEX idx_deal_stage_changes_changed_at ON deal_stage_changes (changed_at);
+
+-- У существующих сделок история начинается с текущего этапа в момент создания
+INSERT INTO deal_stage_changes (deal_id, from_status_id, to_status_id, changed_at)
+SELECT id, NULL, status_id, COALESCE(created_at, EXTRACT(EPOCH FROM now())::BIGINT)
+FROM deals
+WHERE status_id IS NOT NULL AND status_id <> 0;
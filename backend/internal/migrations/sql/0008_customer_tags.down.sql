@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_deal_tags_deal_id;
+DROP TABLE IF EXISTS customer_tags;
@@ -0,0 +1,9 @@
+CREATE TABLE customer_tags (
+    tag_id      BIGINT NOT NULL,
+    customer_id BIGINT NOT NULL,
+    PRIMARY KEY (tag_id, customer_id)
+);
+
+-- Теги сделки и клиента выбираются по владельцу, а первичный ключ начинается с tag_id
+CREATE INDEX idx_customer_tags_customer_id ON customer_tags (customer_id);
+CREATE INDEX IF NOT EXISTS idx_deal_tags_deal_id ON deal_tags (deal_id);
@@ -0,0 +1,10 @@
+ALTER TABLE comments ADD COLUMN edited_at BIGINT;
+
+CREATE TABLE comment_revisions (
+    id         BIGSERIAL PRIMARY KEY,
+    comment_id BIGINT NOT NULL REFERENCES comments (id) ON DELETE CASCADE,
+    content    TEXT NOT NULL,
+    edited_by  BIGINT,
+    edited_at  BIGINT NOT NULL
+);
+CREATE INDEX idx_comment_revisions_comment_id ON comment_revisions (comment_id, edited_at);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS comment_mentions;
+DROP INDEX IF EXISTS idx_comments_deal_id;
+ALTER TABLE comments DROP COLUMN IF EXISTS parent_id;
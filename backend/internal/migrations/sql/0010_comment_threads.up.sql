@@ -0,0 +1,10 @@
+ALTER TABLE comments ADD COLUMN parent_id BIGINT REFERENCES comments (id) ON DELETE SET NULL;
+CREATE INDEX idx_comments_parent_id ON comments (parent_id);
+CREATE INDEX idx_comments_deal_id ON comments (deal_id, created_at);
+
+CREATE TABLE comment_mentions (
+    comment_id BIGINT NOT NULL REFERENCES comments (id) ON DELETE CASCADE,
+    user_id    BIGINT NOT NULL,
+    PRIMARY KEY (comment_id, user_id)
+);
+CREATE INDEX idx_comment_mentions_user_id ON comment_mentions (user_id);
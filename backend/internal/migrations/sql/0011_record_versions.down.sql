@@ -0,0 +1,8 @@
+ALTER TABLE comments DROP COLUMN IF EXISTS version;
+ALTER TABLE roles DROP COLUMN IF EXISTS version;
+ALTER TABLE users DROP COLUMN IF EXISTS version;
+ALTER TABLE tags DROP COLUMN IF EXISTS version;
+ALTER TABLE statuses DROP COLUMN IF EXISTS version;
+ALTER TABLE pipelines DROP COLUMN IF EXISTS version;
+ALTER TABLE deals DROP COLUMN IF EXISTS version;
+ALTER TABLE customers DROP COLUMN IF EXISTS version;
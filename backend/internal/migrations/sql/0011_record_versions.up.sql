@@ -0,0 +1,10 @@
+-- Версия записи для оптимистичной блокировки: растёт при каждом изменении,
+-- из неё строится ETag.
+ALTER TABLE customers ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE deals ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE pipelines ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE statuses ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE tags ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE users ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE roles ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE comments ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
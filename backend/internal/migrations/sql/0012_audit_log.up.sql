@@ -0,0 +1,15 @@
+-- Журнал изменений. Ссылок на пользователя и запись нет: журнал переживает
+-- их удаление.
+CREATE TABLE audit_entries (
+    id         BIGSERIAL PRIMARY KEY,
+    user_id    BIGINT,
+    action     VARCHAR(16) NOT NULL,
+    entity     VARCHAR(32) NOT NULL,
+    entity_id  BIGINT NOT NULL,
+    changes    JSONB NOT NULL DEFAULT '{}',
+    request_id VARCHAR(128) NOT NULL DEFAULT '',
+    created_at BIGINT NOT NULL
+);
+CREATE INDEX idx_audit_entries_entity ON audit_entries (entity, entity_id);
+CREATE INDEX idx_audit_entries_user_id ON audit_entries (user_id);
+CREATE INDEX idx_audit_entries_created_at ON audit_entries (created_at);
@@ -0,0 +1,2 @@
+DELETE FROM statuses WHERE deleted_at IS NOT NULL;
+ALTER TABLE statuses DROP COLUMN IF EXISTS deleted_at;
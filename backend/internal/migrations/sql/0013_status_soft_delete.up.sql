@@ -0,0 +1,3 @@
+-- Этапы удаляются мягко, как остальные записи, и попадают в корзину
+ALTER TABLE statuses ADD COLUMN deleted_at TIMESTAMPTZ;
+CREATE INDEX idx_statuses_deleted_at ON statuses (deleted_at);
@@ -0,0 +1,15 @@
+ALTER TABLE customer_tags
+    DROP CONSTRAINT IF EXISTS fk_customer_tags_tag,
+    DROP CONSTRAINT IF EXISTS fk_customer_tags_customer;
+ALTER TABLE deal_tags
+    DROP CONSTRAINT IF EXISTS fk_deal_tags_tag,
+    DROP CONSTRAINT IF EXISTS fk_deal_tags_deal;
+ALTER TABLE deal_stage_changes DROP CONSTRAINT IF EXISTS fk_deal_stage_changes_user;
+ALTER TABLE comment_revisions DROP CONSTRAINT IF EXISTS fk_comment_revisions_edited_by;
+ALTER TABLE comment_mentions DROP CONSTRAINT IF EXISTS fk_comment_mentions_user;
+ALTER TABLE comments
+    DROP CONSTRAINT IF EXISTS fk_comments_user,
+    DROP CONSTRAINT IF EXISTS fk_comments_deal;
+ALTER TABLE deals
+    DROP CONSTRAINT IF EXISTS fk_deals_status,
+    DROP CONSTRAINT IF EXISTS fk_deals_customer;
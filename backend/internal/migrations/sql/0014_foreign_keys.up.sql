@@ -0,0 +1,42 @@
+-- Сделки удалённых клиентов и комментарии удалённых сделок раньше оставались
+-- активными: удаляем их вместе с владельцем, чтобы из корзины они
+-- восстанавливались вместе с ним
+UPDATE deals d SET deleted_at = c.deleted_at
+FROM customers c
+WHERE d.customer_id = c.id AND d.deleted_at IS NULL AND c.deleted_at IS NOT NULL;
+UPDATE comments cm SET deleted_at = d.deleted_at
+FROM deals d
+WHERE cm.deal_id = d.id AND cm.deleted_at IS NULL AND d.deleted_at IS NOT NULL;
+
+-- Ссылки на записи, которых уже нет, нечем заменить: упоминания и связи с
+-- тегами удаляем, автора правки и перехода этапа забываем
+DELETE FROM comment_mentions WHERE user_id NOT IN (SELECT id FROM users);
+DELETE FROM deal_tags WHERE deal_id NOT IN (SELECT id FROM deals) OR tag_id NOT IN (SELECT id FROM tags);
+DELETE FROM customer_tags WHERE customer_id NOT IN (SELECT id FROM customers) OR tag_id NOT IN (SELECT id FROM tags);
+UPDATE comment_revisions SET edited_by = NULL WHERE edited_by NOT IN (SELECT id FROM users);
+UPDATE deal_stage_changes SET user_id = NULL WHERE user_id NOT IN (SELECT id FROM users);
+
+-- Сделки и комментарии в старых базах могут ссылаться на записи, удалённые
+-- окончательно до появления корзины (или на этап 0). Удалить их молча
+-- нельзя, поэтому эти ключи не проверяют существующие строки (NOT VALID), но
+-- действуют для всех новых и изменённых ссылок
+ALTER TABLE deals
+    ADD CONSTRAINT fk_deals_customer FOREIGN KEY (customer_id) REFERENCES customers (id) NOT VALID,
+    ADD CONSTRAINT fk_deals_status FOREIGN KEY (status_id) REFERENCES statuses (id) NOT VALID;
+ALTER TABLE comments
+    ADD CONSTRAINT fk_comments_deal FOREIGN KEY (deal_id) REFERENCES deals (id) ON DELETE CASCADE NOT VALID,
+    ADD CONSTRAINT fk_comments_user FOREIGN KEY (user_id) REFERENCES users (id) NOT VALID;
+
+-- История этапов ссылается на этапы без ключа: она переживает их удаление
+ALTER TABLE comment_mentions
+    ADD CONSTRAINT fk_comment_mentions_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
+ALTER TABLE comment_revisions
+    ADD CONSTRAINT fk_comment_revisions_edited_by FOREIGN KEY (edited_by) REFERENCES users (id) ON DELETE SET NULL;
+ALTER TABLE deal_stage_changes
+    ADD CONSTRAINT fk_deal_stage_changes_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE SET NULL;
+ALTER TABLE deal_tags
+    ADD CONSTRAINT fk_deal_tags_deal FOREIGN KEY (deal_id) REFERENCES deals (id) ON DELETE CASCADE,
+    ADD CONSTRAINT fk_deal_tags_tag FOREIGN KEY (tag_id) REFERENCES tags (id) ON DELETE CASCADE;
+ALTER TABLE customer_tags
+    ADD CONSTRAINT fk_customer_tags_customer FOREIGN KEY (customer_id) REFERENCES customers (id) ON DELETE CASCADE,
+    ADD CONSTRAINT fk_customer_tags_tag FOREIGN KEY (tag_id) REFERENCES tags (id) ON DELETE CASCADE;
@@ -0,0 +1,23 @@
+-- Задачи импорта клиентов и сделок из CSV и XLSX. Отчёт об отклонённых
+-- строках и предпросмотр хранятся в самой задаче. Задача переживает удаление
+-- пользователя, который её запустил, как и журнал изменений.
+CREATE TABLE import_jobs (
+    id          BIGSERIAL PRIMARY KEY,
+    entity      VARCHAR(32) NOT NULL,
+    file_name   VARCHAR(255) NOT NULL DEFAULT '',
+    dry_run     BOOLEAN NOT NULL DEFAULT FALSE,
+    mapping     JSONB NOT NULL DEFAULT '{}',
+    status      VARCHAR(16) NOT NULL,
+    total       INTEGER NOT NULL DEFAULT 0,
+    processed   INTEGER NOT NULL DEFAULT 0,
+    imported    INTEGER NOT NULL DEFAULT 0,
+    rejected    INTEGER NOT NULL DEFAULT 0,
+    errors      JSONB NOT NULL DEFAULT '[]',
+    preview     JSONB NOT NULL DEFAULT '[]',
+    failure     TEXT NOT NULL DEFAULT '',
+    user_id     BIGINT,
+    created_at  BIGINT NOT NULL,
+    updated_at  BIGINT NOT NULL,
+    finished_at BIGINT
+);
+CREATE INDEX idx_import_jobs_user_id ON import_jobs (user_id);
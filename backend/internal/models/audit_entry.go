@@ -0,0 +1,63 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// Действия в журнале изменений.
+const (
+	AuditCreate = "create"
+	AuditUpdate = "update"
+	AuditDelete = "delete"
+	// Восстановление из корзины и окончательное удаление из неё
+	AuditRestore = "restore"
+	AuditPurge   = "purge"
+)
+
+// AuditEntry — запись журнала изменений: кто (UserID, пусто для анонимного
+// запроса и очистки корзины по сроку хранения), что сделал (Action) с какой записью (Entity — имя ресурса в API,
+// EntityID) и какие поля при этом изменились.
+type AuditEntry struct {
+	ID        uint         `gorm:"primaryKey" json:"id"`
+	UserID    *uint        `json:"user_id"`
+	Action    string       `json:"action"`
+	Entity    string       `json:"entity"`
+	EntityID  uint         `json:"entity_id"`
+	Changes   AuditChanges `gorm:"type:jsonb" json:"changes"`
+	RequestID string       `json:"request_id"`
+	CreatedAt int64        `json:"created_at"`
+}
+
+// AuditChange — значение поля до и после изменения; у созданной записи
+// Before пуст, у удалённой — After.
+type AuditChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// AuditChanges — изменённые поля по их JSON-именам. В базе хранится в JSONB.
+type AuditChanges map[string]AuditChange
+
+func (c AuditChanges) Value() (driver.Value, error) {
+	if c == nil {
+		return "{}", nil
+	}
+	b, err := json.Marshal(c)
+	return string(b), err
+}
+
+func (c *AuditChanges) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, c)
+	case string:
+		return json.Unmarshal([]byte(v), c)
+	case nil:
+		*c = nil
+		return nil
+	default:
+		return fmt.Errorf("нельзя прочитать изменения из %T", value)
+	}
+}
@@ -3,12 +3,17 @@ package models
 import "gorm.io/gorm"
 
 type Comment struct {
-	ID        uint           `gorm:"primaryKey" json:"id"`
-	DealID    uint           `json:"deal_id"`
-	Deal      Deal           `gorm:"foreignKey:DealID"`
-	UserID    uint           `json:"user_id"`
-	User      User           `gorm:"foreignKey:UserID"`
-	Content   string         `json:"content"`
-	CreatedAt int64          `json:"created_at"`
-	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	ID         uint             `gorm:"primaryKey" json:"id"`
+	DealID     uint             `json:"deal_id"`
+	Deal       Deal             `gorm:"foreignKey:DealID" binding:"-"`
+	ParentID   *uint            `json:"parent_id"` // комментарий, на который это ответ
+	UserID     uint             `json:"user_id"`
+	User       User             `gorm:"foreignKey:UserID" binding:"-"`
+	Content    string           `json:"content"`
+	Mentions   []CommentMention `gorm:"foreignKey:CommentID" json:"-"`
+	MentionIDs []uint           `gorm:"-" json:"mentions"`
+	CreatedAt  int64            `json:"created_at"`
+	EditedAt   *int64           `json:"edited_at"`
+	Version    uint             `gorm:"not null;default:1" json:"version"`
+	DeletedAt  gorm.DeletedAt   `gorm:"index" json:"-"`
 }
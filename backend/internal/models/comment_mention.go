@@ -0,0 +1,7 @@
+package models
+
+// CommentMention — упоминание пользователя (@имя) в тексте комментария.
+type CommentMention struct {
+	CommentID uint `gorm:"primaryKey" json:"comment_id"`
+	UserID    uint `gorm:"primaryKey;index" json:"user_id"`
+}
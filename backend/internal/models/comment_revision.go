@@ -0,0 +1,10 @@
+package models
+
+// CommentRevision — прежний текст комментария, сохранённый при его изменении.
+type CommentRevision struct {
+	ID        uint   `gorm:"primaryKey" json:"id"`
+	CommentID uint   `gorm:"index" json:"comment_id"`
+	Content   string `json:"content"`
+	EditedBy  *uint  `json:"edited_by"`
+	EditedAt  int64  `json:"edited_at"`
+}
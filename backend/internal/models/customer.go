@@ -4,11 +4,14 @@ import "gorm.io/gorm"
 
 type Customer struct {
 	ID        uint           `gorm:"primaryKey" json:"id"`
-	Name      string         `json:"name"`
-	Email     string         `json:"email"`
-	Phone     string         `json:"phone"`
-	Company   string         `json:"company"`
+	Name      string         `json:"name" binding:"required,max=255"`
+	Email     string         `json:"email" binding:"omitempty,email,max=255"`
+	Phone     string         `json:"phone" binding:"omitempty,e164"`
+	Company   string         `json:"company" binding:"max=255"`
+	Tags      []Tag          `gorm:"many2many:customer_tags;" json:"-"`
+	TagIDs    []uint         `gorm:"-" json:"tag_ids" binding:"dive,min=1"`
 	CreatedAt int64          `json:"created_at"`
 	UpdatedAt int64          `json:"updated_at"`
+	Version   uint           `gorm:"not null;default:1" json:"version"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 }
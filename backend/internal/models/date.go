@@ -0,0 +1,60 @@
+package models
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Date — календарная дата без времени. В JSON передаётся как "2006-01-02"
+// (формат DateInput в react-admin), в базе хранится в колонке DATE.
+type Date struct {
+	time.Time
+}
+
+const dateLayout = "2006-01-02"
+
+func (d Date) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + d.Format(dateLayout) + `"`), nil
+}
+
+func (d *Date) UnmarshalJSON(b []byte) error {
+	s := strings.Trim(string(b), `"`)
+	if s == "" || s == "null" {
+		d.Time = time.Time{}
+		return nil
+	}
+	// DateInput присылает дату, DateTimeInput — полную метку времени
+	if len(s) > len(dateLayout) {
+		s = s[:len(dateLayout)]
+	}
+	t, err := time.Parse(dateLayout, s)
+	if err != nil {
+		return fmt.Errorf("некорректная дата %q, ожидается ГГГГ-ММ-ДД", s)
+	}
+	d.Time = t
+	return nil
+}
+
+func (d Date) Value() (driver.Value, error) {
+	return d.Format(dateLayout), nil
+}
+
+func (d *Date) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case time.Time:
+		d.Time = v
+	case string:
+		t, err := time.Parse(dateLayout, v)
+		if err != nil {
+			return err
+		}
+		d.Time = t
+	case []byte:
+		return d.Scan(string(v))
+	default:
+		return fmt.Errorf("нельзя прочитать дату из %T", value)
+	}
+	return nil
+}
@@ -3,14 +3,23 @@ package models
 import "gorm.io/gorm"
 
 type Deal struct {
-	ID          uint           `gorm:"primaryKey" json:"id"`
-	Title       string         `json:"title"`
-	Description string         `json:"description"`
-	CustomerID  uint           `json:"customer_id"`
-	Customer    Customer       `gorm:"foreignKey:CustomerID"`
-	StatusID    uint           `json:"status_id"`
-	Status      Status         `gorm:"foreignKey:StatusID"`
-	CreatedAt   int64          `json:"created_at"`
-	UpdatedAt   int64          `json:"updated_at"`
-	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+	ID                uint           `gorm:"primaryKey" json:"id"`
+	Title             string         `json:"title" binding:"required,max=255"`
+	Description       string         `json:"description" binding:"max=10000"`
+	CustomerID        uint           `json:"customer_id" binding:"required"`
+	Customer          Customer       `gorm:"foreignKey:CustomerID" binding:"-"`
+	PipelineID        uint           `json:"pipeline_id"`
+	StatusID          uint           `json:"status_id"`
+	Status            Status         `gorm:"foreignKey:StatusID" binding:"-"`
+	Amount            int64          `json:"amount" binding:"min=0"`             // сумма в минимальных единицах валюты (копейках, центах)
+	Currency          string         `json:"currency" binding:"omitempty,len=3"` // код ISO 4217
+	ExpectedCloseDate *Date          `gorm:"type:date" json:"expected_close_date"`
+	Probability       *int           `json:"probability" binding:"omitempty,min=0,max=100"` // вероятность закрытия, 0–100
+	ClosedAt          *int64         `json:"closed_at"`
+	Tags              []Tag          `gorm:"many2many:deal_tags;" json:"-"`
+	TagIDs            []uint         `gorm:"-" json:"tag_ids" binding:"dive,min=1"`
+	CreatedAt         int64          `json:"created_at"`
+	UpdatedAt         int64          `json:"updated_at"`
+	Version           uint           `gorm:"not null;default:1" json:"version"`
+	DeletedAt         gorm.DeletedAt `gorm:"index" json:"-"`
 }
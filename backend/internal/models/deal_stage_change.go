@@ -0,0 +1,12 @@
+package models
+
+// DealStageChange — переход сделки между этапами. FromStatusID пуст у первой
+// записи, созданной вместе со сделкой.
+type DealStageChange struct {
+	ID           uint  `gorm:"primaryKey" json:"id"`
+	DealID       uint  `gorm:"index" json:"deal_id"`
+	FromStatusID *uint `json:"from_status_id"`
+	ToStatusID   uint  `json:"to_status_id"`
+	UserID       *uint `json:"user_id"`
+	ChangedAt    int64 `json:"changed_at"`
+}
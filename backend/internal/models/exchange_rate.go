@@ -0,0 +1,9 @@
+package models
+
+// ExchangeRate — курс валюты к базовой: сколько единиц базовой валюты стоит
+// одна единица Currency.
+type ExchangeRate struct {
+	Currency  string  `gorm:"primaryKey" json:"id"`
+	Rate      float64 `json:"rate"`
+	UpdatedAt int64   `json:"updated_at"`
+}
@@ -0,0 +1,120 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// Состояния задачи импорта.
+const (
+	ImportQueued  = "queued"
+	ImportRunning = "running"
+	ImportDone    = "done"
+	ImportFailed  = "failed"
+)
+
+// ImportJob — фоновая задача импорта клиентов или сделок (Entity — имя
+// ресурса в API) из загруженного файла. Mapping сопоставляет колонки файла
+// полям записи. Total — число строк с данными, Processed — уже проверенные,
+// Imported и Rejected — сохранённые и отклонённые из них; отчёт об
+// отклонённых строках — в Errors. При пробном запуске (DryRun) ничего не
+// сохраняется, а первые подходящие записи попадают в Preview. Failure —
+// причина, по которой задача прервалась целиком.
+type ImportJob struct {
+	ID         uint            `gorm:"primaryKey" json:"id"`
+	Entity     string          `json:"entity"`
+	FileName   string          `json:"file_name"`
+	DryRun     bool            `json:"dry_run"`
+	Mapping    ImportMapping   `gorm:"type:jsonb" json:"mapping"`
+	Status     string          `json:"status"`
+	Total      int             `json:"total"`
+	Processed  int             `json:"processed"`
+	Imported   int             `json:"imported"`
+	Rejected   int             `json:"rejected"`
+	Errors     ImportRowErrors `gorm:"type:jsonb" json:"errors"`
+	Preview    ImportPreview   `gorm:"type:jsonb" json:"preview"`
+	Failure    string          `json:"failure"`
+	UserID     *uint           `json:"user_id"`
+	CreatedAt  int64           `json:"created_at"`
+	UpdatedAt  int64           `json:"updated_at"`
+	FinishedAt *int64          `json:"finished_at"`
+}
+
+// Finished сообщает, завершилась ли задача, успешно или нет.
+func (j ImportJob) Finished() bool {
+	return j.Status == ImportDone || j.Status == ImportFailed
+}
+
+// ImportMapping — поле записи по заголовку колонки файла.
+type ImportMapping map[string]string
+
+// ImportFieldError — ошибка в поле строки файла: Column — заголовок колонки,
+// из которой взято поле, пуст для полей, не сопоставленных ни одной колонке.
+type ImportFieldError struct {
+	Field   string `json:"field"`
+	Column  string `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+// ImportRowError — отклонённая строка: её номер в файле, значения колонок и
+// ошибки.
+type ImportRowError struct {
+	Row    int                `json:"row"`
+	Values map[string]string  `json:"values"`
+	Errors []ImportFieldError `json:"errors"`
+}
+
+// ImportRowErrors — отчёт об отклонённых строках. В базе хранится в JSONB.
+type ImportRowErrors []ImportRowError
+
+// ImportPreview — записи, которые будут созданы, в их JSON-представлении.
+// В базе хранится в JSONB.
+type ImportPreview []json.RawMessage
+
+func (m ImportMapping) Value() (driver.Value, error) {
+	return jsonValue(m, "{}")
+}
+
+func (m *ImportMapping) Scan(value interface{}) error {
+	return scanJSON(value, m)
+}
+
+func (e ImportRowErrors) Value() (driver.Value, error) {
+	return jsonValue(e, "[]")
+}
+
+func (e *ImportRowErrors) Scan(value interface{}) error {
+	return scanJSON(value, e)
+}
+
+func (p ImportPreview) Value() (driver.Value, error) {
+	return jsonValue(p, "[]")
+}
+
+func (p *ImportPreview) Scan(value interface{}) error {
+	return scanJSON(value, p)
+}
+
+// jsonValue кодирует v для колонки JSONB; пустое значение — empty.
+func jsonValue(v interface{}, empty string) (driver.Value, error) {
+	b, err := json.Marshal(v)
+	if err != nil || string(b) == "null" {
+		return empty, err
+	}
+	return string(b), nil
+}
+
+// scanJSON читает значение колонки JSONB в dest.
+func scanJSON(value interface{}, dest interface{}) error {
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, dest)
+	case string:
+		return json.Unmarshal([]byte(v), dest)
+	case nil:
+		return nil
+	default:
+		return fmt.Errorf("нельзя прочитать JSON из %T", value)
+	}
+}
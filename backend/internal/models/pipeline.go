@@ -0,0 +1,12 @@
+package models
+
+// Pipeline — воронка продаж с упорядоченными этапами.
+type Pipeline struct {
+	ID        uint     `gorm:"primaryKey" json:"id"`
+	Name      string   `json:"name" binding:"required,max=100"`
+	Position  int      `json:"position"`
+	Stages    []Status `gorm:"foreignKey:PipelineID" json:"stages" binding:"dive"`
+	CreatedAt int64    `json:"created_at"`
+	UpdatedAt int64    `json:"updated_at"`
+	Version   uint     `gorm:"not null;default:1" json:"version"`
+}
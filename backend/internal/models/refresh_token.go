@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// RefreshToken хранит хеш refresh-токена. Все токены, полученные ротацией
+// от одного логина, образуют семейство (FamilyID) — оно же сессия.
+type RefreshToken struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	UserID       uint       `gorm:"index" json:"user_id"`
+	FamilyID     string     `gorm:"index" json:"family_id"`
+	TokenHash    string     `gorm:"uniqueIndex" json:"-"`
+	ExpiresAt    time.Time  `json:"expires_at"`
+	RevokedAt    *time.Time `json:"revoked_at"`
+	ReplacedByID *uint      `json:"replaced_by_id"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
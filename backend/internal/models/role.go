@@ -0,0 +1,17 @@
+package models
+
+// Role — именованный набор прав. Пользователь ссылается на роль по имени (User.Role).
+type Role struct {
+	ID          uint             `gorm:"primaryKey" json:"id"`
+	Name        string           `gorm:"uniqueIndex" json:"name"`
+	Description string           `json:"description"`
+	Grants      []RolePermission `gorm:"foreignKey:RoleID" json:"-"`
+	Permissions []string         `gorm:"-" json:"permissions"`
+	Version     uint             `gorm:"not null;default:1" json:"version"`
+}
+
+// RolePermission — право, выданное роли, например "deals:write".
+type RolePermission struct {
+	RoleID     uint   `gorm:"primaryKey" json:"role_id"`
+	Permission string `gorm:"primaryKey" json:"permission"`
+}
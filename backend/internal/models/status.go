@@ -1,7 +1,29 @@
 package models
 
+import "gorm.io/gorm"
+
+// Типы этапов воронки: открытый, выигрыш и проигрыш. Сделка на этапе won или
+// lost считается закрытой.
+const (
+	StageOpen = "open"
+	StageWon  = "won"
+	StageLost = "lost"
+)
+
+// Status — этап воронки продаж.
 type Status struct {
-	ID    uint   `gorm:"primaryKey" json:"id"`
-	Name  string `json:"name"`
-	Color string `json:"color"`
+	ID          uint           `gorm:"primaryKey" json:"id"`
+	Name        string         `json:"name" binding:"required,max=100"`
+	Color       string         `json:"color" binding:"omitempty,hexcolor"`
+	PipelineID  uint           `json:"pipeline_id"`
+	Position    int            `json:"position"`
+	Probability int            `json:"probability" binding:"min=0,max=100"` // вероятность по умолчанию для сделок на этапе, 0–100
+	Type        string         `json:"type" binding:"omitempty,oneof=open won lost"`
+	Version     uint           `gorm:"not null;default:1" json:"version"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// Closed сообщает, является ли этап завершающим.
+func (s Status) Closed() bool {
+	return s.Type == StageWon || s.Type == StageLost
 }
@@ -4,7 +4,9 @@ import "gorm.io/gorm"
 
 type Tag struct {
 	ID        uint           `gorm:"primaryKey" json:"id"`
-	Name      string         `json:"name"`
+	Name      string         `json:"name" binding:"required,max=64"`
 	Deals     []Deal         `gorm:"many2many:deal_tags;"`
+	Customers []Customer     `gorm:"many2many:customer_tags;" json:"-"`
+	Version   uint           `gorm:"not null;default:1" json:"version"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 }
@@ -0,0 +1,12 @@
+package models
+
+// TrashItem — мягко удалённая запись в корзине. Entity — имя ресурса в API
+// (customers, deals, …), ID вида "deals:5" уникален во всей корзине, как
+// того требует react-admin.
+type TrashItem struct {
+	ID        string `json:"id"`
+	Entity    string `json:"entity"`
+	EntityID  uint   `json:"entity_id"`
+	Title     string `json:"title"`
+	DeletedAt int64  `json:"deleted_at"`
+}
@@ -4,9 +4,11 @@ import "gorm.io/gorm"
 
 type User struct {
 	ID           uint           `gorm:"primaryKey" json:"id"`
-	Name         string         `json:"name"`
-	Email        string         `json:"email"`
+	Name         string         `json:"name" binding:"required,max=255"`
+	Email        string         `json:"email" binding:"required,email,max=255"`
 	PasswordHash string         `json:"-"`
-	Role         string         `json:"role"`
+	Role         string         `json:"role" binding:"max=64"`
+	Disabled     bool           `json:"disabled"`
+	Version      uint           `gorm:"not null;default:1" json:"version"`
 	DeletedAt    gorm.DeletedAt `gorm:"index" json:"-"`
 }
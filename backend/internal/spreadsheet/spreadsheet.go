@@ -0,0 +1,80 @@
+// Package spreadsheet читает таблицы из CSV и XLSX в строки текстовых ячеек.
+// Форматы разбираются стандартной библиотекой: XLSX — это ZIP с XML внутри,
+// и для импорта достаточно значений ячеек первого листа.
+package spreadsheet
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// Ошибки чтения: неподдерживаемый или повреждённый файл и слишком длинная
+// таблица.
+var (
+	ErrFormat  = errors.New("Неподдерживаемый или повреждённый файл")
+	ErrTooLong = errors.New("Слишком много строк")
+)
+
+// Read читает таблицу из файла name (формат определяется по расширению:
+// .csv или .xlsx). Строка i результата — строка i+1 файла; пустые строки
+// сохраняются, чтобы номера строк совпадали с файлом. Если строк больше
+// maxRows, возвращается ErrTooLong.
+func Read(name string, r io.ReaderAt, size int64, maxRows int) ([][]string, error) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".csv":
+		return readCSV(io.NewSectionReader(r, 0, size), maxRows)
+	case ".xlsx":
+		return readXLSX(r, size, maxRows)
+	}
+	return nil, fmt.Errorf("%w: %s", ErrFormat, name)
+}
+
+// readCSV читает CSV в UTF-8. Разделитель — запятая, точка с запятой или
+// табуляция, смотря какой чаще встречается в первой строке: Excel с русской
+// локалью сохраняет CSV через точку с запятой.
+func readCSV(r io.Reader, maxRows int) ([][]string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimPrefix(data, []byte("\ufeff"))
+	if !utf8.Valid(data) {
+		return nil, fmt.Errorf("%w: CSV должен быть в кодировке UTF-8", ErrFormat)
+	}
+	first, _, _ := bytes.Cut(data, []byte("\n"))
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comma = ','
+	best := bytes.Count(first, []byte(","))
+	for _, sep := range []rune{';', '\t'} {
+		if n := bytes.Count(first, []byte(string(sep))); n > best {
+			reader.Comma, best = sep, n
+		}
+	}
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	var rows [][]string
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrFormat, err)
+		}
+		// csv.Reader пропускает пустые строки, а номер строки файла нужен для отчёта
+		line, _ := reader.FieldPos(0)
+		if line > maxRows {
+			return nil, ErrTooLong
+		}
+		for len(rows) < line-1 {
+			rows = append(rows, nil)
+		}
+		rows = append(rows, row)
+	}
+}
@@ -0,0 +1,99 @@
+package spreadsheet
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadCSV(t *testing.T) {
+	data := "\ufeffИмя;Email\n\"Иванов; Пётр\";ivanov@example.com\n\nООО Ромашка;\n"
+	rows, err := Read("clients.CSV", strings.NewReader(data), int64(len(data)), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"Имя", "Email"},
+		{"Иванов; Пётр", "ivanov@example.com"},
+		nil,
+		{"ООО Ромашка", ""},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows = %q", rows)
+	}
+
+	if _, err := Read("clients.csv", strings.NewReader(data), int64(len(data)), 3); !errors.Is(err, ErrTooLong) {
+		t.Errorf("ожидалась ErrTooLong, получено %v", err)
+	}
+	bad := "name\n\xff\xfe\n"
+	if _, err := Read("clients.csv", strings.NewReader(bad), int64(len(bad)), 10); !errors.Is(err, ErrFormat) {
+		t.Errorf("не UTF-8: ожидалась ErrFormat, получено %v", err)
+	}
+	if _, err := Read("clients.xls", strings.NewReader(data), int64(len(data)), 10); !errors.Is(err, ErrFormat) {
+		t.Errorf(".xls: ожидалась ErrFormat, получено %v", err)
+	}
+}
+
+func TestReadXLSX(t *testing.T) {
+	parts := map[string]string{
+		"xl/workbook.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="Клиенты" sheetId="1" r:id="rId1"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<?xml version="1.0" encoding="UTF-8"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/sharedStrings" Target="sharedStrings.xml"/>
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+</Relationships>`,
+		"xl/sharedStrings.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<si><t>Название</t></si><si><t>Сумма</t></si><si><r><t>Поставка </t></r><r><t>оборудования</t></r></si></sst>`,
+		"xl/worksheets/sheet1.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>
+<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c></row>
+<row r="3"><c r="A3" t="s"><v>2</v></c><c r="C3"><v>1500.5</v></c></row>
+<row r="4"><c r="B4" t="inlineStr"><is><t>Договор</t></is></c><c r="AA4" t="b"><v>1</v></c></row>
+</sheetData></worksheet>`,
+	}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range parts {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := bytes.NewReader(buf.Bytes())
+	rows, err := Read("deals.xlsx", r, r.Size(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 4 || rows[1] != nil {
+		t.Fatalf("rows = %q", rows)
+	}
+	if !reflect.DeepEqual(rows[0], []string{"Название", "Сумма"}) {
+		t.Errorf("заголовок = %q", rows[0])
+	}
+	if !reflect.DeepEqual(rows[2], []string{"Поставка оборудования", "", "1500.5"}) {
+		t.Errorf("строка 3 = %q", rows[2])
+	}
+	if len(rows[3]) != 27 || rows[3][1] != "Договор" || rows[3][26] != "1" {
+		t.Errorf("строка 4 = %q", rows[3])
+	}
+
+	if _, err := Read("deals.xlsx", r, r.Size(), 3); !errors.Is(err, ErrTooLong) {
+		t.Errorf("ожидалась ErrTooLong, получено %v", err)
+	}
+	if _, err := Read("deals.xlsx", strings.NewReader("not a zip"), 9, 10); !errors.Is(err, ErrFormat) {
+		t.Errorf("ожидалась ErrFormat, получено %v", err)
+	}
+}
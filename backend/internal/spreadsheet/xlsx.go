@@ -0,0 +1,194 @@
+package spreadsheet
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// maxXMLSize ограничивает распакованный размер частей XLSX, чтобы небольшой
+// архив не развернулся в гигабайты.
+const maxXMLSize = 64 << 20
+
+type xlsxWorkbook struct {
+	Sheets []struct {
+		RelID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRelationships struct {
+	Items []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+// xlsxText — текст строки: целиком в <t> или по частям в <r><t> у строк с
+// форматированием.
+type xlsxText struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxText) String() string {
+	if len(t.Runs) == 0 {
+		return t.T
+	}
+	var b strings.Builder
+	for _, r := range t.Runs {
+		b.WriteString(r.T)
+	}
+	return b.String()
+}
+
+type xlsxSharedStrings struct {
+	Items []xlsxText `xml:"si"`
+}
+
+type xlsxSheet struct {
+	Rows []struct {
+		Num   int `xml:"r,attr"`
+		Cells []struct {
+			Ref    string   `xml:"r,attr"`
+			Type   string   `xml:"t,attr"`
+			Value  string   `xml:"v"`
+			Inline xlsxText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// readXLSX читает значения ячеек первого листа книги. Числа и даты
+// возвращаются так, как они хранятся в файле: даты — номером дня Excel.
+func readXLSX(r io.ReaderAt, size int64, maxRows int) ([][]string, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrFormat, err)
+	}
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+	var book xlsxWorkbook
+	if err := decodeXML(files, "xl/workbook.xml", &book); err != nil {
+		return nil, err
+	}
+	var rels xlsxRelationships
+	if err := decodeXML(files, "xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return nil, err
+	}
+	if len(book.Sheets) == 0 {
+		return nil, fmt.Errorf("%w: в книге нет листов", ErrFormat)
+	}
+	sheetPath := ""
+	for _, rel := range rels.Items {
+		if rel.ID == book.Sheets[0].RelID {
+			sheetPath = rel.Target
+		}
+	}
+	if strings.HasPrefix(sheetPath, "/") {
+		sheetPath = strings.TrimPrefix(sheetPath, "/")
+	} else {
+		sheetPath = path.Join("xl", sheetPath)
+	}
+	var shared xlsxSharedStrings
+	if _, ok := files["xl/sharedStrings.xml"]; ok {
+		if err := decodeXML(files, "xl/sharedStrings.xml", &shared); err != nil {
+			return nil, err
+		}
+	}
+	var sheet xlsxSheet
+	if err := decodeXML(files, sheetPath, &sheet); err != nil {
+		return nil, err
+	}
+
+	var rows [][]string
+	for i, row := range sheet.Rows {
+		num := row.Num
+		if num == 0 {
+			num = len(rows) + 1
+		}
+		if num > maxRows {
+			return nil, ErrTooLong
+		}
+		if num <= len(rows) {
+			return nil, fmt.Errorf("%w: строка %d повторяется (%d-я по счёту)", ErrFormat, num, i+1)
+		}
+		for len(rows) < num-1 {
+			rows = append(rows, nil)
+		}
+		var cells []string
+		for j, cell := range row.Cells {
+			col := j
+			if cell.Ref != "" {
+				if col = columnIndex(cell.Ref); col < 0 {
+					return nil, fmt.Errorf("%w: некорректная ячейка %q", ErrFormat, cell.Ref)
+				}
+			}
+			value := cell.Value
+			switch cell.Type {
+			case "s":
+				n, err := strconv.Atoi(cell.Value)
+				if err != nil || n < 0 || n >= len(shared.Items) {
+					return nil, fmt.Errorf("%w: ячейка %s ссылается на несуществующую строку", ErrFormat, cell.Ref)
+				}
+				value = shared.Items[n].String()
+			case "inlineStr":
+				value = cell.Inline.String()
+			}
+			for len(cells) < col {
+				cells = append(cells, "")
+			}
+			if col < len(cells) {
+				cells[col] = value
+			} else {
+				cells = append(cells, value)
+			}
+		}
+		rows = append(rows, cells)
+	}
+	return rows, nil
+}
+
+// decodeXML разбирает часть name архива в v.
+func decodeXML(files map[string]*zip.File, name string, v interface{}) error {
+	f, ok := files[name]
+	if !ok {
+		return fmt.Errorf("%w: нет %s", ErrFormat, name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrFormat, err)
+	}
+	defer rc.Close()
+	if err := xml.NewDecoder(io.LimitReader(rc, maxXMLSize)).Decode(v); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrFormat, name, err)
+	}
+	return nil
+}
+
+// columnIndex возвращает номер колонки (с нуля) по адресу ячейки вида "AB12"
+// или -1, если адрес некорректен.
+func columnIndex(ref string) int {
+	col := 0
+	letters := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		col = col*26 + int(r-'A'+1)
+		letters++
+		if letters > 3 {
+			return -1
+		}
+	}
+	if letters == 0 {
+		return -1
+	}
+	return col - 1
+}
@@ -0,0 +1,22 @@
+package gormstore
+
+import (
+	"crm-backend/internal/models"
+	"crm-backend/internal/store"
+
+	"gorm.io/gorm"
+)
+
+type audit struct {
+	db *gorm.DB
+}
+
+func (s audit) Record(entry *models.AuditEntry) error {
+	return s.db.Create(entry).Error
+}
+
+func (s audit) List(q store.ListQuery) ([]models.AuditEntry, int64, error) {
+	var rows []models.AuditEntry
+	total, err := find(s.db, q, &rows)
+	return rows, total, err
+}
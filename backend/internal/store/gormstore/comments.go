@@ -0,0 +1,102 @@
+package gormstore
+
+import (
+	"crm-backend/internal/models"
+	"crm-backend/internal/store"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type comments struct {
+	db *gorm.DB
+}
+
+func (s comments) List(q store.ListQuery) ([]models.Comment, int64, error) {
+	return s.list(s.db, q)
+}
+
+func (s comments) ListMentioning(userID uint, q store.ListQuery) ([]models.Comment, int64, error) {
+	mentioned := s.db.Session(&gorm.Session{NewDB: true}).Model(&models.CommentMention{}).
+		Select("comment_id").Where("user_id = ?", userID)
+	return s.list(s.db.Where("comments.id IN (?)", mentioned), q)
+}
+
+func (s comments) list(db *gorm.DB, q store.ListQuery) ([]models.Comment, int64, error) {
+	var rows []models.Comment
+	total, err := find(db, q, &rows, "User", "Deal", "Mentions")
+	for i := range rows {
+		rows[i].MentionIDs = mentionIDs(rows[i].Mentions)
+	}
+	return rows, total, err
+}
+
+func (s comments) Get(id uint) (models.Comment, error) {
+	var comment models.Comment
+	err := first(s.db.Preload("User").Preload("Deal").Preload("Mentions"), &comment, id)
+	comment.MentionIDs = mentionIDs(comment.Mentions)
+	return comment, err
+}
+
+func (s comments) Create(comment *models.Comment) error {
+	return s.db.Omit(clause.Associations).Create(comment).Error
+}
+
+func (s comments) UpdateContent(comment *models.Comment) error {
+	res := s.db.Model(&models.Comment{}).Where("id = ? AND version = ?", comment.ID, comment.Version).
+		Updates(map[string]interface{}{"content": comment.Content, "edited_at": comment.EditedAt, "version": comment.Version + 1})
+	if err := versionError(res); err != nil {
+		return err
+	}
+	comment.Version++
+	return nil
+}
+
+func (s comments) Delete(id uint) error {
+	return s.db.Delete(&models.Comment{}, id).Error
+}
+
+func (s comments) AddRevision(revision *models.CommentRevision) error {
+	return s.db.Create(revision).Error
+}
+
+func (s comments) Revisions(commentID uint) ([]models.CommentRevision, error) {
+	rows := []models.CommentRevision{}
+	err := s.db.Where("comment_id = ?", commentID).Order("edited_at, id").Find(&rows).Error
+	return rows, err
+}
+
+func (s comments) MoveToUser(fromID, toID uint) error {
+	return s.db.Model(&models.Comment{}).Where("user_id = ?", fromID).
+		Updates(map[string]interface{}{"user_id": toID, "version": nextVersion}).Error
+}
+
+func (s comments) SetMentions(commentID uint, userIDs []uint) error {
+	if err := s.db.Where("comment_id = ?", commentID).Delete(&models.CommentMention{}).Error; err != nil {
+		return err
+	}
+	userIDs = store.UniqueIDs(userIDs)
+	if len(userIDs) == 0 {
+		return nil
+	}
+	rows := make([]models.CommentMention, 0, len(userIDs))
+	for _, id := range userIDs {
+		rows = append(rows, models.CommentMention{CommentID: commentID, UserID: id})
+	}
+	return s.db.Create(&rows).Error
+}
+
+// mentionIDs возвращает ID упомянутых пользователей; пустой список кодируется как [].
+func mentionIDs(mentions []models.CommentMention) []uint {
+	ids := make([]uint, 0, len(mentions))
+	for _, m := range mentions {
+		ids = append(ids, m.UserID)
+	}
+	return ids
+}
+
+func (s comments) CountSince(since int64) (int64, error) {
+	var n int64
+	err := s.db.Model(&models.Comment{}).Where("created_at >= ?", since).Count(&n).Error
+	return n, err
+}
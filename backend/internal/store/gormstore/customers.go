@@ -0,0 +1,73 @@
+package gormstore
+
+import (
+	"time"
+
+	"crm-backend/internal/models"
+	"crm-backend/internal/store"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type customers struct {
+	db *gorm.DB
+}
+
+func (s customers) links() tagLinks {
+	return tagLinks{s.db, "customer_tags", "customer_id"}
+}
+
+func (s customers) List(q store.ListQuery) ([]models.Customer, int64, error) {
+	var rows []models.Customer
+	total, err := find(s.db, q, &rows, "Tags")
+	for i := range rows {
+		rows[i].TagIDs = tagIDs(rows[i].Tags)
+	}
+	return rows, total, err
+}
+
+func (s customers) Get(id uint) (models.Customer, error) {
+	var customer models.Customer
+	err := first(s.db.Preload("Tags"), &customer, id)
+	customer.TagIDs = tagIDs(customer.Tags)
+	return customer, err
+}
+
+func (s customers) Create(customer *models.Customer) error {
+	return s.db.Omit(clause.Associations).Create(customer).Error
+}
+
+func (s customers) Update(customer *models.Customer) error {
+	return save(s.db, customer, &customer.Version)
+}
+
+func (s customers) Delete(id uint) error {
+	// Общее время удаления отличает записи, удалённые вместе с клиентом, от
+	// удалённых раньше: восстанавливаются только первые
+	at := time.Now()
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		err := softDelete(tx, at, "comments", "deal_id IN (SELECT id FROM deals WHERE customer_id = ? AND deleted_at IS NULL)", id)
+		if err != nil {
+			return err
+		}
+		if err := softDelete(tx, at, "deals", "customer_id = ?", id); err != nil {
+			return err
+		}
+		return softDelete(tx, at, "customers", "id = ?", id)
+	})
+}
+
+func (s customers) TagIDs(id uint) ([]uint, error)       { return s.links().TagIDs(id) }
+func (s customers) SetTags(id uint, tagIDs []uint) error { return s.links().SetTags(id, tagIDs) }
+func (s customers) AddTag(id, tagID uint) error          { return s.links().AddTag(id, tagID) }
+func (s customers) RemoveTag(id, tagID uint) error       { return s.links().RemoveTag(id, tagID) }
+
+// tagIDs возвращает ID тегов; пустой список кодируется как [], а не null.
+func tagIDs(tags []models.Tag) []uint {
+	ids := make([]uint, 0, len(tags))
+	for _, t := range tags {
+		ids = append(ids, t.ID)
+	}
+	return ids
+}
@@ -0,0 +1,150 @@
+package gormstore
+
+import (
+	"time"
+
+	"crm-backend/internal/models"
+	"crm-backend/internal/store"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type deals struct {
+	db *gorm.DB
+}
+
+func (s deals) links() tagLinks {
+	return tagLinks{s.db, "deal_tags", "deal_id"}
+}
+
+func (s deals) List(q store.ListQuery) ([]models.Deal, int64, error) {
+	var rows []models.Deal
+	total, err := find(s.db, q, &rows, "Customer", "Status", "Tags")
+	for i := range rows {
+		rows[i].TagIDs = tagIDs(rows[i].Tags)
+	}
+	return rows, total, err
+}
+
+func (s deals) Get(id uint) (models.Deal, error) {
+	var deal models.Deal
+	err := first(s.db.Preload("Customer").Preload("Status").Preload("Tags"), &deal, id)
+	deal.TagIDs = tagIDs(deal.Tags)
+	return deal, err
+}
+
+func (s deals) Create(deal *models.Deal) error {
+	return s.db.Omit(clause.Associations).Create(deal).Error
+}
+
+func (s deals) Update(deal *models.Deal) error {
+	return save(s.db, deal, &deal.Version)
+}
+
+func (s deals) Delete(id uint) error {
+	at := time.Now()
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := softDelete(tx, at, "comments", "deal_id = ?", id); err != nil {
+			return err
+		}
+		return softDelete(tx, at, "deals", "id = ?", id)
+	})
+}
+
+func (s deals) TagIDs(id uint) ([]uint, error)       { return s.links().TagIDs(id) }
+func (s deals) SetTags(id uint, tagIDs []uint) error { return s.links().SetTags(id, tagIDs) }
+func (s deals) AddTag(id, tagID uint) error          { return s.links().AddTag(id, tagID) }
+func (s deals) RemoveTag(id, tagID uint) error       { return s.links().RemoveTag(id, tagID) }
+
+func (s deals) CountInStage(statusID uint) (int64, error) {
+	var n int64
+	err := s.db.Model(&models.Deal{}).Where("status_id = ?", statusID).Count(&n).Error
+	return n, err
+}
+
+func (s deals) CountInPipeline(pipelineID uint) (int64, error) {
+	var n int64
+	err := s.db.Unscoped().Model(&models.Deal{}).Where("pipeline_id = ?", pipelineID).Count(&n).Error
+	return n, err
+}
+
+func (s deals) MoveToStage(fromID uint, target models.Status, userID *uint) error {
+	now := time.Now().Unix()
+	err := s.db.Exec(`INSERT INTO deal_stage_changes (deal_id, from_status_id, to_status_id, user_id, changed_at)
+		SELECT id, status_id, ?, ?, ? FROM deals WHERE status_id = ?`, target.ID, userID, now, fromID).Error
+	if err != nil {
+		return err
+	}
+	updates := map[string]interface{}{"status_id": target.ID, "pipeline_id": target.PipelineID, "version": nextVersion}
+	if !target.Closed() {
+		updates["closed_at"] = nil
+	} else {
+		updates["closed_at"] = gorm.Expr("COALESCE(closed_at, ?)", now)
+	}
+	return s.db.Unscoped().Model(&models.Deal{}).Where("status_id = ?", fromID).Updates(updates).Error
+}
+
+func (s deals) MoveToCustomer(fromID, toID uint) error {
+	return s.db.Model(&models.Deal{}).Where("customer_id = ?", fromID).
+		Updates(map[string]interface{}{"customer_id": toID, "version": nextVersion}).Error
+}
+
+func (s deals) RecordStageChange(change *models.DealStageChange) error {
+	return s.db.Create(change).Error
+}
+
+func (s deals) StageChanges(dealID uint) ([]models.DealStageChange, error) {
+	var changes []models.DealStageChange
+	err := s.db.Where("deal_id = ?", dealID).Order("changed_at, id").Find(&changes).Error
+	return changes, err
+}
+
+func (s deals) Totals(q store.ListQuery, includeClosed bool, baseCurrency string) ([]store.CurrencySum, error) {
+	tx := where(s.db.Model(&models.Deal{}), q)
+	if !includeClosed {
+		tx = tx.Where("deals.closed_at IS NULL")
+	}
+	var rows []store.CurrencySum
+	// Старые сделки без валюты считаются в базовой; без своей вероятности
+	// сделка берёт вероятность этапа
+	err := tx.Joins("LEFT JOIN statuses ON statuses.id = deals.status_id").
+		Select("COALESCE(NULLIF(deals.currency, ''), ?) AS currency, COUNT(*) AS count, "+
+			"COALESCE(SUM(deals.amount), 0) AS amount, "+
+			"COALESCE(SUM(deals.amount * COALESCE(deals.probability, statuses.probability, 100) / 100.0), 0) AS weighted", baseCurrency).
+		Group("1").Order("1").Scan(&rows).Error
+	return rows, err
+}
+
+func (s deals) StageDurations(from, to time.Time, pipelineID uint) ([]store.StageDuration, error) {
+	visits := s.db.Table("deal_stage_changes AS h").
+		Select("h.deal_id, h.to_status_id AS status_id, h.changed_at AS started_at, "+
+			"COALESCE(LEAD(h.changed_at) OVER (PARTITION BY h.deal_id ORDER BY h.changed_at, h.id), d.closed_at, ?) AS ended_at", time.Now().Unix()).
+		Joins("JOIN deals d ON d.id = h.deal_id AND d.deleted_at IS NULL")
+
+	tx := s.db.Table("(?) AS v", visits).
+		Select("v.status_id, s.name, s.pipeline_id, COUNT(*) AS visits, "+
+			"AVG(GREATEST(v.ended_at - v.started_at, 0)) / 86400.0 AS avg_days").
+		Joins("JOIN statuses s ON s.id = v.status_id AND s.deleted_at IS NULL").
+		Where("v.started_at >= ? AND v.started_at < ?", from.Unix(), to.Unix())
+	if pipelineID != 0 {
+		tx = tx.Where("s.pipeline_id = ?", pipelineID)
+	}
+	rows := []store.StageDuration{}
+	err := tx.Group("v.status_id, s.name, s.pipeline_id, s.position").
+		Order("s.pipeline_id, s.position").
+		Scan(&rows).Error
+	return rows, err
+}
+
+func (s deals) OpenByStage() ([]store.StageCount, error) {
+	rows := []store.StageCount{}
+	err := s.db.Table("statuses AS s").
+		Select("s.id AS status_id, s.name, s.pipeline_id, COUNT(d.id) AS deals").
+		Joins("LEFT JOIN deals d ON d.status_id = s.id AND d.deleted_at IS NULL").
+		Where("s.type = ? AND s.deleted_at IS NULL", models.StageOpen).
+		Group("s.id, s.name, s.pipeline_id, s.position").
+		Order("s.pipeline_id, s.position").
+		Scan(&rows).Error
+	return rows, err
+}
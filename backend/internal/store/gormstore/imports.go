@@ -0,0 +1,48 @@
+package gormstore
+
+import (
+	"time"
+
+	"crm-backend/internal/models"
+	"crm-backend/internal/store"
+
+	"gorm.io/gorm"
+)
+
+type imports struct {
+	db *gorm.DB
+}
+
+func (s imports) List(q store.ListQuery) ([]models.ImportJob, int64, error) {
+	var rows []models.ImportJob
+	total, err := find(s.db, q, &rows)
+	return rows, total, err
+}
+
+func (s imports) Get(id uint) (models.ImportJob, error) {
+	var job models.ImportJob
+	err := first(s.db, &job, id)
+	return job, err
+}
+
+func (s imports) Create(job *models.ImportJob) error {
+	return s.db.Create(job).Error
+}
+
+// unfinished — состояния задач, которые ещё можно менять.
+var unfinished = []string{models.ImportQueued, models.ImportRunning}
+
+func (s imports) Update(job *models.ImportJob) error {
+	res := s.db.Select("*").Where("status IN ?", unfinished).Save(job)
+	return versionError(res)
+}
+
+func (s imports) Interrupt(failure string, staleBefore, at time.Time) (int64, error) {
+	res := s.db.Model(&models.ImportJob{}).
+		Where("status IN ? AND updated_at < ?", unfinished, staleBefore.Unix()).
+		Updates(map[string]interface{}{
+			"status": models.ImportFailed, "failure": failure,
+			"finished_at": at.Unix(), "updated_at": at.Unix(),
+		})
+	return res.RowsAffected, res.Error
+}
@@ -0,0 +1,83 @@
+package gormstore
+
+import (
+	"strings"
+
+	"crm-backend/internal/store"
+
+	"gorm.io/gorm"
+)
+
+// where применяет фильтры и поиск запроса.
+func where(db *gorm.DB, q store.ListQuery) *gorm.DB {
+	spec := q.Spec
+	// Пустой tag_ids — очищенный фильтр, а не «ни одного тега»
+	if len(q.TagIDs) > 0 && spec.TagTable != "" {
+		sub := db.Session(&gorm.Session{NewDB: true}).Table(spec.TagTable).
+			Select(spec.TagKey).
+			Where("tag_id IN ?", q.TagIDs)
+		if q.TagAll {
+			sub = sub.Group(spec.TagKey).Having("COUNT(DISTINCT tag_id) = ?", len(store.UniqueIDs(q.TagIDs)))
+		}
+		db = db.Where(spec.Table+".id IN (?)", sub)
+	}
+	for field, value := range q.Filters {
+		column := spec.Table + "." + field
+		switch v := value.(type) {
+		case []interface{}:
+			if len(v) == 0 {
+				db = db.Where("1 = 0")
+				continue
+			}
+			db = db.Where(column+" IN ?", v)
+		case nil:
+			db = db.Where(column + " IS NULL")
+		default:
+			db = db.Where(column+" = ?", v)
+		}
+	}
+	if q.Search != "" && len(spec.Searchable) > 0 {
+		conds := make([]string, 0, len(spec.Searchable))
+		args := make([]interface{}, 0, len(spec.Searchable))
+		pattern := "%" + likeEscaper.Replace(q.Search) + "%"
+		for _, field := range spec.Searchable {
+			conds = append(conds, spec.Table+"."+field+" ILIKE ?")
+			args = append(args, pattern)
+		}
+		db = db.Where("("+strings.Join(conds, " OR ")+")", args...)
+	}
+	return db
+}
+
+// likeEscaper экранирует спецсимволы LIKE, чтобы поиск сравнивал текст
+// буквально, как memstore. Обратная косая черта — символ экранирования
+// LIKE в PostgreSQL по умолчанию.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// find применяет фильтры, считает общее количество записей, затем сортирует,
+// обрезает выборку по range и загружает её в dest (указатель на срез моделей)
+// вместе с перечисленными связями. db может уже содержать условия, например
+// ограничение одной сделкой. Записи с равным полем сортировки упорядочиваются
+// по id, иначе страницы range могут повторять или терять строки.
+func find(db *gorm.DB, q store.ListQuery, dest interface{}, preloads ...string) (int64, error) {
+	// Подсчёт и выборка строятся от одной базы и не должны делить условия
+	db = db.Session(&gorm.Session{})
+	var total int64
+	if err := where(db.Model(dest), q).Count(&total).Error; err != nil {
+		return 0, err
+	}
+	tx := where(db, q).Order(q.Spec.Table + "." + q.SortField + " " + q.SortOrder)
+	if q.SortField != "id" {
+		tx = tx.Order(q.Spec.Table + ".id " + q.SortOrder)
+	}
+	for _, p := range preloads {
+		tx = tx.Preload(p)
+	}
+	if q.HasRange {
+		tx = tx.Offset(q.Start).Limit(q.End - q.Start + 1)
+	}
+	if err := tx.Find(dest).Error; err != nil {
+		return 0, err
+	}
+	return total, nil
+}
@@ -0,0 +1,151 @@
+package gormstore
+
+import (
+	"sort"
+
+	"crm-backend/internal/models"
+	"crm-backend/internal/store"
+
+	"gorm.io/gorm"
+)
+
+type pipelines struct {
+	db *gorm.DB
+}
+
+// orderStages загружает этапы воронки в порядке их позиций.
+func orderStages(db *gorm.DB) *gorm.DB {
+	return db.Order("statuses.position, statuses.id")
+}
+
+func (s pipelines) List(q store.ListQuery) ([]models.Pipeline, int64, error) {
+	var rows []models.Pipeline
+	total, err := find(s.db, q, &rows, "Stages")
+	for i := range rows {
+		stages := rows[i].Stages
+		sort.SliceStable(stages, func(a, b int) bool {
+			if stages[a].Position != stages[b].Position {
+				return stages[a].Position < stages[b].Position
+			}
+			return stages[a].ID < stages[b].ID
+		})
+	}
+	return rows, total, err
+}
+
+func (s pipelines) Get(id uint) (models.Pipeline, error) {
+	var pipeline models.Pipeline
+	err := first(s.db.Preload("Stages", orderStages), &pipeline, id)
+	return pipeline, err
+}
+
+func (s pipelines) Create(pipeline *models.Pipeline) error {
+	return s.db.Create(pipeline).Error
+}
+
+func (s pipelines) Update(pipeline *models.Pipeline) error {
+	return save(s.db, pipeline, &pipeline.Version)
+}
+
+func (s pipelines) Delete(id uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		// Этапы удалённой воронки не восстановить, поэтому они удаляются окончательно
+		if err := tx.Unscoped().Where("pipeline_id = ?", id).Delete(&models.Status{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.Pipeline{}, id).Error
+	})
+}
+
+func (s pipelines) Default() (models.Pipeline, error) {
+	var pipeline models.Pipeline
+	err := s.db.Order("position, id").First(&pipeline).Error
+	return pipeline, notFound(err)
+}
+
+func (s pipelines) Count() (int64, error) {
+	var n int64
+	err := s.db.Model(&models.Pipeline{}).Count(&n).Error
+	return n, err
+}
+
+type statuses struct {
+	db *gorm.DB
+}
+
+func (s statuses) List(q store.ListQuery) ([]models.Status, int64, error) {
+	var rows []models.Status
+	total, err := find(s.db, q, &rows)
+	return rows, total, err
+}
+
+func (s statuses) Get(id uint) (models.Status, error) {
+	var status models.Status
+	err := first(s.db, &status, id)
+	return status, err
+}
+
+func (s statuses) Create(status *models.Status) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := touchPipelines(tx, nil, status.PipelineID); err != nil {
+			return err
+		}
+		return tx.Create(status).Error
+	})
+}
+
+func (s statuses) Update(status *models.Status) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := touchPipelines(tx, []uint{status.ID}, status.PipelineID); err != nil {
+			return err
+		}
+		return save(tx, status, &status.Version)
+	})
+}
+
+func (s statuses) Delete(id uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := touchPipelines(tx, []uint{id}, 0); err != nil {
+			return err
+		}
+		return tx.Delete(&models.Status{}, id).Error
+	})
+}
+
+func (s statuses) FirstOpen(pipelineID uint) (models.Status, error) {
+	var status models.Status
+	err := s.db.Where("pipeline_id = ? AND type = ?", pipelineID, models.StageOpen).
+		Order("position, id").First(&status).Error
+	return status, notFound(err)
+}
+
+func (s statuses) NextPosition(pipelineID uint) (int, error) {
+	var max *int
+	err := s.db.Model(&models.Status{}).Where("pipeline_id = ?", pipelineID).Select("MAX(position)").Scan(&max).Error
+	if err != nil || max == nil {
+		return 0, err
+	}
+	return *max + 1, nil
+}
+
+func (s statuses) SetPositions(stageIDs []uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := touchPipelines(tx, stageIDs, 0); err != nil {
+			return err
+		}
+		for i, id := range stageIDs {
+			if err := tx.Model(&models.Status{}).Where("id = ?", id).
+				Updates(map[string]interface{}{"position": i, "version": nextVersion}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// touchPipelines увеличивает версию воронки pipelineID и воронок этапов
+// stageIDs: этапы входят в ответ воронки, и её ETag меняется вместе с ними.
+func touchPipelines(db *gorm.DB, stageIDs []uint, pipelineID uint) error {
+	return db.Exec(`UPDATE pipelines SET version = version + 1
+		WHERE id = ? OR id IN (SELECT pipeline_id FROM statuses WHERE id IN ?)`, pipelineID, stageIDs).Error
+}
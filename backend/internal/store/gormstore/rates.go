@@ -0,0 +1,25 @@
+package gormstore
+
+import (
+	"crm-backend/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type rates struct {
+	db *gorm.DB
+}
+
+func (s rates) List() ([]models.ExchangeRate, error) {
+	var rows []models.ExchangeRate
+	err := s.db.Order("currency").Find(&rows).Error
+	return rows, err
+}
+
+func (s rates) Save(rate *models.ExchangeRate) error {
+	return s.db.Save(rate).Error
+}
+
+func (s rates) Delete(currency string) error {
+	return s.db.Delete(&models.ExchangeRate{}, "currency = ?", currency).Error
+}
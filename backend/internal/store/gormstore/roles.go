@@ -0,0 +1,61 @@
+package gormstore
+
+import (
+	"crm-backend/internal/models"
+	"crm-backend/internal/store"
+
+	"gorm.io/gorm"
+)
+
+type roles struct {
+	db *gorm.DB
+}
+
+func (s roles) List(q store.ListQuery) ([]models.Role, int64, error) {
+	var rows []models.Role
+	total, err := find(s.db, q, &rows, "Grants")
+	return rows, total, err
+}
+
+func (s roles) Get(id uint) (models.Role, error) {
+	var role models.Role
+	err := first(s.db.Preload("Grants"), &role, id)
+	return role, err
+}
+
+func (s roles) Exists(name string) (bool, error) {
+	var n int64
+	err := s.db.Model(&models.Role{}).Where("name = ?", name).Count(&n).Error
+	return n > 0, err
+}
+
+func (s roles) Create(role *models.Role) error {
+	return s.db.Omit("Grants").Create(role).Error
+}
+
+func (s roles) Update(role *models.Role) error {
+	return save(s.db, role, &role.Version)
+}
+
+func (s roles) Delete(id uint) error {
+	return s.db.Select("Grants").Delete(&models.Role{ID: id}).Error
+}
+
+func (s roles) SetGrants(role *models.Role) error {
+	if err := s.db.Where("role_id = ?", role.ID).Delete(&models.RolePermission{}).Error; err != nil {
+		return err
+	}
+	if len(role.Grants) == 0 {
+		return nil
+	}
+	return s.db.Create(&role.Grants).Error
+}
+
+func (s roles) Permissions(role string) ([]string, error) {
+	var names []string
+	err := s.db.Model(&models.RolePermission{}).
+		Joins("JOIN roles ON roles.id = role_permissions.role_id").
+		Where("roles.name = ?", role).
+		Pluck("role_permissions.permission", &names).Error
+	return names, err
+}
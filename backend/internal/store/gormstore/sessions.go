@@ -0,0 +1,57 @@
+package gormstore
+
+import (
+	"time"
+
+	"crm-backend/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type sessions struct {
+	db *gorm.DB
+}
+
+func (s sessions) Create(token *models.RefreshToken) error {
+	return s.db.Create(token).Error
+}
+
+func (s sessions) GetByHash(hash string) (models.RefreshToken, error) {
+	var token models.RefreshToken
+	err := s.db.Where("token_hash = ?", hash).First(&token).Error
+	return token, notFound(err)
+}
+
+func (s sessions) Replace(id, replacedByID uint, at time.Time) (bool, error) {
+	res := s.db.Model(&models.RefreshToken{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Updates(map[string]interface{}{"revoked_at": at, "replaced_by_id": replacedByID})
+	return res.RowsAffected > 0, res.Error
+}
+
+func (s sessions) RevokeFamily(familyID string, at time.Time) error {
+	return s.db.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", at).Error
+}
+
+func (s sessions) RevokeUser(userID uint, at time.Time) error {
+	return s.db.Model(&models.RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", at).Error
+}
+
+func (s sessions) ActiveRole(familyID string, userID uint) (string, bool, error) {
+	var roles []string
+	err := s.db.Model(&models.RefreshToken{}).
+		Joins("JOIN users ON users.id = refresh_tokens.user_id").
+		Where("refresh_tokens.family_id = ? AND refresh_tokens.user_id = ?", familyID, userID).
+		Where("refresh_tokens.revoked_at IS NULL").
+		Where("users.deleted_at IS NULL AND users.disabled = ?", false).
+		Limit(1).
+		Pluck("users.role", &roles).Error
+	if err != nil || len(roles) == 0 {
+		return "", false, err
+	}
+	return roles[0], true, nil
+}
@@ -0,0 +1,90 @@
+// Package gormstore реализует store.Store поверх PostgreSQL через GORM.
+package gormstore
+
+import (
+	"context"
+	"errors"
+
+	"crm-backend/internal/store"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Store хранит данные в PostgreSQL. Схема создаётся миграциями.
+type Store struct {
+	db *gorm.DB
+}
+
+var _ store.Store = (*Store)(nil)
+
+// New возвращает хранилище поверх подключения db.
+func New(db *gorm.DB) *Store {
+	return &Store{db: db}
+}
+
+func (s *Store) Customers() store.CustomerStore { return customers{s.db} }
+func (s *Store) Deals() store.DealStore         { return deals{s.db} }
+func (s *Store) Pipelines() store.PipelineStore { return pipelines{s.db} }
+func (s *Store) Statuses() store.StatusStore    { return statuses{s.db} }
+func (s *Store) Tags() store.TagStore           { return tags{s.db} }
+func (s *Store) Users() store.UserStore         { return users{s.db} }
+func (s *Store) Roles() store.RoleStore         { return roles{s.db} }
+func (s *Store) Sessions() store.SessionStore   { return sessions{s.db} }
+func (s *Store) Comments() store.CommentStore   { return comments{s.db} }
+func (s *Store) Rates() store.RateStore         { return rates{s.db} }
+func (s *Store) Audit() store.AuditStore        { return audit{s.db} }
+func (s *Store) Trash() store.TrashStore        { return trash{s.db} }
+func (s *Store) Imports() store.ImportStore     { return imports{s.db} }
+
+func (s *Store) Tx(fn func(tx store.Store) error) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		return fn(&Store{db: tx})
+	})
+}
+
+func (s *Store) WithContext(ctx context.Context) store.Store {
+	return &Store{db: s.db.WithContext(ctx)}
+}
+
+// first загружает запись по ID, переводя отсутствие записи в store.ErrNotFound.
+func first(db *gorm.DB, dest interface{}, id uint) error {
+	return notFound(db.First(dest, id).Error)
+}
+
+// notFound переводит gorm.ErrRecordNotFound в store.ErrNotFound.
+func notFound(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return store.ErrNotFound
+	}
+	return err
+}
+
+// save сохраняет все поля записи value, кроме связей, если её версия в базе
+// всё ещё равна *version, и увеличивает версию. Если запись успели изменить
+// или удалить, возвращает store.ErrConflict.
+func save(db *gorm.DB, value interface{}, version *uint) error {
+	expected := *version
+	*version = expected + 1
+	res := db.Omit(clause.Associations).Select("*").Where("version = ?", expected).Save(value)
+	if err := versionError(res); err != nil {
+		*version = expected
+		return err
+	}
+	return nil
+}
+
+// versionError возвращает store.ErrConflict, если условный UPDATE не нашёл
+// записи с ожидаемой версией.
+func versionError(res *gorm.DB) error {
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return store.ErrConflict
+	}
+	return nil
+}
+
+// nextVersion — выражение для UPDATE, увеличивающее версию записи.
+var nextVersion = gorm.Expr("version + 1")
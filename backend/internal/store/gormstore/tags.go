@@ -0,0 +1,88 @@
+package gormstore
+
+import (
+	"crm-backend/internal/models"
+	"crm-backend/internal/store"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// tagLinks реализует store.Taggable для таблицы связи table, где ссылка на
+// запись хранится в колонке key.
+type tagLinks struct {
+	db    *gorm.DB
+	table string
+	key   string
+}
+
+func (l tagLinks) TagIDs(id uint) ([]uint, error) {
+	ids := []uint{}
+	err := l.db.Table(l.table).
+		Joins("JOIN tags ON tags.id = "+l.table+".tag_id AND tags.deleted_at IS NULL").
+		Where(l.table+"."+l.key+" = ?", id).
+		Order(l.table+".tag_id").
+		Pluck(l.table+".tag_id", &ids).Error
+	return ids, err
+}
+
+func (l tagLinks) SetTags(id uint, tagIDs []uint) error {
+	if err := l.db.Exec("DELETE FROM "+l.table+" WHERE "+l.key+" = ?", id).Error; err != nil {
+		return err
+	}
+	tagIDs = store.UniqueIDs(tagIDs)
+	if len(tagIDs) == 0 {
+		return nil
+	}
+	rows := make([]map[string]interface{}, 0, len(tagIDs))
+	for _, tagID := range tagIDs {
+		rows = append(rows, map[string]interface{}{"tag_id": tagID, l.key: id})
+	}
+	return l.db.Table(l.table).Create(rows).Error
+}
+
+func (l tagLinks) AddTag(id, tagID uint) error {
+	return l.db.Table(l.table).Clauses(clause.OnConflict{DoNothing: true}).
+		Create(map[string]interface{}{"tag_id": tagID, l.key: id}).Error
+}
+
+func (l tagLinks) RemoveTag(id, tagID uint) error {
+	return l.db.Exec("DELETE FROM "+l.table+" WHERE "+l.key+" = ? AND tag_id = ?", id, tagID).Error
+}
+
+type tags struct {
+	db *gorm.DB
+}
+
+func (s tags) List(q store.ListQuery) ([]models.Tag, int64, error) {
+	var rows []models.Tag
+	total, err := find(s.db, q, &rows, "Deals")
+	return rows, total, err
+}
+
+func (s tags) Get(id uint) (models.Tag, error) {
+	var tag models.Tag
+	err := first(s.db.Preload("Deals"), &tag, id)
+	return tag, err
+}
+
+func (s tags) Create(tag *models.Tag) error {
+	return s.db.Omit(clause.Associations).Create(tag).Error
+}
+
+func (s tags) Update(tag *models.Tag) error {
+	return save(s.db, tag, &tag.Version)
+}
+
+func (s tags) Delete(id uint) error {
+	return s.db.Delete(&models.Tag{}, id).Error
+}
+
+func (s tags) Find(ids []uint) ([]models.Tag, error) {
+	rows := []models.Tag{}
+	if len(ids) == 0 {
+		return rows, nil
+	}
+	err := s.db.Where("id IN ?", ids).Order("id").Find(&rows).Error
+	return rows, err
+}
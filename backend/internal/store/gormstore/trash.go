@@ -0,0 +1,241 @@
+package gormstore
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"crm-backend/internal/models"
+	"crm-backend/internal/store"
+
+	"gorm.io/gorm"
+)
+
+type trash struct {
+	db *gorm.DB
+}
+
+// trashTitles — выражение для названия записи в корзине; имена сущностей
+// совпадают с именами таблиц.
+var trashTitles = map[string]string{
+	"comments":  "LEFT(content, 100)",
+	"deals":     "title",
+	"customers": "name",
+	"tags":      "name",
+	"statuses":  "name",
+	"users":     "name",
+}
+
+// items возвращает подзапрос с мягко удалёнными записями всех типов в виде
+// строк models.TrashItem.
+func (s trash) items() *gorm.DB {
+	parts := make([]string, 0, len(store.TrashEntities))
+	for _, entity := range store.TrashEntities {
+		parts = append(parts, "SELECT '"+entity+":' || id AS id, '"+entity+"' AS entity, id AS entity_id, "+
+			"COALESCE("+trashTitles[entity]+", '') AS title, EXTRACT(EPOCH FROM deleted_at)::BIGINT AS deleted_at "+
+			"FROM "+entity+" WHERE deleted_at IS NOT NULL")
+	}
+	return s.db.Table("(" + strings.Join(parts, " UNION ALL ") + ") AS trash")
+}
+
+func (s trash) List(q store.ListQuery) ([]models.TrashItem, int64, error) {
+	var rows []models.TrashItem
+	total, err := find(s.items(), q, &rows)
+	return rows, total, err
+}
+
+func (s trash) DeletedBefore(before time.Time) ([]models.TrashItem, error) {
+	rows := []models.TrashItem{}
+	if err := s.items().Where("deleted_at < ?", before.Unix()).Order("entity_id").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	order := make(map[string]int, len(store.TrashEntities))
+	for i, entity := range store.TrashEntities {
+		order[entity] = i
+	}
+	sort.SliceStable(rows, func(a, b int) bool { return order[rows[a].Entity] < order[rows[b].Entity] })
+	return rows, nil
+}
+
+func (s trash) Restore(entity string, id uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		at, err := deletedAt(tx, entity, id)
+		if err != nil {
+			return err
+		}
+		switch entity {
+		case "deals":
+			err = requireActive(tx, entity, id, "customer_id", "customers")
+			if err == nil {
+				err = requireActive(tx, entity, id, "status_id", "statuses")
+			}
+		case "comments":
+			err = requireActive(tx, entity, id, "deal_id", "deals")
+		case "users":
+			var n int64
+			err = tx.Model(&models.User{}).
+				Where("email = (SELECT email FROM users WHERE id = ?)", id).Count(&n).Error
+			if err == nil && n > 0 {
+				err = store.ErrDuplicate
+			}
+		case "statuses":
+			err = touchPipelines(tx, []uint{id}, 0)
+		}
+		if err != nil {
+			return err
+		}
+		if err := restoreDependents(tx, entity, id, at); err != nil {
+			return err
+		}
+		return undelete(tx.Table(entity).Where("id = ?", id))
+	})
+}
+
+func (s trash) Purge(entity string, id uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if _, err := deletedAt(tx, entity, id); err != nil {
+			return err
+		}
+		var err error
+		switch entity {
+		case "customers":
+			err = requireUnused(tx, "SELECT 1 FROM deals WHERE customer_id = ? AND deleted_at IS NULL", id)
+			if err == nil {
+				err = purgeDeals(tx, "customer_id", id)
+			}
+			if err == nil {
+				err = tx.Exec("DELETE FROM customer_tags WHERE customer_id = ?", id).Error
+			}
+		case "deals":
+			err = purgeDeals(tx, "id", id)
+		case "tags":
+			err = execAll(tx,
+				"DELETE FROM deal_tags WHERE tag_id = ?",
+				"DELETE FROM customer_tags WHERE tag_id = ?",
+			)(id)
+		case "statuses":
+			err = requireUnused(tx, "SELECT 1 FROM deals WHERE status_id = ?", id)
+		case "users":
+			err = requireUnused(tx, "SELECT 1 FROM comments WHERE user_id = ?", id)
+			if err == nil {
+				err = execAll(tx,
+					"DELETE FROM comment_mentions WHERE user_id = ?",
+					"UPDATE deal_stage_changes SET user_id = NULL WHERE user_id = ?",
+					"UPDATE comment_revisions SET edited_by = NULL WHERE edited_by = ?",
+				)(id)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		return tx.Exec("DELETE FROM "+entity+" WHERE id = ?", id).Error
+	})
+}
+
+// deletedAt возвращает время удаления записи из корзины; для записи вне
+// корзины и неизвестного типа — store.ErrNotFound.
+func deletedAt(db *gorm.DB, entity string, id uint) (time.Time, error) {
+	if _, ok := trashTitles[entity]; !ok {
+		return time.Time{}, store.ErrNotFound
+	}
+	var at []time.Time
+	err := db.Table(entity).Where("id = ? AND deleted_at IS NOT NULL", id).Pluck("deleted_at", &at).Error
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(at) == 0 {
+		return time.Time{}, store.ErrNotFound
+	}
+	return at[0], nil
+}
+
+// requireActive возвращает store.ErrParentDeleted, если запись id таблицы
+// table ссылается через column на удалённую запись таблицы parent.
+func requireActive(db *gorm.DB, table string, id uint, column, parent string) error {
+	var n int64
+	err := db.Table(table).Where("id = ?", id).
+		Where(column + " IN (SELECT id FROM " + parent + " WHERE deleted_at IS NULL)").Count(&n).Error
+	if err == nil && n == 0 {
+		return store.ErrParentDeleted
+	}
+	return err
+}
+
+// requireUnused возвращает store.ErrReferenced, если запрос query находит строки.
+func requireUnused(db *gorm.DB, query string, id uint) error {
+	var found []int
+	if err := db.Raw(query+" LIMIT 1", id).Scan(&found).Error; err != nil {
+		return err
+	}
+	if len(found) > 0 {
+		return store.ErrReferenced
+	}
+	return nil
+}
+
+// restoreDependents восстанавливает записи, удалённые вместе с записью
+// entity id в момент at. Комментарии клиента восстанавливаются раньше его
+// сделок: пока сделки удалены, их отбирает то же время удаления.
+func restoreDependents(db *gorm.DB, entity string, id uint, at time.Time) error {
+	switch entity {
+	case "customers":
+		err := undelete(db.Table("comments").Where(
+			"deleted_at = ? AND deal_id IN (SELECT id FROM deals WHERE customer_id = ? AND deleted_at = ?)", at, id, at))
+		if err != nil {
+			return err
+		}
+		return undelete(db.Table("deals").Where("customer_id = ? AND deleted_at = ?", id, at))
+	case "deals":
+		return undelete(db.Table("comments").Where("deal_id = ? AND deleted_at = ?", id, at))
+	case "users":
+		return undelete(db.Table("comments").Where(
+			"user_id = ? AND deleted_at = ? AND deal_id IN (SELECT id FROM deals WHERE deleted_at IS NULL)", id, at))
+	}
+	return nil
+}
+
+// softDelete отмечает неудалённые записи table, отобранные условием where,
+// удалёнными в момент at.
+func softDelete(db *gorm.DB, at time.Time, table, where string, args ...interface{}) error {
+	return db.Table(table).Where("deleted_at IS NULL").Where(where, args...).Update("deleted_at", at).Error
+}
+
+// undelete снимает отметку удаления с записей запроса db и увеличивает их версию.
+func undelete(db *gorm.DB) error {
+	return db.Updates(map[string]interface{}{"deleted_at": nil, "version": nextVersion}).Error
+}
+
+// execAll возвращает функцию, выполняющую запросы по очереди с одним параметром.
+func execAll(db *gorm.DB, queries ...string) func(id uint) error {
+	return func(id uint) error {
+		for _, q := range queries {
+			if err := db.Exec(q, id).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// purgeDeals окончательно удаляет сделки, у которых column равен id, вместе
+// с комментариями и тегами. Историю этапов, правки комментариев и
+// упоминания удаляют внешние ключи.
+func purgeDeals(db *gorm.DB, column string, id uint) error {
+	var dealIDs []uint
+	if err := db.Table("deals").Where(column+" = ?", id).Pluck("id", &dealIDs).Error; err != nil {
+		return err
+	}
+	if len(dealIDs) == 0 {
+		return nil
+	}
+	for _, q := range []string{
+		"DELETE FROM comments WHERE deal_id IN ?",
+		"DELETE FROM deal_tags WHERE deal_id IN ?",
+		"DELETE FROM deals WHERE id IN ?",
+	} {
+		if err := db.Exec(q, dealIDs).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
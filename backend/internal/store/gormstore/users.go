@@ -0,0 +1,77 @@
+package gormstore
+
+import (
+	"time"
+
+	"crm-backend/internal/models"
+	"crm-backend/internal/store"
+
+	"gorm.io/gorm"
+)
+
+type users struct {
+	db *gorm.DB
+}
+
+func (s users) List(q store.ListQuery) ([]models.User, int64, error) {
+	var rows []models.User
+	total, err := find(s.db, q, &rows)
+	return rows, total, err
+}
+
+func (s users) Get(id uint) (models.User, error) {
+	var user models.User
+	err := first(s.db, &user, id)
+	return user, err
+}
+
+func (s users) GetByEmail(email string) (models.User, error) {
+	var user models.User
+	err := s.db.Where("email = ?", email).First(&user).Error
+	return user, notFound(err)
+}
+
+func (s users) Create(user *models.User) error {
+	return s.db.Create(user).Error
+}
+
+func (s users) Update(user *models.User) error {
+	return save(s.db, user, &user.Version)
+}
+
+func (s users) Delete(id uint) error {
+	at := time.Now()
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := softDelete(tx, at, "comments", "user_id = ?", id); err != nil {
+			return err
+		}
+		return softDelete(tx, at, "users", "id = ?", id)
+	})
+}
+
+func (s users) Count() (int64, error) {
+	var n int64
+	err := s.db.Model(&models.User{}).Count(&n).Error
+	return n, err
+}
+
+func (s users) CountWithRole(role string) (int64, error) {
+	var n int64
+	err := s.db.Model(&models.User{}).Where("role = ?", role).Count(&n).Error
+	return n, err
+}
+
+func (s users) RenameRole(oldName, newName string) error {
+	return s.db.Unscoped().Model(&models.User{}).Where("role = ?", oldName).
+		Updates(map[string]interface{}{"role": newName, "version": nextVersion}).Error
+}
+
+func (s users) FindByMentions(handles []string) ([]models.User, error) {
+	var rows []models.User
+	if len(handles) == 0 {
+		return rows, nil
+	}
+	err := s.db.Where("LOWER(email) IN ? OR LOWER(SPLIT_PART(email, '@', 1)) IN ?", handles, handles).
+		Find(&rows).Error
+	return rows, err
+}
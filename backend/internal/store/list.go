@@ -0,0 +1,59 @@
+package store
+
+// ListSpec описывает, по каким полям ресурса разрешены сортировка, фильтрация
+// и полнотекстовый поиск (`q`). Имена полей совпадают с JSON-именами и
+// колонками в базе. Если задана TagTable (таблица связи с тегами, где ссылка
+// на запись хранится в TagKey), список можно фильтровать по tag_ids.
+type ListSpec struct {
+	Resource    string
+	Table       string
+	Sortable    []string
+	Filterable  []string
+	Searchable  []string
+	DefaultSort string
+	TagTable    string
+	TagKey      string
+}
+
+// ListQuery — разобранные параметры sort, range и filter в формате
+// ra-data-simple-rest:
+//
+//	?sort=["title","ASC"]&range=[0,24]&filter={"q":"foo","status_id":2}
+//
+// Фильтр {"tag_ids":[1,2],"tag_match":"all"} оставляет записи со всеми
+// указанными тегами, "any" (по умолчанию) — хотя бы с одним из них.
+// Значение-массив в Filters означает IN, nil — IS NULL.
+type ListQuery struct {
+	Spec      ListSpec
+	SortField string
+	SortOrder string
+	Start     int
+	End       int
+	HasRange  bool
+	Search    string
+	Filters   map[string]interface{}
+	TagIDs    []uint
+	TagAll    bool
+}
+
+// NewListQuery возвращает запрос без фильтров с сортировкой по умолчанию.
+func NewListQuery(spec ListSpec) ListQuery {
+	q := ListQuery{Spec: spec, SortField: spec.DefaultSort, SortOrder: "ASC", Filters: map[string]interface{}{}}
+	if q.SortField == "" {
+		q.SortField = "id"
+	}
+	return q
+}
+
+// UniqueIDs возвращает идентификаторы без повторов в исходном порядке.
+func UniqueIDs(ids []uint) []uint {
+	seen := make(map[uint]bool, len(ids))
+	out := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
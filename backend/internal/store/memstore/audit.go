@@ -0,0 +1,24 @@
+package memstore
+
+import (
+	"crm-backend/internal/models"
+	"crm-backend/internal/store"
+)
+
+type audit struct {
+	s *Store
+}
+
+func (a audit) Record(entry *models.AuditEntry) error {
+	defer a.s.lock()()
+	if entry.CreatedAt == 0 {
+		entry.CreatedAt = now()
+	}
+	a.s.d.audit.insert(entry)
+	return nil
+}
+
+func (a audit) List(q store.ListQuery) ([]models.AuditEntry, int64, error) {
+	defer a.s.lock()()
+	return list(a.s.d.audit.all(), q)
+}
@@ -0,0 +1,139 @@
+package memstore
+
+import (
+	"sort"
+	"time"
+
+	"crm-backend/internal/models"
+	"crm-backend/internal/store"
+)
+
+type comments struct {
+	s *Store
+}
+
+// load загружает автора, сделку и упоминания комментария. Вызывается под блокировкой.
+func (cm comments) load(comment models.Comment) models.Comment {
+	comment.User, _ = cm.s.d.users.get(comment.UserID)
+	comment.Deal, _ = cm.s.d.deals.get(comment.DealID)
+	comment.MentionIDs = append([]uint{}, cm.s.d.mentions[comment.ID]...)
+	return comment
+}
+
+func (cm comments) list(rows []models.Comment, q store.ListQuery) ([]models.Comment, int64, error) {
+	rows, total, err := list(rows, q)
+	for i := range rows {
+		rows[i] = cm.load(rows[i])
+	}
+	return rows, total, err
+}
+
+func (cm comments) List(q store.ListQuery) ([]models.Comment, int64, error) {
+	defer cm.s.lock()()
+	return cm.list(cm.s.d.comments.all(), q)
+}
+
+func (cm comments) ListMentioning(userID uint, q store.ListQuery) ([]models.Comment, int64, error) {
+	defer cm.s.lock()()
+	rows := cm.s.d.comments.filter(func(c *models.Comment) bool {
+		if deleted(c) {
+			return false
+		}
+		for _, id := range cm.s.d.mentions[c.ID] {
+			if id == userID {
+				return true
+			}
+		}
+		return false
+	})
+	return cm.list(rows, q)
+}
+
+func (cm comments) Get(id uint) (models.Comment, error) {
+	defer cm.s.lock()()
+	comment, ok := cm.s.d.comments.get(id)
+	if !ok {
+		return comment, store.ErrNotFound
+	}
+	return cm.load(comment), nil
+}
+
+func (cm comments) Create(comment *models.Comment) error {
+	defer cm.s.lock()()
+	if comment.CreatedAt == 0 {
+		comment.CreatedAt = now()
+	}
+	row := *comment
+	row.User, row.Deal = models.User{}, models.Deal{}
+	row.Mentions, row.MentionIDs = nil, nil
+	cm.s.d.comments.insert(&row)
+	comment.ID, comment.Version = row.ID, row.Version
+	return nil
+}
+
+func (cm comments) UpdateContent(comment *models.Comment) error {
+	defer cm.s.lock()()
+	row, ok := cm.s.d.comments.get(comment.ID)
+	if !ok || row.Version != comment.Version {
+		return store.ErrConflict
+	}
+	row.Content, row.EditedAt = comment.Content, comment.EditedAt
+	row.Version++
+	cm.s.d.comments.save(&row)
+	comment.Version = row.Version
+	return nil
+}
+
+func (cm comments) Delete(id uint) error {
+	defer cm.s.lock()()
+	cm.s.d.comments.delete(id)
+	return nil
+}
+
+// deleteComments удаляет неудалённые комментарии, отобранные keep, отмечая
+// их временем at. Вызывается под блокировкой.
+func (s *Store) deleteComments(at time.Time, keep func(*models.Comment) bool) {
+	for _, comment := range s.d.comments.filter(func(v *models.Comment) bool { return !deleted(v) && keep(v) }) {
+		s.d.comments.deleteAt(comment.ID, at)
+	}
+}
+
+func (cm comments) MoveToUser(fromID, toID uint) error {
+	defer cm.s.lock()()
+	for _, comment := range cm.s.d.comments.filter(func(v *models.Comment) bool { return !deleted(v) && v.UserID == fromID }) {
+		comment.UserID = toID
+		cm.s.d.comments.bump(&comment)
+	}
+	return nil
+}
+
+func (cm comments) AddRevision(revision *models.CommentRevision) error {
+	defer cm.s.lock()()
+	cm.s.d.revisions.insert(revision)
+	return nil
+}
+
+func (cm comments) Revisions(commentID uint) ([]models.CommentRevision, error) {
+	defer cm.s.lock()()
+	rows := cm.s.d.revisions.filter(func(r *models.CommentRevision) bool { return r.CommentID == commentID })
+	sort.SliceStable(rows, func(a, b int) bool { return rows[a].EditedAt < rows[b].EditedAt })
+	return rows, nil
+}
+
+func (cm comments) SetMentions(commentID uint, userIDs []uint) error {
+	defer cm.s.lock()()
+	userIDs = store.UniqueIDs(userIDs)
+	if len(userIDs) == 0 {
+		delete(cm.s.d.mentions, commentID)
+		return nil
+	}
+	sort.Slice(userIDs, func(a, b int) bool { return userIDs[a] < userIDs[b] })
+	cm.s.d.mentions[commentID] = userIDs
+	return nil
+}
+
+func (cm comments) CountSince(since int64) (int64, error) {
+	defer cm.s.lock()()
+	rows := cm.s.d.comments.filter(func(c *models.Comment) bool { return !deleted(c) && c.CreatedAt >= since })
+	return int64(len(rows)), nil
+}
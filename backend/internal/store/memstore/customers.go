@@ -0,0 +1,73 @@
+package memstore
+
+import (
+	"time"
+
+	"crm-backend/internal/models"
+	"crm-backend/internal/store"
+)
+
+type customers struct {
+	s *Store
+}
+
+func (c customers) links() tagLinks {
+	return tagLinks{c.s, func(d *data) map[uint][]uint { return d.customerTags }}
+}
+
+func (c customers) List(q store.ListQuery) ([]models.Customer, int64, error) {
+	defer c.s.lock()()
+	rows := c.s.d.customers.all()
+	for i := range rows {
+		rows[i].TagIDs = c.links().ids(rows[i].ID)
+	}
+	return list(rows, q)
+}
+
+func (c customers) Get(id uint) (models.Customer, error) {
+	defer c.s.lock()()
+	customer, ok := c.s.d.customers.get(id)
+	if !ok {
+		return customer, store.ErrNotFound
+	}
+	customer.TagIDs = c.links().ids(id)
+	return customer, nil
+}
+
+func (c customers) Create(customer *models.Customer) error {
+	defer c.s.lock()()
+	stamp(&customer.CreatedAt, &customer.UpdatedAt)
+	row := *customer
+	row.Tags, row.TagIDs = nil, nil
+	c.s.d.customers.insert(&row)
+	customer.ID, customer.Version = row.ID, row.Version
+	return nil
+}
+
+func (c customers) Update(customer *models.Customer) error {
+	defer c.s.lock()()
+	customer.UpdatedAt = now()
+	row := *customer
+	row.Tags, row.TagIDs = nil, nil
+	if err := c.s.d.customers.update(&row); err != nil {
+		return err
+	}
+	customer.Version = row.Version
+	return nil
+}
+
+func (c customers) Delete(id uint) error {
+	defer c.s.lock()()
+	at := time.Now()
+	for _, deal := range c.s.d.deals.filter(func(d *models.Deal) bool { return !deleted(d) && d.CustomerID == id }) {
+		c.s.deleteComments(at, func(cm *models.Comment) bool { return cm.DealID == deal.ID })
+		c.s.d.deals.deleteAt(deal.ID, at)
+	}
+	c.s.d.customers.deleteAt(id, at)
+	return nil
+}
+
+func (c customers) TagIDs(id uint) ([]uint, error)       { return c.links().TagIDs(id) }
+func (c customers) SetTags(id uint, tagIDs []uint) error { return c.links().SetTags(id, tagIDs) }
+func (c customers) AddTag(id, tagID uint) error          { return c.links().AddTag(id, tagID) }
+func (c customers) RemoveTag(id, tagID uint) error       { return c.links().RemoveTag(id, tagID) }
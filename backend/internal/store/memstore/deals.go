@@ -0,0 +1,284 @@
+package memstore
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"crm-backend/internal/models"
+	"crm-backend/internal/store"
+)
+
+type deals struct {
+	s *Store
+}
+
+func (d deals) links() tagLinks {
+	return tagLinks{d.s, func(d *data) map[uint][]uint { return d.dealTags }}
+}
+
+// load загружает клиента, этап и теги сделки, как Preload в gormstore.
+func (d deals) load(deal models.Deal) models.Deal {
+	deal.Customer, _ = d.s.d.customers.get(deal.CustomerID)
+	deal.Status, _ = d.s.d.statuses.get(deal.StatusID)
+	deal.TagIDs = d.links().ids(deal.ID)
+	return deal
+}
+
+// strip убирает связи перед сохранением: в таблице хранятся только колонки.
+func strip(deal models.Deal) models.Deal {
+	deal.Customer, deal.Status = models.Customer{}, models.Status{}
+	deal.Tags, deal.TagIDs = nil, nil
+	return deal
+}
+
+func (d deals) List(q store.ListQuery) ([]models.Deal, int64, error) {
+	defer d.s.lock()()
+	rows := d.s.d.deals.all()
+	for i := range rows {
+		rows[i] = d.load(rows[i])
+	}
+	return list(rows, q)
+}
+
+func (d deals) Get(id uint) (models.Deal, error) {
+	defer d.s.lock()()
+	deal, ok := d.s.d.deals.get(id)
+	if !ok {
+		return deal, store.ErrNotFound
+	}
+	return d.load(deal), nil
+}
+
+func (d deals) Create(deal *models.Deal) error {
+	defer d.s.lock()()
+	stamp(&deal.CreatedAt, &deal.UpdatedAt)
+	row := strip(*deal)
+	d.s.d.deals.insert(&row)
+	deal.ID, deal.Version = row.ID, row.Version
+	return nil
+}
+
+func (d deals) Update(deal *models.Deal) error {
+	defer d.s.lock()()
+	deal.UpdatedAt = now()
+	row := strip(*deal)
+	if err := d.s.d.deals.update(&row); err != nil {
+		return err
+	}
+	deal.Version = row.Version
+	return nil
+}
+
+func (d deals) Delete(id uint) error {
+	defer d.s.lock()()
+	at := time.Now()
+	if _, ok := d.s.d.deals.get(id); ok {
+		d.s.deleteComments(at, func(cm *models.Comment) bool { return cm.DealID == id })
+	}
+	d.s.d.deals.deleteAt(id, at)
+	return nil
+}
+
+func (d deals) TagIDs(id uint) ([]uint, error)       { return d.links().TagIDs(id) }
+func (d deals) SetTags(id uint, tagIDs []uint) error { return d.links().SetTags(id, tagIDs) }
+func (d deals) AddTag(id, tagID uint) error          { return d.links().AddTag(id, tagID) }
+func (d deals) RemoveTag(id, tagID uint) error       { return d.links().RemoveTag(id, tagID) }
+
+func (d deals) CountInStage(statusID uint) (int64, error) {
+	defer d.s.lock()()
+	var n int64
+	for _, deal := range d.s.d.deals.all() {
+		if deal.StatusID == statusID {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (d deals) CountInPipeline(pipelineID uint) (int64, error) {
+	defer d.s.lock()()
+	var n int64
+	for _, deal := range d.s.d.deals.unscoped() {
+		if deal.PipelineID == pipelineID {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (d deals) MoveToStage(fromID uint, target models.Status, userID *uint) error {
+	defer d.s.lock()()
+	ts := now()
+	for _, deal := range d.s.d.deals.unscoped() {
+		if deal.StatusID != fromID {
+			continue
+		}
+		from := deal.StatusID
+		d.s.d.stageChanges.insert(&models.DealStageChange{
+			DealID: deal.ID, FromStatusID: &from, ToStatusID: target.ID, UserID: userID, ChangedAt: ts,
+		})
+		deal.StatusID, deal.PipelineID = target.ID, target.PipelineID
+		if !target.Closed() {
+			deal.ClosedAt = nil
+		} else if deal.ClosedAt == nil {
+			closedAt := ts
+			deal.ClosedAt = &closedAt
+		}
+		d.s.d.deals.bump(&deal)
+	}
+	return nil
+}
+
+func (d deals) MoveToCustomer(fromID, toID uint) error {
+	defer d.s.lock()()
+	for _, deal := range d.s.d.deals.filter(func(v *models.Deal) bool { return !deleted(v) && v.CustomerID == fromID }) {
+		deal.CustomerID = toID
+		d.s.d.deals.bump(&deal)
+	}
+	return nil
+}
+
+func (d deals) RecordStageChange(change *models.DealStageChange) error {
+	defer d.s.lock()()
+	d.s.d.stageChanges.insert(change)
+	return nil
+}
+
+// changes возвращает историю сделки в порядке (changed_at, id). Вызывается под блокировкой.
+func (d deals) changes(dealID uint) []models.DealStageChange {
+	var out []models.DealStageChange
+	for _, ch := range d.s.d.stageChanges.all() {
+		if ch.DealID == dealID {
+			out = append(out, ch)
+		}
+	}
+	sort.SliceStable(out, func(a, b int) bool { return out[a].ChangedAt < out[b].ChangedAt })
+	return out
+}
+
+func (d deals) StageChanges(dealID uint) ([]models.DealStageChange, error) {
+	defer d.s.lock()()
+	return d.changes(dealID), nil
+}
+
+func (d deals) Totals(q store.ListQuery, includeClosed bool, baseCurrency string) ([]store.CurrencySum, error) {
+	defer d.s.lock()()
+	q.HasRange = false
+	rows := d.s.d.deals.all()
+	for i := range rows {
+		rows[i] = d.load(rows[i])
+	}
+	matched, _, err := list(rows, q)
+	if err != nil {
+		return nil, err
+	}
+	sums := map[string]*store.CurrencySum{}
+	for _, deal := range matched {
+		if deal.ClosedAt != nil && !includeClosed {
+			continue
+		}
+		currency := deal.Currency
+		if currency == "" {
+			currency = baseCurrency
+		}
+		sum, ok := sums[currency]
+		if !ok {
+			sum = &store.CurrencySum{Currency: currency}
+			sums[currency] = sum
+		}
+		probability := 100
+		if deal.Probability != nil {
+			probability = *deal.Probability
+		} else if deal.Status.ID != 0 {
+			probability = deal.Status.Probability
+		}
+		sum.Count++
+		sum.Amount += deal.Amount
+		sum.Weighted += float64(deal.Amount) * float64(probability) / 100
+	}
+	out := make([]store.CurrencySum, 0, len(sums))
+	for _, sum := range sums {
+		out = append(out, *sum)
+	}
+	sort.Slice(out, func(a, b int) bool { return out[a].Currency < out[b].Currency })
+	return out, nil
+}
+
+func (d deals) StageDurations(from, to time.Time, pipelineID uint) ([]store.StageDuration, error) {
+	defer d.s.lock()()
+	type acc struct {
+		visits  int64
+		seconds int64
+	}
+	byStage := map[uint]*acc{}
+	ts := now()
+	for _, deal := range d.s.d.deals.all() {
+		changes := d.changes(deal.ID)
+		for i, ch := range changes {
+			if ch.ChangedAt < from.Unix() || ch.ChangedAt >= to.Unix() {
+				continue
+			}
+			end := ts
+			if i+1 < len(changes) {
+				end = changes[i+1].ChangedAt
+			} else if deal.ClosedAt != nil {
+				end = *deal.ClosedAt
+			}
+			stage, ok := d.s.d.statuses.get(ch.ToStatusID)
+			if !ok || (pipelineID != 0 && stage.PipelineID != pipelineID) {
+				continue
+			}
+			a, ok := byStage[stage.ID]
+			if !ok {
+				a = &acc{}
+				byStage[stage.ID] = a
+			}
+			a.visits++
+			a.seconds += int64(math.Max(float64(end-ch.ChangedAt), 0))
+		}
+	}
+	rows := []store.StageDuration{}
+	for id, a := range byStage {
+		stage, _ := d.s.d.statuses.get(id)
+		rows = append(rows, store.StageDuration{
+			StatusID:   id,
+			Name:       stage.Name,
+			PipelineID: stage.PipelineID,
+			Visits:     a.visits,
+			AvgDays:    float64(a.seconds) / float64(a.visits) / 86400,
+		})
+	}
+	sort.Slice(rows, func(a, b int) bool {
+		sa, _ := d.s.d.statuses.get(rows[a].StatusID)
+		sb, _ := d.s.d.statuses.get(rows[b].StatusID)
+		if sa.PipelineID != sb.PipelineID {
+			return sa.PipelineID < sb.PipelineID
+		}
+		if sa.Position != sb.Position {
+			return sa.Position < sb.Position
+		}
+		return sa.ID < sb.ID
+	})
+	return rows, nil
+}
+
+func (d deals) OpenByStage() ([]store.StageCount, error) {
+	defer d.s.lock()()
+	counts := map[uint]int64{}
+	for _, deal := range d.s.d.deals.all() {
+		counts[deal.StatusID]++
+	}
+	stages := d.s.d.statuses.filter(func(st *models.Status) bool { return !deleted(st) && st.Type == models.StageOpen })
+	sort.SliceStable(stages, func(a, b int) bool {
+		if stages[a].PipelineID != stages[b].PipelineID {
+			return stages[a].PipelineID < stages[b].PipelineID
+		}
+		return stages[a].Position < stages[b].Position
+	})
+	rows := make([]store.StageCount, 0, len(stages))
+	for _, st := range stages {
+		rows = append(rows, store.StageCount{StatusID: st.ID, Name: st.Name, PipelineID: st.PipelineID, Deals: counts[st.ID]})
+	}
+	return rows, nil
+}
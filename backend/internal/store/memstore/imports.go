@@ -0,0 +1,59 @@
+package memstore
+
+import (
+	"time"
+
+	"crm-backend/internal/models"
+	"crm-backend/internal/store"
+)
+
+type imports struct {
+	s *Store
+}
+
+func (i imports) List(q store.ListQuery) ([]models.ImportJob, int64, error) {
+	defer i.s.lock()()
+	return list(i.s.d.imports.all(), q)
+}
+
+func (i imports) Get(id uint) (models.ImportJob, error) {
+	defer i.s.lock()()
+	job, ok := i.s.d.imports.get(id)
+	if !ok {
+		return models.ImportJob{}, store.ErrNotFound
+	}
+	return job, nil
+}
+
+func (i imports) Create(job *models.ImportJob) error {
+	defer i.s.lock()()
+	stamp(&job.CreatedAt, &job.UpdatedAt)
+	i.s.d.imports.insert(job)
+	return nil
+}
+
+func (i imports) Update(job *models.ImportJob) error {
+	defer i.s.lock()()
+	if old, ok := i.s.d.imports.get(job.ID); !ok || old.Finished() {
+		return store.ErrConflict
+	}
+	job.UpdatedAt = now()
+	i.s.d.imports.save(job)
+	return nil
+}
+
+func (i imports) Interrupt(failure string, staleBefore, at time.Time) (int64, error) {
+	defer i.s.lock()()
+	var n int64
+	for _, job := range i.s.d.imports.all() {
+		if job.Finished() || job.UpdatedAt >= staleBefore.Unix() {
+			continue
+		}
+		ts := at.Unix()
+		job.Status, job.Failure = models.ImportFailed, failure
+		job.FinishedAt, job.UpdatedAt = &ts, ts
+		i.s.d.imports.save(&job)
+		n++
+	}
+	return n, nil
+}
@@ -0,0 +1,170 @@
+package memstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"crm-backend/internal/store"
+)
+
+// list отбирает, сортирует и обрезает записи по запросу q так же, как
+// gormstore делает это в SQL. Поля берутся из JSON-представления записей:
+// их имена совпадают с колонками.
+func list[T any](rows []T, q store.ListQuery) ([]T, int64, error) {
+	type item struct {
+		row    T
+		fields map[string]interface{}
+	}
+	items := make([]item, 0, len(rows))
+	for _, row := range rows {
+		fields, err := jsonFields(row)
+		if err != nil {
+			return nil, 0, err
+		}
+		if matches(fields, q) {
+			items = append(items, item{row, fields})
+		}
+	}
+	sort.SliceStable(items, func(a, b int) bool {
+		c := compare(items[a].fields[q.SortField], items[b].fields[q.SortField])
+		if c == 0 {
+			c = compare(items[a].fields["id"], items[b].fields["id"])
+		}
+		if q.SortOrder == "DESC" {
+			return c > 0
+		}
+		return c < 0
+	})
+
+	total := int64(len(items))
+	if q.HasRange {
+		start, end := q.Start, q.End+1
+		if start > len(items) {
+			start = len(items)
+		}
+		if end > len(items) {
+			end = len(items)
+		}
+		items = items[start:end]
+	}
+	out := make([]T, 0, len(items))
+	for _, it := range items {
+		out = append(out, it.row)
+	}
+	return out, total, nil
+}
+
+func jsonFields(v interface{}) (map[string]interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	err = json.Unmarshal(b, &fields)
+	return fields, err
+}
+
+func matches(fields map[string]interface{}, q store.ListQuery) bool {
+	for field, value := range q.Filters {
+		switch v := value.(type) {
+		case []interface{}:
+			found := false
+			for _, item := range v {
+				if equal(fields[field], item) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		case nil:
+			if fields[field] != nil {
+				return false
+			}
+		default:
+			if !equal(fields[field], v) {
+				return false
+			}
+		}
+	}
+	if q.Search != "" && len(q.Spec.Searchable) > 0 {
+		needle := strings.ToLower(q.Search)
+		found := false
+		for _, field := range q.Spec.Searchable {
+			if s, ok := fields[field].(string); ok && strings.Contains(strings.ToLower(s), needle) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(q.TagIDs) > 0 {
+		has := map[string]bool{}
+		if ids, ok := fields["tag_ids"].([]interface{}); ok {
+			for _, id := range ids {
+				has[fmt.Sprint(id)] = true
+			}
+		}
+		hits := 0
+		wanted := store.UniqueIDs(q.TagIDs)
+		for _, id := range wanted {
+			if has[fmt.Sprint(id)] {
+				hits++
+			}
+		}
+		if hits == 0 || (q.TagAll && hits != len(wanted)) {
+			return false
+		}
+	}
+	return true
+}
+
+// equal сравнивает значения так, как их сравнил бы PostgreSQL после
+// приведения типов: 2, 2.0 и "2" равны.
+func equal(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return fmt.Sprint(a) == fmt.Sprint(b)
+}
+
+// compare упорядочивает значения полей; NULL больше любого значения, как в
+// PostgreSQL по умолчанию.
+func compare(a, b interface{}) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	}
+	switch x := a.(type) {
+	case float64:
+		if y, ok := b.(float64); ok {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	case bool:
+		if y, ok := b.(bool); ok {
+			switch {
+			case x == y:
+				return 0
+			case !x:
+				return -1
+			}
+			return 1
+		}
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
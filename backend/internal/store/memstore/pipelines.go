@@ -0,0 +1,179 @@
+package memstore
+
+import (
+	"sort"
+
+	"crm-backend/internal/models"
+	"crm-backend/internal/store"
+)
+
+type pipelines struct {
+	s *Store
+}
+
+// stagesOf возвращает этапы воронки по порядку позиций. Вызывается под блокировкой.
+func (p pipelines) stagesOf(pipelineID uint) []models.Status {
+	stages := p.s.d.statuses.filter(func(st *models.Status) bool { return !deleted(st) && st.PipelineID == pipelineID })
+	sort.SliceStable(stages, func(a, b int) bool { return stages[a].Position < stages[b].Position })
+	return stages
+}
+
+func (p pipelines) List(q store.ListQuery) ([]models.Pipeline, int64, error) {
+	defer p.s.lock()()
+	rows, total, err := list(p.s.d.pipelines.all(), q)
+	for i := range rows {
+		rows[i].Stages = p.stagesOf(rows[i].ID)
+	}
+	return rows, total, err
+}
+
+func (p pipelines) Get(id uint) (models.Pipeline, error) {
+	defer p.s.lock()()
+	pipeline, ok := p.s.d.pipelines.get(id)
+	if !ok {
+		return pipeline, store.ErrNotFound
+	}
+	pipeline.Stages = p.stagesOf(id)
+	return pipeline, nil
+}
+
+func (p pipelines) Create(pipeline *models.Pipeline) error {
+	defer p.s.lock()()
+	stamp(&pipeline.CreatedAt, &pipeline.UpdatedAt)
+	row := *pipeline
+	row.Stages = nil
+	p.s.d.pipelines.insert(&row)
+	pipeline.ID, pipeline.Version = row.ID, row.Version
+	for i := range pipeline.Stages {
+		pipeline.Stages[i].PipelineID = row.ID
+		p.s.d.statuses.insert(&pipeline.Stages[i])
+	}
+	return nil
+}
+
+func (p pipelines) Update(pipeline *models.Pipeline) error {
+	defer p.s.lock()()
+	pipeline.UpdatedAt = now()
+	row := *pipeline
+	row.Stages = nil
+	if err := p.s.d.pipelines.update(&row); err != nil {
+		return err
+	}
+	pipeline.Version = row.Version
+	return nil
+}
+
+func (p pipelines) Delete(id uint) error {
+	defer p.s.lock()()
+	for _, stage := range p.s.d.statuses.unscoped() {
+		if stage.PipelineID == id {
+			p.s.d.statuses.purge(stage.ID)
+		}
+	}
+	p.s.d.pipelines.delete(id)
+	return nil
+}
+
+func (p pipelines) Default() (models.Pipeline, error) {
+	defer p.s.lock()()
+	rows := p.s.d.pipelines.all()
+	if len(rows) == 0 {
+		return models.Pipeline{}, store.ErrNotFound
+	}
+	sort.SliceStable(rows, func(a, b int) bool { return rows[a].Position < rows[b].Position })
+	return rows[0], nil
+}
+
+func (p pipelines) Count() (int64, error) {
+	defer p.s.lock()()
+	return int64(len(p.s.d.pipelines.all())), nil
+}
+
+type statuses struct {
+	s *Store
+}
+
+func (st statuses) List(q store.ListQuery) ([]models.Status, int64, error) {
+	defer st.s.lock()()
+	return list(st.s.d.statuses.all(), q)
+}
+
+func (st statuses) Get(id uint) (models.Status, error) {
+	defer st.s.lock()()
+	status, ok := st.s.d.statuses.get(id)
+	if !ok {
+		return status, store.ErrNotFound
+	}
+	return status, nil
+}
+
+func (st statuses) Create(status *models.Status) error {
+	defer st.s.lock()()
+	st.s.d.statuses.insert(status)
+	st.touchPipelines(status.PipelineID)
+	return nil
+}
+
+func (st statuses) Update(status *models.Status) error {
+	defer st.s.lock()()
+	old, _ := st.s.d.statuses.get(status.ID)
+	if err := st.s.d.statuses.update(status); err != nil {
+		return err
+	}
+	st.touchPipelines(old.PipelineID, status.PipelineID)
+	return nil
+}
+
+func (st statuses) Delete(id uint) error {
+	defer st.s.lock()()
+	if stage, ok := st.s.d.statuses.get(id); ok {
+		st.s.d.statuses.delete(id)
+		st.touchPipelines(stage.PipelineID)
+	}
+	return nil
+}
+
+// touchPipelines увеличивает версию воронок ids, как в gormstore: этапы
+// входят в ответ воронки. Вызывается под блокировкой.
+func (st statuses) touchPipelines(ids ...uint) {
+	seen := map[uint]bool{}
+	for _, id := range ids {
+		if pipeline, ok := st.s.d.pipelines.get(id); ok && !seen[id] {
+			seen[id] = true
+			st.s.d.pipelines.bump(&pipeline)
+		}
+	}
+}
+
+func (st statuses) FirstOpen(pipelineID uint) (models.Status, error) {
+	defer st.s.lock()()
+	for _, stage := range (pipelines{st.s}).stagesOf(pipelineID) {
+		if stage.Type == models.StageOpen {
+			return stage, nil
+		}
+	}
+	return models.Status{}, store.ErrNotFound
+}
+
+func (st statuses) NextPosition(pipelineID uint) (int, error) {
+	defer st.s.lock()()
+	stages := (pipelines{st.s}).stagesOf(pipelineID)
+	if len(stages) == 0 {
+		return 0, nil
+	}
+	return stages[len(stages)-1].Position + 1, nil
+}
+
+func (st statuses) SetPositions(stageIDs []uint) error {
+	defer st.s.lock()()
+	var pipelineIDs []uint
+	for i, id := range stageIDs {
+		if stage, ok := st.s.d.statuses.get(id); ok {
+			stage.Position = i
+			st.s.d.statuses.bump(&stage)
+			pipelineIDs = append(pipelineIDs, stage.PipelineID)
+		}
+	}
+	st.touchPipelines(pipelineIDs...)
+	return nil
+}
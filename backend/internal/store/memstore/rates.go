@@ -0,0 +1,33 @@
+package memstore
+
+import (
+	"sort"
+
+	"crm-backend/internal/models"
+)
+
+type rates struct {
+	s *Store
+}
+
+func (r rates) List() ([]models.ExchangeRate, error) {
+	defer r.s.lock()()
+	rows := make([]models.ExchangeRate, 0, len(r.s.d.rates))
+	for _, rate := range r.s.d.rates {
+		rows = append(rows, rate)
+	}
+	sort.Slice(rows, func(a, b int) bool { return rows[a].Currency < rows[b].Currency })
+	return rows, nil
+}
+
+func (r rates) Save(rate *models.ExchangeRate) error {
+	defer r.s.lock()()
+	r.s.d.rates[rate.Currency] = *rate
+	return nil
+}
+
+func (r rates) Delete(currency string) error {
+	defer r.s.lock()()
+	delete(r.s.d.rates, currency)
+	return nil
+}
@@ -0,0 +1,105 @@
+package memstore
+
+import (
+	"crm-backend/internal/models"
+	"crm-backend/internal/store"
+)
+
+type roles struct {
+	s *Store
+}
+
+// withGrants загружает права роли, как Preload("Grants"). Вызывается под блокировкой.
+func (r roles) withGrants(role models.Role) models.Role {
+	role.Grants = []models.RolePermission{}
+	for _, perm := range r.s.d.grants[role.ID] {
+		role.Grants = append(role.Grants, models.RolePermission{RoleID: role.ID, Permission: perm})
+	}
+	return role
+}
+
+func (r roles) List(q store.ListQuery) ([]models.Role, int64, error) {
+	defer r.s.lock()()
+	rows, total, err := list(r.s.d.roles.all(), q)
+	for i := range rows {
+		rows[i] = r.withGrants(rows[i])
+	}
+	return rows, total, err
+}
+
+func (r roles) Get(id uint) (models.Role, error) {
+	defer r.s.lock()()
+	role, ok := r.s.d.roles.get(id)
+	if !ok {
+		return role, store.ErrNotFound
+	}
+	return r.withGrants(role), nil
+}
+
+// byName ищет роль по имени. Вызывается под блокировкой.
+func (r roles) byName(name string) (models.Role, bool) {
+	for _, role := range r.s.d.roles.all() {
+		if role.Name == name {
+			return role, true
+		}
+	}
+	return models.Role{}, false
+}
+
+func (r roles) Exists(name string) (bool, error) {
+	defer r.s.lock()()
+	_, ok := r.byName(name)
+	return ok, nil
+}
+
+func (r roles) Create(role *models.Role) error {
+	defer r.s.lock()()
+	if _, ok := r.byName(role.Name); ok {
+		return errDuplicate
+	}
+	row := *role
+	row.Grants, row.Permissions = nil, nil
+	r.s.d.roles.insert(&row)
+	role.ID, role.Version = row.ID, row.Version
+	return nil
+}
+
+func (r roles) Update(role *models.Role) error {
+	defer r.s.lock()()
+	if other, ok := r.byName(role.Name); ok && other.ID != role.ID {
+		return errDuplicate
+	}
+	row := *role
+	row.Grants, row.Permissions = nil, nil
+	if err := r.s.d.roles.update(&row); err != nil {
+		return err
+	}
+	role.Version = row.Version
+	return nil
+}
+
+func (r roles) Delete(id uint) error {
+	defer r.s.lock()()
+	delete(r.s.d.grants, id)
+	r.s.d.roles.delete(id)
+	return nil
+}
+
+func (r roles) SetGrants(role *models.Role) error {
+	defer r.s.lock()()
+	perms := make([]string, 0, len(role.Grants))
+	for _, g := range role.Grants {
+		perms = append(perms, g.Permission)
+	}
+	r.s.d.grants[role.ID] = perms
+	return nil
+}
+
+func (r roles) Permissions(name string) ([]string, error) {
+	defer r.s.lock()()
+	role, ok := r.byName(name)
+	if !ok {
+		return nil, nil
+	}
+	return append([]string(nil), r.s.d.grants[role.ID]...), nil
+}
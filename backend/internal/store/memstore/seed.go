@@ -0,0 +1,51 @@
+package memstore
+
+import "crm-backend/internal/models"
+
+// seedRoles повторяет роли и права, которые создают миграции
+// 0004_roles_permissions и 0005_deal_value.
+var seedRoles = []struct {
+	name, description string
+	permissions       []string
+}{
+	{"admin", "Администратор: все права", nil},
+	{"manager", "Руководитель продаж", []string{
+		"customers:read", "customers:write", "customers:delete",
+		"deals:read", "deals:write", "deals:delete",
+		"statuses:read", "statuses:write", "statuses:delete",
+		"tags:read", "tags:write", "tags:delete",
+		"comments:read", "comments:write", "comments:delete",
+		"users:read", "exchange_rates:manage",
+	}},
+	{"sales_rep", "Менеджер по продажам", []string{
+		"customers:read", "customers:write",
+		"deals:read", "deals:write",
+		"statuses:read",
+		"tags:read", "tags:write",
+		"comments:read", "comments:write",
+		"users:read",
+	}},
+	{"accountant", "Бухгалтер: только просмотр", []string{
+		"customers:read", "deals:read", "statuses:read",
+		"tags:read", "comments:read", "users:read",
+	}},
+	{"user", "Пользователь по умолчанию", []string{
+		"customers:read", "customers:write", "customers:delete",
+		"deals:read", "deals:write", "deals:delete",
+		"statuses:read", "statuses:write",
+		"tags:read", "tags:write", "tags:delete",
+		"comments:read", "comments:write", "comments:delete",
+		"users:read",
+	}},
+}
+
+// seed создаёт встроенные роли и основную воронку (миграции 0004–0006).
+func seed(d *data) {
+	for _, r := range seedRoles {
+		role := models.Role{Name: r.name, Description: r.description}
+		d.roles.insert(&role)
+		d.grants[role.ID] = append([]string(nil), r.permissions...)
+	}
+	ts := now()
+	d.pipelines.insert(&models.Pipeline{Name: "Основная воронка", CreatedAt: ts, UpdatedAt: ts})
+}
@@ -0,0 +1,77 @@
+package memstore
+
+import (
+	"time"
+
+	"crm-backend/internal/models"
+	"crm-backend/internal/store"
+)
+
+type sessions struct {
+	s *Store
+}
+
+func (ss sessions) Create(token *models.RefreshToken) error {
+	defer ss.s.lock()()
+	if token.CreatedAt.IsZero() {
+		token.CreatedAt = time.Now()
+	}
+	ss.s.d.tokens.insert(token)
+	return nil
+}
+
+func (ss sessions) GetByHash(hash string) (models.RefreshToken, error) {
+	defer ss.s.lock()()
+	for _, token := range ss.s.d.tokens.all() {
+		if token.TokenHash == hash {
+			return token, nil
+		}
+	}
+	return models.RefreshToken{}, store.ErrNotFound
+}
+
+func (ss sessions) Replace(id, replacedByID uint, at time.Time) (bool, error) {
+	defer ss.s.lock()()
+	token, ok := ss.s.d.tokens.get(id)
+	if !ok || token.RevokedAt != nil {
+		return false, nil
+	}
+	token.RevokedAt, token.ReplacedByID = &at, &replacedByID
+	ss.s.d.tokens.save(&token)
+	return true, nil
+}
+
+// revoke отзывает все активные токены, для которых match вернула true.
+func (ss sessions) revoke(at time.Time, match func(*models.RefreshToken) bool) {
+	defer ss.s.lock()()
+	for _, token := range ss.s.d.tokens.all() {
+		if token.RevokedAt == nil && match(&token) {
+			token.RevokedAt = &at
+			ss.s.d.tokens.save(&token)
+		}
+	}
+}
+
+func (ss sessions) RevokeFamily(familyID string, at time.Time) error {
+	ss.revoke(at, func(t *models.RefreshToken) bool { return t.FamilyID == familyID })
+	return nil
+}
+
+func (ss sessions) RevokeUser(userID uint, at time.Time) error {
+	ss.revoke(at, func(t *models.RefreshToken) bool { return t.UserID == userID })
+	return nil
+}
+
+func (ss sessions) ActiveRole(familyID string, userID uint) (string, bool, error) {
+	defer ss.s.lock()()
+	user, ok := ss.s.d.users.get(userID)
+	if !ok || user.Disabled {
+		return "", false, nil
+	}
+	for _, token := range ss.s.d.tokens.all() {
+		if token.FamilyID == familyID && token.UserID == userID && token.RevokedAt == nil {
+			return user.Role, true, nil
+		}
+	}
+	return "", false, nil
+}
@@ -0,0 +1,168 @@
+// Package memstore реализует store.Store в памяти процесса. Поведение
+// повторяет gormstore на свежей базе после миграций, поэтому хранилище
+// подходит для тестов обработчиков без PostgreSQL.
+package memstore
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"crm-backend/internal/models"
+	"crm-backend/internal/store"
+)
+
+// errDuplicate — нарушено ограничение уникальности, как у индекса в базе.
+var errDuplicate = errors.New("memstore: нарушено ограничение уникальности")
+
+// Store хранит данные в памяти. Все операции сериализуются одним мьютексом.
+type Store struct {
+	mu   *sync.Mutex
+	d    *data
+	inTx bool
+}
+
+var _ store.Store = (*Store)(nil)
+
+type data struct {
+	customers    *table[models.Customer]
+	customerTags map[uint][]uint
+	deals        *table[models.Deal]
+	dealTags     map[uint][]uint
+	stageChanges *table[models.DealStageChange]
+	pipelines    *table[models.Pipeline]
+	statuses     *table[models.Status]
+	tags         *table[models.Tag]
+	users        *table[models.User]
+	roles        *table[models.Role]
+	grants       map[uint][]string
+	tokens       *table[models.RefreshToken]
+	comments     *table[models.Comment]
+	revisions    *table[models.CommentRevision]
+	mentions     map[uint][]uint
+	rates        map[string]models.ExchangeRate
+	audit        *table[models.AuditEntry]
+	imports      *table[models.ImportJob]
+}
+
+// New возвращает пустое хранилище с теми же начальными данными, что создают
+// миграции: встроенные роли с правами и основная воронка.
+func New() *Store {
+	d := &data{
+		customers:    newTable[models.Customer](),
+		customerTags: map[uint][]uint{},
+		deals:        newTable[models.Deal](),
+		dealTags:     map[uint][]uint{},
+		stageChanges: newTable[models.DealStageChange](),
+		pipelines:    newTable[models.Pipeline](),
+		statuses:     newTable[models.Status](),
+		tags:         newTable[models.Tag](),
+		users:        newTable[models.User](),
+		roles:        newTable[models.Role](),
+		grants:       map[uint][]string{},
+		tokens:       newTable[models.RefreshToken](),
+		comments:     newTable[models.Comment](),
+		revisions:    newTable[models.CommentRevision](),
+		mentions:     map[uint][]uint{},
+		rates:        map[string]models.ExchangeRate{},
+		audit:        newTable[models.AuditEntry](),
+		imports:      newTable[models.ImportJob](),
+	}
+	seed(d)
+	return &Store{mu: &sync.Mutex{}, d: d}
+}
+
+func (d *data) clone() *data {
+	c := *d
+	c.customers = d.customers.clone()
+	c.customerTags = cloneLinks(d.customerTags)
+	c.deals = d.deals.clone()
+	c.dealTags = cloneLinks(d.dealTags)
+	c.stageChanges = d.stageChanges.clone()
+	c.pipelines = d.pipelines.clone()
+	c.statuses = d.statuses.clone()
+	c.tags = d.tags.clone()
+	c.users = d.users.clone()
+	c.roles = d.roles.clone()
+	c.grants = make(map[uint][]string, len(d.grants))
+	for id, perms := range d.grants {
+		c.grants[id] = append([]string(nil), perms...)
+	}
+	c.tokens = d.tokens.clone()
+	c.comments = d.comments.clone()
+	c.revisions = d.revisions.clone()
+	c.mentions = cloneLinks(d.mentions)
+	c.rates = make(map[string]models.ExchangeRate, len(d.rates))
+	for k, v := range d.rates {
+		c.rates[k] = v
+	}
+	c.audit = d.audit.clone()
+	c.imports = d.imports.clone()
+	return &c
+}
+
+func cloneLinks(m map[uint][]uint) map[uint][]uint {
+	c := make(map[uint][]uint, len(m))
+	for id, ids := range m {
+		c[id] = append([]uint(nil), ids...)
+	}
+	return c
+}
+
+// lock захватывает мьютекс хранилища; внутри Tx он уже захвачен.
+func (s *Store) lock() func() {
+	if s.inTx {
+		return func() {}
+	}
+	s.mu.Lock()
+	return s.mu.Unlock
+}
+
+func (s *Store) Customers() store.CustomerStore { return customers{s} }
+func (s *Store) Deals() store.DealStore         { return deals{s} }
+func (s *Store) Pipelines() store.PipelineStore { return pipelines{s} }
+func (s *Store) Statuses() store.StatusStore    { return statuses{s} }
+func (s *Store) Tags() store.TagStore           { return tags{s} }
+func (s *Store) Users() store.UserStore         { return users{s} }
+func (s *Store) Roles() store.RoleStore         { return roles{s} }
+func (s *Store) Sessions() store.SessionStore   { return sessions{s} }
+func (s *Store) Comments() store.CommentStore   { return comments{s} }
+func (s *Store) Rates() store.RateStore         { return rates{s} }
+func (s *Store) Audit() store.AuditStore        { return audit{s} }
+func (s *Store) Trash() store.TrashStore        { return trash{s} }
+func (s *Store) Imports() store.ImportStore     { return imports{s} }
+
+// WithContext возвращает то же хранилище: запросы в памяти не отменяются.
+func (s *Store) WithContext(context.Context) store.Store { return s }
+
+// Tx выполняет fn, удерживая мьютекс; при ошибке данные восстанавливаются из
+// снимка, сделанного перед началом.
+func (s *Store) Tx(fn func(tx store.Store) error) error {
+	if s.inTx {
+		return fn(s)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snapshot := s.d.clone()
+	if err := fn(&Store{mu: s.mu, d: s.d, inTx: true}); err != nil {
+		*s.d = *snapshot
+		return err
+	}
+	return nil
+}
+
+func now() int64 {
+	return time.Now().Unix()
+}
+
+// stamp заполняет незаданные метки создания и изменения, как autoCreateTime в GORM.
+func stamp(createdAt, updatedAt *int64) {
+	ts := now()
+	if *createdAt == 0 {
+		*createdAt = ts
+	}
+	if *updatedAt == 0 {
+		*updatedAt = ts
+	}
+}
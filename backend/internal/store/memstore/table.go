@@ -0,0 +1,191 @@
+package memstore
+
+import (
+	"reflect"
+	"sort"
+	"time"
+
+	"crm-backend/internal/store"
+
+	"gorm.io/gorm"
+)
+
+// table хранит записи одной модели по ID. Модель должна иметь поле ID uint;
+// если у неё есть DeletedAt gorm.DeletedAt, удаление мягкое, как в GORM, а
+// поле Version uint ведётся как версия записи в базе.
+type table[T any] struct {
+	rows map[uint]T
+	next uint
+}
+
+func newTable[T any]() *table[T] {
+	return &table[T]{rows: map[uint]T{}}
+}
+
+func (t *table[T]) clone() *table[T] {
+	c := &table[T]{rows: make(map[uint]T, len(t.rows)), next: t.next}
+	for id, v := range t.rows {
+		c.rows[id] = v
+	}
+	return c
+}
+
+// insert присваивает записи следующий ID, если он не задан, и сохраняет её копию.
+// Версия новой записи — 1, как по умолчанию в базе.
+func (t *table[T]) insert(v *T) {
+	if f := versionField(v); f.IsValid() && f.Uint() == 0 {
+		f.SetUint(1)
+	}
+	id := idOf(v)
+	if id == 0 {
+		t.next++
+		id = t.next
+		setID(v, id)
+	} else if id > t.next {
+		t.next = id
+	}
+	t.rows[id] = *v
+}
+
+// get возвращает неудалённую запись.
+func (t *table[T]) get(id uint) (T, bool) {
+	v, ok := t.rows[id]
+	if !ok || deleted(&v) {
+		var zero T
+		return zero, false
+	}
+	return v, true
+}
+
+// save заменяет запись с тем же ID, если она есть, иначе вставляет новую — как Save в GORM.
+func (t *table[T]) save(v *T) {
+	if _, ok := t.rows[idOf(v)]; ok {
+		t.rows[idOf(v)] = *v
+		return
+	}
+	t.insert(v)
+}
+
+// update сохраняет неудалённую запись, если её версия совпадает с
+// сохранённой, и увеличивает версию — как save в gormstore.
+func (t *table[T]) update(v *T) error {
+	row, ok := t.get(idOf(v))
+	if !ok || versionField(&row).Uint() != versionField(v).Uint() {
+		return store.ErrConflict
+	}
+	f := versionField(v)
+	f.SetUint(f.Uint() + 1)
+	t.rows[idOf(v)] = *v
+	return nil
+}
+
+// bump увеличивает версию записи, изменённой в обход update, и сохраняет её.
+func (t *table[T]) bump(v *T) {
+	if f := versionField(v); f.IsValid() {
+		f.SetUint(f.Uint() + 1)
+	}
+	t.save(v)
+}
+
+// all возвращает неудалённые записи по возрастанию ID.
+func (t *table[T]) all() []T {
+	return t.filter(func(v *T) bool { return !deleted(v) })
+}
+
+// unscoped возвращает все записи, включая удалённые.
+func (t *table[T]) unscoped() []T {
+	return t.filter(func(*T) bool { return true })
+}
+
+func (t *table[T]) filter(keep func(*T) bool) []T {
+	ids := make([]uint, 0, len(t.rows))
+	for id := range t.rows {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(a, b int) bool { return ids[a] < ids[b] })
+	out := make([]T, 0, len(ids))
+	for _, id := range ids {
+		v := t.rows[id]
+		if keep(&v) {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// delete удаляет запись: мягко, если у модели есть DeletedAt, иначе окончательно.
+func (t *table[T]) delete(id uint) {
+	t.deleteAt(id, time.Now())
+}
+
+// deleteAt удаляет запись, как delete, отмечая мягкое удаление временем at.
+func (t *table[T]) deleteAt(id uint, at time.Time) {
+	v, ok := t.rows[id]
+	if !ok {
+		return
+	}
+	f := reflect.ValueOf(&v).Elem().FieldByName("DeletedAt")
+	if !f.IsValid() {
+		delete(t.rows, id)
+		return
+	}
+	if !deleted(&v) {
+		f.Set(reflect.ValueOf(gorm.DeletedAt{Time: at, Valid: true}))
+		t.rows[id] = v
+	}
+}
+
+// trashed возвращает мягко удалённые записи по возрастанию ID.
+func (t *table[T]) trashed() []T {
+	return t.filter(func(v *T) bool { return deleted(v) })
+}
+
+// deletedAt возвращает время мягкого удаления записи; false, если запись
+// не удалена или её нет.
+func (t *table[T]) deletedAt(id uint) (time.Time, bool) {
+	v, ok := t.rows[id]
+	if !ok || !deleted(&v) {
+		return time.Time{}, false
+	}
+	return deletedField(&v).Time, true
+}
+
+// restore снимает с записи отметку удаления и увеличивает её версию.
+func (t *table[T]) restore(id uint) {
+	v, ok := t.rows[id]
+	if !ok {
+		return
+	}
+	reflect.ValueOf(&v).Elem().FieldByName("DeletedAt").Set(reflect.ValueOf(gorm.DeletedAt{}))
+	t.bump(&v)
+}
+
+// purge удаляет запись окончательно.
+func (t *table[T]) purge(id uint) {
+	delete(t.rows, id)
+}
+
+func idOf(v interface{}) uint {
+	return uint(reflect.ValueOf(v).Elem().FieldByName("ID").Uint())
+}
+
+func setID(v interface{}, id uint) {
+	reflect.ValueOf(v).Elem().FieldByName("ID").SetUint(uint64(id))
+}
+
+func versionField(v interface{}) reflect.Value {
+	return reflect.ValueOf(v).Elem().FieldByName("Version")
+}
+
+func deleted(v interface{}) bool {
+	return deletedField(v).Valid
+}
+
+// deletedField возвращает отметку удаления; у модели без DeletedAt — пустую.
+func deletedField(v interface{}) gorm.DeletedAt {
+	f := reflect.ValueOf(v).Elem().FieldByName("DeletedAt")
+	if !f.IsValid() {
+		return gorm.DeletedAt{}
+	}
+	return f.Interface().(gorm.DeletedAt)
+}
@@ -0,0 +1,141 @@
+package memstore
+
+import (
+	"sort"
+
+	"crm-backend/internal/models"
+	"crm-backend/internal/store"
+)
+
+// tagLinks реализует store.Taggable над связями запись → теги из links.
+type tagLinks struct {
+	s     *Store
+	links func(*data) map[uint][]uint
+}
+
+// ids возвращает неудалённые теги записи по возрастанию ID. Вызывается под блокировкой.
+func (l tagLinks) ids(id uint) []uint {
+	out := []uint{}
+	for _, tagID := range l.links(l.s.d)[id] {
+		if _, ok := l.s.d.tags.get(tagID); ok {
+			out = append(out, tagID)
+		}
+	}
+	sort.Slice(out, func(a, b int) bool { return out[a] < out[b] })
+	return out
+}
+
+func (l tagLinks) TagIDs(id uint) ([]uint, error) {
+	defer l.s.lock()()
+	return l.ids(id), nil
+}
+
+func (l tagLinks) SetTags(id uint, tagIDs []uint) error {
+	defer l.s.lock()()
+	links := l.links(l.s.d)
+	if len(tagIDs) == 0 {
+		delete(links, id)
+		return nil
+	}
+	links[id] = store.UniqueIDs(tagIDs)
+	return nil
+}
+
+func (l tagLinks) AddTag(id, tagID uint) error {
+	defer l.s.lock()()
+	links := l.links(l.s.d)
+	for _, t := range links[id] {
+		if t == tagID {
+			return nil
+		}
+	}
+	links[id] = append(append([]uint(nil), links[id]...), tagID)
+	return nil
+}
+
+func (l tagLinks) RemoveTag(id, tagID uint) error {
+	defer l.s.lock()()
+	links := l.links(l.s.d)
+	kept := []uint{}
+	for _, t := range links[id] {
+		if t != tagID {
+			kept = append(kept, t)
+		}
+	}
+	links[id] = kept
+	return nil
+}
+
+type tags struct {
+	s *Store
+}
+
+// withDeals загружает неудалённые сделки тега, как Preload("Deals").
+func (t tags) withDeals(tag models.Tag) models.Tag {
+	tag.Deals = []models.Deal{}
+	for _, deal := range t.s.d.deals.all() {
+		for _, id := range t.s.d.dealTags[deal.ID] {
+			if id == tag.ID {
+				tag.Deals = append(tag.Deals, deal)
+				break
+			}
+		}
+	}
+	return tag
+}
+
+func (t tags) List(q store.ListQuery) ([]models.Tag, int64, error) {
+	defer t.s.lock()()
+	rows, total, err := list(t.s.d.tags.all(), q)
+	for i := range rows {
+		rows[i] = t.withDeals(rows[i])
+	}
+	return rows, total, err
+}
+
+func (t tags) Get(id uint) (models.Tag, error) {
+	defer t.s.lock()()
+	tag, ok := t.s.d.tags.get(id)
+	if !ok {
+		return tag, store.ErrNotFound
+	}
+	return t.withDeals(tag), nil
+}
+
+func (t tags) Create(tag *models.Tag) error {
+	defer t.s.lock()()
+	row := *tag
+	row.Deals, row.Customers = nil, nil
+	t.s.d.tags.insert(&row)
+	tag.ID, tag.Version = row.ID, row.Version
+	return nil
+}
+
+func (t tags) Update(tag *models.Tag) error {
+	defer t.s.lock()()
+	row := *tag
+	row.Deals, row.Customers = nil, nil
+	if err := t.s.d.tags.update(&row); err != nil {
+		return err
+	}
+	tag.Version = row.Version
+	return nil
+}
+
+func (t tags) Delete(id uint) error {
+	defer t.s.lock()()
+	t.s.d.tags.delete(id)
+	return nil
+}
+
+func (t tags) Find(ids []uint) ([]models.Tag, error) {
+	defer t.s.lock()()
+	rows := []models.Tag{}
+	for _, id := range store.UniqueIDs(ids) {
+		if tag, ok := t.s.d.tags.get(id); ok {
+			rows = append(rows, tag)
+		}
+	}
+	sort.Slice(rows, func(a, b int) bool { return rows[a].ID < rows[b].ID })
+	return rows, nil
+}
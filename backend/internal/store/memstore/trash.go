@@ -0,0 +1,246 @@
+package memstore
+
+import (
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"crm-backend/internal/models"
+	"crm-backend/internal/store"
+)
+
+type trash struct {
+	s *Store
+}
+
+// trashTable — операции корзины над таблицей любой модели с DeletedAt.
+type trashTable interface {
+	deletedAt(id uint) (time.Time, bool)
+	restore(id uint)
+	purge(id uint)
+}
+
+// tables возвращает таблицы корзины по именам сущностей. Вызывается под блокировкой.
+func (t trash) tables() map[string]trashTable {
+	d := t.s.d
+	return map[string]trashTable{
+		"comments":  d.comments,
+		"deals":     d.deals,
+		"customers": d.customers,
+		"tags":      d.tags,
+		"statuses":  d.statuses,
+		"users":     d.users,
+	}
+}
+
+// items возвращает записи корзины в порядке store.TrashEntities. Вызывается под блокировкой.
+func (t trash) items() []models.TrashItem {
+	d := t.s.d
+	var out []models.TrashItem
+	out = trashItems(out, "comments", d.comments, func(c *models.Comment) (uint, string) {
+		// Как LEFT(content, 100) в gormstore: первые 100 символов, а не байт
+		content := c.Content
+		if utf8.RuneCountInString(content) > 100 {
+			content = string([]rune(content)[:100])
+		}
+		return c.ID, content
+	})
+	out = trashItems(out, "deals", d.deals, func(v *models.Deal) (uint, string) { return v.ID, v.Title })
+	out = trashItems(out, "customers", d.customers, func(v *models.Customer) (uint, string) { return v.ID, v.Name })
+	out = trashItems(out, "tags", d.tags, func(v *models.Tag) (uint, string) { return v.ID, v.Name })
+	out = trashItems(out, "statuses", d.statuses, func(v *models.Status) (uint, string) { return v.ID, v.Name })
+	out = trashItems(out, "users", d.users, func(v *models.User) (uint, string) { return v.ID, v.Name })
+	return out
+}
+
+func trashItems[T any](out []models.TrashItem, entity string, t *table[T], title func(*T) (uint, string)) []models.TrashItem {
+	for _, v := range t.trashed() {
+		id, name := title(&v)
+		out = append(out, models.TrashItem{
+			ID:        entity + ":" + strconv.FormatUint(uint64(id), 10),
+			Entity:    entity,
+			EntityID:  id,
+			Title:     name,
+			DeletedAt: deletedField(&v).Time.Unix(),
+		})
+	}
+	return out
+}
+
+func (t trash) List(q store.ListQuery) ([]models.TrashItem, int64, error) {
+	defer t.s.lock()()
+	return list(t.items(), q)
+}
+
+func (t trash) DeletedBefore(before time.Time) ([]models.TrashItem, error) {
+	defer t.s.lock()()
+	rows := []models.TrashItem{}
+	for _, item := range t.items() {
+		if item.DeletedAt < before.Unix() {
+			rows = append(rows, item)
+		}
+	}
+	return rows, nil
+}
+
+func (t trash) Restore(entity string, id uint) error {
+	defer t.s.lock()()
+	d := t.s.d
+	tbl, ok := t.tables()[entity]
+	if !ok {
+		return store.ErrNotFound
+	}
+	at, ok := tbl.deletedAt(id)
+	if !ok {
+		return store.ErrNotFound
+	}
+	switch entity {
+	case "deals":
+		deal := d.deals.rows[id]
+		_, customer := d.customers.get(deal.CustomerID)
+		_, stage := d.statuses.get(deal.StatusID)
+		if !customer || !stage {
+			return store.ErrParentDeleted
+		}
+	case "comments":
+		if _, ok := d.deals.get(d.comments.rows[id].DealID); !ok {
+			return store.ErrParentDeleted
+		}
+	case "users":
+		user := d.users.rows[id]
+		if (users{t.s}).emailTaken(&user) {
+			return store.ErrDuplicate
+		}
+	case "statuses":
+		(statuses{t.s}).touchPipelines(d.statuses.rows[id].PipelineID)
+	}
+	t.restoreDependents(entity, id, at)
+	tbl.restore(id)
+	return nil
+}
+
+// restoreDependents восстанавливает записи, удалённые вместе с записью
+// entity id в момент at, как в gormstore. Вызывается под блокировкой.
+func (t trash) restoreDependents(entity string, id uint, at time.Time) {
+	d := t.s.d
+	restoreComments := func(keep func(*models.Comment) bool) {
+		for _, comment := range d.comments.trashed() {
+			if comment.DeletedAt.Time.Equal(at) && keep(&comment) {
+				d.comments.restore(comment.ID)
+			}
+		}
+	}
+	switch entity {
+	case "customers":
+		for _, deal := range d.deals.trashed() {
+			if deal.CustomerID == id && deal.DeletedAt.Time.Equal(at) {
+				restoreComments(func(cm *models.Comment) bool { return cm.DealID == deal.ID })
+				d.deals.restore(deal.ID)
+			}
+		}
+	case "deals":
+		restoreComments(func(cm *models.Comment) bool { return cm.DealID == id })
+	case "users":
+		restoreComments(func(cm *models.Comment) bool {
+			_, active := d.deals.get(cm.DealID)
+			return cm.UserID == id && active
+		})
+	}
+}
+
+func (t trash) Purge(entity string, id uint) error {
+	defer t.s.lock()()
+	d := t.s.d
+	tbl, ok := t.tables()[entity]
+	if !ok {
+		return store.ErrNotFound
+	}
+	if _, ok := tbl.deletedAt(id); !ok {
+		return store.ErrNotFound
+	}
+	switch entity {
+	case "customers":
+		if len(d.deals.filter(func(v *models.Deal) bool { return !deleted(v) && v.CustomerID == id })) > 0 {
+			return store.ErrReferenced
+		}
+		for _, deal := range d.deals.unscoped() {
+			if deal.CustomerID == id {
+				t.purgeDeal(deal.ID)
+			}
+		}
+		delete(d.customerTags, id)
+	case "deals":
+		t.purgeDeal(id)
+	case "comments":
+		t.purgeComment(id)
+	case "tags":
+		for _, links := range []map[uint][]uint{d.dealTags, d.customerTags} {
+			for owner, ids := range links {
+				links[owner] = without(ids, id)
+			}
+		}
+	case "statuses":
+		if len(d.deals.filter(func(v *models.Deal) bool { return v.StatusID == id })) > 0 {
+			return store.ErrReferenced
+		}
+	case "users":
+		if len(d.comments.filter(func(v *models.Comment) bool { return v.UserID == id })) > 0 {
+			return store.ErrReferenced
+		}
+		for comment, ids := range d.mentions {
+			d.mentions[comment] = without(ids, id)
+		}
+		for _, token := range d.tokens.filter(func(v *models.RefreshToken) bool { return v.UserID == id }) {
+			d.tokens.purge(token.ID)
+		}
+		for _, ch := range d.stageChanges.filter(func(v *models.DealStageChange) bool { return v.UserID != nil && *v.UserID == id }) {
+			ch.UserID = nil
+			d.stageChanges.save(&ch)
+		}
+		for _, r := range d.revisions.filter(func(v *models.CommentRevision) bool { return v.EditedBy != nil && *v.EditedBy == id }) {
+			r.EditedBy = nil
+			d.revisions.save(&r)
+		}
+	}
+	tbl.purge(id)
+	return nil
+}
+
+// purgeDeal окончательно удаляет сделку с комментариями, тегами и историей
+// этапов, как внешние ключи в базе. Вызывается под блокировкой.
+func (t trash) purgeDeal(id uint) {
+	d := t.s.d
+	for _, comment := range d.comments.filter(func(v *models.Comment) bool { return v.DealID == id }) {
+		t.purgeComment(comment.ID)
+	}
+	for _, ch := range d.stageChanges.filter(func(v *models.DealStageChange) bool { return v.DealID == id }) {
+		d.stageChanges.purge(ch.ID)
+	}
+	delete(d.dealTags, id)
+	d.deals.purge(id)
+}
+
+// purgeComment окончательно удаляет комментарий с правками и упоминаниями;
+// ответы на него остаются без родителя. Вызывается под блокировкой.
+func (t trash) purgeComment(id uint) {
+	d := t.s.d
+	for _, r := range d.revisions.filter(func(v *models.CommentRevision) bool { return v.CommentID == id }) {
+		d.revisions.purge(r.ID)
+	}
+	delete(d.mentions, id)
+	for _, reply := range d.comments.filter(func(v *models.Comment) bool { return v.ParentID != nil && *v.ParentID == id }) {
+		reply.ParentID = nil
+		d.comments.save(&reply)
+	}
+	d.comments.purge(id)
+}
+
+func without(ids []uint, id uint) []uint {
+	out := ids[:0:0]
+	for _, v := range ids {
+		if v != id {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,119 @@
+package memstore
+
+import (
+	"strings"
+	"time"
+
+	"crm-backend/internal/models"
+	"crm-backend/internal/store"
+)
+
+type users struct {
+	s *Store
+}
+
+func (u users) List(q store.ListQuery) ([]models.User, int64, error) {
+	defer u.s.lock()()
+	return list(u.s.d.users.all(), q)
+}
+
+func (u users) Get(id uint) (models.User, error) {
+	defer u.s.lock()()
+	user, ok := u.s.d.users.get(id)
+	if !ok {
+		return user, store.ErrNotFound
+	}
+	return user, nil
+}
+
+func (u users) GetByEmail(email string) (models.User, error) {
+	defer u.s.lock()()
+	for _, user := range u.s.d.users.all() {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return models.User{}, store.ErrNotFound
+}
+
+// emailTaken повторяет частичный уникальный индекс idx_users_email.
+// Вызывается под блокировкой.
+func (u users) emailTaken(user *models.User) bool {
+	for _, other := range u.s.d.users.all() {
+		if other.ID != user.ID && other.Email == user.Email {
+			return true
+		}
+	}
+	return false
+}
+
+func (u users) Create(user *models.User) error {
+	defer u.s.lock()()
+	if u.emailTaken(user) {
+		return errDuplicate
+	}
+	u.s.d.users.insert(user)
+	return nil
+}
+
+func (u users) Update(user *models.User) error {
+	defer u.s.lock()()
+	if u.emailTaken(user) {
+		return errDuplicate
+	}
+	return u.s.d.users.update(user)
+}
+
+func (u users) Delete(id uint) error {
+	defer u.s.lock()()
+	at := time.Now()
+	if _, ok := u.s.d.users.get(id); ok {
+		u.s.deleteComments(at, func(cm *models.Comment) bool { return cm.UserID == id })
+	}
+	u.s.d.users.deleteAt(id, at)
+	return nil
+}
+
+func (u users) Count() (int64, error) {
+	defer u.s.lock()()
+	return int64(len(u.s.d.users.all())), nil
+}
+
+func (u users) CountWithRole(role string) (int64, error) {
+	defer u.s.lock()()
+	var n int64
+	for _, user := range u.s.d.users.all() {
+		if user.Role == role {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (u users) RenameRole(oldName, newName string) error {
+	defer u.s.lock()()
+	for _, user := range u.s.d.users.unscoped() {
+		if user.Role == oldName {
+			user.Role = newName
+			u.s.d.users.bump(&user)
+		}
+	}
+	return nil
+}
+
+func (u users) FindByMentions(handles []string) ([]models.User, error) {
+	defer u.s.lock()()
+	wanted := map[string]bool{}
+	for _, h := range handles {
+		wanted[h] = true
+	}
+	var rows []models.User
+	for _, user := range u.s.d.users.all() {
+		email := strings.ToLower(user.Email)
+		local, _, _ := strings.Cut(email, "@")
+		if wanted[email] || wanted[local] {
+			rows = append(rows, user)
+		}
+	}
+	return rows, nil
+}
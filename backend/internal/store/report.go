@@ -0,0 +1,27 @@
+package store
+
+// CurrencySum — сумма сделок в одной валюте. Weighted — сумма, взвешенная по
+// вероятности сделки, а без неё — по вероятности этапа.
+type CurrencySum struct {
+	Currency string
+	Count    int64
+	Amount   int64
+	Weighted float64
+}
+
+// StageDuration — среднее время, которое сделки проводят на этапе.
+type StageDuration struct {
+	StatusID   uint    `json:"status_id"`
+	Name       string  `json:"name"`
+	PipelineID uint    `json:"pipeline_id"`
+	Visits     int64   `json:"visits"`
+	AvgDays    float64 `json:"avg_days"`
+}
+
+// StageCount — количество сделок на этапе.
+type StageCount struct {
+	StatusID   uint
+	Name       string
+	PipelineID uint
+	Deals      int64
+}
@@ -0,0 +1,273 @@
+// Package store описывает доступ к данным CRM. Обработчики работают только с
+// этими интерфейсами; gormstore реализует их поверх PostgreSQL, memstore —
+// в памяти для быстрых тестов.
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"crm-backend/internal/models"
+)
+
+// ErrNotFound — запись не найдена или удалена.
+var ErrNotFound = errors.New("Запись не найдена")
+
+// ErrConflict — запись изменили или удалили после того, как её прочитали.
+// Update сохраняет запись, только если её Version совпадает с версией в
+// хранилище, и увеличивает Version. Перенос сделок между этапами, новые
+// позиции этапов и переименование роли тоже увеличивают версию затронутых
+// записей, а любое изменение этапов — версию их воронки. Теги меняются
+// вместе с Update записи.
+var ErrConflict = errors.New("Запись изменена другим запросом")
+
+// Ошибки корзины: запись нельзя восстановить, пока удалена та, от которой
+// она зависит (клиент или этап сделки, сделка комментария), или пока
+// её уникальное значение (email пользователя) занято другой записью; нельзя
+// окончательно удалить запись, на которую ссылаются другие.
+var (
+	ErrParentDeleted = errors.New("Связанная запись удалена")
+	ErrDuplicate     = errors.New("Значение уже занято другой записью")
+	ErrReferenced    = errors.New("На запись ссылаются другие записи")
+)
+
+// Store объединяет хранилища всех агрегатов.
+type Store interface {
+	Customers() CustomerStore
+	Deals() DealStore
+	Pipelines() PipelineStore
+	Statuses() StatusStore
+	Tags() TagStore
+	Users() UserStore
+	Roles() RoleStore
+	Sessions() SessionStore
+	Comments() CommentStore
+	Rates() RateStore
+	Audit() AuditStore
+	Trash() TrashStore
+	Imports() ImportStore
+	// Tx выполняет fn в транзакции: если fn вернула ошибку, все изменения,
+	// сделанные через tx, откатываются.
+	Tx(fn func(tx Store) error) error
+	// WithContext возвращает хранилище, запросы которого выполняются в ctx:
+	// отменяются вместе с ним и попадают в журнал с его request_id.
+	WithContext(ctx context.Context) Store
+}
+
+// Taggable — операции с тегами записи (сделки или клиента).
+type Taggable interface {
+	TagIDs(id uint) ([]uint, error)
+	// SetTags заменяет теги записи; пустой список снимает все теги.
+	SetTags(id uint, tagIDs []uint) error
+	AddTag(id, tagID uint) error
+	RemoveTag(id, tagID uint) error
+}
+
+// CustomerStore — клиенты. List и Get заполняют TagIDs. Delete удаляет
+// клиента вместе с его сделками и их комментариями, отмечая их тем же
+// временем удаления.
+type CustomerStore interface {
+	List(q ListQuery) ([]models.Customer, int64, error)
+	Get(id uint) (models.Customer, error)
+	Create(customer *models.Customer) error
+	Update(customer *models.Customer) error
+	Delete(id uint) error
+	Taggable
+}
+
+// DealStore — сделки, их история этапов и отчёты. List и Get загружают
+// клиента и этап и заполняют TagIDs. Delete удаляет сделку вместе с её
+// комментариями, отмечая их тем же временем удаления.
+type DealStore interface {
+	List(q ListQuery) ([]models.Deal, int64, error)
+	Get(id uint) (models.Deal, error)
+	Create(deal *models.Deal) error
+	Update(deal *models.Deal) error
+	Delete(id uint) error
+	Taggable
+
+	// CountInStage считает неудалённые сделки на этапе.
+	CountInStage(statusID uint) (int64, error)
+	// CountInPipeline считает сделки воронки, включая удалённые.
+	CountInPipeline(pipelineID uint) (int64, error)
+	// MoveToStage переносит все сделки (включая удалённые) с этапа fromID на
+	// target и записывает переходы в историю от имени userID.
+	MoveToStage(fromID uint, target models.Status, userID *uint) error
+	// MoveToCustomer переносит неудалённые сделки клиента fromID к клиенту toID.
+	MoveToCustomer(fromID, toID uint) error
+	RecordStageChange(change *models.DealStageChange) error
+	// StageChanges возвращает историю этапов сделки в хронологическом порядке.
+	StageChanges(dealID uint) ([]models.DealStageChange, error)
+	// Totals суммирует сделки, отобранные фильтром q, по валютам. Закрытые
+	// сделки учитываются только при includeClosed.
+	Totals(q ListQuery, includeClosed bool, baseCurrency string) ([]CurrencySum, error)
+	// StageDurations считает среднее время на этапах по посещениям,
+	// начавшимся в [from, to); pipelineID = 0 — по всем воронкам.
+	StageDurations(from, to time.Time, pipelineID uint) ([]StageDuration, error)
+	// OpenByStage считает неудалённые сделки на каждом открытом этапе,
+	// включая этапы без сделок.
+	OpenByStage() ([]StageCount, error)
+}
+
+// PipelineStore — воронки. List и Get загружают этапы по порядку позиций.
+type PipelineStore interface {
+	List(q ListQuery) ([]models.Pipeline, int64, error)
+	Get(id uint) (models.Pipeline, error)
+	// Create создаёт воронку вместе с этапами из Stages.
+	Create(pipeline *models.Pipeline) error
+	// Update сохраняет название и позицию воронки, не трогая этапы.
+	Update(pipeline *models.Pipeline) error
+	// Delete удаляет воронку вместе с её этапами.
+	Delete(id uint) error
+	// Default возвращает воронку, используемую, когда клиент её не указал.
+	Default() (models.Pipeline, error)
+	Count() (int64, error)
+}
+
+// StatusStore — этапы воронок.
+type StatusStore interface {
+	List(q ListQuery) ([]models.Status, int64, error)
+	Get(id uint) (models.Status, error)
+	Create(status *models.Status) error
+	Update(status *models.Status) error
+	Delete(id uint) error
+	// FirstOpen возвращает первый по позиции открытый этап воронки.
+	FirstOpen(pipelineID uint) (models.Status, error)
+	// NextPosition возвращает позицию после последнего этапа воронки.
+	NextPosition(pipelineID uint) (int, error)
+	// SetPositions нумерует этапы по порядку stageIDs начиная с нуля.
+	SetPositions(stageIDs []uint) error
+}
+
+// TagStore — теги. List и Get загружают сделки тега.
+type TagStore interface {
+	List(q ListQuery) ([]models.Tag, int64, error)
+	Get(id uint) (models.Tag, error)
+	Create(tag *models.Tag) error
+	Update(tag *models.Tag) error
+	Delete(id uint) error
+	// Find возвращает существующие теги из ids.
+	Find(ids []uint) ([]models.Tag, error)
+}
+
+// UserStore — пользователи. Delete удаляет пользователя вместе с его
+// комментариями, отмечая их тем же временем удаления.
+type UserStore interface {
+	List(q ListQuery) ([]models.User, int64, error)
+	Get(id uint) (models.User, error)
+	GetByEmail(email string) (models.User, error)
+	Create(user *models.User) error
+	Update(user *models.User) error
+	Delete(id uint) error
+	Count() (int64, error)
+	CountWithRole(role string) (int64, error)
+	// RenameRole переназначает всем пользователям (включая удалённых) роль
+	// oldName на newName.
+	RenameRole(oldName, newName string) error
+	// FindByMentions ищет пользователей, у которых email целиком или его часть
+	// до @ совпадает с одним из handles без учёта регистра.
+	FindByMentions(handles []string) ([]models.User, error)
+}
+
+// RoleStore — роли и выданные им права. List и Get загружают Grants.
+type RoleStore interface {
+	List(q ListQuery) ([]models.Role, int64, error)
+	Get(id uint) (models.Role, error)
+	Exists(name string) (bool, error)
+	Create(role *models.Role) error
+	Update(role *models.Role) error
+	Delete(id uint) error
+	// SetGrants заменяет права роли на role.Grants.
+	SetGrants(role *models.Role) error
+	// Permissions возвращает права роли по её имени.
+	Permissions(role string) ([]string, error)
+}
+
+// SessionStore — refresh-токены и сессии (семейства токенов).
+type SessionStore interface {
+	Create(token *models.RefreshToken) error
+	GetByHash(hash string) (models.RefreshToken, error)
+	// Replace отзывает токен id, если он ещё не отозван, и связывает его с
+	// заменившим; false означает, что токен уже был отозван.
+	Replace(id, replacedByID uint, at time.Time) (bool, error)
+	RevokeFamily(familyID string, at time.Time) error
+	RevokeUser(userID uint, at time.Time) error
+	// ActiveRole возвращает роль пользователя, если его сессия familyID не
+	// отозвана, а сам он существует и не отключён.
+	ActiveRole(familyID string, userID uint) (string, bool, error)
+}
+
+// CommentStore — комментарии, их история и упоминания. List и Get загружают
+// автора и сделку и заполняют MentionIDs.
+type CommentStore interface {
+	List(q ListQuery) ([]models.Comment, int64, error)
+	// ListMentioning возвращает комментарии, в которых упомянут userID.
+	ListMentioning(userID uint, q ListQuery) ([]models.Comment, int64, error)
+	Get(id uint) (models.Comment, error)
+	Create(comment *models.Comment) error
+	// UpdateContent сохраняет текст и отметку об изменении.
+	UpdateContent(comment *models.Comment) error
+	Delete(id uint) error
+	AddRevision(revision *models.CommentRevision) error
+	Revisions(commentID uint) ([]models.CommentRevision, error)
+	// MoveToUser передаёт неудалённые комментарии пользователя fromID
+	// пользователю toID.
+	MoveToUser(fromID, toID uint) error
+	// SetMentions заменяет упоминания комментария.
+	SetMentions(commentID uint, userIDs []uint) error
+	// CountSince считает неудалённые комментарии, созданные не раньше since (unix).
+	CountSince(since int64) (int64, error)
+}
+
+// AuditStore — журнал изменений. Записи только добавляются, обычно в той же
+// транзакции, что и само изменение.
+type AuditStore interface {
+	Record(entry *models.AuditEntry) error
+	List(q ListQuery) ([]models.AuditEntry, int64, error)
+}
+
+// TrashEntities — типы записей, которые удаляются мягко и попадают в
+// корзину, в порядке окончательного удаления: зависимые раньше тех, от
+// которых они зависят.
+var TrashEntities = []string{"comments", "deals", "customers", "tags", "statuses", "users"}
+
+// TrashStore — корзина: мягко удалённые записи всех типов из TrashEntities.
+// Записи вне корзины для Restore и Purge не существуют (ErrNotFound).
+type TrashStore interface {
+	List(q ListQuery) ([]models.TrashItem, int64, error)
+	// DeletedBefore возвращает записи, удалённые раньше before, в порядке
+	// TrashEntities.
+	DeletedBefore(before time.Time) ([]models.TrashItem, error)
+	// Restore возвращает запись из корзины и увеличивает её версию. Вместе с
+	// записью восстанавливаются удалённые одновременно с ней зависимые:
+	// сделки и комментарии клиента, комментарии сделки и пользователя (если
+	// сделка комментария не удалена).
+	Restore(entity string, id uint) error
+	// Purge окончательно удаляет запись вместе с данными, которые без неё не
+	// нужны: клиента — с его сделками, сделку — с комментариями и историей,
+	// тег — со связями. Пользователь с комментариями и этап, на который
+	// ссылаются сделки, не удаляются (ErrReferenced).
+	Purge(entity string, id uint) error
+}
+
+// ImportStore — задачи импорта. Задачу меняет только выполняющий её
+// процесс, поэтому версий у неё нет.
+type ImportStore interface {
+	List(q ListQuery) ([]models.ImportJob, int64, error)
+	Get(id uint) (models.ImportJob, error)
+	Create(job *models.ImportJob) error
+	// Update сохраняет задачу, если она ещё не завершена; завершённую
+	// (например, признанную брошенной) не трогает и возвращает ErrConflict.
+	Update(job *models.ImportJob) error
+	// Interrupt завершает с ошибкой failure незавершённые задачи, которые не
+	// обновлялись с момента staleBefore: выполнявший их процесс упал.
+	Interrupt(failure string, staleBefore, at time.Time) (int64, error)
+}
+
+// RateStore — курсы валют к базовой.
+type RateStore interface {
+	List() ([]models.ExchangeRate, error)
+	Save(rate *models.ExchangeRate) error
+	Delete(currency string) error
+}
@@ -1,16 +1,22 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"os"
 
+	"crm-backend/internal/config"
 	"crm-backend/internal/handlers"
-	"crm-backend/internal/models"
+	"crm-backend/internal/logging"
+	"crm-backend/internal/metrics"
+	"crm-backend/internal/store/gormstore"
 
 	"github.com/gin-gonic/gin"
-	swaggerFiles "github.com/swaggo/files"
-	ginSwagger "github.com/swaggo/gin-swagger"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
@@ -22,82 +28,121 @@ import (
 // @BasePath /
 
 func main() {
-	// Получаем параметры подключения из переменных окружения
-	dsn := os.Getenv("DATABASE_DSN")
-	if dsn == "" {
-		dsn = "host=localhost user=postgres password=postgres dbname=crm port=5432 sslmode=disable"
+	cfg, flags, err := config.Load(os.Args[1:], os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		config.Usage(os.Stdout)
+		return
 	}
+	if err != nil {
+		config.Usage(os.Stderr)
+		log.Fatalf("Ошибка конфигурации: %v", err)
+	}
+	if err := validateConfig(cfg); err != nil {
+		log.Fatalf("Некорректная конфигурация:\n%v", err)
+	}
+	if flags.CheckConfig {
+		fmt.Print(cfg.Redacted().YAML())
+		fmt.Println("Конфигурация корректна")
+		return
+	}
+
+	// Уровень уже проверен validateConfig
+	level, _ := logging.ParseLevel(cfg.Log.Level)
+	logger := logging.New(os.Stdout, level)
+	slog.SetDefault(logger)
+
+	handlers.SetJWTSecret(cfg.Auth.JWTSecret)
+	handlers.AccessTokenTTL = cfg.Auth.AccessTokenTTL
+	handlers.RefreshTokenTTL = cfg.Auth.RefreshTokenTTL
+	handlers.BaseCurrency = cfg.BaseCurrency
+	handlers.CommentEditWindow = cfg.CommentEditWindow
+	if cfg.Log.Level != "debug" {
+		gin.SetMode(gin.ReleaseMode)
+	}
+
+	connect := func() *gorm.DB {
+		db, err := gorm.Open(postgres.Open(cfg.Database.DSN), &gorm.Config{
+			Logger: logging.NewGormLogger(logger, cfg.Log.SlowQuery),
+		})
+		if err != nil {
+			fatal("Ошибка подключения к базе данных", err)
+		}
+		sqlDB, err := db.DB()
+		if err != nil {
+			fatal("Ошибка подключения к базе данных", err)
+		}
+		sqlDB.SetMaxOpenConns(cfg.Database.MaxOpenConns)
+		sqlDB.SetMaxIdleConns(cfg.Database.MaxIdleConns)
+		sqlDB.SetConnMaxLifetime(cfg.Database.ConnMaxLifetime)
+		sqlDB.SetConnMaxIdleTime(cfg.Database.ConnMaxIdleTime)
+		slog.Info("Успешное подключение к базе данных")
+		return db
+	}
+
+	if len(flags.Args) > 0 && flags.Args[0] == "migrate" {
+		runMigrate(flags.Args[1:], connect)
+		return
+	}
+
+	slog.Info("Конфигурация", "config", cfg)
+	if len(cfg.CORS.AllowOrigins) == 0 {
+		slog.Warn("CORS отключён: cors.allow_origins пуст, браузерный фронтенд с другого источника не получит доступ")
+	}
+
+	db := connect()
 
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	// Применяем новые миграции схемы
+	migrator := newMigrator(db)
+	done, err := migrator.Up()
 	if err != nil {
-		log.Fatalf("Ошибка подключения к базе данных: %v", err)
+		fatal("Ошибка применения миграций", err)
+	}
+	for _, mig := range done {
+		slog.Info("Применена миграция", "version", mig.Version, "name", mig.Name)
+	}
+
+	reg := metrics.NewRegistry()
+	if sqlDB, err := db.DB(); err == nil {
+		reg.MustRegister(collectors.NewDBStatsCollector(sqlDB, "crm"))
+	}
+	st := gormstore.New(db)
+	if n, err := handlers.InterruptStaleImports(st); err != nil {
+		slog.Error("Ошибка завершения брошенных задач импорта", "error", err)
+	} else if n > 0 {
+		slog.Info("Брошенные задачи импорта завершены с ошибкой", "count", n)
+	}
+	imports := handlers.NewImportRunner(st)
+	ctx, stopJobs := context.WithCancel(context.Background())
+	go purgeTrash(ctx, st, cfg.Trash)
+
+	r := newRouter(st, cfg, dbProbe{db: db, migrator: migrator}, reg, imports)
+	if err := serve(cfg.HTTP, r); err != nil {
+		slog.Error("Ошибка остановки сервера", "error", err)
+	}
+	stopJobs()
+	imports.Stop()
+
+	// Пул закрывается после того, как начатые запросы и импорты завершились
+	if sqlDB, err := db.DB(); err == nil {
+		if err := sqlDB.Close(); err != nil {
+			slog.Error("Ошибка закрытия соединений с базой данных", "error", err)
+		}
+	}
+	slog.Info("Сервер остановлен")
+}
+
+// fatal пишет ошибку в журнал и завершает процесс.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// validateConfig дополняет config.Validate проверками, которые зависят от
+// справочников пакета handlers.
+func validateConfig(cfg config.Config) error {
+	err := cfg.Validate()
+	if !handlers.ValidCurrency(cfg.BaseCurrency) {
+		err = errors.Join(err, fmt.Errorf("base_currency: неизвестная валюта %q", cfg.BaseCurrency))
 	}
-	fmt.Println("Успешное подключение к базе данных")
-
-	// Миграция моделей
-	db.AutoMigrate(
-		&models.Customer{},
-		&models.Deal{},
-		&models.Status{},
-		&models.Comment{},
-		&models.Tag{},
-		&models.User{},
-	)
-
-	r := gin.Default()
-
-	// Auth
-	r.POST("/auth/register", handlers.Register(db))
-	r.POST("/auth/login", handlers.Login(db))
-	r.GET("/auth/me", handlers.JWTAuthMiddleware(), handlers.Me(db))
-
-	// CRUD для клиентов
-	r.GET("/customers", handlers.GetCustomers(db))
-	r.GET("/customers/:id", handlers.GetCustomer(db))
-	r.POST("/customers", handlers.CreateCustomer(db))
-	r.PUT("/customers/:id", handlers.UpdateCustomer(db))
-	r.DELETE("/customers/:id", handlers.DeleteCustomer(db))
-
-	// CRUD для сделок
-	r.GET("/deals", handlers.GetDeals(db))
-	r.GET("/deals/:id", handlers.GetDeal(db))
-	r.POST("/deals", handlers.CreateDeal(db))
-	r.PUT("/deals/:id", handlers.UpdateDeal(db))
-	r.DELETE("/deals/:id", handlers.DeleteDeal(db))
-
-	// CRUD для статусов
-	r.GET("/statuses", handlers.GetStatuses(db))
-	r.GET("/statuses/:id", handlers.GetStatus(db))
-	r.POST("/statuses", handlers.CreateStatus(db))
-	r.PUT("/statuses/:id", handlers.UpdateStatus(db))
-	r.DELETE("/statuses/:id", handlers.DeleteStatus(db))
-
-	// CRUD для тегов
-	r.GET("/tags", handlers.GetTags(db))
-	r.GET("/tags/:id", handlers.GetTag(db))
-	r.POST("/tags", handlers.CreateTag(db))
-	r.PUT("/tags/:id", handlers.UpdateTag(db))
-	r.DELETE("/tags/:id", handlers.DeleteTag(db))
-
-	// CRUD для пользователей (требует авторизации)
-	u := r.Group("/users")
-	u.Use(handlers.JWTAuthMiddleware())
-	u.GET("", handlers.GetUsers(db))
-	u.GET(":id", handlers.GetUser(db))
-	u.POST("", handlers.CreateUser(db))
-	u.PUT(":id", handlers.UpdateUser(db))
-	u.DELETE(":id", handlers.DeleteUser(db))
-
-	// CRUD для комментариев (требует авторизации)
-	cmt := r.Group("/comments")
-	cmt.Use(handlers.JWTAuthMiddleware())
-	cmt.GET("", handlers.GetComments(db))
-	cmt.GET(":id", handlers.GetComment(db))
-	cmt.POST("", handlers.CreateComment(db))
-	cmt.PUT(":id", handlers.UpdateComment(db))
-	cmt.DELETE(":id", handlers.DeleteComment(db))
-
-	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
-
-	r.Run(":8080") // Запуск сервера на порту 8080
+	return err
 }
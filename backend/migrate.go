@@ -0,0 +1,102 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"crm-backend/internal/migrations"
+
+	"gorm.io/gorm"
+)
+
+const migrateUsage = `Использование: crm-backend migrate <команда> [параметры]
+
+Команды:
+  up              применить все новые миграции
+  down [-steps N] откатить последние N миграций (по умолчанию 1)
+  status          показать список миграций и их состояние
+  create <name>   создать пустую пару файлов миграции
+`
+
+// runMigrate выполняет подкоманду migrate. Подключение к базе открывается
+// через connect только для команд, которым оно нужно.
+func runMigrate(args []string, connect func() *gorm.DB) {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, migrateUsage)
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "create":
+		fs := flag.NewFlagSet("create", flag.ExitOnError)
+		dir := fs.String("dir", migrations.SourceDir, "каталог с файлами миграций")
+		fs.Parse(args[1:])
+		if fs.NArg() != 1 {
+			fmt.Fprint(os.Stderr, migrateUsage)
+			os.Exit(2)
+		}
+		up, down, err := migrations.Create(*dir, fs.Arg(0))
+		if err != nil {
+			log.Fatalf("Ошибка создания миграции: %v", err)
+		}
+		fmt.Println("Создано:", up)
+		fmt.Println("Создано:", down)
+
+	case "up":
+		m := newMigrator(connect())
+		done, err := m.Up()
+		for _, mig := range done {
+			fmt.Printf("Применена %04d_%s\n", mig.Version, mig.Name)
+		}
+		if err != nil {
+			log.Fatalf("Ошибка применения миграций: %v", err)
+		}
+		if len(done) == 0 {
+			fmt.Println("Новых миграций нет")
+		}
+
+	case "down":
+		fs := flag.NewFlagSet("down", flag.ExitOnError)
+		steps := fs.Int("steps", 1, "сколько миграций откатить")
+		fs.Parse(args[1:])
+		m := newMigrator(connect())
+		done, err := m.Down(*steps)
+		for _, mig := range done {
+			fmt.Printf("Откачена %04d_%s\n", mig.Version, mig.Name)
+		}
+		if err != nil {
+			log.Fatalf("Ошибка отката миграций: %v", err)
+		}
+		if len(done) == 0 {
+			fmt.Println("Нечего откатывать")
+		}
+
+	case "status":
+		m := newMigrator(connect())
+		statuses, err := m.Status()
+		if err != nil {
+			log.Fatalf("Ошибка получения статуса миграций: %v", err)
+		}
+		for _, st := range statuses {
+			applied := "не применена"
+			if st.AppliedAt != nil {
+				applied = "применена " + st.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%-40s %s\n", st.Version, st.Name, applied)
+		}
+
+	default:
+		fmt.Fprint(os.Stderr, migrateUsage)
+		os.Exit(2)
+	}
+}
+
+func newMigrator(db *gorm.DB) *migrations.Migrator {
+	m, err := migrations.New(db)
+	if err != nil {
+		log.Fatalf("Ошибка загрузки миграций: %v", err)
+	}
+	return m
+}
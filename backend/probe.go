@@ -0,0 +1,27 @@
+package main
+
+import (
+	"context"
+
+	"crm-backend/internal/migrations"
+
+	"gorm.io/gorm"
+)
+
+// dbProbe проверяет готовность сервера по состоянию PostgreSQL.
+type dbProbe struct {
+	db       *gorm.DB
+	migrator *migrations.Migrator
+}
+
+func (p dbProbe) Ping(ctx context.Context) error {
+	sqlDB, err := p.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+func (p dbProbe) PendingMigrations(ctx context.Context) (int, error) {
+	return p.migrator.WithContext(ctx).Pending()
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"log/slog"
+
+	"crm-backend/internal/config"
+	"crm-backend/internal/handlers"
+	"crm-backend/internal/metrics"
+	"crm-backend/internal/store"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	swaggerFiles "github.com/swaggo/files"
+	ginSwagger "github.com/swaggo/gin-swagger"
+)
+
+// corsMiddleware строит политику CORS для браузерного фронтенда. Источник
+// "*" разрешает любой, в остальных допускаются шаблоны вида https://*.example.com.
+func corsMiddleware(cfg config.CORSConfig) gin.HandlerFunc {
+	policy := cors.Config{
+		AllowMethods:     cfg.AllowMethods,
+		AllowHeaders:     cfg.AllowHeaders,
+		ExposeHeaders:    cfg.ExposeHeaders,
+		AllowCredentials: cfg.AllowCredentials,
+		MaxAge:           cfg.MaxAge,
+		AllowWildcard:    true,
+	}
+	for _, origin := range cfg.AllowOrigins {
+		if origin == "*" {
+			policy.AllowAllOrigins = true
+			policy.AllowOrigins = nil
+			break
+		}
+		policy.AllowOrigins = append(policy.AllowOrigins, origin)
+	}
+	return cors.New(policy)
+}
+
+// newRouter собирает HTTP API поверх хранилища st. probe отвечает за
+// проверку готовности в /readyz, в reg регистрируются метрики для /metrics,
+// imports выполняет задачи импорта.
+func newRouter(st store.Store, cfg config.Config, probe handlers.ReadinessProbe, reg *prometheus.Registry, imports *handlers.ImportRunner) *gin.Engine {
+	// Журнал запросов идёт первым, чтобы в него попадали и ответы CORS, и паники;
+	// метрики — до Recovery, чтобы паника учитывалась как 500
+	r := gin.New()
+	r.Use(handlers.RequestLogger(slog.Default()))
+	if cfg.Metrics.Enabled {
+		r.Use(metrics.NewHTTP(reg).Middleware())
+	}
+	r.Use(handlers.Recovery(slog.Default()))
+
+	if len(cfg.CORS.AllowOrigins) > 0 {
+		r.Use(corsMiddleware(cfg.CORS))
+	}
+
+	// Проверки для оркестратора
+	r.GET("/healthz", handlers.Healthz())
+	r.GET("/readyz", handlers.Readyz(probe))
+	if cfg.Metrics.Enabled {
+		metrics.RegisterBusiness(reg, st)
+		r.GET("/metrics", metrics.Handler(reg, cfg.Metrics.Token))
+	}
+
+	// Auth
+	r.POST("/auth/register", handlers.Register(st))
+	r.POST("/auth/login", handlers.Login(st))
+	r.POST("/auth/refresh", handlers.Refresh(st))
+	r.POST("/auth/logout", handlers.Logout(st))
+	r.GET("/auth/me", handlers.JWTAuthMiddleware(st), handlers.Me(st))
+
+	// Все остальные маршруты требуют авторизации и соответствующего права
+	auth := handlers.JWTAuthMiddleware(st)
+	can := handlers.RequirePermission
+
+	// CRUD для клиентов
+	cust := r.Group("/customers", auth)
+	cust.GET("", can(handlers.PermCustomersRead), handlers.GetCustomers(st))
+	cust.GET(":id", can(handlers.PermCustomersRead), handlers.GetCustomer(st))
+	cust.POST("", can(handlers.PermCustomersWrite), handlers.CreateCustomer(st))
+	cust.PUT(":id", can(handlers.PermCustomersWrite), handlers.UpdateCustomer(st))
+	cust.PATCH(":id", can(handlers.PermCustomersWrite), handlers.UpdateCustomer(st))
+	cust.DELETE(":id", can(handlers.PermCustomersDelete), handlers.DeleteCustomer(st))
+	cust.POST("bulk/update", can(handlers.PermCustomersWrite), handlers.BulkUpdateCustomers(st))
+	cust.POST("bulk/delete", can(handlers.PermCustomersDelete), handlers.BulkDeleteCustomers(st))
+	cust.POST("import", can(handlers.PermCustomersWrite), handlers.ImportCustomers(st, imports))
+	cust.PUT(":id/tags", can(handlers.PermCustomersWrite), handlers.SetCustomerTags(st))
+	cust.POST(":id/tags/:tag_id", can(handlers.PermCustomersWrite), handlers.AddCustomerTag(st))
+	cust.DELETE(":id/tags/:tag_id", can(handlers.PermCustomersWrite), handlers.RemoveCustomerTag(st))
+	cust.GET(":id/audit", can(handlers.PermAuditRead), handlers.GetRecordAudit(st, "customers"))
+
+	// CRUD для сделок
+	d := r.Group("/deals", auth)
+	d.GET("", can(handlers.PermDealsRead), handlers.GetDeals(st))
+	d.GET(":id", can(handlers.PermDealsRead), handlers.GetDeal(st))
+	d.POST("", can(handlers.PermDealsWrite), handlers.CreateDeal(st))
+	d.PUT(":id", can(handlers.PermDealsWrite), handlers.UpdateDeal(st))
+	d.PATCH(":id", can(handlers.PermDealsWrite), handlers.UpdateDeal(st))
+	d.DELETE(":id", can(handlers.PermDealsDelete), handlers.DeleteDeal(st))
+	d.POST("bulk/update", can(handlers.PermDealsWrite), handlers.BulkUpdateDeals(st))
+	d.POST("bulk/delete", can(handlers.PermDealsDelete), handlers.BulkDeleteDeals(st))
+	d.POST("import", can(handlers.PermDealsWrite), handlers.ImportDeals(st, imports))
+	d.GET(":id/history", can(handlers.PermDealsRead), handlers.GetDealHistory(st))
+	d.GET(":id/comments", can(handlers.PermCommentsRead), handlers.GetDealComments(st))
+	d.POST(":id/comments", can(handlers.PermCommentsWrite), handlers.CreateDealComment(st))
+	d.PUT(":id/tags", can(handlers.PermDealsWrite), handlers.SetDealTags(st))
+	d.POST(":id/tags/:tag_id", can(handlers.PermDealsWrite), handlers.AddDealTag(st))
+	d.DELETE(":id/tags/:tag_id", can(handlers.PermDealsWrite), handlers.RemoveDealTag(st))
+	d.GET(":id/audit", can(handlers.PermAuditRead), handlers.GetRecordAudit(st, "deals"))
+	r.GET("/reports/pipeline", auth, can(handlers.PermDealsRead), handlers.GetPipelineTotals(st))
+	r.GET("/reports/stage-durations", auth, can(handlers.PermDealsRead), handlers.GetStageDurations(st))
+
+	// Курсы валют для пересчёта сумм в базовую валюту
+	fx := r.Group("/exchange-rates", auth)
+	fx.GET("", can(handlers.PermDealsRead), handlers.GetExchangeRates(st))
+	fx.PUT(":currency", can(handlers.PermRatesManage), handlers.PutExchangeRate(st))
+	fx.DELETE(":currency", can(handlers.PermRatesManage), handlers.DeleteExchangeRate(st))
+
+	// CRUD для статусов
+	sts := r.Group("/statuses", auth)
+	sts.GET("", can(handlers.PermStatusesRead), handlers.GetStatuses(st))
+	sts.GET(":id", can(handlers.PermStatusesRead), handlers.GetStatus(st))
+	sts.POST("", can(handlers.PermStatusesWrite), handlers.CreateStatus(st))
+	sts.PUT(":id", can(handlers.PermStatusesWrite), handlers.UpdateStatus(st))
+	sts.PATCH(":id", can(handlers.PermStatusesWrite), handlers.UpdateStatus(st))
+	sts.DELETE(":id", can(handlers.PermStatusesDelete), handlers.DeleteStatus(st))
+	sts.GET(":id/audit", can(handlers.PermAuditRead), handlers.GetRecordAudit(st, "statuses"))
+
+	// Воронки и порядок их этапов
+	pl := r.Group("/pipelines", auth)
+	pl.GET("", can(handlers.PermStatusesRead), handlers.GetPipelines(st))
+	pl.GET(":id", can(handlers.PermStatusesRead), handlers.GetPipeline(st))
+	pl.POST("", can(handlers.PermStatusesWrite), handlers.CreatePipeline(st))
+	pl.PUT(":id", can(handlers.PermStatusesWrite), handlers.UpdatePipeline(st))
+	pl.PATCH(":id", can(handlers.PermStatusesWrite), handlers.UpdatePipeline(st))
+	pl.DELETE(":id", can(handlers.PermStatusesDelete), handlers.DeletePipeline(st))
+	pl.POST(":id/reorder", can(handlers.PermStatusesWrite), handlers.ReorderStages(st))
+	pl.GET(":id/audit", can(handlers.PermAuditRead), handlers.GetRecordAudit(st, "pipelines"))
+
+	// CRUD для тегов
+	t := r.Group("/tags", auth)
+	t.GET("", can(handlers.PermTagsRead), handlers.GetTags(st))
+	t.GET(":id", can(handlers.PermTagsRead), handlers.GetTag(st))
+	t.POST("", can(handlers.PermTagsWrite), handlers.CreateTag(st))
+	t.PUT(":id", can(handlers.PermTagsWrite), handlers.UpdateTag(st))
+	t.PATCH(":id", can(handlers.PermTagsWrite), handlers.UpdateTag(st))
+	t.DELETE(":id", can(handlers.PermTagsDelete), handlers.DeleteTag(st))
+	t.GET(":id/audit", can(handlers.PermAuditRead), handlers.GetRecordAudit(st, "tags"))
+
+	// CRUD для пользователей
+	u := r.Group("/users", auth)
+	u.GET("", can(handlers.PermUsersRead), handlers.GetUsers(st))
+	u.GET(":id", can(handlers.PermUsersRead), handlers.GetUser(st))
+	u.POST("", can(handlers.PermUsersManage), handlers.CreateUser(st))
+	u.PUT(":id", can(handlers.PermUsersManage), handlers.UpdateUser(st))
+	u.PATCH(":id", can(handlers.PermUsersManage), handlers.UpdateUser(st))
+	u.DELETE(":id", can(handlers.PermUsersManage), handlers.DeleteUser(st))
+	u.GET(":id/audit", can(handlers.PermAuditRead), handlers.GetRecordAudit(st, "users"))
+
+	// CRUD для комментариев
+	cmt := r.Group("/comments", auth)
+	cmt.GET("", can(handlers.PermCommentsRead), handlers.GetComments(st))
+	cmt.GET("mentions", can(handlers.PermCommentsRead), handlers.GetMyMentions(st))
+	cmt.GET(":id", can(handlers.PermCommentsRead), handlers.GetComment(st))
+	cmt.POST("", can(handlers.PermCommentsWrite), handlers.CreateComment(st))
+	cmt.PUT(":id", can(handlers.PermCommentsWrite), handlers.UpdateComment(st))
+	cmt.PATCH(":id", can(handlers.PermCommentsWrite), handlers.UpdateComment(st))
+	cmt.DELETE(":id", can(handlers.PermCommentsDelete), handlers.DeleteComment(st))
+	cmt.GET(":id/revisions", can(handlers.PermCommentsRead), handlers.GetCommentRevisions(st))
+	cmt.GET(":id/audit", can(handlers.PermAuditRead), handlers.GetRecordAudit(st, "comments"))
+
+	// Роли и права
+	rl := r.Group("/roles", auth, can(handlers.PermRolesManage))
+	rl.GET("", handlers.GetRoles(st))
+	rl.GET(":id", handlers.GetRole(st))
+	rl.POST("", handlers.CreateRole(st))
+	rl.PUT(":id", handlers.UpdateRole(st))
+	rl.PATCH(":id", handlers.UpdateRole(st))
+	rl.DELETE(":id", handlers.DeleteRole(st))
+	r.GET("/permissions", auth, can(handlers.PermRolesManage), handlers.GetPermissions())
+
+	// Журнал изменений
+	r.GET("/audit", auth, can(handlers.PermAuditRead), handlers.GetAudit(st))
+
+	// Задачи импорта: пользователь видит свои, администратор — все
+	im := r.Group("/imports", auth)
+	im.GET("", handlers.GetImports(st))
+	im.GET(":id", handlers.GetImport(st))
+
+	// Корзина: права проверяются по типу записи
+	tr := r.Group("/trash", auth)
+	tr.GET("", handlers.GetTrash(st))
+	tr.POST(":entity/:id/restore", handlers.RestoreTrash(st))
+	tr.DELETE(":entity/:id", handlers.PurgeTrash(st))
+
+	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+
+	return r
+}
@@ -0,0 +1,1654 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"crm-backend/internal/config"
+	"crm-backend/internal/handlers"
+	"crm-backend/internal/logging"
+	"crm-backend/internal/metrics"
+	"crm-backend/internal/models"
+	"crm-backend/internal/store"
+	"crm-backend/internal/store/memstore"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const testPassword = "secret"
+
+// testConfig — конфигурация по умолчанию для разработки.
+var testConfig = config.Default().WithEnvDefaults()
+
+// covered — маршруты ("GET /deals/:id"), по которым тесты отправили запрос.
+var (
+	coveredMu sync.Mutex
+	covered   = map[string]bool{}
+)
+
+// TestMain после прогона проверяет, что тесты обращались к каждому маршруту
+// newRouter. При запуске части тестов через -run проверка пропускается.
+func TestMain(m *testing.M) {
+	handlers.SetJWTSecret("test-secret")
+	gin.SetMode(gin.TestMode)
+	gin.DefaultWriter = io.Discard
+	slog.SetDefault(logging.New(io.Discard, slog.LevelError))
+
+	code := m.Run()
+	if code == 0 && flag.Lookup("test.run").Value.String() == "" {
+		var missing []string
+		for _, rt := range emptyRouter(testConfig).Routes() {
+			if key := rt.Method + " " + rt.Path; !covered[key] {
+				missing = append(missing, key)
+			}
+		}
+		if len(missing) > 0 {
+			sort.Strings(missing)
+			fmt.Println("Маршруты без тестов:\n  " + strings.Join(missing, "\n  "))
+			code = 1
+		}
+	}
+	os.Exit(code)
+}
+
+// matchRoute находит маршрут, которым gin обработает запрос. Статические
+// сегменты приоритетнее параметров, как в дереве маршрутов gin.
+func matchRoute(routes gin.RoutesInfo, method, path string) string {
+	segs := strings.Split(strings.Trim(path, "/"), "/")
+	best, bestStatic := "", -1
+	for _, rt := range routes {
+		if rt.Method != method {
+			continue
+		}
+		pattern := strings.Split(strings.Trim(rt.Path, "/"), "/")
+		static, ok := 0, true
+		for i, p := range pattern {
+			if strings.HasPrefix(p, "*") {
+				break
+			}
+			if i >= len(segs) {
+				ok = false
+				break
+			}
+			if strings.HasPrefix(p, ":") {
+				continue
+			}
+			if p != segs[i] {
+				ok = false
+				break
+			}
+			static++
+		}
+		last := pattern[len(pattern)-1]
+		if ok && !strings.HasPrefix(last, "*") && len(pattern) != len(segs) {
+			ok = false
+		}
+		if ok && static > bestStatic {
+			best, bestStatic = rt.Method+" "+rt.Path, static
+		}
+	}
+	return best
+}
+
+// testProbe подменяет проверки PostgreSQL для /readyz.
+type testProbe struct {
+	pingErr error
+	pending int
+}
+
+func (p testProbe) Ping(context.Context) error { return p.pingErr }
+
+func (p testProbe) PendingMigrations(context.Context) (int, error) { return p.pending, nil }
+
+// api — сервер поверх пустого хранилища в памяти и токен администратора.
+type api struct {
+	t     *testing.T
+	r     *gin.Engine
+	st    *memstore.Store
+	token string
+}
+
+func newAPI(t *testing.T) *api {
+	t.Helper()
+	st := memstore.New()
+	imports := handlers.NewImportRunner(st)
+	t.Cleanup(imports.Stop)
+	a := &api{t: t, r: newRouter(st, testConfig, testProbe{}, metrics.NewRegistry(), imports), st: st}
+	a.addUser("Админ", "admin@example.com", handlers.AdminRole)
+	a.token = a.login("admin@example.com")
+	return a
+}
+
+// emptyRouter собирает API с настройками cfg поверх пустого хранилища.
+func emptyRouter(cfg config.Config) *gin.Engine {
+	st := memstore.New()
+	return newRouter(st, cfg, testProbe{}, metrics.NewRegistry(), handlers.NewImportRunner(st))
+}
+
+// addUser создаёт пользователя с паролем testPassword напрямую в хранилище.
+func (a *api) addUser(name, email, role string) models.User {
+	a.t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	user := models.User{Name: name, Email: email, Role: role, PasswordHash: string(hash)}
+	if err := a.st.Users().Create(&user); err != nil {
+		a.t.Fatal(err)
+	}
+	return user
+}
+
+func (a *api) loginPair(email string) map[string]interface{} {
+	a.t.Helper()
+	var pair map[string]interface{}
+	a.doAs("", "POST", "/auth/login", gin.H{"email": email, "password": testPassword}, http.StatusOK, &pair)
+	return pair
+}
+
+func (a *api) login(email string) string {
+	a.t.Helper()
+	return a.loginPair(email)["token"].(string)
+}
+
+// do отправляет запрос от имени администратора, проверяет код ответа и
+// разбирает JSON-ответ в out, если он не nil.
+func (a *api) do(method, path string, body interface{}, want int, out interface{}) *httptest.ResponseRecorder {
+	a.t.Helper()
+	return a.doAs(a.token, method, path, body, want, out)
+}
+
+func (a *api) doAs(token, method, path string, body interface{}, want int, out interface{}) *httptest.ResponseRecorder {
+	a.t.Helper()
+	return a.send(token, nil, method, path, body, want, out)
+}
+
+// doWith отправляет запрос от имени администратора с дополнительными заголовками.
+func (a *api) doWith(header http.Header, method, path string, body interface{}, want int, out interface{}) *httptest.ResponseRecorder {
+	a.t.Helper()
+	return a.send(a.token, header, method, path, body, want, out)
+}
+
+func (a *api) send(token string, header http.Header, method, path string, body interface{}, want int, out interface{}) *httptest.ResponseRecorder {
+	a.t.Helper()
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			a.t.Fatal(err)
+		}
+		reader = bytes.NewReader(b)
+		header = header.Clone()
+		if header == nil {
+			header = http.Header{}
+		}
+		header.Set("Content-Type", "application/json")
+	}
+	return a.serve(token, header, method, path, reader, want, out)
+}
+
+// upload отправляет от имени администратора форму multipart/form-data с
+// файлом file и полями fields.
+func (a *api) upload(path, file, content string, fields map[string]string, want int, out interface{}) *httptest.ResponseRecorder {
+	a.t.Helper()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for k, v := range fields {
+		if err := mw.WriteField(k, v); err != nil {
+			a.t.Fatal(err)
+		}
+	}
+	if file != "" {
+		fw, err := mw.CreateFormFile("file", file)
+		if err != nil {
+			a.t.Fatal(err)
+		}
+		if _, err := io.WriteString(fw, content); err != nil {
+			a.t.Fatal(err)
+		}
+	}
+	if err := mw.Close(); err != nil {
+		a.t.Fatal(err)
+	}
+	return a.serve(a.token, http.Header{"Content-Type": {mw.FormDataContentType()}}, "POST", path, &buf, want, out)
+}
+
+func (a *api) serve(token string, header http.Header, method, path string, body io.Reader, want int, out interface{}) *httptest.ResponseRecorder {
+	a.t.Helper()
+	req := httptest.NewRequest(method, path, body)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	for k, values := range header {
+		for _, v := range values {
+			req.Header.Add(k, v)
+		}
+	}
+	w := httptest.NewRecorder()
+	a.r.ServeHTTP(w, req)
+
+	if route := matchRoute(a.r.Routes(), method, req.URL.Path); route != "" {
+		coveredMu.Lock()
+		covered[route] = true
+		coveredMu.Unlock()
+	}
+	if w.Code != want {
+		a.t.Fatalf("%s %s: код %d, ожидался %d: %s", method, path, w.Code, want, w.Body.String())
+	}
+	if out != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), out); err != nil {
+			a.t.Fatalf("%s %s: некорректный JSON: %v: %s", method, path, err, w.Body.String())
+		}
+	}
+	return w
+}
+
+// query кодирует параметры списка в формате ra-data-simple-rest.
+func query(path string, params ...string) string {
+	v := url.Values{}
+	for i := 0; i+1 < len(params); i += 2 {
+		v.Set(params[i], params[i+1])
+	}
+	return path + "?" + v.Encode()
+}
+
+func id(v map[string]interface{}) uint {
+	return uint(v["id"].(float64))
+}
+
+func path(format string, args ...interface{}) string {
+	return fmt.Sprintf(format, args...)
+}
+
+// stages создаёт в основной воронке этапы «Новая», «В работе» и «Выиграна».
+func (a *api) stages() (open, work, won uint) {
+	a.t.Helper()
+	var s map[string]interface{}
+	a.do("POST", "/statuses", gin.H{"name": "Новая", "probability": 10}, http.StatusCreated, &s)
+	open = id(s)
+	a.do("POST", "/statuses", gin.H{"name": "В работе", "probability": 50}, http.StatusCreated, &s)
+	work = id(s)
+	a.do("POST", "/statuses", gin.H{"name": "Выиграна", "type": models.StageWon, "probability": 100}, http.StatusCreated, &s)
+	won = id(s)
+	return
+}
+
+func (a *api) customer(name string) uint {
+	a.t.Helper()
+	var c map[string]interface{}
+	a.do("POST", "/customers", gin.H{"name": name, "email": strings.ToLower(name) + "@example.com"}, http.StatusCreated, &c)
+	return id(c)
+}
+
+func (a *api) deal(title string, customerID uint) uint {
+	a.t.Helper()
+	var d map[string]interface{}
+	a.do("POST", "/deals", gin.H{"title": title, "customer_id": customerID, "amount": 100000}, http.StatusCreated, &d)
+	return id(d)
+}
+
+func TestAuth(t *testing.T) {
+	a := newAPI(t)
+
+	a.doAs("", "POST", "/auth/register", gin.H{"email": "new@example.com"}, http.StatusBadRequest, nil)
+	var reg map[string]interface{}
+	a.doAs("", "POST", "/auth/register", gin.H{"name": "Новый", "email": "new@example.com", "password": "password1"}, http.StatusCreated, &reg)
+	if reg["role"] != handlers.DefaultRole {
+		t.Fatalf("роль при регистрации: %v", reg)
+	}
+	a.doAs("", "POST", "/auth/login", gin.H{"email": "new@example.com", "password": "password1"}, http.StatusOK, nil)
+	a.doAs("", "POST", "/auth/register", gin.H{"name": "Новый", "email": "new@example.com", "password": "password1"}, http.StatusConflict, nil)
+	a.doAs("", "POST", "/auth/login", gin.H{"email": "admin@example.com", "password": "wrong"}, http.StatusUnauthorized, nil)
+
+	var me map[string]interface{}
+	a.do("GET", "/auth/me", nil, http.StatusOK, &me)
+	if me["role"] != handlers.AdminRole || len(me["permissions"].([]interface{})) == 0 {
+		t.Fatalf("неожиданный ответ /auth/me: %v", me)
+	}
+	a.doAs("", "GET", "/auth/me", nil, http.StatusUnauthorized, nil)
+
+	// Ротация: старый refresh-токен после замены отзывает всю сессию
+	pair := a.loginPair("admin@example.com")
+	var next map[string]interface{}
+	a.doAs("", "POST", "/auth/refresh", gin.H{"refresh_token": pair["refresh_token"]}, http.StatusOK, &next)
+	a.doAs("", "POST", "/auth/refresh", gin.H{"refresh_token": pair["refresh_token"]}, http.StatusUnauthorized, nil)
+	a.doAs("", "POST", "/auth/refresh", gin.H{"refresh_token": next["refresh_token"]}, http.StatusUnauthorized, nil)
+	a.doAs(next["token"].(string), "GET", "/auth/me", nil, http.StatusUnauthorized, nil)
+
+	token := a.login("admin@example.com")
+	a.doAs(token, "POST", "/auth/logout", gin.H{}, http.StatusNoContent, nil)
+	a.doAs(token, "GET", "/auth/me", nil, http.StatusUnauthorized, nil)
+}
+
+func TestPermissions(t *testing.T) {
+	a := newAPI(t)
+	a.addUser("Бухгалтер", "acc@example.com", "accountant")
+	token := a.login("acc@example.com")
+
+	a.doAs(token, "GET", "/customers", nil, http.StatusOK, nil)
+	a.doAs(token, "POST", "/customers", gin.H{"name": "ООО Ромашка"}, http.StatusForbidden, nil)
+	a.doAs(token, "GET", "/roles", nil, http.StatusForbidden, nil)
+
+	var perms []map[string]interface{}
+	a.do("GET", "/permissions", nil, http.StatusOK, &perms)
+	if len(perms) == 0 {
+		t.Fatal("пустой список прав")
+	}
+}
+
+func TestCustomers(t *testing.T) {
+	a := newAPI(t)
+	var tag map[string]interface{}
+	a.do("POST", "/tags", gin.H{"name": "VIP"}, http.StatusCreated, &tag)
+	tagID := id(tag)
+
+	var c map[string]interface{}
+	a.do("POST", "/customers", gin.H{"name": "Acme", "company": "Acme Inc", "tag_ids": []uint{tagID}}, http.StatusCreated, &c)
+	cid := id(c)
+	a.customer("Globex")
+	a.do("POST", "/customers", gin.H{"name": "X", "tag_ids": []uint{999}}, http.StatusBadRequest, nil)
+
+	var list []map[string]interface{}
+	w := a.do("GET", query("/customers", "sort", `["name","DESC"]`, "range", `[0,0]`), nil, http.StatusOK, &list)
+	if len(list) != 1 || list[0]["name"] != "Globex" || w.Header().Get("Content-Range") != "customers 0-0/2" {
+		t.Fatalf("неожиданная страница клиентов: %v, %s", list, w.Header().Get("Content-Range"))
+	}
+	a.do("GET", query("/customers", "filter", fmt.Sprintf(`{"tag_ids":[%d]}`, tagID)), nil, http.StatusOK, &list)
+	if len(list) != 1 || id(list[0]) != cid {
+		t.Fatalf("фильтр по тегу вернул %v", list)
+	}
+	a.do("GET", query("/customers", "filter", `{"q":"glob"}`), nil, http.StatusOK, &list)
+	if len(list) != 1 || list[0]["name"] != "Globex" {
+		t.Fatalf("поиск вернул %v", list)
+	}
+	a.do("GET", query("/customers", "sort", `["password","ASC"]`), nil, http.StatusBadRequest, nil)
+
+	a.do("GET", path("/customers/%d", cid), nil, http.StatusOK, &c)
+	a.do("PUT", path("/customers/%d", cid), gin.H{"name": "Acme Corp"}, http.StatusOK, &c)
+	if c["name"] != "Acme Corp" || len(c["tag_ids"].([]interface{})) != 1 {
+		t.Fatalf("обновление без tag_ids изменило теги: %v", c)
+	}
+
+	a.do("PUT", path("/customers/%d/tags", cid), gin.H{"tag_ids": []uint{}}, http.StatusOK, &c)
+	if len(c["tag_ids"].([]interface{})) != 0 {
+		t.Fatalf("теги не сняты: %v", c)
+	}
+	a.do("POST", path("/customers/%d/tags/%d", cid, tagID), nil, http.StatusOK, &c)
+	if len(c["tag_ids"].([]interface{})) != 1 {
+		t.Fatalf("тег не добавлен: %v", c)
+	}
+	a.do("DELETE", path("/customers/%d/tags/%d", cid, tagID), nil, http.StatusOK, &c)
+	if len(c["tag_ids"].([]interface{})) != 0 {
+		t.Fatalf("тег не снят: %v", c)
+	}
+
+	a.do("DELETE", path("/customers/%d", cid), nil, http.StatusNoContent, nil)
+	a.do("GET", path("/customers/%d", cid), nil, http.StatusNotFound, nil)
+	a.do("GET", "/customers/abc", nil, http.StatusNotFound, nil)
+}
+
+func TestDeals(t *testing.T) {
+	a := newAPI(t)
+	open, work, won := a.stages()
+	cid := a.customer("Acme")
+
+	var d map[string]interface{}
+	a.do("POST", "/deals", gin.H{"title": "Поставка", "customer_id": cid, "amount": 150000, "currency": "usd"}, http.StatusCreated, &d)
+	did := id(d)
+	if uint(d["status_id"].(float64)) != open || d["currency"] != "USD" {
+		t.Fatalf("сделка не получила первый открытый этап: %v", d)
+	}
+	a.do("POST", "/deals", gin.H{"title": "Плохая", "currency": "XXX"}, http.StatusBadRequest, nil)
+	a.deal("Внедрение", cid)
+
+	var list []map[string]interface{}
+	a.do("GET", query("/deals", "filter", `{"currency":"USD"}`), nil, http.StatusOK, &list)
+	if len(list) != 1 || id(list[0]) != did {
+		t.Fatalf("фильтр по валюте вернул %v", list)
+	}
+
+	a.do("PUT", path("/deals/%d", did), gin.H{"status_id": work}, http.StatusOK, &d)
+	a.do("PUT", path("/deals/%d", did), gin.H{"status_id": won}, http.StatusOK, &d)
+	if d["closed_at"] == nil {
+		t.Fatalf("сделка на этапе won не закрыта: %v", d)
+	}
+	a.do("GET", path("/deals/%d", did), nil, http.StatusOK, &d)
+	if d["Status"].(map[string]interface{})["name"] != "Выиграна" {
+		t.Fatalf("этап сделки не загружен: %v", d)
+	}
+
+	var history struct {
+		Transitions []map[string]interface{} `json:"transitions"`
+		TimeInStage []map[string]interface{} `json:"time_in_stage"`
+	}
+	a.do("GET", path("/deals/%d/history", did), nil, http.StatusOK, &history)
+	if len(history.Transitions) != 3 || len(history.TimeInStage) != 3 {
+		t.Fatalf("неожиданная история: %+v", history)
+	}
+
+	var tag map[string]interface{}
+	a.do("POST", "/tags", gin.H{"name": "Срочно"}, http.StatusCreated, &tag)
+	a.do("PUT", path("/deals/%d/tags", did), gin.H{"tag_ids": []uint{id(tag)}}, http.StatusOK, &d)
+	a.do("DELETE", path("/deals/%d/tags/%d", did, id(tag)), nil, http.StatusOK, &d)
+	a.do("POST", path("/deals/%d/tags/%d", did, id(tag)), nil, http.StatusOK, &d)
+	a.do("POST", path("/deals/%d/tags/%d", did, 999), nil, http.StatusNotFound, nil)
+	a.do("GET", query("/deals", "filter", fmt.Sprintf(`{"tag_ids":[%d],"tag_match":"all"}`, id(tag))), nil, http.StatusOK, &list)
+	if len(list) != 1 {
+		t.Fatalf("фильтр по тегам вернул %v", list)
+	}
+
+	a.do("DELETE", path("/deals/%d", did), nil, http.StatusNoContent, nil)
+	a.do("GET", path("/deals/%d", did), nil, http.StatusNotFound, nil)
+}
+
+func TestReportsAndRates(t *testing.T) {
+	a := newAPI(t)
+	a.stages()
+	cid := a.customer("Acme")
+	a.deal("Первая", cid)
+	a.do("POST", "/deals", gin.H{"title": "Вторая", "customer_id": cid, "amount": 1000, "currency": "USD"}, http.StatusCreated, nil)
+
+	var totals struct {
+		Count        int64    `json:"count"`
+		Amount       int64    `json:"amount"`
+		MissingRates []string `json:"missing_rates"`
+	}
+	a.do("GET", "/reports/pipeline", nil, http.StatusOK, &totals)
+	if totals.Count != 2 || len(totals.MissingRates) != 1 {
+		t.Fatalf("неожиданные итоги: %+v", totals)
+	}
+
+	a.do("PUT", "/exchange-rates/usd", gin.H{"rate": 90}, http.StatusOK, nil)
+	a.do("PUT", "/exchange-rates/RUB", gin.H{"rate": 2}, http.StatusBadRequest, nil)
+	var rates []map[string]interface{}
+	a.do("GET", "/exchange-rates", nil, http.StatusOK, &rates)
+	if len(rates) != 1 {
+		t.Fatalf("неожиданные курсы: %v", rates)
+	}
+	a.do("GET", "/reports/pipeline", nil, http.StatusOK, &totals)
+	if totals.Amount != 100000+90000 || len(totals.MissingRates) != 0 {
+		t.Fatalf("итоги не пересчитаны по курсу: %+v", totals)
+	}
+	a.do("DELETE", "/exchange-rates/USD", nil, http.StatusNoContent, nil)
+
+	var durations []map[string]interface{}
+	a.do("GET", "/reports/stage-durations", nil, http.StatusOK, &durations)
+	if len(durations) != 1 || durations[0]["visits"].(float64) != 2 {
+		t.Fatalf("неожиданный отчёт по этапам: %v", durations)
+	}
+	a.do("GET", query("/reports/stage-durations", "from", "2024-13-01"), nil, http.StatusBadRequest, nil)
+}
+
+func TestStatusesAndPipelines(t *testing.T) {
+	a := newAPI(t)
+	open, work, _ := a.stages()
+	did := a.deal("Сделка", a.customer("Acme"))
+
+	var s map[string]interface{}
+	a.do("GET", path("/statuses/%d", work), nil, http.StatusOK, &s)
+	a.do("PUT", path("/statuses/%d", work), gin.H{"name": "Переговоры", "type": "unknown"}, http.StatusBadRequest, nil)
+	a.do("PUT", path("/statuses/%d", work), gin.H{"name": "Переговоры"}, http.StatusOK, &s)
+	var list []map[string]interface{}
+	a.do("GET", query("/statuses", "filter", `{"pipeline_id":1}`), nil, http.StatusOK, &list)
+	if len(list) != 3 || list[0]["name"] != "Новая" {
+		t.Fatalf("этапы не упорядочены по позиции: %v", list)
+	}
+
+	// Этап со сделками удаляется только с переносом сделок
+	a.do("DELETE", path("/statuses/%d", open), nil, http.StatusConflict, nil)
+	var resp errorResponse
+	for params, message := range map[string]string{
+		"cascade=true": "Сделки этапа нельзя удалить вместе с ним: перенесите их на другой этап (move_to)",
+		"move_to=abc":  "Параметр move_to должен быть ID записи",
+		"move_to=999":  "Этап move_to должен быть другим этапом той же воронки",
+	} {
+		a.do("DELETE", path("/statuses/%d?%s", open, params), nil, http.StatusBadRequest, &resp)
+		if resp.Message != message {
+			t.Errorf("%s: %q", params, resp.Message)
+		}
+	}
+	a.do("DELETE", query(path("/statuses/%d", open), "move_to", fmt.Sprint(work)), nil, http.StatusNoContent, nil)
+	var d map[string]interface{}
+	a.do("GET", path("/deals/%d", did), nil, http.StatusOK, &d)
+	if uint(d["status_id"].(float64)) != work {
+		t.Fatalf("сделка не перенесена: %v", d)
+	}
+
+	var p map[string]interface{}
+	a.do("POST", "/pipelines", gin.H{"name": "Партнёры", "stages": []gin.H{{"name": "Заявка"}, {"name": "Договор"}}}, http.StatusCreated, &p)
+	pid := id(p)
+	a.do("POST", "/pipelines", gin.H{"name": ""}, http.StatusBadRequest, nil)
+	a.do("GET", path("/pipelines/%d", pid), nil, http.StatusOK, &p)
+	stages := p["stages"].([]interface{})
+	first, second := id(stages[0].(map[string]interface{})), id(stages[1].(map[string]interface{}))
+	a.do("POST", path("/pipelines/%d/reorder", pid), gin.H{"stage_ids": []uint{second, first}}, http.StatusOK, &p)
+	if id(p["stages"].([]interface{})[0].(map[string]interface{})) != second {
+		t.Fatalf("порядок этапов не изменён: %v", p)
+	}
+	a.do("POST", path("/pipelines/%d/reorder", pid), gin.H{"stage_ids": []uint{first}}, http.StatusBadRequest, nil)
+	a.do("PUT", path("/pipelines/%d", pid), gin.H{"name": "Партнёрские продажи", "position": 1}, http.StatusOK, &p)
+	a.do("GET", "/pipelines", nil, http.StatusOK, &list)
+	if len(list) != 2 || list[1]["name"] != "Партнёрские продажи" {
+		t.Fatalf("неожиданный список воронок: %v", list)
+	}
+
+	a.do("DELETE", "/pipelines/1", nil, http.StatusConflict, nil)
+	a.do("DELETE", path("/pipelines/%d", pid), nil, http.StatusNoContent, nil)
+	a.do("GET", path("/statuses/%d", first), nil, http.StatusNotFound, nil)
+	a.do("DELETE", "/pipelines/1", nil, http.StatusConflict, nil)
+}
+
+func TestTags(t *testing.T) {
+	a := newAPI(t)
+	a.stages()
+	did := a.deal("Сделка", a.customer("Acme"))
+
+	var tag map[string]interface{}
+	a.do("POST", "/tags", gin.H{"name": "Партнёр"}, http.StatusCreated, &tag)
+	tid := id(tag)
+	a.do("PUT", path("/deals/%d/tags", did), gin.H{"tag_ids": []uint{tid}}, http.StatusOK, nil)
+	a.do("GET", path("/tags/%d", tid), nil, http.StatusOK, &tag)
+	if len(tag["Deals"].([]interface{})) != 1 {
+		t.Fatalf("сделки тега не загружены: %v", tag)
+	}
+	a.do("PUT", path("/tags/%d", tid), gin.H{"name": "Ключевой партнёр"}, http.StatusOK, &tag)
+	var list []map[string]interface{}
+	a.do("GET", query("/tags", "filter", `{"q":"ключ"}`), nil, http.StatusOK, &list)
+	if len(list) != 1 {
+		t.Fatalf("поиск тегов вернул %v", list)
+	}
+	a.do("DELETE", path("/tags/%d", tid), nil, http.StatusNoContent, nil)
+	a.do("GET", path("/tags/%d", tid), nil, http.StatusNotFound, nil)
+}
+
+func TestUsersAndRoles(t *testing.T) {
+	a := newAPI(t)
+
+	var role map[string]interface{}
+	a.do("POST", "/roles", gin.H{"name": "support", "permissions": []string{handlers.PermCustomersRead}}, http.StatusCreated, &role)
+	rid := id(role)
+	a.do("POST", "/roles", gin.H{"name": "support"}, http.StatusConflict, nil)
+	a.do("POST", "/roles", gin.H{"name": "bad", "permissions": []string{"nope"}}, http.StatusBadRequest, nil)
+
+	var u map[string]interface{}
+	a.do("POST", "/users", gin.H{"name": "Ира", "email": "ira@example.com", "role": "support"}, http.StatusCreated, &u)
+	uid := id(u)
+	a.do("POST", "/users", gin.H{"name": "Нет", "email": "no@example.com", "role": "ghost"}, http.StatusBadRequest, nil)
+
+	// Переименование роли переносится на пользователей
+	a.do("PUT", path("/roles/%d", rid), gin.H{"name": "helpdesk", "permissions": []string{handlers.PermCustomersRead, handlers.PermDealsRead}}, http.StatusOK, &role)
+	a.do("GET", path("/roles/%d", rid), nil, http.StatusOK, &role)
+	if len(role["permissions"].([]interface{})) != 2 {
+		t.Fatalf("права роли не обновлены: %v", role)
+	}
+	a.do("GET", path("/users/%d", uid), nil, http.StatusOK, &u)
+	if u["role"] != "helpdesk" {
+		t.Fatalf("роль пользователя не переименована: %v", u)
+	}
+	a.do("DELETE", path("/roles/%d", rid), nil, http.StatusConflict, nil)
+
+	var roles []map[string]interface{}
+	a.do("GET", query("/roles", "filter", `{"name":"admin"}`), nil, http.StatusOK, &roles)
+	if len(roles) != 1 {
+		t.Fatalf("роль admin не найдена: %v", roles)
+	}
+	a.do("PUT", path("/roles/%d", id(roles[0])), gin.H{"name": "admin"}, http.StatusConflict, nil)
+	a.do("DELETE", path("/roles/%d", id(roles[0])), nil, http.StatusConflict, nil)
+
+	// Отключение пользователя завершает его сессии
+	a.addUser("Олег", "oleg@example.com", handlers.DefaultRole)
+	token := a.login("oleg@example.com")
+	var list []map[string]interface{}
+	a.do("GET", query("/users", "filter", `{"email":"oleg@example.com"}`), nil, http.StatusOK, &list)
+	oleg := id(list[0])
+	a.do("PUT", path("/users/%d", oleg), gin.H{"disabled": true}, http.StatusOK, nil)
+	a.doAs(token, "GET", "/auth/me", nil, http.StatusUnauthorized, nil)
+
+	a.do("DELETE", path("/users/%d", uid), nil, http.StatusNoContent, nil)
+	a.do("GET", path("/users/%d", uid), nil, http.StatusNotFound, nil)
+	a.do("DELETE", path("/roles/%d", rid), nil, http.StatusNoContent, nil)
+	a.do("GET", path("/roles/%d", rid), nil, http.StatusNotFound, nil)
+}
+
+func TestComments(t *testing.T) {
+	a := newAPI(t)
+	a.stages()
+	did := a.deal("Сделка", a.customer("Acme"))
+	bob := a.addUser("Боб", "bob@example.com", handlers.DefaultRole)
+	bobToken := a.login("bob@example.com")
+
+	var cm map[string]interface{}
+	a.do("POST", "/comments", gin.H{"deal_id": did, "content": "Нужна смета, @bob"}, http.StatusCreated, &cm)
+	cid := id(cm)
+	if m := cm["mentions"].([]interface{}); len(m) != 1 || uint(m[0].(float64)) != bob.ID {
+		t.Fatalf("упоминание не распознано: %v", cm)
+	}
+	a.do("POST", "/comments", gin.H{"deal_id": did, "content": "  "}, http.StatusBadRequest, nil)
+
+	var reply map[string]interface{}
+	a.doAs(bobToken, "POST", path("/deals/%d/comments", did), gin.H{"parent_id": cid, "content": "Готовлю"}, http.StatusCreated, &reply)
+	a.do("POST", path("/deals/%d/comments", did), gin.H{"parent_id": 999, "content": "?"}, http.StatusBadRequest, nil)
+
+	var feed []map[string]interface{}
+	a.do("GET", query(path("/deals/%d/comments", did), "filter", `{"parent_id":null}`), nil, http.StatusOK, &feed)
+	if len(feed) != 1 || id(feed[0]) != cid {
+		t.Fatalf("лента верхнего уровня: %v", feed)
+	}
+	a.do("GET", query("/comments", "filter", fmt.Sprintf(`{"deal_id":%d}`, did)), nil, http.StatusOK, &feed)
+	if len(feed) != 2 {
+		t.Fatalf("комментарии сделки: %v", feed)
+	}
+	a.doAs(bobToken, "GET", "/comments/mentions", nil, http.StatusOK, &feed)
+	if len(feed) != 1 || id(feed[0]) != cid {
+		t.Fatalf("упоминания Боба: %v", feed)
+	}
+
+	// Чужой комментарий может менять только администратор
+	a.doAs(bobToken, "PUT", path("/comments/%d", cid), gin.H{"content": "Взлом"}, http.StatusForbidden, nil)
+	a.do("PUT", path("/comments/%d", cid), gin.H{"content": "Нужна смета до пятницы"}, http.StatusOK, &cm)
+	if cm["edited_at"] == nil || len(cm["mentions"].([]interface{})) != 0 {
+		t.Fatalf("правка не сохранена: %v", cm)
+	}
+	var revisions []map[string]interface{}
+	a.do("GET", path("/comments/%d/revisions", cid), nil, http.StatusOK, &revisions)
+	if len(revisions) != 1 || revisions[0]["content"] != "Нужна смета, @bob" {
+		t.Fatalf("история правок: %v", revisions)
+	}
+	a.do("GET", path("/comments/%d", cid), nil, http.StatusOK, &cm)
+
+	a.doAs(bobToken, "DELETE", path("/comments/%d", id(reply)), nil, http.StatusNoContent, nil)
+	a.do("DELETE", path("/comments/%d", cid), nil, http.StatusNoContent, nil)
+	a.do("GET", path("/comments/%d", cid), nil, http.StatusNotFound, nil)
+}
+
+func TestCORS(t *testing.T) {
+	a := newAPI(t)
+	send := func(r *gin.Engine, method, origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/customers", nil)
+		req.Header.Set("Origin", origin)
+		if method == "OPTIONS" {
+			req.Header.Set("Access-Control-Request-Method", "PUT")
+			req.Header.Set("Access-Control-Request-Headers", "Authorization, Content-Type")
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send(a.r, "OPTIONS", "http://localhost:3000")
+	if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Origin") != "http://localhost:3000" {
+		t.Fatalf("preflight с фронтенда: код %d, заголовки %v", w.Code, w.Header())
+	}
+	if !strings.Contains(w.Header().Get("Access-Control-Allow-Methods"), "PUT") {
+		t.Errorf("PUT не разрешён: %v", w.Header())
+	}
+	w = send(a.r, "GET", "http://localhost:3000")
+	if !strings.Contains(w.Header().Get("Access-Control-Expose-Headers"), "Content-Range") {
+		t.Errorf("Content-Range недоступен браузеру: %v", w.Header())
+	}
+	if w = send(a.r, "OPTIONS", "https://evil.example.com"); w.Code != http.StatusForbidden {
+		t.Errorf("чужой источник: код %d", w.Code)
+	}
+
+	// В production источники по умолчанию не открыты
+	cfg := config.Default()
+	cfg.Env = config.EnvProduction
+	prod := emptyRouter(cfg.WithEnvDefaults())
+	if w = send(prod, "GET", "http://localhost:3000"); w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("production без allow_origins: %v", w.Header())
+	}
+	cfg.CORS.AllowOrigins = []string{"https://*.example.com"}
+	cfg.CORS.AllowCredentials = true
+	prod = emptyRouter(cfg)
+	w = send(prod, "OPTIONS", "https://crm.example.com")
+	if w.Header().Get("Access-Control-Allow-Origin") != "https://crm.example.com" || w.Header().Get("Access-Control-Allow-Credentials") != "true" {
+		t.Errorf("шаблон источника: код %d, заголовки %v", w.Code, w.Header())
+	}
+}
+
+func TestHealth(t *testing.T) {
+	a := newAPI(t)
+	a.doAs("", "GET", "/healthz", nil, http.StatusOK, nil)
+
+	var ready struct {
+		Status     string
+		Migrations struct{ Pending int }
+	}
+	a.doAs("", "GET", "/readyz", nil, http.StatusOK, &ready)
+	if ready.Status != "ready" {
+		t.Errorf("readyz: %+v", ready)
+	}
+
+	for _, probe := range []testProbe{{pingErr: errors.New("connection refused")}, {pending: 2}} {
+		a.r = newRouter(a.st, testConfig, probe, metrics.NewRegistry(), handlers.NewImportRunner(a.st))
+		w := a.doAs("", "GET", "/readyz", nil, http.StatusServiceUnavailable, &ready)
+		if ready.Status != "not_ready" || ready.Migrations.Pending != probe.pending || strings.Contains(w.Body.String(), "refused") {
+			t.Errorf("readyz при %+v: %+v", probe, ready)
+		}
+	}
+}
+
+func TestRequestLog(t *testing.T) {
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(logging.New(&buf, slog.LevelInfo))
+	a := newAPI(t)
+	slog.SetDefault(prev)
+	a.r.GET("/panic", func(*gin.Context) { panic("pq: relation \"secret\" does not exist") })
+
+	send := func(path, requestID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", "Bearer "+a.token)
+		if requestID != "" {
+			req.Header.Set(handlers.RequestIDHeader, requestID)
+		}
+		w := httptest.NewRecorder()
+		a.r.ServeHTTP(w, req)
+		return w
+	}
+
+	buf.Reset()
+	w := send("/auth/me", "trace-42")
+	if got := w.Header().Get(handlers.RequestIDHeader); got != "trace-42" {
+		t.Errorf("X-Request-ID клиента не возвращён: %q", got)
+	}
+	var entry struct {
+		Msg       string
+		RequestID string `json:"request_id"`
+		Route     string
+		Status    int
+		UserID    uint `json:"user_id"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("запись журнала не JSON: %v: %s", err, buf.String())
+	}
+	if entry.RequestID != "trace-42" || entry.Route != "/auth/me" || entry.Status != http.StatusOK || entry.UserID == 0 {
+		t.Errorf("запись журнала: %s", buf.String())
+	}
+
+	// Непригодный идентификатор заменяется сгенерированным
+	w = send("/auth/me", "bad id\n")
+	if got := w.Header().Get(handlers.RequestIDHeader); len(got) != 32 {
+		t.Errorf("сгенерированный X-Request-ID: %q", got)
+	}
+
+	buf.Reset()
+	w = send("/panic", "")
+	var body struct {
+		Code      string
+		Message   string
+		RequestID string `json:"request_id"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || w.Code != http.StatusInternalServerError {
+		t.Fatalf("паника: код %d: %s", w.Code, w.Body.String())
+	}
+	if body.Code != handlers.CodeInternal || strings.Contains(body.Message, "secret") || body.RequestID != w.Header().Get(handlers.RequestIDHeader) {
+		t.Errorf("ответ на ошибку: %s", w.Body.String())
+	}
+	if !strings.Contains(buf.String(), `relation \"secret\"`) || !strings.Contains(buf.String(), body.RequestID) {
+		t.Errorf("ошибка не попала в журнал с request_id: %s", buf.String())
+	}
+}
+
+// errorResponse — тело ответа с ошибкой.
+type errorResponse struct {
+	Code    string
+	Message string
+	Details []struct {
+		Field   string
+		Code    string
+		Message string
+	}
+	Meta map[string]interface{}
+}
+
+func TestErrors(t *testing.T) {
+	a := newAPI(t)
+	send := func(method, path, lang, body string) (*httptest.ResponseRecorder, errorResponse) {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+a.token)
+		req.Header.Set("Content-Type", "application/json")
+		if lang != "" {
+			req.Header.Set("Accept-Language", lang)
+		}
+		w := httptest.NewRecorder()
+		a.r.ServeHTTP(w, req)
+		var resp errorResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s %s: некорректный JSON: %s", method, path, w.Body.String())
+		}
+		return w, resp
+	}
+
+	// Язык выбирается по Accept-Language, по умолчанию — русский
+	w, resp := send("GET", "/deals/999", "", "")
+	if w.Code != http.StatusNotFound || resp.Code != handlers.CodeNotFound || resp.Message != "Сделка не найдена" {
+		t.Errorf("404 по умолчанию: %d %s", w.Code, w.Body.String())
+	}
+	w, resp = send("GET", "/deals/999", "en-US,en;q=0.9,ru;q=0.5", "")
+	if resp.Message != "Deal not found" || w.Header().Get("Content-Language") != "en" {
+		t.Errorf("404 по-английски: %s", w.Body.String())
+	}
+	if _, resp = send("GET", "/deals/999", "de, ru;q=0.8, en;q=0.9", ""); resp.Message != "Deal not found" {
+		t.Errorf("вес q не учтён: %+v", resp)
+	}
+
+	// Ошибка в поле возвращается в details
+	w, resp = send("POST", "/deals", "en", `{"title":"X","customer_id":1,"currency":"XXX"}`)
+	if w.Code != http.StatusBadRequest || resp.Code != handlers.CodeValidation || len(resp.Details) != 1 ||
+		resp.Details[0].Field != "currency" || resp.Details[0].Message != "Unknown currency: XXX" {
+		t.Errorf("ошибка валидации: %s", w.Body.String())
+	}
+	w, resp = send("POST", "/deals", "", `{"title":"X","amount":"много"}`)
+	if w.Code != http.StatusBadRequest || len(resp.Details) != 1 || resp.Details[0].Field != "amount" || resp.Details[0].Code != "type" {
+		t.Errorf("неверный тип поля: %s", w.Body.String())
+	}
+	if w, resp = send("POST", "/deals", "", `{"title":`); resp.Code != handlers.CodeBadRequest {
+		t.Errorf("некорректный JSON: %s", w.Body.String())
+	}
+	if w, resp = send("GET", query("/deals", "sort", `["password","ASC"]`), "en", ""); resp.Message != `Sorting by "password" is not supported` {
+		t.Errorf("параметры списка: %s", w.Body.String())
+	}
+
+	// Конфликт состояния — 409 с подробностями в meta
+	open, _, _ := a.stages()
+	a.deal("Мешает", a.customer("Acme"))
+	w, resp = send("DELETE", path("/statuses/%d", open), "", "")
+	if w.Code != http.StatusConflict || resp.Code != handlers.CodeConflict || resp.Meta["deals"] != float64(1) {
+		t.Errorf("конфликт: %s", w.Body.String())
+	}
+
+	// Права и аутентификация
+	a.addUser("Гость", "guest@example.com", handlers.DefaultRole)
+	a.token = a.login("guest@example.com")
+	if w, resp = send("GET", "/roles", "en", ""); w.Code != http.StatusForbidden || resp.Code != handlers.CodeForbidden ||
+		resp.Message != "Insufficient permissions: roles:manage is required" {
+		t.Errorf("403: %s", w.Body.String())
+	}
+	a.token = "broken"
+	if w, resp = send("GET", "/auth/me", "", ""); w.Code != http.StatusUnauthorized || resp.Code != handlers.CodeUnauthorized {
+		t.Errorf("401: %s", w.Body.String())
+	}
+}
+
+func TestValidation(t *testing.T) {
+	a := newAPI(t)
+	// fields отправляет body и возвращает поля с ошибками в виде "поле:правило"
+	fields := func(method, path string, body gin.H) []string {
+		t.Helper()
+		var resp errorResponse
+		a.do(method, path, body, http.StatusBadRequest, &resp)
+		if resp.Code != handlers.CodeValidation {
+			t.Errorf("%s %s: код ошибки %q", method, path, resp.Code)
+		}
+		var got []string
+		for _, d := range resp.Details {
+			if d.Message == "" {
+				t.Errorf("%s %s: пустое сообщение для %s", method, path, d.Field)
+			}
+			got = append(got, d.Field+":"+d.Code)
+		}
+		sort.Strings(got)
+		return got
+	}
+	check := func(got []string, want ...string) {
+		t.Helper()
+		if strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Errorf("ошибки полей %v, ожидались %v", got, want)
+		}
+	}
+
+	check(fields("POST", "/customers", gin.H{"name": "", "email": "not-an-email", "phone": "8 (999) 123-45-67"}),
+		"email:email", "name:required", "phone:e164")
+	check(fields("POST", "/customers", gin.H{"name": strings.Repeat("я", 256)}), "name:max")
+	cid := a.customer("Acme")
+	a.do("POST", "/customers", gin.H{"name": "Globex", "phone": "+14155552671"}, http.StatusCreated, nil)
+	check(fields("PUT", path("/customers/%d", cid), gin.H{"email": "broken"}), "email:email")
+
+	check(fields("POST", "/deals", gin.H{"title": "", "amount": -1, "probability": 101}),
+		"amount:min", "customer_id:required", "probability:max", "title:required")
+	check(fields("POST", "/deals", gin.H{"title": "Сделка", "customer_id": 999}), "customer_id:not_found")
+
+	check(fields("POST", "/statuses", gin.H{"name": "Этап", "color": "red"}), "color:hexcolor")
+	a.do("POST", "/statuses", gin.H{"name": "Этап", "color": "#ff0000"}, http.StatusCreated, nil)
+	check(fields("POST", "/pipelines", gin.H{"name": "Воронка", "stages": []gin.H{{"name": "Заявка"}, {"name": ""}}}),
+		"stages[1].name:required")
+
+	check(fields("POST", "/tags", gin.H{"name": ""}), "name:required")
+	check(fields("POST", "/users", gin.H{"name": "Ира", "email": "ira"}), "email:email")
+	check(fields("PUT", "/exchange-rates/USD", gin.H{"rate": -2}), "rate:gt")
+
+	// Длина строки и величина числа описываются разными сообщениями
+	var resp errorResponse
+	a.do("POST", "/tags", gin.H{"name": strings.Repeat("x", 65)}, http.StatusBadRequest, &resp)
+	if len(resp.Details) != 1 || resp.Details[0].Message != "Не более 64 символов" {
+		t.Errorf("сообщение о длине: %+v", resp.Details)
+	}
+}
+
+func TestPatch(t *testing.T) {
+	a := newAPI(t)
+	_, work, _ := a.stages()
+	var tag map[string]interface{}
+	a.do("POST", "/tags", gin.H{"name": "VIP"}, http.StatusCreated, &tag)
+
+	// Отсутствующие поля не меняются, null сбрасывает поле, id и даты из тела игнорируются
+	var c map[string]interface{}
+	a.do("POST", "/customers", gin.H{"name": "Acme", "phone": "+14155552671", "tag_ids": []uint{id(tag)}}, http.StatusCreated, &c)
+	cid := id(c)
+	a.do("PATCH", path("/customers/%d", cid), gin.H{"company": "Acme Inc", "phone": nil, "tag_ids": nil, "id": 999, "created_at": 1}, http.StatusOK, &c)
+	if id(c) != cid || c["name"] != "Acme" || c["company"] != "Acme Inc" || c["phone"] != "" || len(c["tag_ids"].([]interface{})) != 0 || c["created_at"] == float64(1) {
+		t.Fatalf("PATCH клиента: %v", c)
+	}
+	a.do("PATCH", path("/customers/%d", cid), gin.H{"name": nil}, http.StatusBadRequest, nil)
+	a.do("PATCH", path("/customers/%d", cid), []int{1}, http.StatusBadRequest, nil)
+
+	var d map[string]interface{}
+	did := a.deal("Сделка", cid)
+	a.do("PATCH", path("/deals/%d", did), gin.H{"status_id": work}, http.StatusOK, &d)
+	if d["title"] != "Сделка" || d["amount"] != float64(100000) || uint(d["status_id"].(float64)) != work {
+		t.Fatalf("PATCH сделки: %v", d)
+	}
+
+	var st map[string]interface{}
+	a.do("PATCH", path("/statuses/%d", work), gin.H{"color": "#00ff00"}, http.StatusOK, &st)
+	if st["name"] != "В работе" || st["color"] != "#00ff00" {
+		t.Fatalf("PATCH этапа: %v", st)
+	}
+	var pipelines []map[string]interface{}
+	a.do("GET", "/pipelines", nil, http.StatusOK, &pipelines)
+	a.do("PATCH", path("/pipelines/%d", id(pipelines[0])), gin.H{"name": "Продажи"}, http.StatusOK, nil)
+	a.do("PATCH", path("/tags/%d", id(tag)), gin.H{"name": "Ключевой"}, http.StatusOK, nil)
+
+	var role map[string]interface{}
+	a.do("POST", "/roles", gin.H{"name": "hr", "permissions": []string{handlers.PermUsersManage}}, http.StatusCreated, &role)
+	a.do("PATCH", path("/roles/%d", id(role)), gin.H{"description": "Кадры"}, http.StatusOK, &role)
+	if role["name"] != "hr" || len(role["permissions"].([]interface{})) != 1 {
+		t.Fatalf("PATCH роли: %v", role)
+	}
+
+	var cm map[string]interface{}
+	a.do("POST", "/comments", gin.H{"deal_id": did, "content": "Черновик"}, http.StatusCreated, &cm)
+	a.do("PATCH", path("/comments/%d", id(cm)), gin.H{"content": " Итог ", "deal_id": 999}, http.StatusOK, &cm)
+	if cm["content"] != "Итог" || uint(cm["deal_id"].(float64)) != did {
+		t.Fatalf("PATCH комментария: %v", cm)
+	}
+
+	// Право users:manage не позволяет менять роли и трогать администраторов
+	hr := a.addUser("Кадровик", "hr@example.com", "hr")
+	hrToken := a.login("hr@example.com")
+	a.doAs(hrToken, "PATCH", path("/users/%d", hr.ID), gin.H{"role": handlers.AdminRole}, http.StatusForbidden, nil)
+	a.doAs(hrToken, "PATCH", path("/users/%d", hr.ID), gin.H{"name": "Кадры"}, http.StatusOK, nil)
+	a.doAs(hrToken, "POST", "/users", gin.H{"name": "Ира", "email": "ira@example.com", "role": handlers.AdminRole}, http.StatusForbidden, nil)
+	var ira map[string]interface{}
+	a.doAs(hrToken, "POST", "/users", gin.H{"name": "Ира", "email": "ira@example.com", "password": "password1"}, http.StatusCreated, &ira)
+	if ira["role"] != handlers.DefaultRole {
+		t.Fatalf("роль нового пользователя: %v", ira)
+	}
+	var admins []map[string]interface{}
+	a.do("GET", query("/users", "filter", `{"role":"admin"}`), nil, http.StatusOK, &admins)
+	a.doAs(hrToken, "PATCH", path("/users/%d", id(admins[0])), gin.H{"name": "Взлом"}, http.StatusForbidden, nil)
+	a.doAs(hrToken, "DELETE", path("/users/%d", id(admins[0])), nil, http.StatusForbidden, nil)
+	a.doAs(hrToken, "PATCH", path("/users/%d", id(ira)), gin.H{"email": "hr@example.com"}, http.StatusConflict, nil)
+
+	// Администратор меняет роль и пароль
+	a.do("PATCH", path("/users/%d", id(ira)), gin.H{"role": "hr", "password": "password2"}, http.StatusOK, nil)
+	a.doAs("", "POST", "/auth/login", gin.H{"email": "ira@example.com", "password": "password2"}, http.StatusOK, nil)
+}
+
+func TestETags(t *testing.T) {
+	a := newAPI(t)
+	cid := a.customer("Acme")
+	ifMatch := func(tag string) http.Header { return http.Header{"If-Match": {tag}} }
+
+	// GET отдаёт ETag, If-None-Match с ним же отвечает 304 без тела
+	w := a.do("GET", path("/customers/%d", cid), nil, http.StatusOK, nil)
+	tag := w.Header().Get("ETag")
+	if tag != `"1"` {
+		t.Fatalf("ETag новой записи: %q", tag)
+	}
+	w = a.doWith(http.Header{"If-None-Match": {`"0", ` + tag}}, "GET", path("/customers/%d", cid), nil, http.StatusNotModified, nil)
+	if w.Body.Len() != 0 || w.Header().Get("ETag") != tag {
+		t.Fatalf("ответ 304: %q %q", w.Header().Get("ETag"), w.Body.String())
+	}
+
+	// Изменение увеличивает версию; устаревший If-Match отклоняется с 412
+	var c map[string]interface{}
+	w = a.doWith(ifMatch(tag), "PATCH", path("/customers/%d", cid), gin.H{"company": "Acme Inc"}, http.StatusOK, &c)
+	if c["version"] != float64(2) || w.Header().Get("ETag") != `"2"` {
+		t.Fatalf("версия после PATCH: %v %q", c, w.Header().Get("ETag"))
+	}
+	var body map[string]interface{}
+	a.doWith(ifMatch(tag), "PUT", path("/customers/%d", cid), gin.H{"name": "Acme"}, http.StatusPreconditionFailed, &body)
+	if body["code"] != handlers.CodePreconditionFailed {
+		t.Fatalf("ошибка 412: %v", body)
+	}
+	a.doWith(ifMatch(`W/"2"`), "PUT", path("/customers/%d", cid), gin.H{"name": "Acme"}, http.StatusPreconditionFailed, nil)
+	a.doWith(ifMatch(`"1", "2"`), "PUT", path("/customers/%d", cid), gin.H{"name": "Acme"}, http.StatusOK, nil)
+	a.doWith(ifMatch("*"), "PATCH", path("/customers/%d", cid), gin.H{"phone": "+14155552671"}, http.StatusOK, &c)
+
+	// Смена тегов тоже меняет версию записи
+	var vip map[string]interface{}
+	w = a.do("POST", "/tags", gin.H{"name": "VIP"}, http.StatusCreated, &vip)
+	if w.Header().Get("ETag") != `"1"` {
+		t.Fatalf("ETag нового тега: %q", w.Header().Get("ETag"))
+	}
+	a.doWith(ifMatch(`"3"`), "POST", path("/customers/%d/tags/%d", cid, id(vip)), nil, http.StatusPreconditionFailed, nil)
+	a.doWith(ifMatch(`"4"`), "POST", path("/customers/%d/tags/%d", cid, id(vip)), nil, http.StatusOK, &c)
+	if c["version"] != float64(5) {
+		t.Fatalf("версия после добавления тега: %v", c)
+	}
+	a.doWith(ifMatch(`"4"`), "DELETE", path("/customers/%d", cid), nil, http.StatusPreconditionFailed, nil)
+	a.doWith(ifMatch(`"5"`), "DELETE", path("/customers/%d", cid), nil, http.StatusNoContent, nil)
+
+	// Переименование тега тоже версионируется
+	w = a.doWith(ifMatch(`"1"`), "PATCH", path("/tags/%d", id(vip)), gin.H{"name": "VIP+"}, http.StatusOK, &vip)
+	if vip["version"] != float64(2) || w.Header().Get("ETag") != `"2"` {
+		t.Fatalf("версия тега после PATCH: %v %q", vip, w.Header().Get("ETag"))
+	}
+	a.doWith(ifMatch(`"1"`), "PATCH", path("/tags/%d", id(vip)), gin.H{"name": "VIP"}, http.StatusPreconditionFailed, nil)
+	a.doWith(http.Header{"If-None-Match": {`"1"`}}, "GET", path("/tags/%d", id(vip)), nil, http.StatusOK, nil)
+
+	// Перестановка этапов меняет ETag воронки
+	var p map[string]interface{}
+	a.do("POST", "/pipelines", gin.H{"name": "Партнёры", "stages": []gin.H{{"name": "Заявка"}, {"name": "Договор"}}}, http.StatusCreated, &p)
+	w = a.do("GET", path("/pipelines/%d", id(p)), nil, http.StatusOK, &p)
+	before := w.Header().Get("ETag")
+	stages := p["stages"].([]interface{})
+	first, second := id(stages[0].(map[string]interface{})), id(stages[1].(map[string]interface{}))
+	a.do("POST", path("/pipelines/%d/reorder", id(p)), gin.H{"stage_ids": []uint{second, first}}, http.StatusOK, nil)
+	a.doWith(http.Header{"If-None-Match": {before}}, "GET", path("/pipelines/%d", id(p)), nil, http.StatusOK, nil)
+	a.doWith(ifMatch(before), "PATCH", path("/pipelines/%d", id(p)), gin.H{"name": "Партнёрские"}, http.StatusPreconditionFailed, nil)
+}
+
+func TestAudit(t *testing.T) {
+	a := newAPI(t)
+	var me map[string]interface{}
+	a.do("GET", "/auth/me", nil, http.StatusOK, &me)
+	adminID := id(me)
+	entries := func(path string) []map[string]interface{} {
+		t.Helper()
+		var out []map[string]interface{}
+		a.do("GET", path, nil, http.StatusOK, &out)
+		return out
+	}
+	changes := func(e map[string]interface{}) map[string]interface{} {
+		return e["changes"].(map[string]interface{})
+	}
+
+	// Создание, изменение и удаление клиента попадают в журнал с автором и изменёнными полями
+	var c map[string]interface{}
+	a.do("POST", "/customers", gin.H{"name": "Acme", "phone": "+14155552671"}, http.StatusCreated, &c)
+	cid := id(c)
+	a.doWith(http.Header{handlers.RequestIDHeader: {"audit-1"}}, "PATCH", path("/customers/%d", cid), gin.H{"phone": "+14155552672"}, http.StatusOK, nil)
+	a.do("PATCH", path("/customers/%d", cid), gin.H{"phone": "+14155552672"}, http.StatusOK, nil)
+	log := entries(path("/customers/%d/audit", cid))
+	if len(log) != 2 || log[0]["action"] != "create" || log[1]["action"] != "update" {
+		t.Fatalf("журнал клиента: %v", log)
+	}
+	if uint(log[1]["user_id"].(float64)) != adminID || log[1]["request_id"] != "audit-1" {
+		t.Fatalf("автор изменения: %v", log[1])
+	}
+	phone := changes(log[1])["phone"].(map[string]interface{})
+	if phone["before"] != "+14155552671" || phone["after"] != "+14155552672" || len(changes(log[1])) != 1 {
+		t.Fatalf("изменения клиента: %v", changes(log[1]))
+	}
+	if changes(log[0])["name"].(map[string]interface{})["after"] != "Acme" || changes(log[0])["email"] != nil {
+		t.Fatalf("создание клиента: %v", changes(log[0]))
+	}
+	a.do("DELETE", path("/customers/%d", cid), nil, http.StatusNoContent, nil)
+	log = entries(path("/customers/%d/audit", cid))
+	if len(log) != 3 || log[2]["action"] != "delete" || changes(log[2])["name"].(map[string]interface{})["before"] != "Acme" {
+		t.Fatalf("удаление клиента: %v", log)
+	}
+
+	// Теги сделки пишутся как изменение tag_ids, отклонённое изменение — нет
+	var tag map[string]interface{}
+	a.do("POST", "/tags", gin.H{"name": "VIP"}, http.StatusCreated, &tag)
+	a.do("PATCH", path("/tags/%d", id(tag)), gin.H{"name": "Ключевой"}, http.StatusOK, nil)
+	_, work, _ := a.stages()
+	did := a.deal("Сделка", a.customer("Beta"))
+	a.do("POST", path("/deals/%d/tags/%d", did, id(tag)), nil, http.StatusOK, nil)
+	a.doWith(http.Header{"If-Match": {`"1"`}}, "PATCH", path("/deals/%d", did), gin.H{"title": "Новая"}, http.StatusPreconditionFailed, nil)
+	log = entries(path("/deals/%d/audit", did))
+	if len(log) != 2 || fmt.Sprint(changes(log[1])["tag_ids"]) != fmt.Sprintf("map[after:[%d] before:<nil>]", id(tag)) {
+		t.Fatalf("журнал сделки: %v", log)
+	}
+	if len(entries(path("/tags/%d/audit", id(tag)))) != 2 {
+		t.Fatal("журнал тега неполон")
+	}
+
+	a.do("PATCH", path("/statuses/%d", work), gin.H{"color": "#00ff00"}, http.StatusOK, nil)
+	if log = entries(path("/statuses/%d/audit", work)); len(log) != 2 {
+		t.Fatalf("журнал этапа: %v", log)
+	}
+	var p map[string]interface{}
+	a.do("POST", "/pipelines", gin.H{"name": "Партнёры", "stages": []gin.H{{"name": "Заявка"}, {"name": "Договор"}}}, http.StatusCreated, &p)
+	stages := p["stages"].([]interface{})
+	first, second := id(stages[0].(map[string]interface{})), id(stages[1].(map[string]interface{}))
+	a.do("POST", path("/pipelines/%d/reorder", id(p)), gin.H{"stage_ids": []uint{second, first}}, http.StatusOK, nil)
+	if log = entries(path("/pipelines/%d/audit", id(p))); len(log) != 2 || changes(log[1])["stage_ids"] == nil {
+		t.Fatalf("журнал воронки: %v", log)
+	}
+
+	var cm map[string]interface{}
+	a.do("POST", path("/deals/%d/comments", did), gin.H{"content": "Позвонить"}, http.StatusCreated, &cm)
+	a.do("DELETE", path("/comments/%d", id(cm)), nil, http.StatusNoContent, nil)
+	if log = entries(path("/comments/%d/audit", id(cm))); len(log) != 2 || log[1]["action"] != "delete" {
+		t.Fatalf("журнал комментария: %v", log)
+	}
+
+	// Смена пароля видна в журнале без хеша
+	user := a.addUser("Оля", "olya@example.com", handlers.DefaultRole)
+	token := a.login("olya@example.com")
+	a.do("PATCH", path("/users/%d", user.ID), gin.H{"password": "password2"}, http.StatusOK, nil)
+	log = entries(path("/users/%d/audit", user.ID))
+	if len(log) != 1 || fmt.Sprint(changes(log[0])) != "map[password_changed:map[after:true before:<nil>]]" {
+		t.Fatalf("журнал пользователя: %v", log)
+	}
+
+	// Общий журнал фильтруется; без права audit:read он недоступен
+	log = entries(query("/audit", "filter", `{"entity":"customers","action":"delete"}`))
+	if len(log) != 1 || uint(log[0]["entity_id"].(float64)) != cid {
+		t.Fatalf("фильтр журнала: %v", log)
+	}
+	a.do("GET", query("/audit", "filter", `{"changes":1}`), nil, http.StatusBadRequest, nil)
+	a.doAs(token, "GET", "/audit", nil, http.StatusForbidden, nil)
+	a.doAs(token, "GET", path("/deals/%d/audit", did), nil, http.StatusForbidden, nil)
+}
+
+func TestTrash(t *testing.T) {
+	a := newAPI(t)
+	trash := func(token string, params ...string) []map[string]interface{} {
+		t.Helper()
+		var out []map[string]interface{}
+		a.doAs(token, "GET", query("/trash", params...), nil, http.StatusOK, &out)
+		return out
+	}
+	a.stages()
+
+	// Клиент удаляется вместе со сделками, а восстанавливается только с теми,
+	// что были удалены вместе с ним
+	cid := a.customer("Acme")
+	early, late := a.deal("Ранняя", cid), a.deal("Поздняя", cid)
+	a.do("DELETE", path("/deals/%d", early), nil, http.StatusNoContent, nil)
+	a.do("DELETE", path("/customers/%d?cascade=true", cid), nil, http.StatusNoContent, nil)
+	a.do("GET", path("/deals/%d", late), nil, http.StatusNotFound, nil)
+	if items := trash(a.token); len(items) != 3 {
+		t.Fatalf("корзина: %v", items)
+	}
+	items := trash(a.token, "filter", `{"entity":"deals"}`, "sort", `["entity_id","ASC"]`)
+	if len(items) != 2 || items[0]["id"] != fmt.Sprintf("deals:%d", early) || items[0]["title"] != "Ранняя" {
+		t.Fatalf("сделки в корзине: %v", items)
+	}
+	a.do("POST", path("/trash/deals/%d/restore", early), nil, http.StatusConflict, nil)
+	a.do("POST", path("/trash/customers/%d/restore", cid), nil, http.StatusNoContent, nil)
+	a.do("GET", path("/deals/%d", late), nil, http.StatusOK, nil)
+	a.do("GET", path("/deals/%d", early), nil, http.StatusNotFound, nil)
+	a.do("POST", path("/trash/deals/%d/restore", early), nil, http.StatusNoContent, nil)
+	a.do("POST", path("/trash/deals/%d/restore", early), nil, http.StatusNotFound, nil)
+	a.do("POST", path("/trash/pipelines/1/restore"), nil, http.StatusNotFound, nil)
+	var log []map[string]interface{}
+	a.do("GET", path("/customers/%d/audit", cid), nil, http.StatusOK, &log)
+	if last := log[len(log)-1]; last["action"] != "restore" {
+		t.Fatalf("восстановление в журнале: %v", log)
+	}
+
+	// Корзину видят по праву на удаление, окончательно удаляет только администратор
+	a.addUser("Менеджер", "rep@example.com", "sales_rep")
+	rep := a.login("rep@example.com")
+	user := a.addUser("Оля", "olya@example.com", handlers.DefaultRole)
+	olya := a.login("olya@example.com")
+	a.addUser("Петя", "petya@example.com", handlers.DefaultRole)
+	petya := a.login("petya@example.com")
+	var cm, done map[string]interface{}
+	a.doAs(olya, "POST", path("/deals/%d/comments", late), gin.H{"content": "Позвонить"}, http.StatusCreated, &cm)
+	a.doAs(olya, "DELETE", path("/comments/%d", id(cm)), nil, http.StatusNoContent, nil)
+	a.doAs(olya, "POST", path("/deals/%d/comments", a.deal("Другая", a.customer("Beta"))), gin.H{"content": "Готово"}, http.StatusCreated, &done)
+	a.do("DELETE", path("/users/%d?cascade=true", user.ID), nil, http.StatusNoContent, nil)
+	if items := trash(rep); len(items) != 0 {
+		t.Fatalf("корзина без прав на удаление: %v", items)
+	}
+	if items := trash(petya, "filter", `{"entity":["comments","users"]}`); len(items) != 2 || items[0]["entity"] != "comments" || items[1]["entity"] != "comments" {
+		t.Fatalf("корзина пользователя: %v", items)
+	}
+	a.doAs(rep, "POST", path("/trash/comments/%d/restore", id(cm)), nil, http.StatusForbidden, nil)
+	a.doAs(petya, "DELETE", path("/trash/comments/%d", id(cm)), nil, http.StatusForbidden, nil)
+
+	// Пользователь с комментариями не удаляется окончательно, даже если они
+	// сами в корзине, а email, занятый другим, не даёт его восстановить
+	a.do("DELETE", path("/trash/users/%d", user.ID), nil, http.StatusConflict, nil)
+	a.do("POST", path("/trash/comments/%d/restore", id(done)), nil, http.StatusNoContent, nil)
+	a.addUser("Оля 2", "olya@example.com", handlers.DefaultRole)
+	a.do("POST", path("/trash/users/%d/restore", user.ID), nil, http.StatusConflict, nil)
+
+	a.do("DELETE", path("/trash/comments/%d", id(cm)), nil, http.StatusNoContent, nil)
+	a.do("DELETE", path("/trash/comments/%d", id(cm)), nil, http.StatusNotFound, nil)
+	a.do("GET", path("/comments/%d/audit", id(cm)), nil, http.StatusOK, &log)
+	if last := log[len(log)-1]; last["action"] != "purge" {
+		t.Fatalf("окончательное удаление в журнале: %v", log)
+	}
+
+	// Очистка по сроку хранения удаляет всё, на что больше никто не ссылается
+	a.do("DELETE", path("/customers/%d?cascade=true", cid), nil, http.StatusNoContent, nil)
+	n, err := handlers.PurgeExpiredTrash(a.st, time.Now().Add(time.Hour))
+	if err != nil || n != 3 {
+		t.Fatalf("очистка корзины: %d, %v", n, err)
+	}
+	if items := trash(a.token); len(items) != 1 || items[0]["id"] != fmt.Sprintf("users:%d", user.ID) {
+		t.Fatalf("после очистки: %v", items)
+	}
+}
+
+func TestDeletePolicies(t *testing.T) {
+	a := newAPI(t)
+	open, _, _ := a.stages()
+	blockers := func(resp errorResponse) []string {
+		t.Helper()
+		list, _ := resp.Meta["blockers"].([]interface{})
+		titles := make([]string, 0, len(list))
+		for _, b := range list {
+			titles = append(titles, fmt.Sprint(b.(map[string]interface{})["title"]))
+		}
+		return titles
+	}
+	var resp errorResponse
+	var deal, cm map[string]interface{}
+
+	// Клиента со сделками без cascade или move_to не удалить: 409 со списком сделок
+	acme := a.customer("Acme")
+	first := a.deal("Первая", acme)
+	a.deal("Вторая", acme)
+	a.do("DELETE", path("/customers/%d", acme), nil, http.StatusConflict, &resp)
+	if titles := blockers(resp); resp.Meta["deals"] != float64(2) || strings.Join(titles, ",") != "Первая,Вторая" {
+		t.Fatalf("409 клиента: %+v", resp)
+	}
+	for _, params := range []string{"cascade=maybe", "move_to=abc", "cascade=true&move_to=1", fmt.Sprintf("move_to=%d", acme), "move_to=999"} {
+		a.do("DELETE", path("/customers/%d?%s", acme, params), nil, http.StatusBadRequest, nil)
+	}
+
+	// move_to переносит сделки к другому клиенту
+	beta := a.customer("Beta")
+	a.do("DELETE", path("/customers/%d?move_to=%d", acme, beta), nil, http.StatusNoContent, nil)
+	a.do("GET", path("/deals/%d", first), nil, http.StatusOK, &deal)
+	if deal["customer_id"] != float64(beta) || deal["version"] != float64(2) {
+		t.Fatalf("сделка после переноса: %v", deal)
+	}
+
+	// cascade удаляет сделки вместе с их комментариями, а восстановление
+	// клиента возвращает их все
+	a.do("POST", "/comments", gin.H{"deal_id": first, "content": "Созвонились"}, http.StatusCreated, &cm)
+	a.do("DELETE", path("/customers/%d?cascade=true", beta), nil, http.StatusNoContent, nil)
+	a.do("GET", path("/comments/%d", id(cm)), nil, http.StatusNotFound, nil)
+	a.do("POST", path("/trash/customers/%d/restore", beta), nil, http.StatusNoContent, nil)
+	a.do("GET", path("/deals/%d", first), nil, http.StatusOK, nil)
+	a.do("GET", path("/comments/%d", id(cm)), nil, http.StatusOK, nil)
+
+	// Сделка удаляется и восстанавливается вместе с комментариями
+	a.do("DELETE", path("/deals/%d", first), nil, http.StatusNoContent, nil)
+	a.do("GET", path("/comments/%d", id(cm)), nil, http.StatusNotFound, nil)
+	a.do("POST", path("/trash/deals/%d/restore", first), nil, http.StatusNoContent, nil)
+	a.do("GET", path("/comments/%d", id(cm)), nil, http.StatusOK, nil)
+
+	// Этап со сделками: 409 с теми же подробностями
+	a.do("DELETE", path("/statuses/%d", open), nil, http.StatusConflict, &resp)
+	if titles := blockers(resp); resp.Meta["deals"] != float64(2) || len(titles) != 2 {
+		t.Fatalf("409 этапа: %+v", resp)
+	}
+
+	// Комментарии пользователя удаляются вместе с ним или передаются другому
+	olya := a.addUser("Оля", "olya@example.com", handlers.DefaultRole)
+	a.doAs(a.login("olya@example.com"), "POST", "/comments", gin.H{"deal_id": first, "content": "Олин комментарий"}, http.StatusCreated, &cm)
+	a.do("DELETE", path("/users/%d", olya.ID), nil, http.StatusConflict, &resp)
+	if titles := blockers(resp); resp.Meta["comments"] != float64(1) || strings.Join(titles, ",") != "Олин комментарий" {
+		t.Fatalf("409 пользователя: %+v", resp)
+	}
+	a.do("DELETE", path("/users/%d?move_to=%d", olya.ID, olya.ID), nil, http.StatusBadRequest, nil)
+	petya := a.addUser("Петя", "petya@example.com", handlers.DefaultRole)
+	a.do("DELETE", path("/users/%d?move_to=%d", olya.ID, petya.ID), nil, http.StatusNoContent, nil)
+	a.do("GET", path("/comments/%d", id(cm)), nil, http.StatusOK, &cm)
+	if cm["user_id"] != float64(petya.ID) {
+		t.Fatalf("комментарий после передачи: %v", cm)
+	}
+	a.do("DELETE", path("/users/%d?cascade=true", petya.ID), nil, http.StatusNoContent, nil)
+	a.do("GET", path("/comments/%d", id(cm)), nil, http.StatusNotFound, nil)
+	a.do("POST", path("/trash/users/%d/restore", petya.ID), nil, http.StatusNoContent, nil)
+	a.do("GET", path("/comments/%d", id(cm)), nil, http.StatusOK, nil)
+}
+
+func TestBulk(t *testing.T) {
+	a := newAPI(t)
+	open, work, won := a.stages()
+	acme := a.customer("Acme")
+	first, second, third := a.deal("Первая", acme), a.deal("Вторая", acme), a.deal("Третья", acme)
+	var tag, deal map[string]interface{}
+	a.do("POST", "/tags", gin.H{"name": "VIP"}, http.StatusCreated, &tag)
+	var result struct {
+		DryRun   bool `json:"dry_run"`
+		Affected int
+		Failed   int
+		Items    []struct {
+			ID uint
+			OK bool
+		}
+	}
+	var resp errorResponse
+
+	// Записи выбираются либо списком ids, либо непустым фильтром
+	move := gin.H{"status_id": work}
+	for _, body := range []gin.H{
+		{"data": move},
+		{"ids": []uint{first}, "filter": gin.H{"status_id": open}, "data": move},
+		{"filter": gin.H{}, "data": move},
+		{"filter": gin.H{"q": ""}, "data": move},
+		{"filter": gin.H{"tag_match": "any", "tag_ids": []uint{}}, "data": move},
+		{"filter": gin.H{"password": "x"}, "data": move},
+		{"ids": []uint{first}, "data": gin.H{}},
+	} {
+		a.do("POST", "/deals/bulk/update", body, http.StatusBadRequest, nil)
+	}
+
+	// dry_run показывает результат, но ничего не сохраняет
+	a.do("POST", "/deals/bulk/update", gin.H{
+		"filter": gin.H{"status_id": open}, "data": gin.H{"status_id": work, "add_tag_ids": []uint{id(tag)}}, "dry_run": true,
+	}, http.StatusOK, &result)
+	if !result.DryRun || result.Affected != 3 || result.Failed != 0 || len(result.Items) != 3 || result.Items[0].ID != first {
+		t.Fatalf("пробный прогон: %+v", result)
+	}
+	a.do("GET", path("/deals/%d", first), nil, http.StatusOK, &deal)
+	if deal["status_id"] != float64(open) || len(deal["tag_ids"].([]interface{})) != 0 {
+		t.Fatalf("пробный прогон изменил сделку: %v", deal)
+	}
+
+	// Ошибка в одной сделке откатывает всю операцию
+	a.do("POST", "/deals/bulk/update", gin.H{"ids": []uint{first, 999, second}, "data": move}, http.StatusConflict, &resp)
+	items, _ := resp.Meta["items"].([]interface{})
+	if resp.Meta["failed"] != float64(1) || len(items) != 3 ||
+		items[1].(map[string]interface{})["error"].(map[string]interface{})["message"] != "Сделка не найдена" {
+		t.Fatalf("частичная ошибка: %+v", resp)
+	}
+	a.do("GET", path("/deals/%d", first), nil, http.StatusOK, &deal)
+	if deal["status_id"] != float64(open) {
+		t.Fatalf("ошибка не откатила изменения: %v", deal)
+	}
+
+	// Сделки переносятся на этап вместе с тегами и историей этапов
+	a.do("POST", "/deals/bulk/update", gin.H{"ids": []uint{first, second}, "data": gin.H{"status_id": won, "add_tag_ids": []uint{id(tag)}}}, http.StatusOK, &result)
+	if result.DryRun || result.Affected != 2 {
+		t.Fatalf("обновление: %+v", result)
+	}
+	a.do("GET", path("/deals/%d", first), nil, http.StatusOK, &deal)
+	if deal["status_id"] != float64(won) || deal["closed_at"] == nil || fmt.Sprint(deal["tag_ids"]) != fmt.Sprintf("[%d]", id(tag)) {
+		t.Fatalf("сделка после обновления: %v", deal)
+	}
+
+	// Удаление по фильтру и по списку
+	a.do("POST", "/deals/bulk/delete", gin.H{"filter": gin.H{"status_id": won}, "dry_run": true}, http.StatusOK, &result)
+	if result.Affected != 2 {
+		t.Fatalf("пробное удаление: %+v", result)
+	}
+	a.do("GET", path("/deals/%d", first), nil, http.StatusOK, nil)
+	a.do("POST", "/deals/bulk/delete", gin.H{"ids": []uint{first, second}}, http.StatusOK, &result)
+	a.do("GET", path("/deals/%d", second), nil, http.StatusNotFound, nil)
+	a.do("GET", path("/deals/%d", third), nil, http.StatusOK, nil)
+
+	// Клиенты: теги и удаление по тем же правилам, что и для одного клиента
+	beta := a.customer("Beta")
+	var customer map[string]interface{}
+	a.do("POST", "/customers/bulk/update", gin.H{"ids": []uint{acme, beta}, "data": gin.H{"tag_ids": []uint{id(tag)}}}, http.StatusOK, &result)
+	a.do("POST", "/customers/bulk/update", gin.H{"ids": []uint{acme}, "data": gin.H{"remove_tag_ids": []uint{id(tag)}}}, http.StatusOK, &result)
+	a.do("GET", path("/customers/%d", beta), nil, http.StatusOK, &customer)
+	if fmt.Sprint(customer["tag_ids"]) != fmt.Sprintf("[%d]", id(tag)) {
+		t.Fatalf("теги клиента: %v", customer)
+	}
+	a.do("POST", "/customers/bulk/delete?cascade=true", gin.H{"filter": gin.H{"q": ""}}, http.StatusBadRequest, nil)
+	a.do("POST", "/customers/bulk/delete", gin.H{"ids": []uint{acme, beta}}, http.StatusConflict, &resp)
+	items, _ = resp.Meta["items"].([]interface{})
+	if len(items) != 2 || items[0].(map[string]interface{})["error"].(map[string]interface{})["code"] != handlers.CodeConflict {
+		t.Fatalf("клиент со сделками: %+v", resp)
+	}
+	a.do("GET", path("/customers/%d", beta), nil, http.StatusOK, nil)
+	a.do("POST", "/customers/bulk/delete?cascade=true", gin.H{"ids": []uint{acme, beta}}, http.StatusOK, &result)
+	a.do("GET", path("/deals/%d", third), nil, http.StatusNotFound, nil)
+}
+
+// xlsxFile собирает минимальную книгу XLSX с одним листом, ячейки которого —
+// строки inlineStr.
+func xlsxFile(t *testing.T, rows [][]string) string {
+	t.Helper()
+	var sheet strings.Builder
+	sheet.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	for i, row := range rows {
+		fmt.Fprintf(&sheet, `<row r="%d">`, i+1)
+		for j, v := range row {
+			fmt.Fprintf(&sheet, `<c r="%c%d" t="inlineStr"><is><t>%s</t></is></c>`, 'A'+j, i+1, v)
+		}
+		sheet.WriteString(`</row>`)
+	}
+	sheet.WriteString(`</sheetData></worksheet>`)
+	parts := map[string]string{
+		"xl/workbook.xml": `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+			`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Лист1" sheetId="1" r:id="rId1"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`,
+		"xl/worksheets/sheet1.xml": sheet.String(),
+	}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range parts {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(w, content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+// waitImport ждёт завершения задачи импорта.
+func (a *api) waitImport(job models.ImportJob) models.ImportJob {
+	a.t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		a.do("GET", path("/imports/%d", job.ID), nil, http.StatusOK, &job)
+		if job.Finished() {
+			return job
+		}
+	}
+	a.t.Fatalf("импорт %d не завершился: %+v", job.ID, job)
+	return job
+}
+
+func TestImport(t *testing.T) {
+	a := newAPI(t)
+	_, work, _ := a.stages()
+	acme := a.customer("Acme")
+	var job models.ImportJob
+	var resp errorResponse
+
+	csv := "Название;Email;Телефон\n" +
+		"ООО Ромашка;info@romashka.ru;+7 (999) 123-45-67\n" +
+		";не email;\n" +
+		"\n" +
+		"Лютик;lutik@example.com;\n"
+	mapping := `{"Название":"name","Email":"email","Телефон":"phone"}`
+
+	// Файл, сопоставление и обязательные поля проверяются сразу
+	a.upload("/customers/import", "", "", nil, http.StatusBadRequest, nil)
+	a.upload("/customers/import", "clients.txt", csv, nil, http.StatusBadRequest, nil)
+	a.upload("/customers/import", "clients.csv", csv, map[string]string{"mapping": `{"Название":"password"}`}, http.StatusBadRequest, &resp)
+	a.upload("/customers/import", "clients.csv", csv, map[string]string{"mapping": `{"Город":"name"}`}, http.StatusBadRequest, &resp)
+	a.upload("/customers/import", "clients.csv", csv, map[string]string{"mapping": `{"Email":"email"}`}, http.StatusBadRequest, &resp)
+	if len(resp.Details) != 1 || resp.Details[0].Field != "mapping" || resp.Details[0].Code != "required" {
+		t.Fatalf("нет обязательного поля: %+v", resp)
+	}
+
+	// Пробный запуск проверяет строки и ничего не сохраняет
+	w := a.upload("/customers/import", "clients.csv", csv, map[string]string{"mapping": mapping, "dry_run": "true"}, http.StatusAccepted, &job)
+	if w.Header().Get("Location") != path("/imports/%d", job.ID) || job.Total != 3 {
+		t.Fatalf("задача: %+v, Location %q", job, w.Header().Get("Location"))
+	}
+	job = a.waitImport(job)
+	if job.Status != models.ImportDone || job.Processed != 3 || job.Imported != 2 || job.Rejected != 1 || len(job.Preview) != 2 {
+		t.Fatalf("пробный запуск: %+v", job)
+	}
+	if !strings.Contains(string(job.Preview[0]), `"phone":"+79991234567"`) {
+		t.Errorf("предпросмотр: %s", job.Preview[0])
+	}
+	rejected := job.Errors[0]
+	if rejected.Row != 3 || rejected.Values["Email"] != "не email" || len(rejected.Errors) != 2 ||
+		rejected.Errors[0].Column != "Название" || rejected.Errors[0].Message != "Обязательное поле" {
+		t.Fatalf("отчёт об ошибках: %+v", job.Errors)
+	}
+	var customers []map[string]interface{}
+	a.do("GET", "/customers", nil, http.StatusOK, &customers)
+	if len(customers) != 1 {
+		t.Fatalf("пробный запуск создал клиентов: %v", customers)
+	}
+
+	// Импорт создаёт подходящих клиентов и пишет их в журнал
+	a.upload("/customers/import", "clients.csv", csv, map[string]string{"mapping": mapping}, http.StatusAccepted, &job)
+	job = a.waitImport(job)
+	if job.Status != models.ImportDone || job.Imported != 2 || job.Rejected != 1 || len(job.Preview) != 0 {
+		t.Fatalf("импорт клиентов: %+v", job)
+	}
+	a.do("GET", query("/customers", "filter", `{"name":"ООО Ромашка"}`), nil, http.StatusOK, &customers)
+	if len(customers) != 1 || customers[0]["email"] != "info@romashka.ru" {
+		t.Fatalf("клиент не импортирован: %v", customers)
+	}
+	var entries []map[string]interface{}
+	a.do("GET", path("/customers/%d/audit", id(customers[0])), nil, http.StatusOK, &entries)
+	if len(entries) != 1 || entries[0]["action"] != models.AuditCreate {
+		t.Fatalf("журнал импортированного клиента: %v", entries)
+	}
+
+	// Сделки из XLSX: колонки сопоставляются по именам полей, клиент и этап
+	// ищутся по названию, сумма — в рублях, дата — номером дня Excel
+	book := xlsxFile(t, [][]string{
+		{"title", "customer", "status", "amount", "expected_close_date"},
+		{"Поставка", "Acme", "в работе", "1 500,50", "45678"},
+		{"Без клиента", "Нет такого", "", "10", ""},
+		{"Дробь", "Acme", "", "1.234", "31.12.2025"},
+	})
+	a.upload("/deals/import", "deals.xlsx", book, nil, http.StatusAccepted, &job)
+	job = a.waitImport(job)
+	if job.Status != models.ImportDone || job.Imported != 1 || job.Rejected != 2 {
+		t.Fatalf("импорт сделок: %+v", job)
+	}
+	if e := job.Errors[0].Errors[0]; e.Field != "customer_id" || e.Column != "customer" || e.Message != "Клиент «Нет такого» не найден" {
+		t.Errorf("ошибка поиска клиента: %+v", e)
+	}
+	if e := job.Errors[1].Errors[0]; e.Field != "amount" {
+		t.Errorf("ошибка суммы: %+v", e)
+	}
+	var deals []map[string]interface{}
+	a.do("GET", query("/deals", "filter", fmt.Sprintf(`{"customer_id":%d}`, acme)), nil, http.StatusOK, &deals)
+	if len(deals) != 1 || deals[0]["amount"] != float64(150050) || deals[0]["status_id"] != float64(work) ||
+		deals[0]["expected_close_date"] != "2025-01-21" {
+		t.Fatalf("сделка не импортирована: %v", deals)
+	}
+
+	// Задачи видит только тот, кто их запустил, и администратор
+	var jobs []models.ImportJob
+	a.do("GET", query("/imports", "filter", `{"entity":"customers"}`), nil, http.StatusOK, &jobs)
+	if len(jobs) != 2 {
+		t.Fatalf("задачи администратора: %+v", jobs)
+	}
+	a.addUser("Менеджер", "manager@example.com", handlers.DefaultRole)
+	manager := a.login("manager@example.com")
+	a.doAs(manager, "GET", "/imports", nil, http.StatusOK, &jobs)
+	if len(jobs) != 0 {
+		t.Fatalf("чужие задачи: %+v", jobs)
+	}
+	a.doAs(manager, "GET", path("/imports/%d", job.ID), nil, http.StatusNotFound, nil)
+
+	// При старте завершаются только задачи, которые давно не обновлялись:
+	// свежие может выполнять другой процесс. Завершённую задачу её
+	// исполнитель уже не перезапишет
+	stale := models.ImportJob{Entity: "customers", Status: models.ImportRunning}
+	if err := a.st.Imports().Create(&stale); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := handlers.InterruptStaleImports(a.st); err != nil || n != 0 {
+		t.Fatalf("свежая задача прервана: %d, %v", n, err)
+	}
+	now := time.Now()
+	if n, err := a.st.Imports().Interrupt("прервана", now.Add(time.Second), now); err != nil || n != 1 {
+		t.Fatalf("брошенная задача не прервана: %d, %v", n, err)
+	}
+	stale.Status = models.ImportDone
+	if err := a.st.Imports().Update(&stale); !errors.Is(err, store.ErrConflict) {
+		t.Errorf("обновление завершённой задачи: %v", err)
+	}
+	if got, _ := a.st.Imports().Get(stale.ID); got.Status != models.ImportFailed || got.Failure != "прервана" {
+		t.Errorf("задача после прерывания: %+v", got)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	a := newAPI(t)
+	open, work, _ := a.stages()
+	cust := a.customer("Acme")
+	did := a.deal("Первая", cust)
+	a.deal("Вторая", cust)
+	a.do("POST", "/comments", gin.H{"deal_id": did, "content": "Созвонились"}, http.StatusCreated, nil)
+
+	w := a.doAs("", "GET", "/metrics", nil, http.StatusOK, nil)
+	body := w.Body.String()
+	for _, want := range []string{
+		`crm_http_requests_total{method="POST",route="/deals",status="201"} 2`,
+		`crm_http_request_duration_seconds_count{method="POST",route="/deals"} 2`,
+		fmt.Sprintf(`crm_open_deals{pipeline_id="1",status="Новая",status_id="%d"} 2`, open),
+		fmt.Sprintf(`crm_open_deals{pipeline_id="1",status="В работе",status_id="%d"} 0`, work),
+		`crm_comments_created_today 1`,
+		`go_goroutines`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("нет метрики %s", want)
+		}
+	}
+	if strings.Contains(body, `status="Выиграна"`) {
+		t.Error("закрытый этап попал в открытые сделки")
+	}
+
+	cfg := testConfig
+	cfg.Metrics.Token = "scrape-me"
+	secured := emptyRouter(cfg)
+	for token, want := range map[string]int{"": http.StatusUnauthorized, "wrong": http.StatusUnauthorized, "scrape-me": http.StatusOK} {
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		secured.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Errorf("токен %q: код %d, ожидался %d", token, w.Code, want)
+		}
+	}
+}
+
+func TestSwagger(t *testing.T) {
+	a := newAPI(t)
+	a.doAs("", "GET", "/swagger/index.html", nil, http.StatusOK, nil)
+}
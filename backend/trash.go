@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"crm-backend/internal/config"
+	"crm-backend/internal/handlers"
+	"crm-backend/internal/store"
+)
+
+// purgeTrash раз в cfg.PurgeInterval окончательно удаляет записи, которые
+// пролежали в корзине дольше cfg.RetentionDays, пока не отменён ctx.
+func purgeTrash(ctx context.Context, st store.Store, cfg config.TrashConfig) {
+	if cfg.RetentionDays == 0 {
+		slog.Info("Корзина не очищается: trash.retention_days = 0")
+		return
+	}
+	retention := time.Duration(cfg.RetentionDays) * 24 * time.Hour
+	ticker := time.NewTicker(cfg.PurgeInterval)
+	defer ticker.Stop()
+	for {
+		n, err := handlers.PurgeExpiredTrash(st.WithContext(ctx), time.Now().Add(-retention))
+		switch {
+		case ctx.Err() != nil:
+			return
+		case err != nil:
+			slog.Error("Ошибка очистки корзины", "error", err)
+		case n > 0:
+			slog.Info("Записи удалены из корзины по сроку хранения", "count", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -24,7 +24,7 @@ import { isAdmin } from './helpers';
 import russianMessages from 'ra-language-russian';
 import { createTheme } from '@mui/material/styles';
 import { Dashboard } from './Dashboard';
-import { setUserRole, clearUserRole } from './helpers';
+import { setUserRole, clearUserRole, setUserPermissions, getUserPermissions } from './helpers';
 
 const apiUrl = 'http://localhost:8080';
 
@@ -40,8 +40,9 @@ const authProvider = {
         if (!response.ok) {
             throw new Error('Ошибка авторизации');
         }
-        const { token } = await response.json();
+        const { token, refresh_token } = await response.json();
         localStorage.setItem('jwt', token);
+        localStorage.setItem('refresh_token', refresh_token);
         // Получаем роль пользователя
         const meReq = new Request(`${apiUrl}/auth/me`, {
             method: 'GET',
@@ -51,20 +52,37 @@ const authProvider = {
         if (meResp.ok) {
             const user = await meResp.json();
             setUserRole(user.role);
+            setUserPermissions(user.permissions);
         }
     },
-    logout: () => {
-        localStorage.removeItem('jwt');
+    logout: async () => {
+        const token = localStorage.getItem('jwt');
+        const refreshToken = localStorage.getItem('refresh_token');
+        if (token || refreshToken) {
+            const headers = new Headers({ 'Content-Type': 'application/json' });
+            if (token) {
+                headers.set('Authorization', `Bearer ${token}`);
+            }
+            try {
+                await fetch(`${apiUrl}/auth/logout`, {
+                    method: 'POST',
+                    body: JSON.stringify({ refresh_token: refreshToken }),
+                    headers,
+                });
+            } catch (e) {
+                // сервер недоступен — всё равно очищаем локальную сессию
+            }
+        }
+        clearTokens();
         clearUserRole();
-        return Promise.resolve();
     },
     checkAuth: () => {
         return localStorage.getItem('jwt') ? Promise.resolve() : Promise.reject();
     },
-    getPermissions: () => Promise.resolve(),
+    getPermissions: () => Promise.resolve(getUserPermissions()),
     checkError: (error) => {
         if (error.status === 401 || error.status === 403) {
-            localStorage.removeItem('jwt');
+            clearTokens();
             clearUserRole();
             return Promise.reject();
         }
@@ -72,19 +90,78 @@ const authProvider = {
     },
 };
 
-// Добавляем JWT в каждый запрос
+const clearTokens = () => {
+    localStorage.removeItem('jwt');
+    localStorage.removeItem('refresh_token');
+};
+
+// Обмен refresh-токена на новую пару; одновременные запросы ждут один обмен
+let refreshing = null;
+const refreshTokens = () => {
+    if (!refreshing) {
+        refreshing = fetch(`${apiUrl}/auth/refresh`, {
+            method: 'POST',
+            body: JSON.stringify({ refresh_token: localStorage.getItem('refresh_token') }),
+            headers: new Headers({ 'Content-Type': 'application/json' }),
+        })
+            .then(response => {
+                if (!response.ok) {
+                    throw new Error('Сессия истекла');
+                }
+                return response.json();
+            })
+            .then(({ token, refresh_token }) => {
+                localStorage.setItem('jwt', token);
+                localStorage.setItem('refresh_token', refresh_token);
+            })
+            .finally(() => {
+                refreshing = null;
+            });
+    }
+    return refreshing;
+};
+
+// Добавляем JWT в каждый запрос и один раз повторяем его после обновления токена
 const httpClient = (url, options = {}) => {
     if (!options.headers) {
         options.headers = new Headers({ Accept: 'application/json' });
     }
-    const token = localStorage.getItem('jwt');
-    if (token) {
-        options.headers.set('Authorization', `Bearer ${token}`);
-    }
-    return fetchUtils.fetchJson(url, options);
+    const request = () => {
+        const token = localStorage.getItem('jwt');
+        if (token) {
+            options.headers.set('Authorization', `Bearer ${token}`);
+        }
+        return fetchUtils.fetchJson(url, options);
+    };
+    return request().catch(error => {
+        if (error.status !== 401 || !localStorage.getItem('refresh_token')) {
+            throw error;
+        }
+        return refreshTokens().then(request, () => {
+            throw error;
+        });
+    });
 };
 
-const dataProvider = simpleRestProvider(apiUrl, httpClient);
+const restProvider = simpleRestProvider(apiUrl, httpClient);
+
+// Сделки и клиенты обновляются и удаляются пачкой одним запросом, а не по
+// запросу на каждую запись
+const bulkResources = ['deals', 'customers'];
+const bulk = (resource, action, body) =>
+    httpClient(`${apiUrl}/${resource}/bulk/${action}`, { method: 'POST', body: JSON.stringify(body) });
+
+const dataProvider = {
+    ...restProvider,
+    updateMany: (resource, params) =>
+        bulkResources.includes(resource)
+            ? bulk(resource, 'update', { ids: params.ids, data: params.data }).then(() => ({ data: params.ids }))
+            : restProvider.updateMany(resource, params),
+    deleteMany: (resource, params) =>
+        bulkResources.includes(resource)
+            ? bulk(resource, 'delete', { ids: params.ids }).then(() => ({ data: params.ids }))
+            : restProvider.deleteMany(resource, params),
+};
 
 const i18nProvider = () => russianMessages;
 
@@ -7,9 +7,6 @@ export const CommentCreate = props => (
             <ReferenceInput source="deal_id" reference="deals" label="Сделка">
                 <SelectInput optionText="title" />
             </ReferenceInput>
-            <ReferenceInput source="user_id" reference="users" label="Пользователь">
-                <SelectInput optionText="name" />
-            </ReferenceInput>
             <TextInput source="content" label="Комментарий" />
         </SimpleForm>
     </Create>
@@ -6,10 +6,10 @@ export const CommentEdit = props => (
         <SimpleForm>
             <TextInput disabled source="id" label="ID" />
             <ReferenceInput source="deal_id" reference="deals" label="Сделка">
-                <SelectInput optionText="title" />
+                <SelectInput optionText="title" disabled />
             </ReferenceInput>
             <ReferenceInput source="user_id" reference="users" label="Пользователь">
-                <SelectInput optionText="name" />
+                <SelectInput optionText="name" disabled />
             </ReferenceInput>
             <TextInput source="content" label="Комментарий" />
         </SimpleForm>
@@ -1,5 +1,5 @@
 import * as React from 'react';
-import { Create, SimpleForm, TextInput } from 'react-admin';
+import { Create, SimpleForm, TextInput, ReferenceArrayInput, SelectArrayInput } from 'react-admin';
 
 export const CustomerCreate = (props) => (
     <Create {...props} title="Создать клиента">
@@ -8,6 +8,9 @@ export const CustomerCreate = (props) => (
             <TextInput source="email" label="Email" />
             <TextInput source="phone" label="Телефон" />
             <TextInput source="company" label="Компания" />
+            <ReferenceArrayInput source="tag_ids" reference="tags" label="Теги">
+                <SelectArrayInput optionText="name" />
+            </ReferenceArrayInput>
         </SimpleForm>
     </Create>
 ); 
\ No newline at end of file
@@ -1,5 +1,5 @@
 import * as React from 'react';
-import { Edit, SimpleForm, TextInput } from 'react-admin';
+import { Edit, SimpleForm, TextInput, ReferenceArrayInput, SelectArrayInput } from 'react-admin';
 
 export const CustomerEdit = (props) => (
     <Edit {...props} title="Редактировать клиента">
@@ -9,6 +9,9 @@ export const CustomerEdit = (props) => (
             <TextInput source="email" label="Email" />
             <TextInput source="phone" label="Телефон" />
             <TextInput source="company" label="Компания" />
+            <ReferenceArrayInput source="tag_ids" reference="tags" label="Теги">
+                <SelectArrayInput optionText="name" />
+            </ReferenceArrayInput>
         </SimpleForm>
     </Edit>
 ); 
\ No newline at end of file
@@ -1,5 +1,5 @@
 import * as React from 'react';
-import { Create, SimpleForm, TextInput, ReferenceInput, SelectInput } from 'react-admin';
+import { Create, SimpleForm, TextInput, ReferenceInput, SelectInput, ReferenceArrayInput, SelectArrayInput } from 'react-admin';
 
 export const DealCreate = (props) => (
     <Create {...props} title="Создать сделку">
@@ -12,6 +12,9 @@ export const DealCreate = (props) => (
             <ReferenceInput source="status_id" reference="statuses" label="Статус">
                 <SelectInput optionText="name" />
             </ReferenceInput>
+            <ReferenceArrayInput source="tag_ids" reference="tags" label="Теги">
+                <SelectArrayInput optionText="name" />
+            </ReferenceArrayInput>
         </SimpleForm>
     </Create>
 ); 
\ No newline at end of file
@@ -1,5 +1,5 @@
 import * as React from 'react';
-import { Edit, SimpleForm, TextInput, ReferenceInput, SelectInput } from 'react-admin';
+import { Edit, SimpleForm, TextInput, ReferenceInput, SelectInput, ReferenceArrayInput, SelectArrayInput } from 'react-admin';
 
 export const DealEdit = (props) => (
     <Edit {...props} title="Редактировать сделку">
@@ -13,6 +13,9 @@ export const DealEdit = (props) => (
             <ReferenceInput source="status_id" reference="statuses" label="Статус">
                 <SelectInput optionText="name" />
             </ReferenceInput>
+            <ReferenceArrayInput source="tag_ids" reference="tags" label="Теги">
+                <SelectArrayInput optionText="name" />
+            </ReferenceArrayInput>
         </SimpleForm>
     </Edit>
 ); 
\ No newline at end of file
@@ -8,4 +8,19 @@ export const setUserRole = (role) => {
 
 export const clearUserRole = () => {
     localStorage.removeItem('user_role');
-}; 
\ No newline at end of file
+    localStorage.removeItem('user_permissions');
+};
+
+export const setUserPermissions = (permissions) => {
+    localStorage.setItem('user_permissions', JSON.stringify(permissions || []));
+};
+
+export const getUserPermissions = () => {
+    try {
+        return JSON.parse(localStorage.getItem('user_permissions')) || [];
+    } catch (e) {
+        return [];
+    }
+};
+
+export const hasPermission = (permission) => getUserPermissions().includes(permission); 
\ No newline at end of file